@@ -0,0 +1,92 @@
+// Package baseline holds the trivial models a real one has to beat for its
+// scores to mean anything: a regressor that predicts one number learned
+// from the training labels, and a classifier that predicts the most
+// frequent training class. Both are crossval.Models.
+package baseline
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Regression strategies.
+const (
+	Mean   = "mean"
+	Median = "median"
+)
+
+// Regressor predicts Value for every row: the mean of the training labels,
+// or their median. The zero Regressor uses the mean.
+type Regressor struct {
+	Strategy string  `json:"strategy,omitempty"`
+	Value    float64 `json:"value"`
+}
+
+func (r *Regressor) Fit(X [][]float64, y []float64) error {
+	if len(y) == 0 {
+		return fmt.Errorf("no labels to fit a baseline on")
+	}
+	switch r.Strategy {
+	case "", Mean:
+		sum := 0.0
+		for _, label := range y {
+			sum += label
+		}
+		r.Value = sum / float64(len(y))
+	case Median:
+		sorted := append([]float64(nil), y...)
+		sort.Float64s(sorted)
+		mid := len(sorted) / 2
+		r.Value = sorted[mid]
+		if len(sorted)%2 == 0 {
+			r.Value = (sorted[mid-1] + sorted[mid]) / 2
+		}
+	default:
+		return fmt.Errorf("unknown baseline strategy %q, want mean or median", r.Strategy)
+	}
+	return nil
+}
+
+func (r *Regressor) Predict(X [][]float64) []float64 {
+	return constant(len(X), r.Value)
+}
+
+// Classifier predicts Class, the most frequent training label, for every
+// row; the lowest such label on ties.
+type Classifier struct {
+	Class float64 `json:"class"`
+	// Share is the fraction of the training labels that are Class, the
+	// accuracy of the baseline on its own training rows.
+	Share float64 `json:"share"`
+}
+
+func (c *Classifier) Fit(X [][]float64, y []float64) error {
+	if len(y) == 0 {
+		return fmt.Errorf("no labels to fit a baseline on")
+	}
+	counts := make(map[float64]int)
+	for _, label := range y {
+		counts[label]++
+	}
+	best, bestCount := math.Inf(1), 0
+	for label, count := range counts {
+		if count > bestCount || count == bestCount && label < best {
+			best, bestCount = label, count
+		}
+	}
+	c.Class, c.Share = best, float64(bestCount)/float64(len(y))
+	return nil
+}
+
+func (c *Classifier) Predict(X [][]float64) []float64 {
+	return constant(len(X), c.Class)
+}
+
+func constant(n int, value float64) []float64 {
+	predictions := make([]float64, n)
+	for i := range predictions {
+		predictions[i] = value
+	}
+	return predictions
+}
@@ -0,0 +1,70 @@
+package distributed
+
+// AdaptiveBatchConfig enables per-worker batch size adaptation. At the end of
+// every epoch a worker doubles its batch size when the per-sample gradient
+// variance fell below VarianceThreshold, and halves it when the epoch loss
+// improved by less than PlateauTolerance (relative), so fewer, larger updates
+// are made once gradients agree.
+type AdaptiveBatchConfig struct {
+	MinBatch          int
+	MaxBatch          int
+	VarianceThreshold float64
+	PlateauTolerance  float64
+}
+
+// batchController holds the adaptation state of a single worker.
+type batchController struct {
+	config   AdaptiveBatchConfig
+	lastLoss float64
+	events   int
+}
+
+func newBatchController(config AdaptiveBatchConfig) *batchController {
+	return &batchController{config: config, lastLoss: -1}
+}
+
+// adjust returns the batch size to use for the next epoch.
+func (c *batchController) adjust(workerID, epoch, batchSize int, variance, loss float64) int {
+	next := batchSize
+	plateau := c.lastLoss > 0 && (c.lastLoss-loss)/c.lastLoss < c.config.PlateauTolerance
+	c.lastLoss = loss
+
+	switch {
+	case plateau && batchSize > c.config.MinBatch:
+		next = batchSize / 2
+		if next < c.config.MinBatch {
+			next = c.config.MinBatch
+		}
+		logger.With("worker_id", workerID, "epoch", epoch+1).Info("Worker %d epoch %d: loss plateaued at %.6f, shrinking batch size %d -> %d",
+			workerID, epoch+1, loss, batchSize, next)
+	case variance < c.config.VarianceThreshold && batchSize < c.config.MaxBatch:
+		next = batchSize * 2
+		if next > c.config.MaxBatch {
+			next = c.config.MaxBatch
+		}
+		logger.With("worker_id", workerID, "epoch", epoch+1).Info("Worker %d epoch %d: gradient variance %.6f below %.6f, growing batch size %d -> %d",
+			workerID, epoch+1, variance, c.config.VarianceThreshold, batchSize, next)
+	}
+
+	if next != batchSize {
+		c.events++
+	}
+	return next
+}
+
+// gradientVariance is the mean, over all parameters, of the variance of the
+// per-sample gradients in a batch, each sample counted by its weight. The
+// gradients and their squares are sums weighted the same way, and weight is
+// the batch's total sample weight.
+func gradientVariance(weightGradients, squaredGradients []float64, biasGradient, squaredBias, weight float64) float64 {
+	if weight == 0 {
+		return 0
+	}
+	mean := biasGradient / weight
+	total := squaredBias/weight - mean*mean
+	for j := range weightGradients {
+		mean := weightGradients[j] / weight
+		total += squaredGradients[j]/weight - mean*mean
+	}
+	return total / float64(len(weightGradients)+1)
+}
@@ -0,0 +1,124 @@
+package distributed
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// admission bounds the prediction traffic the server takes on, so a burst
+// of requests cannot starve a training job on the same machine: a token
+// bucket caps the rate of requests, and a semaphore the number scored at
+// once. A request over either limit is answered 429 rather than queued
+// without bound.
+type admission struct {
+	limiter *rate.Limiter // nil for no rate limit
+	slots   chan struct{} // nil for no concurrency cap
+	wait    time.Duration // longest a request queues for a slot
+
+	mu           sync.Mutex
+	admitted     int64
+	queued       time.Duration // total time admitted requests queued for a slot
+	rateRejected int64
+	busyRejected int64
+}
+
+// newAdmission returns the limits for perSecond requests a second, in bursts
+// of up to burst, and maxConcurrent requests at once, each waiting up to
+// wait for its turn. Zero turns a limit off.
+func newAdmission(perSecond float64, burst, maxConcurrent int, wait time.Duration) *admission {
+	a := &admission{wait: wait}
+	if perSecond > 0 {
+		if burst <= 0 {
+			burst = int(math.Ceil(perSecond))
+		}
+		a.limiter = rate.NewLimiter(rate.Limit(perSecond), burst)
+	}
+	if maxConcurrent > 0 {
+		a.slots = make(chan struct{}, maxConcurrent)
+	}
+	return a
+}
+
+// limit admits requests to next within the limits.
+func (a *admission) limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.limiter != nil {
+			reservation := a.limiter.Reserve()
+			if delay := reservation.Delay(); delay > 0 {
+				reservation.Cancel()
+				a.count(func() { a.rateRejected++ })
+				tooManyRequests(w, delay, fmt.Errorf("over the limit of %g requests per second", float64(a.limiter.Limit())))
+				return
+			}
+		}
+		if a.slots != nil {
+			start := time.Now()
+			if !a.acquire(r) {
+				a.count(func() { a.busyRejected++ })
+				tooManyRequests(w, a.wait, fmt.Errorf("%d requests already in progress", cap(a.slots)))
+				return
+			}
+			defer func() { <-a.slots }()
+			queued := time.Since(start)
+			a.count(func() { a.queued += queued })
+		}
+		a.count(func() { a.admitted++ })
+		next(w, r)
+	}
+}
+
+// acquire takes a slot, waiting up to a.wait for one to free up. It fails
+// if none does, or if the client goes away first.
+func (a *admission) acquire(r *http.Request) bool {
+	select {
+	case a.slots <- struct{}{}:
+		return true
+	default:
+	}
+	if a.wait <= 0 {
+		return false
+	}
+	timer := time.NewTimer(a.wait)
+	defer timer.Stop()
+	select {
+	case a.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func (a *admission) count(update func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	update()
+}
+
+// tooManyRequests answers 429, asking the client to retry after delay.
+func tooManyRequests(w http.ResponseWriter, delay time.Duration, err error) {
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(delay.Seconds())))))
+	writeHTTPError(w, http.StatusTooManyRequests, err)
+}
+
+// writeMetrics writes the admission counters in the Prometheus text format.
+func (a *admission) writeMetrics(w io.Writer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	fmt.Fprintf(w, "serving_admitted_requests_total %d\n", a.admitted)
+	fmt.Fprintf(w, "serving_rejected_requests_total{reason=\"rate\"} %d\n", a.rateRejected)
+	fmt.Fprintf(w, "serving_rejected_requests_total{reason=\"concurrency\"} %d\n", a.busyRejected)
+	if a.slots != nil {
+		fmt.Fprintf(w, "serving_requests_in_flight %d\n", len(a.slots))
+		fmt.Fprintf(w, "serving_queue_seconds_sum %g\n", a.queued.Seconds())
+		fmt.Fprintf(w, "serving_queue_seconds_count %d\n", a.admitted)
+	}
+}
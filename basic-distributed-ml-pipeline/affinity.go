@@ -0,0 +1,116 @@
+package distributed
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseCPUSets parses the -cpu-sets flag: CPU lists in the Linux cpulist
+// format ("0-3,8"), separated by semicolons, or "numa" for one set per NUMA
+// node of this machine. Worker i is pinned to set i modulo the number of sets.
+func parseCPUSets(value string) ([][]int, error) {
+	if value == "numa" {
+		return numaCPUSets()
+	}
+	var sets [][]int
+	for _, field := range strings.Split(value, ";") {
+		if strings.TrimSpace(field) == "" {
+			continue
+		}
+		set, err := parseCPUList(field)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("no CPU sets in %q", value)
+	}
+	return sets, nil
+}
+
+// parseCPUList parses a cpulist such as "0-3,8,10-11".
+func parseCPUList(list string) ([]int, error) {
+	var cpus []int
+	for _, part := range strings.Split(strings.TrimSpace(list), ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, err := strconv.Atoi(first)
+		if err != nil || from < 0 {
+			return nil, fmt.Errorf("invalid CPU %q in %q", part, list)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(last); err != nil || to < from {
+				return nil, fmt.Errorf("invalid CPU range %q in %q", part, list)
+			}
+		}
+		for cpu := from; cpu <= to; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// numaCPUSets reads the CPUs of every NUMA node from sysfs.
+func numaCPUSets() ([][]int, error) {
+	paths, err := filepath.Glob("/sys/devices/system/node/node[0-9]*/cpulist")
+	if err != nil || len(paths) == 0 {
+		return nil, fmt.Errorf("cannot find the NUMA nodes of this machine")
+	}
+	sort.Strings(paths)
+	var sets [][]int
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(string(data)) == "" {
+			continue // a node with memory but no CPUs
+		}
+		set, err := parseCPUList(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		sets = append(sets, set)
+	}
+	return sets, nil
+}
+
+// distinctCPUs counts the CPUs in all sets together, the GOMAXPROCS that
+// lets every pinned worker run at once without oversubscribing them.
+func distinctCPUs(sets [][]int) int {
+	seen := make(map[int]bool)
+	for _, set := range sets {
+		for _, cpu := range set {
+			seen[cpu] = true
+		}
+	}
+	return len(seen)
+}
+
+func formatCPUs(cpus []int) string {
+	fields := make([]string, len(cpus))
+	for i, cpu := range cpus {
+		fields[i] = strconv.Itoa(cpu)
+	}
+	return strings.Join(fields, ",")
+}
+
+// pinWorker locks the calling goroutine to its OS thread and restricts that
+// thread to the worker's CPU set. It logs and carries on unpinned when the
+// platform refuses.
+func pinWorker(worker int, sets [][]int) {
+	if len(sets) == 0 {
+		return
+	}
+	cpus := sets[worker%len(sets)]
+	if err := pinThread(cpus); err != nil {
+		logger.With("worker_id", worker).Error("Worker %d cannot be pinned to CPUs %s: %v", worker, formatCPUs(cpus), err)
+		return
+	}
+	logger.With("worker_id", worker).Info("Worker %d pinned to CPUs %s", worker, formatCPUs(cpus))
+}
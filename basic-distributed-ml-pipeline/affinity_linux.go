@@ -0,0 +1,19 @@
+package distributed
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// pinThread keeps the calling goroutine on its current OS thread and
+// schedules that thread only on cpus. The goroutine should exit without
+// unlocking, so the runtime retires the pinned thread instead of reusing it.
+func pinThread(cpus []int) error {
+	runtime.LockOSThread()
+	var set unix.CPUSet
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+	return unix.SchedSetaffinity(0, &set)
+}
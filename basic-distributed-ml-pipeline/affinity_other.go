@@ -0,0 +1,11 @@
+//go:build !linux
+
+package distributed
+
+import "fmt"
+
+// pinThread is only implemented on Linux; elsewhere workers run wherever
+// the Go scheduler puts them.
+func pinThread(cpus []int) error {
+	return fmt.Errorf("CPU affinity is not supported on this platform")
+}
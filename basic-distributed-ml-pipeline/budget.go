@@ -0,0 +1,142 @@
+package distributed
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// budget stops training once a wall-clock or update limit is reached. Zero
+// limits are not enforced.
+type budget struct {
+	maxDuration time.Duration
+	deadline    time.Time
+	maxUpdates  int64
+	updates     atomic.Int64
+
+	mu     sync.Mutex
+	reason string
+}
+
+func newBudget(maxDuration time.Duration, maxUpdates int64, start time.Time) *budget {
+	b := &budget{maxDuration: maxDuration, maxUpdates: maxUpdates}
+	if maxDuration > 0 {
+		b.deadline = start.Add(maxDuration)
+	}
+	return b
+}
+
+// spend counts one applied update and returns the total so far.
+func (b *budget) spend() int64 {
+	return b.updates.Add(1)
+}
+
+// exhausted reports whether training must stop, remembering the first limit
+// that was hit.
+func (b *budget) exhausted() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.reason != "" {
+		return true
+	}
+	switch {
+	case b.maxUpdates > 0 && b.updates.Load() >= b.maxUpdates:
+		b.reason = fmt.Sprintf("reached %d updates", b.maxUpdates)
+	case !b.deadline.IsZero() && time.Now().After(b.deadline):
+		b.reason = fmt.Sprintf("exceeded the %v time budget", b.maxDuration)
+	default:
+		return false
+	}
+	return true
+}
+
+// stop makes training stop for reason, unless it already has for another.
+func (b *budget) stop(reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.reason == "" {
+		b.reason = reason
+	}
+}
+
+func (b *budget) stopReason() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.reason
+}
+
+// Checkpoint is a training snapshot on disk: written every few epochs, and
+// with the best model seen when a budget stops a run early. Training resumes
+// from it after Completed epochs.
+type Checkpoint struct {
+	Weights   []float64       `json:"weights"`
+	Bias      float64         `json:"bias"`
+	Epoch     int             `json:"epoch"`     // last completed epoch of the worker that produced it, -1 if none
+	TrainMSE  float64         `json:"train_mse"` // that worker's average epoch loss
+	Updates   int64           `json:"updates"`
+	Completed int             `json:"completed_epochs"` // epochs finished by every worker
+	Metrics   map[int]float64 `json:"metrics,omitempty"`
+	Reason    string          `json:"reason"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// bestModel keeps a copy of the weights with the lowest epoch loss reported
+// by any worker.
+type bestModel struct {
+	mu       sync.Mutex
+	weights  []float64
+	bias     float64
+	epoch    int
+	updates  int64 // of the model when the weights were copied
+	trainMSE float64
+}
+
+func newBestModel() *bestModel {
+	return &bestModel{epoch: -1, trainMSE: math.Inf(1)}
+}
+
+func (b *bestModel) offer(model *Model, epoch int, mse float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if math.IsNaN(mse) || mse >= b.trainMSE {
+		return
+	}
+
+	model.mu.Lock()
+	b.weights = append(b.weights[:0], model.Weights...)
+	b.bias = model.Bias
+	b.updates = model.Updates
+	model.mu.Unlock()
+	b.epoch, b.trainMSE = epoch, mse
+}
+
+// checkpoint returns the best snapshot, stamped with the epochs and updates
+// that produced its weights, or the given model after its updates and
+// completed epochs when no epoch finished before training stopped.
+func (b *bestModel) checkpoint(fallback *Model, updates int64, completed int, reason string) Checkpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	checkpoint := Checkpoint{
+		Weights:   append([]float64(nil), b.weights...),
+		Bias:      b.bias,
+		Epoch:     b.epoch,
+		TrainMSE:  b.trainMSE,
+		Updates:   b.updates,
+		Completed: b.epoch + 1,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+	if b.epoch < 0 {
+		fallback.mu.Lock()
+		checkpoint.Weights = append([]float64(nil), fallback.Weights...)
+		checkpoint.Bias = fallback.Bias
+		fallback.mu.Unlock()
+		checkpoint.TrainMSE = 0
+		checkpoint.Updates, checkpoint.Completed = updates, completed
+	}
+	return checkpoint
+}
@@ -0,0 +1,260 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopherconAU/blobstore"
+	"gopherconAU/dataset"
+	"gopherconAU/logging"
+)
+
+// PreprocessConfig describes how raw CSV rows become training data. Together
+// with the dataset content hash it addresses an entry in the preprocessing
+// cache, so any change to either produces a fresh entry.
+type PreprocessConfig struct {
+	Transform string          `json:"transform"`
+	Mapping   dataset.Mapping `json:"mapping"`
+	Parse     dataset.Options `json:"parse"`
+}
+
+// cacheInfo is stored next to every cache entry so entries can be listed
+// without decoding the data.
+type cacheInfo struct {
+	Key         string           `json:"key"`
+	Dataset     string           `json:"dataset"`
+	ContentHash string           `json:"content_hash"`
+	Config      PreprocessConfig `json:"config"`
+	Rows        int              `json:"rows"`
+	Bytes       int              `json:"bytes"`
+	CreatedAt   time.Time        `json:"created_at"`
+}
+
+type cacheEntry struct {
+	Data   []DataPoint
+	Scaler Scaler
+	Parts  []int // rows per input file, in file order
+}
+
+type preprocessCache struct {
+	store blobstore.Store
+}
+
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ".cache"
+	}
+	return filepath.Join(dir, "gopherconAU", "preprocessed")
+}
+
+func openPreprocessCache(dir string) (*preprocessCache, error) {
+	store, err := blobstore.NewLocal(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &preprocessCache{store: store}, nil
+}
+
+// cacheFormat is bumped whenever cached rows gain fields, so that entries
+// written by older builds are not mistaken for complete ones.
+const cacheFormat = "2"
+
+func cacheKey(contentHash string, config PreprocessConfig) string {
+	encoded, _ := json.Marshal(config)
+	sum := sha256.Sum256(append([]byte(cacheFormat+"\n"+contentHash+"\n"), encoded...))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *preprocessCache) load(ctx context.Context, key string) (*cacheEntry, error) {
+	r, err := c.store.Get(ctx, key+".gob")
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var entry cacheEntry
+	if err := gob.NewDecoder(r).Decode(&entry); err != nil {
+		return nil, fmt.Errorf("decoding cache entry %s: %v", key, err)
+	}
+	return &entry, nil
+}
+
+func (c *preprocessCache) save(ctx context.Context, info cacheInfo, entry cacheEntry) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return err
+	}
+	info.Bytes = buf.Len()
+	if err := c.store.Put(ctx, info.Key+".gob", &buf); err != nil {
+		return err
+	}
+
+	encoded, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	return c.store.Put(ctx, info.Key+".json", bytes.NewReader(encoded))
+}
+
+func (c *preprocessCache) entries(ctx context.Context) ([]cacheInfo, error) {
+	keys, err := c.store.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []cacheInfo
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".json") {
+			continue
+		}
+		r, err := c.store.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		var info cacheInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			logger.Error("Skipping unreadable cache metadata %s: %v", key, err)
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (c *preprocessCache) remove(ctx context.Context, key string) error {
+	if err := c.store.Delete(ctx, key+".gob"); err != nil {
+		return err
+	}
+	return c.store.Delete(ctx, key+".json")
+}
+
+// loadPreprocessed returns the standardized dataset for the files of the
+// given location, whose combined content hash is given, reading it from the
+// cache when an entry for the same content and config exists and loading and
+// normalizing it otherwise. It also returns the number of rows from each
+// file. A nil cache disables caching.
+func loadPreprocessed(cache *preprocessCache, location string, paths []string, contentHash string, config PreprocessConfig) ([]DataPoint, []int, Scaler, error) {
+	ctx := context.Background()
+	key := cacheKey(contentHash, config)
+
+	if cache != nil {
+		entry, err := cache.load(ctx, key)
+		if err == nil {
+			logger.Info("Loaded %d preprocessed samples from cache entry %s", len(entry.Data), key[:12])
+			if entry.Parts == nil {
+				entry.Parts = []int{len(entry.Data)}
+			}
+			return entry.Data, entry.Parts, entry.Scaler, nil
+		}
+		if err != blobstore.ErrNotFound {
+			logger.Error("Ignoring cache entry %s: %v", key[:12], err)
+		}
+	}
+
+	raw, parts, err := loadFiles(paths, config.Mapping, config.Parse)
+	if err != nil {
+		return nil, nil, Scaler{}, err
+	}
+	scaler, err := statsScaler(paths, config.Mapping, config.Parse)
+	if err != nil {
+		logger.Error("Fitting the scaler on the loaded rows instead of column statistics: %v", err)
+		scaler = fitScaler(raw)
+	}
+	data := scaler.transform(raw)
+
+	if cache != nil {
+		info := cacheInfo{
+			Key:         key,
+			Dataset:     location,
+			ContentHash: contentHash,
+			Config:      config,
+			Rows:        len(data),
+			CreatedAt:   time.Now(),
+		}
+		if err := cache.save(ctx, info, cacheEntry{Data: data, Scaler: scaler, Parts: parts}); err != nil {
+			logger.Error("Failed to cache preprocessed data: %v", err)
+		} else {
+			logger.Info("Cached preprocessed data as entry %s", key[:12])
+		}
+	}
+	return data, parts, scaler, nil
+}
+
+// runCache implements the "cache" command with its "list" and "purge"
+// subcommands for inspecting and clearing the preprocessing cache.
+func runCache(args []string) {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "purge") {
+		fmt.Fprintln(os.Stderr, "usage: cache list|purge [flags]")
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet("cache "+args[0], flag.ExitOnError)
+	dir := fs.String("cache-dir", defaultCacheDir(), "preprocessing cache directory")
+	olderThan := fs.Duration("older-than", 0, "purge only entries older than this (0 purges everything)")
+	dataset := fs.String("dataset", "", "purge only entries built from this dataset path")
+	var logOptions logging.Options
+	logOptions.RegisterFlags(fs)
+	fs.Parse(args[1:])
+	configureLogging(logOptions)
+	defer logger.Close()
+
+	ctx := context.Background()
+	cache, err := openPreprocessCache(*dir)
+	if err != nil {
+		logger.Error("Failed to open cache: %v", err)
+		return
+	}
+	entries, err := cache.entries(ctx)
+	if err != nil {
+		logger.Error("Failed to list cache: %v", err)
+		return
+	}
+
+	if args[0] == "list" {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tDATASET\tTRANSFORM\tROWS\tSIZE\tCREATED")
+		total := 0
+		for _, info := range entries {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d KiB\t%s\n", info.Key[:12], info.Dataset, info.Config.Transform,
+				info.Rows, info.Bytes/1024, info.CreatedAt.Format(time.RFC3339))
+			total += info.Bytes
+		}
+		w.Flush()
+		fmt.Printf("%d entries, %d KiB in %s\n", len(entries), total/1024, *dir)
+		return
+	}
+
+	removed := 0
+	for _, info := range entries {
+		if *olderThan > 0 && time.Since(info.CreatedAt) < *olderThan {
+			continue
+		}
+		if *dataset != "" && info.Dataset != *dataset {
+			continue
+		}
+		if err := cache.remove(ctx, info.Key); err != nil {
+			logger.Error("Failed to remove cache entry %s: %v", info.Key[:12], err)
+			continue
+		}
+		removed++
+	}
+	logger.Info("Purged %d of %d cache entries from %s", removed, len(entries), *dir)
+}
@@ -0,0 +1,180 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopherconAU/blobstore"
+)
+
+// epochCheckpointer writes the model to its checkpoint store every few epochs, counting an
+// epoch as completed once every worker has finished it. It also samples the
+// resource usage of the process after every completed epoch.
+type epochCheckpointer struct {
+	store *checkpointStore
+	every int
+
+	mu        sync.Mutex
+	finished  []int // epochs finished per worker
+	completed int   // epochs finished by every worker
+	usage     []ResourceUsage
+}
+
+// newEpochCheckpointer returns a checkpointer for workers that start after
+// completed epochs. It only counts epochs when every is zero or store nil.
+func newEpochCheckpointer(store *checkpointStore, every, workers, completed int) *epochCheckpointer {
+	c := &epochCheckpointer{store: store, every: every, finished: make([]int, workers), completed: completed}
+	for i := range c.finished {
+		c.finished[i] = completed
+	}
+	return c
+}
+
+// epochDone records that worker finished another epoch training model, and
+// checkpoints model when that completes a checkpointed epoch.
+func (c *epochCheckpointer) epochDone(worker int, model *Model) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.finished[worker]++
+	completed := c.finished[0]
+	for _, n := range c.finished {
+		completed = min(completed, n)
+	}
+	if completed == c.completed {
+		return
+	}
+	c.completed = completed
+	usage := sampleResources(completed)
+	c.usage = append(c.usage, usage)
+	logger.Debug("After epoch %d: RSS %.1f MiB, heap %.1f MiB, %d goroutines, %d GCs",
+		completed, mebibytes(usage.RSSBytes), mebibytes(usage.HeapBytes), usage.Goroutines, usage.NumGC)
+	if c.every <= 0 || c.store == nil || completed%c.every != 0 {
+		return
+	}
+
+	checkpoint := Checkpoint{
+		Epoch:     completed - 1,
+		Completed: completed,
+		Reason:    fmt.Sprintf("epoch %d completed", completed),
+		CreatedAt: time.Now(),
+	}
+	model.mu.Lock()
+	checkpoint.Weights = append([]float64(nil), model.Weights...)
+	checkpoint.Bias = model.Bias
+	checkpoint.Updates = model.Updates
+	model.mu.Unlock()
+	checkpoint.Metrics, checkpoint.TrainMSE = model.metricsUpTo(completed)
+
+	if err := c.store.write(checkpoint); err != nil {
+		logger.Error("Failed to write checkpoint: %v", err)
+		return
+	}
+	logger.Info("Checkpointed epoch %d (%d updates) to %s", completed, checkpoint.Updates, c.store)
+}
+
+// completedEpochs returns the number of epochs every worker has finished.
+func (c *epochCheckpointer) completedEpochs() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.completed
+}
+
+// resources returns the resource usage sampled after every completed epoch.
+func (c *epochCheckpointer) resources() []ResourceUsage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]ResourceUsage(nil), c.usage...)
+}
+
+// metricsUpTo copies the epoch losses of the first n epochs and returns them
+// with the loss of the last one.
+func (m *Model) metricsUpTo(n int) (map[int]float64, float64) {
+	m.MetricsMu.Lock()
+	defer m.MetricsMu.Unlock()
+	metrics := make(map[int]float64)
+	for epoch, mse := range m.Metrics {
+		if epoch < n {
+			metrics[epoch] = mse
+		}
+	}
+	return metrics, metrics[n-1]
+}
+
+// checkpointStore keeps a checkpoint under one key of a blobstore.Store, so
+// that it may live in a local file, on S3 or in Cloud Storage.
+type checkpointStore struct {
+	store    blobstore.Store
+	key      string
+	location string
+}
+
+// openCheckpoints opens the store holding the checkpoint at location: a file
+// path, or a URL such as s3://bucket/prefix/checkpoint.json.
+func openCheckpoints(ctx context.Context, location string) (*checkpointStore, error) {
+	dir, key := path.Split(filepath.ToSlash(location))
+	if key == "" {
+		return nil, fmt.Errorf("checkpoint location %q names no file", location)
+	}
+	if dir == "" {
+		dir = "."
+	}
+	store, err := blobstore.Open(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &checkpointStore{store: store, key: key, location: location}, nil
+}
+
+func (c *checkpointStore) String() string { return c.location }
+
+// best returns the store, sharing c's, of the best model of a run, which is
+// kept beside the checkpoint: checkpoint.best.json for checkpoint.json.
+func (c *checkpointStore) best() *checkpointStore {
+	ext := path.Ext(c.key)
+	key := strings.TrimSuffix(c.key, ext) + ".best" + ext
+	return &checkpointStore{store: c.store, key: key, location: strings.TrimSuffix(c.location, c.key) + key}
+}
+
+func (c *checkpointStore) Close() error { return c.store.Close() }
+
+// write replaces the checkpoint. Stores cannot rename, so it is put under a
+// temporary key and then copied into place, and a crash while writing leaves
+// the previous checkpoint intact. It is written even once training has been
+// cancelled, which is when the last checkpoint of a run is taken.
+func (c *checkpointStore) write(checkpoint Checkpoint) error {
+	ctx := context.Background()
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.key + ".tmp"
+	if err := c.store.Put(ctx, tmp, bytes.NewReader(append(data, '\n'))); err != nil {
+		return err
+	}
+	if err := blobstore.Copy(ctx, c.store, tmp, c.key); err != nil {
+		return err
+	}
+	return c.store.Delete(ctx, tmp)
+}
+
+// read loads the checkpoint to resume training from.
+func (c *checkpointStore) read(ctx context.Context) (*Checkpoint, error) {
+	r, err := c.store.Get(ctx, c.key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", c.location, err)
+	}
+	defer r.Close()
+	var checkpoint Checkpoint
+	if err := json.NewDecoder(r).Decode(&checkpoint); err != nil {
+		return nil, fmt.Errorf("%s: %v", c.location, err)
+	}
+	return &checkpoint, nil
+}
@@ -0,0 +1,211 @@
+package distributed
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/components"
+	"github.com/go-echarts/go-echarts/v2/opts"
+)
+
+// trainingDashboard serves a page that follows a training run as it
+// happens: the MSE of every worker per epoch, the updates per second and
+// what every worker is doing. The page polls /progress.json and redraws
+// until the run ends.
+type trainingDashboard struct {
+	metrics *trainingMetrics
+	epochs  int
+
+	mu   sync.Mutex
+	rate [][2]float64 // seconds into the run and updates per second over the second before
+}
+
+// dashboardState is the body of /progress.json.
+type dashboardState struct {
+	Status    string           `json:"status"` // running, or how the run ended
+	Epochs    int              `json:"epochs"`
+	Updates   int64            `json:"updates"`
+	Elapsed   float64          `json:"elapsed_seconds"`
+	WorkerMSE [][][2]float64   `json:"worker_mse"` // by worker: epoch and MSE
+	EpochMSE  [][2]float64     `json:"epoch_mse"`  // epoch and the mean MSE of the workers
+	Rate      [][2]float64     `json:"rate"`
+	Workers   []workerActivity `json:"workers"`
+}
+
+// workerActivity is the status of one worker on the dashboard.
+type workerActivity struct {
+	State   string `json:"state"`
+	Batches int64  `json:"batches"`
+	Pending int    `json:"pending"`
+}
+
+func newTrainingDashboard(m *trainingMetrics, epochs int) *trainingDashboard {
+	return &trainingDashboard{metrics: m, epochs: epochs}
+}
+
+// sample records the updates per second once a second until the run ends.
+func (d *trainingDashboard) sample() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var last int64
+	for range ticker.C {
+		d.metrics.mu.Lock()
+		start, updates, done := d.metrics.start, d.metrics.updates, d.metrics.done != nil
+		d.metrics.mu.Unlock()
+		if start.IsZero() {
+			continue // training has not begun
+		}
+		d.mu.Lock()
+		d.rate = append(d.rate, [2]float64{time.Since(start).Seconds(), float64(updates - last)})
+		d.mu.Unlock()
+		last = updates
+		if done {
+			return
+		}
+	}
+}
+
+// state gathers the body of /progress.json.
+func (d *trainingDashboard) state() dashboardState {
+	m := d.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := dashboardState{Status: "running", Epochs: d.epochs, Updates: m.updates}
+	if m.done != nil {
+		s.Status = m.done.Status
+	}
+	if !m.start.IsZero() {
+		s.Elapsed = time.Since(m.start).Seconds()
+	}
+	s.WorkerMSE = make([][][2]float64, len(m.workers))
+	for _, event := range m.history {
+		if worker := int(event.WorkerId); worker < len(s.WorkerMSE) {
+			s.WorkerMSE[worker] = append(s.WorkerMSE[worker], [2]float64{float64(event.Epoch + 1), event.Mse})
+		}
+	}
+	for epoch, mse := range m.epochMSE {
+		s.EpochMSE = append(s.EpochMSE, [2]float64{float64(epoch + 1), mse})
+	}
+	sort.Slice(s.EpochMSE, func(i, j int) bool { return s.EpochMSE[i][0] < s.EpochMSE[j][0] })
+	for _, p := range m.workers {
+		activity := workerActivity{Batches: p.batches, Pending: p.pending}
+		switch {
+		case m.done != nil:
+			activity.State = s.Status
+		case p.epochs >= d.epochs:
+			activity.State = "finished"
+		default:
+			activity.State = fmt.Sprintf("epoch %d of %d", p.epochs+1, d.epochs)
+		}
+		s.Workers = append(s.Workers, activity)
+	}
+
+	d.mu.Lock()
+	s.Rate = append([][2]float64(nil), d.rate...)
+	d.mu.Unlock()
+	return s
+}
+
+func (d *trainingDashboard) serveProgress(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(d.state()); err != nil {
+		logger.Error("%v", err)
+	}
+}
+
+// page lays out the charts, empty until the script of each fills it in.
+func (d *trainingDashboard) page() *components.Page {
+	mse := charts.NewLine()
+	mse.SetGlobalOptions(charts.WithTitleOpts(opts.Title{Title: "Training MSE by epoch"}))
+	mse.AddJSFuncs(dashboardPoll(dashboardMSE))
+	rate := charts.NewLine()
+	rate.SetGlobalOptions(charts.WithTitleOpts(opts.Title{Title: "Updates per second"}))
+	rate.AddJSFuncs(dashboardPoll(dashboardRate))
+	workers := charts.NewBar()
+	workers.SetGlobalOptions(charts.WithTitleOpts(opts.Title{Title: "Workers"}))
+	workers.AddJSFuncs(dashboardPoll(dashboardWorkers))
+
+	page := components.NewPage()
+	page.SetPageTitle("Distributed training")
+	page.AddCharts(mse, rate, workers)
+	return page
+}
+
+// serveTrainingDashboard serves the dashboard of m, for a run of epochs, on
+// addr at / and /progress.json until the returned server is closed.
+func serveTrainingDashboard(addr string, m *trainingMetrics, epochs int) *http.Server {
+	d := newTrainingDashboard(m, epochs)
+	go d.sample()
+	page := d.page()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/progress.json", d.serveProgress)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if err := page.Render(w); err != nil {
+			logger.Error("%v", err)
+		}
+	})
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("Dashboard server: %v", err)
+		}
+	}()
+	logger.Info("Serving the training dashboard on %s", addr)
+	return server
+}
+
+// dashboardPoll wraps draw, JavaScript that redraws the chart %MY_ECHARTS%
+// from the state d of /progress.json, in a loop that fetches the state
+// every second while the run lasts. go-echarts strips newlines from it, so
+// every statement ends in a semicolon.
+func dashboardPoll(draw string) string {
+	return `(function () {
+		function poll() {
+			fetch('/progress.json').then(function (r) { return r.json(); }).then(function (d) {
+				var status = d.status + ', ' + d.updates + ' updates in ' + d.elapsed_seconds.toFixed(1) + 's';
+				` + draw + `;
+				if (d.status === 'running') { setTimeout(poll, 1000); }
+			});
+		}
+		poll();
+	})();`
+}
+
+const (
+	dashboardMSE = `var series = (d.worker_mse || []).map(function (points, w) {
+			return {name: 'Worker ' + w, type: 'line', data: points || []};
+		});
+		series.push({name: 'Mean', type: 'line', lineStyle: {width: 4}, data: d.epoch_mse || []});
+		%MY_ECHARTS%.setOption({
+			title: {text: 'Training MSE by epoch', subtext: status},
+			legend: {data: series.map(function (s) { return s.name; })},
+			tooltip: {trigger: 'axis'},
+			xAxis: {type: 'value', name: 'epoch', min: 1, max: d.epochs, minInterval: 1},
+			yAxis: {type: 'value', name: 'MSE', scale: true},
+			series: series
+		}, {replaceMerge: ['series']})`
+	dashboardRate = `%MY_ECHARTS%.setOption({
+			title: {text: 'Updates per second', subtext: status},
+			tooltip: {trigger: 'axis'},
+			xAxis: {type: 'value', name: 'seconds'},
+			yAxis: {type: 'value', name: 'updates/s'},
+			series: [{name: 'updates/s', type: 'line', showSymbol: false, data: d.rate || []}]
+		}, {replaceMerge: ['series']})`
+	dashboardWorkers = `var names = (d.workers || []).map(function (w, i) { return 'Worker ' + i + ' (' + w.state + ')'; });
+		%MY_ECHARTS%.setOption({
+			title: {text: 'Workers', subtext: status},
+			legend: {data: ['batches trained', 'batches left this epoch']},
+			tooltip: {trigger: 'axis'},
+			xAxis: {type: 'category', data: names},
+			yAxis: {type: 'value', name: 'batches'},
+			series: [
+				{name: 'batches trained', type: 'bar', stack: 'batches', data: (d.workers || []).map(function (w) { return w.batches; })},
+				{name: 'batches left this epoch', type: 'bar', stack: 'batches', data: (d.workers || []).map(function (w) { return w.pending; })}
+			]
+		}, {replaceMerge: ['series']})`
+)
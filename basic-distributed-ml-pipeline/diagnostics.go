@@ -0,0 +1,124 @@
+package distributed
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// BatchSummary describes the batch a worker was processing when it panicked.
+type BatchSummary struct {
+	Worker     int       `json:"worker"`
+	Epoch      int       `json:"epoch"`
+	Start      int       `json:"start"` // index of the first row in the worker's shard
+	End        int       `json:"end"`   // exclusive
+	FeatureMin []float64 `json:"feature_min"`
+	FeatureMax []float64 `json:"feature_max"`
+	LabelMin   float64   `json:"label_min"`
+	LabelMax   float64   `json:"label_max"`
+	NonFinite  int       `json:"non_finite"` // NaN or infinite values in the batch
+}
+
+// PanicReport is the diagnostics bundle written for every recovered panic.
+type PanicReport struct {
+	Time      time.Time     `json:"time"`
+	Component string        `json:"component"`
+	Panic     string        `json:"panic"`
+	Stack     string        `json:"stack"`
+	Batch     *BatchSummary `json:"batch,omitempty"`
+}
+
+// diagnostics writes panic reports to a directory. An empty directory only
+// logs them.
+type diagnostics struct {
+	dir   string
+	mu    sync.Mutex
+	count int
+}
+
+func newDiagnostics(dir string) *diagnostics {
+	return &diagnostics{dir: dir}
+}
+
+// recovered records a panic value caught by recover, with the current stack.
+func (d *diagnostics) recovered(component string, value interface{}, batch *BatchSummary) {
+	report := PanicReport{
+		Time:      time.Now(),
+		Component: component,
+		Panic:     fmt.Sprint(value),
+		Stack:     string(debug.Stack()),
+		Batch:     batch,
+	}
+
+	d.mu.Lock()
+	d.count++
+	n := d.count
+	d.mu.Unlock()
+
+	logger.Error("Recovered panic in %s: %s", component, report.Panic)
+	if d.dir == "" {
+		return
+	}
+	if err := os.MkdirAll(d.dir, 0o755); err != nil {
+		logger.Error("Failed to create diagnostics directory: %v", err)
+		return
+	}
+	path := filepath.Join(d.dir, fmt.Sprintf("panic-%s-%03d.json", report.Time.Format("20060102T150405"), n))
+	if err := writeJSON(path, report); err != nil {
+		logger.Error("Failed to write diagnostics bundle: %v", err)
+		return
+	}
+	logger.Error("Diagnostics bundle written to %s", path)
+}
+
+func (d *diagnostics) panics() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.count
+}
+
+func summarizeBatch(worker, epoch, start int, batch []DataPoint) *BatchSummary {
+	summary := &BatchSummary{
+		Worker:   worker,
+		Epoch:    epoch,
+		Start:    start,
+		End:      start + len(batch),
+		LabelMin: math.Inf(1),
+		LabelMax: math.Inf(-1),
+	}
+	for _, dp := range batch {
+		for j, f := range dp.Features {
+			if j >= len(summary.FeatureMin) {
+				summary.FeatureMin = append(summary.FeatureMin, math.Inf(1))
+				summary.FeatureMax = append(summary.FeatureMax, math.Inf(-1))
+			}
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				summary.NonFinite++
+				continue
+			}
+			summary.FeatureMin[j] = math.Min(summary.FeatureMin[j], f)
+			summary.FeatureMax[j] = math.Max(summary.FeatureMax[j], f)
+		}
+		if math.IsNaN(dp.Label) || math.IsInf(dp.Label, 0) {
+			summary.NonFinite++
+			continue
+		}
+		summary.LabelMin = math.Min(summary.LabelMin, dp.Label)
+		summary.LabelMax = math.Max(summary.LabelMax, dp.Label)
+	}
+
+	// JSON has no infinities; columns without a finite value report zeros.
+	for j := range summary.FeatureMin {
+		if math.IsInf(summary.FeatureMin[j], 1) {
+			summary.FeatureMin[j], summary.FeatureMax[j] = 0, 0
+		}
+	}
+	if math.IsInf(summary.LabelMin, 1) {
+		summary.LabelMin, summary.LabelMax = 0, 0
+	}
+	return summary
+}
@@ -0,0 +1,308 @@
+package distributed
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"gopherconAU/cli"
+	"gopherconAU/dataset"
+	"gopherconAU/logging"
+)
+
+// modelSnapshot holds what diffmodel compares of a saved model: a model
+// artifact written by -save-model, watch or schedule, or a checkpoint. Fields
+// only one of the formats has are nil in the other.
+type modelSnapshot struct {
+	Weights   []float64           `json:"weights"`
+	Bias      float64             `json:"bias"`
+	Scaler    *Scaler             `json:"scaler"`
+	Dataset   *DatasetFingerprint `json:"dataset"`
+	TestMSE   *float64            `json:"test_mse"`
+	TrainMSE  *float64            `json:"train_mse"`
+	Epoch     *int                `json:"epoch"`
+	Updates   *int64              `json:"updates"`
+	Metrics   map[int]float64     `json:"metrics"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+func readModelSnapshot(path string) (*modelSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot modelSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", path, err)
+	}
+	if len(snapshot.Weights) == 0 {
+		return nil, fmt.Errorf("%s holds no model weights", path)
+	}
+	if snapshot.Epoch != nil && *snapshot.Epoch < 0 {
+		// A checkpoint written before any epoch finished has no train MSE.
+		snapshot.Epoch, snapshot.TrainMSE = nil, nil
+	}
+	return &snapshot, nil
+}
+
+// ModelDiff is the difference between two saved models, from A to B.
+type ModelDiff struct {
+	A string `json:"a"`
+	B string `json:"b"`
+	// Weights lists every weight, largest absolute change first.
+	Weights []WeightDelta `json:"weights"`
+	Bias    ValueDelta    `json:"bias"`
+	// WeightNorm is the L2 norm of either model's weights; DeltaNorm that
+	// of their difference, and Cosine the cosine similarity of the two
+	// weight vectors.
+	WeightNorm ValueDelta `json:"weight_norm"`
+	DeltaNorm  float64    `json:"delta_norm"`
+	Cosine     float64    `json:"cosine_similarity"`
+	// Metrics compares the scores and counters both models carry, such as
+	// the test MSE of an artifact or the per-epoch losses of checkpoints.
+	Metrics []MetricDelta `json:"metrics,omitempty"`
+	// ScalerShift is the largest change of a feature mean or standard
+	// deviation between the models' scalers, when both have one.
+	ScalerShift *float64 `json:"scaler_shift,omitempty"`
+	// SameData and SameSchema compare the dataset hashes of artifacts.
+	SameData   *bool    `json:"same_data,omitempty"`
+	SameSchema *bool    `json:"same_schema,omitempty"`
+	Age        Duration `json:"age"` // B's creation time minus A's
+}
+
+// WeightDelta is the change of one weight. Relative is the change over |A|,
+// nil when A is 0.
+type WeightDelta struct {
+	Feature  string   `json:"feature"`
+	A        float64  `json:"a"`
+	B        float64  `json:"b"`
+	Delta    float64  `json:"delta"`
+	Relative *float64 `json:"relative,omitempty"`
+}
+
+// ValueDelta is a value in either model and its change.
+type ValueDelta struct {
+	A     float64 `json:"a"`
+	B     float64 `json:"b"`
+	Delta float64 `json:"delta"`
+}
+
+func valueDelta(a, b float64) ValueDelta {
+	return ValueDelta{A: a, B: b, Delta: b - a}
+}
+
+// MetricDelta is a named ValueDelta.
+type MetricDelta struct {
+	Name string `json:"name"`
+	ValueDelta
+}
+
+// Duration marshals as a Go duration string.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// diffModels compares a and b, naming their weights after features; weights
+// beyond the names are called w1, w2 and so on.
+func diffModels(a, b *modelSnapshot, features []string) (*ModelDiff, error) {
+	if len(a.Weights) != len(b.Weights) {
+		return nil, fmt.Errorf("the models have %d and %d weights", len(a.Weights), len(b.Weights))
+	}
+	diff := &ModelDiff{Bias: valueDelta(a.Bias, b.Bias)}
+
+	var dot, normA, normB, normDelta float64
+	for j := range a.Weights {
+		name := fmt.Sprintf("w%d", j+1)
+		if j < len(features) {
+			name = features[j]
+		}
+		delta := WeightDelta{Feature: name, A: a.Weights[j], B: b.Weights[j], Delta: b.Weights[j] - a.Weights[j]}
+		if delta.A != 0 {
+			relative := delta.Delta / math.Abs(delta.A)
+			delta.Relative = &relative
+		}
+		diff.Weights = append(diff.Weights, delta)
+
+		dot += a.Weights[j] * b.Weights[j]
+		normA += a.Weights[j] * a.Weights[j]
+		normB += b.Weights[j] * b.Weights[j]
+		normDelta += delta.Delta * delta.Delta
+	}
+	sort.SliceStable(diff.Weights, func(i, j int) bool {
+		return math.Abs(diff.Weights[i].Delta) > math.Abs(diff.Weights[j].Delta)
+	})
+	diff.WeightNorm = valueDelta(math.Sqrt(normA), math.Sqrt(normB))
+	diff.DeltaNorm = math.Sqrt(normDelta)
+	if normA > 0 && normB > 0 {
+		diff.Cosine = dot / math.Sqrt(normA*normB)
+	}
+
+	addMetric := func(name string, a, b *float64) {
+		if a != nil && b != nil {
+			diff.Metrics = append(diff.Metrics, MetricDelta{Name: name, ValueDelta: valueDelta(*a, *b)})
+		}
+	}
+	addMetric("test MSE", a.TestMSE, b.TestMSE)
+	addMetric("train MSE", a.TrainMSE, b.TrainMSE)
+	if a.Updates != nil && b.Updates != nil {
+		updatesA, updatesB := float64(*a.Updates), float64(*b.Updates)
+		addMetric("updates", &updatesA, &updatesB)
+	}
+	if a.Epoch != nil && b.Epoch != nil {
+		epochA, epochB := float64(*a.Epoch+1), float64(*b.Epoch+1)
+		addMetric("epoch", &epochA, &epochB)
+	}
+	var epochs []int
+	for epoch := range a.Metrics {
+		if _, ok := b.Metrics[epoch]; ok {
+			epochs = append(epochs, epoch)
+		}
+	}
+	sort.Ints(epochs)
+	for _, epoch := range epochs {
+		mseA, mseB := a.Metrics[epoch], b.Metrics[epoch]
+		addMetric(fmt.Sprintf("epoch %d MSE", epoch+1), &mseA, &mseB)
+	}
+
+	if a.Scaler != nil && b.Scaler != nil && len(a.Scaler.Means) == len(b.Scaler.Means) {
+		shift := 0.0
+		for j := range a.Scaler.Means {
+			shift = math.Max(shift, math.Abs(b.Scaler.Means[j]-a.Scaler.Means[j]))
+			shift = math.Max(shift, math.Abs(b.Scaler.Stds[j]-a.Scaler.Stds[j]))
+		}
+		diff.ScalerShift = &shift
+	}
+	if a.Dataset != nil && b.Dataset != nil {
+		sameData := a.Dataset.ContentHash == b.Dataset.ContentHash
+		sameSchema := a.Dataset.SchemaHash == b.Dataset.SchemaHash
+		diff.SameData, diff.SameSchema = &sameData, &sameSchema
+	}
+	if !a.CreatedAt.IsZero() && !b.CreatedAt.IsZero() {
+		diff.Age = Duration(b.CreatedAt.Sub(a.CreatedAt))
+	}
+	return diff, nil
+}
+
+// Print writes the diff for reading, with at most top weights (0 for all).
+func (d *ModelDiff) Print(w io.Writer, top int) {
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", d.A, d.B)
+	if d.Age != 0 {
+		fmt.Fprintf(w, "created %v apart\n", time.Duration(d.Age).Round(time.Second))
+	}
+	if d.SameData != nil {
+		fmt.Fprintf(w, "same dataset: %t, same schema: %t\n", *d.SameData, *d.SameSchema)
+	}
+	fmt.Fprintf(w, "weight norm %.6f -> %.6f (%+.6f), change norm %.6f, cosine similarity %.6f\n",
+		d.WeightNorm.A, d.WeightNorm.B, d.WeightNorm.Delta, d.DeltaNorm, d.Cosine)
+	fmt.Fprintf(w, "bias %.6f -> %.6f (%+.6f)\n", d.Bias.A, d.Bias.B, d.Bias.Delta)
+	if d.ScalerShift != nil {
+		fmt.Fprintf(w, "largest scaler mean or std change %.6f\n", *d.ScalerShift)
+	}
+
+	if len(d.Metrics) > 0 {
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "METRIC\tA\tB\tDELTA")
+		for _, m := range d.Metrics {
+			fmt.Fprintf(tw, "%s\t%.6g\t%.6g\t%+.6g\n", m.Name, m.A, m.B, m.Delta)
+		}
+		tw.Flush()
+	}
+
+	weights := d.Weights
+	if top > 0 && top < len(weights) {
+		weights = weights[:top]
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FEATURE\tA\tB\tDELTA\tRELATIVE")
+	for _, weight := range weights {
+		relative := "n/a"
+		if weight.Relative != nil {
+			relative = fmt.Sprintf("%+.1f%%", *weight.Relative*100)
+		}
+		fmt.Fprintf(tw, "%s\t%.6f\t%.6f\t%+.6f\t%s\n", weight.Feature, weight.A, weight.B, weight.Delta, relative)
+	}
+	tw.Flush()
+	if len(weights) < len(d.Weights) {
+		fmt.Fprintf(w, "... %d weights with smaller changes not shown\n", len(d.Weights)-len(weights))
+	}
+}
+
+// runDiffModel implements the "diffmodel" command: it compares two saved
+// models or checkpoints weight by weight and prints how they differ.
+func runDiffModel(args []string) {
+	fs := flag.NewFlagSet("diffmodel", flag.ExitOnError)
+	format := fs.String("format", "text", "output format: text or json")
+	top := fs.Int("top", 0, "show only the weights that changed most (0 shows all)")
+	dataPath := fs.String("data", "", "name the weights after the feature columns of this CSV or .xlsx file")
+	mapping := defaultMapping()
+	mapping.RegisterFlags(fs)
+	var parseOptions dataset.Options
+	parseOptions.RegisterFlags(fs)
+	var logOptions logging.Options
+	logOptions.RegisterFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: diffmodel [flags] old.json new.json")
+		fs.PrintDefaults()
+	}
+	cli.Parse(fs, args)
+	configureLogging(logOptions)
+	defer logger.Close()
+	if fs.NArg() != 2 || (*format != "text" && *format != "json") {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	a, err := readModelSnapshot(fs.Arg(0))
+	if err != nil {
+		logger.Error("Failed to read model: %v", err)
+		os.Exit(1)
+	}
+	b, err := readModelSnapshot(fs.Arg(1))
+	if err != nil {
+		logger.Error("Failed to read model: %v", err)
+		os.Exit(1)
+	}
+
+	var features []string
+	if *dataPath != "" {
+		header, err := dataset.ReadHeader(*dataPath, parseOptions)
+		if err != nil {
+			logger.Error("Failed to read header: %v", err)
+			os.Exit(1)
+		}
+		columns, err := mapping.Resolve(header)
+		if err != nil {
+			logger.Error("Invalid column mapping: %v", err)
+			os.Exit(1)
+		}
+		features = columns.FeatureNames
+	}
+
+	diff, err := diffModels(a, b, features)
+	if err != nil {
+		logger.Error("Cannot compare %s and %s: %v", fs.Arg(0), fs.Arg(1), err)
+		os.Exit(1)
+	}
+	diff.A, diff.B = fs.Arg(0), fs.Arg(1)
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(diff); err != nil {
+			logger.Error("Failed to write diff: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+	diff.Print(os.Stdout, *top)
+}
@@ -0,0 +1,153 @@
+package distributed
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"gopherconAU/basic-distributed-ml-pipeline/predictionapi"
+)
+
+// maxPendingPredictions is the most predictions a model remembers for
+// feedback, labelled or not; the oldest are forgotten first.
+const maxPendingPredictions = 100000
+
+// errNotPending is the error for feedback that matches no prediction
+// waiting for its labels.
+var errNotPending = errors.New("no prediction awaits feedback")
+
+// feedbackTracker joins ground-truth labels, which arrive long after the
+// prediction they judge, with that prediction by its request ID, and keeps
+// the model's error over the most recently labelled predictions.
+type feedbackTracker struct {
+	retention time.Duration // how long a prediction waits for its labels
+
+	mu      sync.Mutex
+	pending map[string]pendingPrediction
+	order   []pendingKey // pending predictions, oldest first, for expiry
+	window  []outcome    // ring of the latest labelled predictions
+	next    int          // where the next outcome goes in window
+	samples int          // outcomes in window
+
+	labelled  int64 // predictions given their labels
+	unmatched int64 // feedback for no pending prediction
+	expired   int64 // predictions forgotten before their labels came
+}
+
+// pendingPrediction is a served response waiting for its labels.
+type pendingPrediction struct {
+	version     string
+	predictions []float64
+	servedAt    time.Time
+}
+
+type pendingKey struct {
+	requestID string
+	servedAt  time.Time
+}
+
+// outcome is one labelled prediction.
+type outcome struct {
+	err float64 // prediction minus label
+	hit bool    // the prediction rounds to the label
+}
+
+func newFeedbackTracker(retention time.Duration, window int) *feedbackTracker {
+	return &feedbackTracker{
+		retention: retention,
+		pending:   make(map[string]pendingPrediction),
+		window:    make([]outcome, window),
+	}
+}
+
+// remember keeps a served response until its labels arrive. A request ID
+// served again replaces the earlier response.
+func (t *feedbackTracker) remember(requestID, version string, predictions []float64, servedAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expire(servedAt)
+	t.pending[requestID] = pendingPrediction{version: version, predictions: predictions, servedAt: servedAt}
+	t.order = append(t.order, pendingKey{requestID, servedAt})
+	for len(t.order) > maxPendingPredictions {
+		t.forgetOldest()
+	}
+}
+
+// expire forgets the predictions older than the retention.
+func (t *feedbackTracker) expire(now time.Time) {
+	for len(t.order) > 0 && now.Sub(t.order[0].servedAt) > t.retention {
+		t.forgetOldest()
+	}
+}
+
+func (t *feedbackTracker) forgetOldest() {
+	key := t.order[0]
+	t.order = t.order[1:]
+	// The prediction may have been labelled already, or replaced by a later
+	// request with the same ID.
+	if p, ok := t.pending[key.requestID]; ok && p.servedAt.Equal(key.servedAt) {
+		delete(t.pending, key.requestID)
+		t.expired++
+	}
+}
+
+// label scores the prediction served for requestID against its labels,
+// one per instance, and returns the version that made it. A prediction
+// takes its labels once.
+func (t *feedbackTracker) label(requestID string, labels []float64, now time.Time) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expire(now)
+	p, ok := t.pending[requestID]
+	if !ok {
+		t.unmatched++
+		return "", fmt.Errorf("%w for %q: it is unknown, already labelled or older than %s", errNotPending, requestID, t.retention)
+	}
+	if len(labels) != len(p.predictions) {
+		return "", fmt.Errorf("prediction %q has %d instances, got %d labels", requestID, len(p.predictions), len(labels))
+	}
+	for i, label := range labels {
+		if math.IsNaN(label) || math.IsInf(label, 0) {
+			return "", fmt.Errorf("label %d is %g", i, label)
+		}
+	}
+	delete(t.pending, requestID)
+
+	for i, label := range labels {
+		t.window[t.next] = outcome{err: p.predictions[i] - label, hit: math.Round(p.predictions[i]) == label}
+		t.next = (t.next + 1) % len(t.window)
+		t.samples = min(t.samples+1, len(t.window))
+	}
+	t.labelled += int64(len(labels))
+	return p.version, nil
+}
+
+// metrics summarizes the window; Samples is zero before any feedback.
+func (t *feedbackTracker) metrics() predictionapi.OnlineMetrics {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	m := predictionapi.OnlineMetrics{Samples: t.samples}
+	if t.samples == 0 {
+		return m
+	}
+	hits := 0
+	for _, o := range t.window[:t.samples] {
+		m.MSE += o.err * o.err
+		m.MAE += math.Abs(o.err)
+		if o.hit {
+			hits++
+		}
+	}
+	n := float64(t.samples)
+	m.MSE, m.MAE, m.Accuracy = m.MSE/n, m.MAE/n, float64(hits)/n
+	return m
+}
+
+// counts returns the labelled, unmatched and expired counters.
+func (t *feedbackTracker) counts() (labelled, unmatched, expired int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.labelled, t.unmatched, t.expired
+}
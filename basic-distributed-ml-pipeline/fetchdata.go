@@ -0,0 +1,88 @@
+package distributed
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"gopherconAU/cli"
+	"gopherconAU/dataset"
+	"gopherconAU/logging"
+)
+
+// runFetchData implements the "fetch-data" command: it downloads the demo
+// datasets every example runs on into a data directory, checking each
+// against its SHA-256 digest. Files already present and intact are kept.
+func runFetchData(args []string) {
+	fs := flag.NewFlagSet("fetch-data", flag.ExitOnError)
+	dir := fs.String("dir", "data", "directory the datasets are written to")
+	baseURL := fs.String("base-url", dataset.DefaultBaseURL, "URL the dataset files are downloaded from, such as a mirror")
+	force := fs.Bool("force", false, "download again even if an intact copy is present")
+	list := fs.Bool("list", false, "list the datasets instead of downloading them")
+	timeout := fs.Duration("timeout", 5*time.Minute, "give up on a download after this long")
+	var logOptions logging.Options
+	logOptions.RegisterFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: fetch-data [flags] [dataset...]")
+		fs.PrintDefaults()
+	}
+	cli.Parse(fs, args)
+	configureLogging(logOptions)
+	defer logger.Close()
+
+	if *list {
+		for _, demo := range dataset.Demos {
+			fmt.Printf("%-8s %-24s %s; used by %s\n", demo.Name, demo.File, demo.Description, demo.UsedBy)
+		}
+		return
+	}
+
+	demos := dataset.Demos
+	if fs.NArg() > 0 {
+		demos = nil
+		for _, name := range fs.Args() {
+			demo, err := dataset.FindDemo(name)
+			if err != nil {
+				logger.Error("%v", err)
+				os.Exit(2)
+			}
+			demos = append(demos, demo)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	client := &http.Client{Timeout: *timeout}
+	failed := 0
+	for _, demo := range demos {
+		log := logger.With("dataset", demo.Name)
+		path := filepath.Join(*dir, demo.File)
+		if !*force {
+			if ok, err := demo.Verify(path); ok {
+				log.Info("%s is already present", path)
+				continue
+			} else if err == nil {
+				log.Warn("%s does not match its checksum; downloading it again", path)
+			}
+		}
+
+		start := time.Now()
+		if _, err := demo.Fetch(ctx, client, *baseURL, *dir); err != nil {
+			log.Error("Failed to fetch %s: %v", demo.Name, err)
+			failed++
+			continue
+		}
+		log.With("duration_ms", logging.Milliseconds(time.Since(start))).Info("Fetched %s to %s", demo.Name, path)
+	}
+	if failed > 0 {
+		logger.Error("%d of %d datasets could not be fetched", failed, len(demos))
+		os.Exit(1)
+	}
+	logger.Info("Run the examples with -data %s/<file>", *dir)
+}
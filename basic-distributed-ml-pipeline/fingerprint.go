@@ -0,0 +1,156 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopherconAU/basic-distributed-ml-pipeline/predictionapi"
+	"gopherconAU/blobstore"
+	"gopherconAU/dataset"
+)
+
+// DatasetFingerprint identifies the exact data a model was trained on. The
+// content hash changes with any edit to the file; the schema hash only when
+// the columns change, which is what makes a model unusable.
+type DatasetFingerprint = predictionapi.DatasetFingerprint
+
+// fingerprintDataset hashes the file contents and its header.
+func fingerprintDataset(path string, rows int, options dataset.Options) (DatasetFingerprint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return DatasetFingerprint{}, err
+	}
+	defer file.Close()
+
+	content := sha256.New()
+	if _, err := io.Copy(content, file); err != nil {
+		return DatasetFingerprint{}, err
+	}
+
+	header, err := dataset.ReadHeader(path, options)
+	if err != nil {
+		return DatasetFingerprint{}, err
+	}
+
+	return DatasetFingerprint{
+		Path:        path,
+		ContentHash: hex.EncodeToString(content.Sum(nil)),
+		SchemaHash:  schemaHash(header),
+		Rows:        rows,
+	}, nil
+}
+
+// fingerprintFiles fingerprints a dataset given as a location that expanded
+// to several files. A single file is fingerprinted as before; for several,
+// the content hash covers every file's hash in order.
+func fingerprintFiles(location string, paths []string, rows int, options dataset.Options) (DatasetFingerprint, error) {
+	if len(paths) == 1 {
+		return fingerprintDataset(paths[0], rows, options)
+	}
+
+	content := sha256.New()
+	var first DatasetFingerprint
+	for i, path := range paths {
+		fingerprint, err := fingerprintDataset(path, 0, options)
+		if err != nil {
+			return DatasetFingerprint{}, err
+		}
+		if i == 0 {
+			first = fingerprint
+		} else if fingerprint.SchemaHash != first.SchemaHash {
+			return DatasetFingerprint{}, fmt.Errorf("%s has different columns than %s", path, paths[0])
+		}
+		fmt.Fprintln(content, fingerprint.ContentHash)
+	}
+
+	return DatasetFingerprint{
+		Path:        location,
+		ContentHash: hex.EncodeToString(content.Sum(nil)),
+		SchemaHash:  first.SchemaHash,
+		Rows:        rows,
+	}, nil
+}
+
+func schemaHash(columns []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(columns, "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
+
+// linearKind names the linear models of this program in their artifacts,
+// which the serve command tells apart from the logistic regression and
+// k-means models of the other programs.
+const linearKind = "linear"
+
+// ModelArtifact is a trained linear model as written to disk.
+type ModelArtifact struct {
+	// Kind is linearKind; artifacts from before kinds have none.
+	Kind    string             `json:"kind,omitempty"`
+	Weights []float64          `json:"weights"`
+	Bias    float64            `json:"bias"`
+	Scaler  *Scaler            `json:"scaler,omitempty"`
+	Dataset DatasetFingerprint `json:"dataset"`
+	// Features are the feature columns in weight order.
+	Features  []string  `json:"features,omitempty"`
+	TestMSE   float64   `json:"test_mse"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RunRecord is the experiment record of one training run.
+type RunRecord struct {
+	StartedAt    time.Time          `json:"started_at"`
+	Dataset      DatasetFingerprint `json:"dataset"`
+	Config       TrainConfig        `json:"config"`
+	EpochMSE     []float64          `json:"epoch_mse"`
+	TestMSE      float64            `json:"test_mse"`
+	TrainingTime time.Duration      `json:"training_time_ns"`
+	Updates      int64              `json:"updates"`
+	// MeanStaleness and MaxStaleness measure how out of date the weights
+	// behind the average and the worst gradient were, in updates.
+	MeanStaleness float64 `json:"mean_staleness"`
+	MaxStaleness  int64   `json:"max_staleness"`
+	// EvalTrajectory is the progressive test-set evaluation, if enabled.
+	EvalTrajectory []EvalPoint `json:"eval_trajectory,omitempty"`
+	// Resources is the resource usage after every completed epoch.
+	Resources []ResourceUsage `json:"resources,omitempty"`
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// putArtifact stores the artifact as JSON under key in a model registry.
+func putArtifact(ctx context.Context, store blobstore.Store, key string, artifact ModelArtifact) error {
+	data, err := json.MarshalIndent(artifact, "", "  ")
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, key, bytes.NewReader(append(data, '\n')))
+}
+
+// getArtifact reads an artifact written by putArtifact. A missing key is
+// reported as blobstore.ErrNotFound.
+func getArtifact(ctx context.Context, store blobstore.Store, key string) (*ModelArtifact, error) {
+	r, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var artifact ModelArtifact
+	if err := json.NewDecoder(r).Decode(&artifact); err != nil {
+		return nil, fmt.Errorf("decoding %s: %v", key, err)
+	}
+	return &artifact, nil
+}
@@ -0,0 +1,100 @@
+package distributed
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"gopherconAU/dataset"
+)
+
+// makeFolds assigns every row a cross-validation fold, keyed by row ID. Rows
+// with a group keep their group together; otherwise folds are stratified by
+// label. The same seed always produces the same folds.
+func makeFolds(data []DataPoint, k int, seed int64) (map[string]int, error) {
+	rng := rand.New(rand.NewSource(seed))
+	var assign []int
+	var err error
+	if hasGroups(data) {
+		assign, err = dataset.GroupKFold(groupKeys(data), k, rng)
+	} else {
+		assign, err = dataset.StratifiedKFold(labelStrata(data, k), k, rng)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	folds := make(map[string]int, len(data))
+	for i, dp := range data {
+		folds[dp.ID] = assign[i]
+	}
+	return folds, nil
+}
+
+// labelStrata returns a stratum per row: the label itself when it takes few
+// distinct values, as wine quality does, and otherwise its quantile bin.
+func labelStrata(data []DataPoint, k int) []string {
+	const maxClasses = 20
+	strata := make([]string, len(data))
+	distinct := make(map[float64]bool)
+	for i, dp := range data {
+		distinct[dp.Label] = true
+		strata[i] = strconv.FormatFloat(dp.Label, 'g', -1, 64)
+	}
+	if len(distinct) <= maxClasses {
+		return strata
+	}
+
+	// Bins of about k rows each, so every fold gets one row per bin.
+	order := make([]int, len(data))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool {
+		return data[order[a]].Label < data[order[b]].Label
+	})
+	for rank, i := range order {
+		strata[i] = strconv.Itoa(rank / k)
+	}
+	return strata
+}
+
+// foldsFor returns the fold of every row in data, checking that the
+// assignment covers them all and leaves no fold empty.
+func foldsFor(data []DataPoint, folds map[string]int) ([]int, int, error) {
+	assign := make([]int, len(data))
+	count := 0
+	for i, dp := range data {
+		fold, ok := folds[dp.ID]
+		if !ok {
+			return nil, 0, fmt.Errorf("no fold assigned to row %q", dp.ID)
+		}
+		assign[i] = fold
+		count = max(count, fold+1)
+	}
+
+	sizes := make([]int, count)
+	for _, fold := range assign {
+		sizes[fold]++
+	}
+	for fold, size := range sizes {
+		if size == 0 {
+			return nil, 0, fmt.Errorf("fold %d has no rows", fold)
+		}
+	}
+	if count < 2 {
+		return nil, 0, fmt.Errorf("need at least 2 folds, got %d", count)
+	}
+	return assign, count, nil
+}
+
+// exportFolds writes the fold of every row, in dataset order.
+func exportFolds(path string, data []DataPoint, folds map[string]int) error {
+	ids := make([]string, len(data))
+	assign := make([]int, len(data))
+	for i, dp := range data {
+		ids[i], assign[i] = dp.ID, folds[dp.ID]
+	}
+	return dataset.WriteFolds(path, ids, assign)
+}
@@ -0,0 +1,148 @@
+package distributed
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// GossipConfig controls the decentralized training mode, where every worker
+// owns a local model and periodically averages it with randomly chosen peers
+// instead of writing into one shared model.
+type GossipConfig struct {
+	Interval time.Duration
+	Fanout   int
+	Seed     int64 // seeds the choice of peers
+}
+
+// gossipNetwork connects the local models of all workers. There is no master:
+// each worker independently pushes and pulls weights to Fanout random peers
+// every Interval.
+type gossipNetwork struct {
+	models    []*Model
+	config    GossipConfig
+	rngMu     sync.Mutex
+	rng       *rand.Rand
+	exchanges int64
+}
+
+func newGossipNetwork(models []*Model, config GossipConfig) *gossipNetwork {
+	if config.Fanout > len(models)-1 {
+		config.Fanout = len(models) - 1
+	}
+	return &gossipNetwork{
+		models: models,
+		config: config,
+		rng:    rand.New(rand.NewSource(config.Seed)),
+	}
+}
+
+// run gossips on behalf of worker id until stop is closed.
+func (g *gossipNetwork) run(id int, stop <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	if g.config.Fanout <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(g.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for _, peer := range g.pickPeers(id) {
+				g.exchange(id, peer)
+			}
+		}
+	}
+}
+
+func (g *gossipNetwork) pickPeers(id int) []int {
+	g.rngMu.Lock()
+	defer g.rngMu.Unlock()
+
+	candidates := make([]int, 0, len(g.models)-1)
+	for i := range g.models {
+		if i != id {
+			candidates = append(candidates, i)
+		}
+	}
+	g.rng.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	return candidates[:g.config.Fanout]
+}
+
+// exchange replaces the weights of both workers with their pairwise average.
+// Locks are always taken in worker order so concurrent exchanges cannot
+// deadlock.
+func (g *gossipNetwork) exchange(a, b int) {
+	first, second := g.models[a], g.models[b]
+	if a > b {
+		first, second = second, first
+	}
+	first.mu.Lock()
+	defer first.mu.Unlock()
+	second.mu.Lock()
+	defer second.mu.Unlock()
+
+	for j := range first.Weights {
+		avg := (first.Weights[j] + second.Weights[j]) / 2
+		first.Weights[j] = avg
+		second.Weights[j] = avg
+	}
+	avgBias := (first.Bias + second.Bias) / 2
+	first.Bias = avgBias
+	second.Bias = avgBias
+
+	atomic.AddInt64(&g.exchanges, 1)
+}
+
+// consensus averages all local models into a single model for evaluation.
+func (g *gossipNetwork) consensus() *Model {
+	featureCount := len(g.models[0].Weights)
+	result := &Model{
+		Weights: make([]float64, featureCount),
+		Metrics: make(map[int]float64),
+	}
+
+	for _, m := range g.models {
+		m.mu.Lock()
+		for j, w := range m.Weights {
+			result.Weights[j] += w / float64(len(g.models))
+		}
+		result.Bias += m.Bias / float64(len(g.models))
+		result.Updates += m.Updates
+		m.mu.Unlock()
+	}
+
+	// Per-epoch MSE is the mean over the workers' local models.
+	for _, m := range g.models {
+		m.MetricsMu.Lock()
+		for epoch, mse := range m.Metrics {
+			result.Metrics[epoch] += mse / float64(len(g.models))
+		}
+		m.MetricsMu.Unlock()
+	}
+	return result
+}
+
+// disagreement is the largest Euclidean distance between a local model and the
+// consensus, a direct measure of how far gossip is from agreement.
+func (g *gossipNetwork) disagreement(consensus *Model) float64 {
+	maxDist := 0.0
+	for _, m := range g.models {
+		m.mu.Lock()
+		dist := math.Pow(m.Bias-consensus.Bias, 2)
+		for j, w := range m.Weights {
+			dist += math.Pow(w-consensus.Weights[j], 2)
+		}
+		m.mu.Unlock()
+		maxDist = math.Max(maxDist, math.Sqrt(dist))
+	}
+	return maxDist
+}
@@ -0,0 +1,248 @@
+package distributed
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"gopherconAU/basic-distributed-ml-pipeline/trainerpb"
+)
+
+// trainingMetrics tracks the progress of a training run for scraping over
+// HTTP while it runs. A nil *trainingMetrics records nothing, so workers can
+// report to it unconditionally.
+type trainingMetrics struct {
+	mu        sync.Mutex
+	start     time.Time
+	updates   int64
+	workers   []workerProgress
+	epochMSE  map[int]float64 // mean of the workers' MSE per epoch
+	epochRuns map[int]int     // workers that reported each epoch
+	evaluator *progressiveEvaluator
+
+	// Subscribers to the live event stream, the epoch events so far to
+	// replay to new ones, and the final event once the run is done.
+	subscribers map[*metricSubscriber]bool
+	history     []*trainerpb.MetricEvent
+	done        *trainerpb.MetricEvent
+}
+
+// metricSubscriber receives events until events is closed. Events that do
+// not fit its buffer are dropped rather than slowing training down.
+type metricSubscriber struct {
+	events  chan *trainerpb.MetricEvent
+	batches bool
+	dropped int
+}
+
+// workerProgress is what one worker has reported so far.
+type workerProgress struct {
+	epochs  int     // epochs completed
+	batches int64   // batches trained on
+	pending int     // batches left in the current epoch
+	mse     float64 // MSE of the last completed epoch
+}
+
+func newTrainingMetrics() *trainingMetrics {
+	return &trainingMetrics{}
+}
+
+// begin resets the metrics for a run of workers starting now. evaluator, if
+// not nil, has its snapshot queue reported too.
+func (m *trainingMetrics) begin(workers int, evaluator *progressiveEvaluator) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.start = time.Now()
+	m.updates = 0
+	m.workers = make([]workerProgress, workers)
+	m.epochMSE = make(map[int]float64)
+	m.epochRuns = make(map[int]int)
+	m.evaluator = evaluator
+	m.history, m.done = nil, nil
+}
+
+// startEpoch records that worker has batches to train on this epoch.
+func (m *trainingMetrics) startEpoch(worker, batches int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if worker < len(m.workers) {
+		m.workers[worker].pending = batches
+	}
+}
+
+// batchDone records one applied batch of worker, with its MSE.
+func (m *trainingMetrics) batchDone(worker int, mse float64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.updates++
+	event := &trainerpb.MetricEvent{Kind: trainerpb.MetricEvent_BATCH, WorkerId: int32(worker), Mse: mse, Updates: m.updates}
+	if worker < len(m.workers) {
+		m.workers[worker].batches++
+		m.workers[worker].pending = max(m.workers[worker].pending-1, 0)
+		event.Epoch, event.WorkerBatches = int32(m.workers[worker].epochs), m.workers[worker].batches
+	}
+	m.publish(event)
+}
+
+// epochDone records worker's MSE over epoch.
+func (m *trainingMetrics) epochDone(worker, epoch int, mse float64) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if worker < len(m.workers) {
+		m.workers[worker].epochs = epoch + 1
+		m.workers[worker].mse = mse
+		m.workers[worker].pending = 0
+	}
+	n := m.epochRuns[epoch]
+	m.epochMSE[epoch] = (m.epochMSE[epoch]*float64(n) + mse) / float64(n+1)
+	m.epochRuns[epoch] = n + 1
+
+	event := &trainerpb.MetricEvent{
+		Kind:         trainerpb.MetricEvent_EPOCH,
+		WorkerId:     int32(worker),
+		Epoch:        int32(epoch),
+		Mse:          mse,
+		Updates:      m.updates,
+		EpochMeanMse: m.epochMSE[epoch],
+	}
+	if worker < len(m.workers) {
+		event.WorkerBatches = m.workers[worker].batches
+	}
+	m.history = append(m.history, event)
+	m.publish(event)
+}
+
+// finish sends the final event, with the run's status, and ends every
+// subscription.
+func (m *trainingMetrics) finish(status string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.done = &trainerpb.MetricEvent{Kind: trainerpb.MetricEvent_DONE, Updates: m.updates, Status: status}
+	m.publish(m.done)
+	for subscriber := range m.subscribers {
+		m.unsubscribeLocked(subscriber)
+	}
+}
+
+// subscribe returns a subscriber that first receives the epochs completed
+// so far; it must be passed to unsubscribe once no longer read.
+func (m *trainingMetrics) subscribe(batches bool) *metricSubscriber {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subscriber := &metricSubscriber{
+		events:  make(chan *trainerpb.MetricEvent, len(m.history)+1024),
+		batches: batches,
+	}
+	for _, event := range m.history {
+		subscriber.events <- event
+	}
+	if m.done != nil {
+		subscriber.events <- m.done
+		close(subscriber.events)
+		return subscriber
+	}
+	if m.subscribers == nil {
+		m.subscribers = make(map[*metricSubscriber]bool)
+	}
+	m.subscribers[subscriber] = true
+	return subscriber
+}
+
+func (m *trainingMetrics) unsubscribe(subscriber *metricSubscriber) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unsubscribeLocked(subscriber)
+}
+
+func (m *trainingMetrics) unsubscribeLocked(subscriber *metricSubscriber) {
+	if !m.subscribers[subscriber] {
+		return
+	}
+	delete(m.subscribers, subscriber)
+	close(subscriber.events)
+	if subscriber.dropped > 0 {
+		logger.Warn("Metrics subscriber fell behind; %d events were dropped", subscriber.dropped)
+	}
+}
+
+// publish stamps event and sends it to every subscriber that wants it.
+func (m *trainingMetrics) publish(event *trainerpb.MetricEvent) {
+	event.TimeUnixNano = time.Now().UnixNano()
+	for subscriber := range m.subscribers {
+		if event.Kind == trainerpb.MetricEvent_BATCH && !subscriber.batches {
+			continue
+		}
+		select {
+		case subscriber.events <- event:
+		default:
+			subscriber.dropped++
+		}
+	}
+}
+
+// serveMetrics writes the metrics in the Prometheus text format.
+func (m *trainingMetrics) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "training_updates_total %d\n", m.updates)
+	if !m.start.IsZero() {
+		elapsed := time.Since(m.start).Seconds()
+		fmt.Fprintf(w, "training_elapsed_seconds %g\n", elapsed)
+		fmt.Fprintf(w, "training_updates_per_second %g\n", float64(m.updates)/elapsed)
+	}
+
+	epochs := make([]int, 0, len(m.epochMSE))
+	for epoch := range m.epochMSE {
+		epochs = append(epochs, epoch)
+	}
+	sort.Ints(epochs)
+	for _, epoch := range epochs {
+		fmt.Fprintf(w, "training_epoch_mse{epoch=\"%d\"} %g\n", epoch+1, m.epochMSE[epoch])
+	}
+
+	for i, p := range m.workers {
+		fmt.Fprintf(w, "training_worker_epochs_completed{worker=\"%d\"} %d\n", i, p.epochs)
+		fmt.Fprintf(w, "training_worker_batches_total{worker=\"%d\"} %d\n", i, p.batches)
+		fmt.Fprintf(w, "training_worker_queue_depth{worker=\"%d\"} %d\n", i, p.pending)
+		if p.epochs > 0 {
+			fmt.Fprintf(w, "training_worker_epoch_mse{worker=\"%d\"} %g\n", i, p.mse)
+		}
+	}
+	if m.evaluator != nil {
+		fmt.Fprintf(w, "training_eval_queue_depth %d\n", len(m.evaluator.snapshots))
+	}
+}
+
+// serveTrainingMetrics serves m on addr at /metrics until the returned
+// server is closed.
+func serveTrainingMetrics(addr string, m *trainingMetrics) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", m.serveMetrics)
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("Metrics server: %v", err)
+		}
+	}()
+	logger.Info("Serving training metrics on %s/metrics", addr)
+	return server
+}
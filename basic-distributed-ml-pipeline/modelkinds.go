@@ -0,0 +1,152 @@
+package distributed
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopherconAU/kmeans"
+	logreg "gopherconAU/linear-regression"
+)
+
+// predictor scores rows of raw features with one kind of model the serve
+// command can serve.
+type predictor interface {
+	// inputs is the number of features every row has.
+	inputs() int
+	// predict scores the rows, each of inputs features.
+	predict(rows [][]float64) []float64
+	// warmUpRows are rows typical of the training data, which every
+	// prediction path of the model is exercised by.
+	warmUpRows() [][]float64
+}
+
+// decodeModel decodes a published model of any kind the serve command
+// serves, as its kind field names it: the linear models of this program,
+// the logistic regressions of train-logreg and the k-means clusterings of
+// cluster. For the other kinds, the artifact carries only the kind and the
+// feature columns.
+func decodeModel(data []byte) (predictor, ModelArtifact, error) {
+	var header struct {
+		Kind string `json:"kind"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, ModelArtifact{}, fmt.Errorf("decoding: %v", err)
+	}
+	switch header.Kind {
+	case "", linearKind:
+		var artifact ModelArtifact
+		if err := json.Unmarshal(data, &artifact); err != nil {
+			return nil, ModelArtifact{}, fmt.Errorf("decoding: %v", err)
+		}
+		if err := artifact.validate(); err != nil {
+			return nil, ModelArtifact{}, err
+		}
+		artifact.Kind = linearKind
+		model := &Model{Weights: artifact.Weights, Bias: artifact.Bias, Scaler: artifact.Scaler}
+		return linearPredictor{model}, artifact, nil
+	case logreg.Kind:
+		model, err := logreg.Decode(data)
+		if err != nil {
+			return nil, ModelArtifact{}, err
+		}
+		// The polynomial terms and crosses are computed from named
+		// columns of a file, which requests do not have.
+		if model.Degree > 1 || model.Cross != nil {
+			return nil, ModelArtifact{}, fmt.Errorf("logistic regressions with polynomial features or feature crosses cannot be served")
+		}
+		return logisticPredictor{model}, ModelArtifact{Kind: logreg.Kind, Features: model.Features}, nil
+	case kmeans.Kind:
+		result, features, err := kmeans.Decode(data)
+		if err != nil {
+			return nil, ModelArtifact{}, err
+		}
+		return clusterPredictor{result}, ModelArtifact{Kind: kmeans.Kind, Features: features}, nil
+	}
+	return nil, ModelArtifact{}, fmt.Errorf("unknown model kind %q, want %s, %s or %s", header.Kind, linearKind, logreg.Kind, kmeans.Kind)
+}
+
+// linearPredictor predicts with a linear model, standardizing the rows
+// with its own scaler.
+type linearPredictor struct {
+	model *Model
+}
+
+func (p linearPredictor) inputs() int { return len(p.model.Weights) }
+
+func (p linearPredictor) predict(instances [][]float64) []float64 {
+	rows := make([]DataPoint, len(instances))
+	for i, features := range instances {
+		rows[i] = DataPoint{Features: features}
+	}
+	if p.model.Scaler != nil {
+		rows = p.model.Scaler.transform(rows)
+	}
+	features := make([][]float64, len(rows))
+	for i, row := range rows {
+		features[i] = row.Features
+	}
+	return p.model.PredictBatch(features)
+}
+
+// warmUpRows are the mean of the training features and one standard
+// deviation above it, which exercises every weight.
+func (p linearPredictor) warmUpRows() [][]float64 {
+	var means, stds []float64
+	if s := p.model.Scaler; s != nil {
+		means, stds = s.Means, s.Stds
+	}
+	return meanAndAbove(p.inputs(), means, stds)
+}
+
+// logisticPredictor predicts the class, 0 or 1, of every row with a
+// logistic regression, which standardizes the rows itself.
+type logisticPredictor struct {
+	model *logreg.LogisticRegression
+}
+
+func (p logisticPredictor) inputs() int { return len(p.model.Features) }
+
+func (p logisticPredictor) predict(rows [][]float64) []float64 {
+	return p.model.PredictBatch(rows)
+}
+
+func (p logisticPredictor) warmUpRows() [][]float64 {
+	return meanAndAbove(p.inputs(), p.model.Means, p.model.Stds)
+}
+
+// clusterPredictor predicts the cluster, numbered from 0, of every row as
+// the nearest centroid of a k-means clustering.
+type clusterPredictor struct {
+	result *kmeans.Result
+}
+
+func (p clusterPredictor) inputs() int { return len(p.result.Centroids[0]) }
+
+func (p clusterPredictor) predict(rows [][]float64) []float64 {
+	clusters := make([]float64, len(rows))
+	for i, row := range rows {
+		clusters[i] = float64(p.result.Predict(row))
+	}
+	return clusters
+}
+
+// warmUpRows are the centroids, which exercise every cluster.
+func (p clusterPredictor) warmUpRows() [][]float64 {
+	return p.result.Centroids
+}
+
+// meanAndAbove returns the rows of n features at the means and one standard
+// deviation above them, or at zero and one without standardization.
+func meanAndAbove(n int, means, stds []float64) [][]float64 {
+	mean := make([]float64, n)
+	above := make([]float64, n)
+	for j := range above {
+		above[j] = 1
+	}
+	if means != nil {
+		for j := range mean {
+			mean[j], above[j] = means[j], means[j]+stds[j]
+		}
+	}
+	return [][]float64{mean, above}
+}
@@ -0,0 +1,475 @@
+package distributed
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative trainerpb/trainer.proto
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"gopherconAU/basic-distributed-ml-pipeline/trainerpb"
+	"gopherconAU/convergence"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// maxMessageSize bounds gRPC messages, which must hold a worker's whole
+// shard when it joins.
+const maxMessageSize = 256 << 20
+
+// joinTimeout is how long a worker waits for its master to come up.
+const joinTimeout = time.Minute
+
+// trainerServer is the master of multi-process training. It owns the model,
+// hands every joining worker a shard of the training data and passes the
+// gradients workers push to a parameter server, as in-process workers do.
+type trainerServer struct {
+	trainerpb.UnimplementedTrainerServer
+
+	config TrainConfig
+	model  *Model
+	shards [][]DataPoint
+	params ParameterServer
+
+	// joinWindow is how long workers have to join; workerTimeout is how
+	// long a joined worker may go without a call in progress before it is
+	// dropped.
+	joinWindow    time.Duration
+	workerTimeout time.Duration
+
+	mu      sync.Mutex
+	workers []remoteWorker // by worker id, in joining order, then the unclaimed shards once joining closes
+	ended   int            // workers finished or dropped
+	done    chan struct{}  // closed once every worker has finished or been dropped
+}
+
+// remoteWorker is the master's view of a joined worker. Every call it makes
+// is its heartbeat: it is alive while a call is in progress, such as one
+// waiting for stragglers, and for workerTimeout after its last call ends.
+type remoteWorker struct {
+	calls    int // calls in progress
+	lastSeen time.Time
+	finished bool
+	dropped  bool
+}
+
+// snapshot pulls the weights worker should continue with.
+func (s *trainerServer) snapshot(worker int) *trainerpb.ModelSnapshot {
+	pulled := s.params.Pull(worker)
+	return &trainerpb.ModelSnapshot{
+		Weights: pulled.Weights,
+		Bias:    pulled.Bias,
+		Updates: pulled.Updates,
+	}
+}
+
+func (s *trainerServer) Join(ctx context.Context, req *trainerpb.JoinRequest) (*trainerpb.Assignment, error) {
+	s.mu.Lock()
+	if len(s.workers) == len(s.shards) {
+		s.mu.Unlock()
+		return nil, status.Errorf(codes.ResourceExhausted, "all %d shards are assigned", len(s.shards))
+	}
+	id := len(s.workers)
+	s.workers = append(s.workers, remoteWorker{lastSeen: time.Now()})
+	s.mu.Unlock()
+
+	shard := make([]*trainerpb.DataPoint, len(s.shards[id]))
+	for i, dp := range s.shards[id] {
+		shard[i] = &trainerpb.DataPoint{Features: dp.Features, Label: dp.Label, Weight: dp.Weight}
+	}
+	logger.With("worker_id", id, "hostname", req.Hostname).Info("Worker %d joined from %s with %d samples", id, req.Hostname, len(shard))
+	return &trainerpb.Assignment{
+		WorkerId:          int32(id),
+		Shard:             shard,
+		Epochs:            int32(s.config.Epochs),
+		BatchSize:         int32(s.config.BatchSize),
+		LearningRate:      s.config.LearningRate,
+		Model:             s.snapshot(id),
+		LossTolerance:     s.config.Convergence.LossTolerance,
+		GradientTolerance: s.config.Convergence.GradientTolerance,
+	}, nil
+}
+
+func (s *trainerServer) PushGradient(ctx context.Context, g *trainerpb.Gradient) (*trainerpb.ModelSnapshot, error) {
+	if len(g.Weights) != len(s.model.Weights) {
+		return nil, status.Errorf(codes.InvalidArgument, "gradient has %d weights, model has %d", len(g.Weights), len(s.model.Weights))
+	}
+	if g.BatchWeight <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "batch weight must be positive, got %v", g.BatchWeight)
+	}
+	release, err := s.call(g.WorkerId)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	gradient := batchGradient{weights: g.Weights, bias: g.Bias, weight: g.BatchWeight}
+	s.params.Push(int(g.WorkerId), gradient, g.Version, s.config.LearningRate)
+	s.config.Metrics.batchDone(int(g.WorkerId), g.Error/g.BatchWeight)
+	return s.snapshot(int(g.WorkerId)), nil
+}
+
+func (s *trainerServer) PullModel(ctx context.Context, req *trainerpb.PullRequest) (*trainerpb.ModelSnapshot, error) {
+	release, err := s.call(req.WorkerId)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return s.snapshot(int(req.WorkerId)), nil
+}
+
+// call checks that worker id has joined and not been dropped, and counts a
+// call of it in progress until the returned function is run.
+func (s *trainerServer) call(id int32) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 0 || int(id) >= len(s.workers) {
+		return nil, status.Errorf(codes.NotFound, "no worker %d has joined", id)
+	}
+	if s.workers[id].dropped {
+		return nil, status.Errorf(codes.FailedPrecondition, "worker %d was dropped after %v without a call", id, s.workerTimeout)
+	}
+	s.workers[id].calls++
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.workers[id].calls--
+		s.workers[id].lastSeen = time.Now()
+	}, nil
+}
+
+// end marks worker id as finished, or as dropped, once, and closes done when
+// it was the last worker training. It reports whether the worker was still
+// training.
+func (s *trainerServer) end(id int, dropped bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.workers[id].finished || s.workers[id].dropped {
+		return false
+	}
+	if dropped {
+		s.workers[id].dropped = true
+	} else {
+		s.workers[id].finished = true
+	}
+	s.ended++
+	if s.ended == len(s.shards) {
+		close(s.done)
+	}
+	return true
+}
+
+// closeJoiningAfter waits joinWindow and then drops the shards no worker has
+// joined for, so that neither the master nor the workers waiting for them at
+// a barrier wait forever. Later joins are turned away as for a full run.
+// When no worker has joined at all, it closes noneJoined instead.
+func (s *trainerServer) closeJoiningAfter(ctx context.Context, noneJoined chan struct{}) {
+	timer := time.NewTimer(s.joinWindow)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return
+	case <-s.done:
+		return
+	case <-timer.C:
+	}
+
+	s.mu.Lock()
+	joined := len(s.workers)
+	if joined == 0 {
+		s.mu.Unlock()
+		close(noneJoined)
+		return
+	}
+	for len(s.workers) < len(s.shards) {
+		s.workers = append(s.workers, remoteWorker{dropped: true})
+		s.ended++
+	}
+	if joined < len(s.shards) && s.ended == len(s.shards) {
+		close(s.done)
+	}
+	s.mu.Unlock()
+
+	for id := joined; id < len(s.shards); id++ {
+		s.params.Leave(id)
+		logger.With("worker_id", id).Error("No worker joined within %v for shard %d; dropping its %d samples", s.joinWindow, id, len(s.shards[id]))
+	}
+}
+
+// dropLapsed drops every worker that has gone more than workerTimeout
+// without a call, so that neither the master nor the workers waiting for it
+// at a barrier wait forever for a worker that died. Its shard is left
+// untrained from then on.
+func (s *trainerServer) dropLapsed(ctx context.Context) {
+	ticker := time.NewTicker(s.workerTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+		var lapsed []int
+		s.mu.Lock()
+		for id, w := range s.workers {
+			if !w.finished && !w.dropped && w.calls == 0 && time.Since(w.lastSeen) > s.workerTimeout {
+				lapsed = append(lapsed, id)
+			}
+		}
+		s.mu.Unlock()
+		for _, id := range lapsed {
+			if s.end(id, true) {
+				s.params.Leave(id)
+				logger.With("worker_id", id).Error("Worker %d made no call for %v; dropping it and its %d samples", id, s.workerTimeout, len(s.shards[id]))
+			}
+		}
+	}
+}
+
+func (s *trainerServer) ReportEpoch(ctx context.Context, report *trainerpb.EpochReport) (*trainerpb.Ack, error) {
+	release, err := s.call(report.WorkerId)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	s.mu.Lock()
+	finished := s.workers[report.WorkerId].finished
+	s.mu.Unlock()
+	if finished {
+		// A repeated last report, such as a retry, changes nothing.
+		return &trainerpb.Ack{}, nil
+	}
+	s.params.Advance(int(report.WorkerId))
+	s.model.recordEpoch(int(report.WorkerId), int(report.Epoch), report.Mse)
+	s.config.Metrics.epochDone(int(report.WorkerId), int(report.Epoch), report.Mse)
+	logger.With("worker_id", report.WorkerId, "epoch", report.Epoch+1, "mse", report.Mse).Info(
+		"Worker %d completed epoch %d with MSE: %.6f", report.WorkerId, report.Epoch+1, report.Mse)
+
+	if report.Last && s.end(int(report.WorkerId), false) {
+		s.params.Leave(int(report.WorkerId))
+	}
+	return &trainerpb.Ack{}, nil
+}
+
+// serveTraining trains like train, but with workers running as separate
+// processes that join over gRPC at listen. The shards of workers that have
+// not joined within joinWindow are left untrained, and it fails if none has.
+// It returns once every one of the workers has finished its last epoch or
+// been dropped for making no call for workerTimeout, or with the model so
+// far, also written to config.CheckpointPath, once ctx is cancelled. A
+// joinWindow of 0 waits for every worker to join, and a workerTimeout of 0
+// for every worker however long it is silent.
+func serveTraining(ctx context.Context, config TrainConfig, trainData []DataPoint, listen string, workers int, joinWindow, workerTimeout time.Duration) (*Model, time.Duration, error) {
+	if len(trainData) == 0 {
+		return nil, 0, fmt.Errorf("no training samples")
+	}
+	if workers < 1 || workers > len(trainData) {
+		return nil, 0, fmt.Errorf("cannot split %d samples between %d workers", len(trainData), workers)
+	}
+	model := &Model{
+		Weights:   make([]float64, len(trainData[0].Features)),
+		StartTime: time.Now(),
+		Metrics:   make(map[int]float64),
+	}
+	models := make([]*Model, workers)
+	for i := range models {
+		models[i] = model
+	}
+	server := &trainerServer{
+		config: config,
+		model:  model,
+		shards: make([][]DataPoint, workers),
+		params: newParameterServer(config, models),
+		done:   make(chan struct{}),
+
+		joinWindow:    joinWindow,
+		workerTimeout: workerTimeout,
+	}
+	chunkSize := len(trainData) / workers
+	for i := range server.shards {
+		end := (i + 1) * chunkSize
+		if i == workers-1 {
+			end = len(trainData)
+		}
+		server.shards[i] = trainData[i*chunkSize : end]
+		if config.Noise.Enabled() {
+			noise := config.Noise
+			noise.Seed += int64(i)
+			server.shards[i], _ = addNoise(noise, server.shards[i])
+		}
+	}
+
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, 0, err
+	}
+	grpcServer := grpc.NewServer(grpc.MaxSendMsgSize(maxMessageSize), grpc.MaxRecvMsgSize(maxMessageSize))
+	trainerpb.RegisterTrainerServer(grpcServer, server)
+	config.Metrics.begin(workers, nil)
+	go grpcServer.Serve(listener)
+	if workerTimeout > 0 {
+		go server.dropLapsed(ctx)
+	}
+
+	logger.Info("Training configuration:")
+	logger.Info("- Remote workers: %d", workers)
+	logger.Info("- Batch size: %d", config.BatchSize)
+	logger.Info("- Epochs: %d", config.Epochs)
+	logger.Info("- Learning rate: %f", config.LearningRate)
+	if config.Aggregation == "allreduce" {
+		logger.Info("- Aggregation: allreduce")
+	} else {
+		logger.Info("- Consistency: %s", config.Consistency)
+	}
+	if config.Convergence.Enabled() {
+		logger.Info("- Convergence: %s", config.Convergence)
+	}
+	if config.Penalty.Enabled() {
+		logger.Info("- Penalty: %s", config.Penalty)
+	}
+	logger.Info("Master listening on %s, waiting for workers", listener.Addr())
+
+	noneJoined := make(chan struct{})
+	if joinWindow > 0 {
+		go server.closeJoiningAfter(ctx, noneJoined)
+	}
+
+	trainingStartTime := time.Now()
+	select {
+	case <-noneJoined:
+		grpcServer.Stop()
+		return nil, 0, fmt.Errorf("no worker joined within %v", joinWindow)
+	case <-server.done:
+		grpcServer.GracefulStop()
+	case <-ctx.Done():
+		logger.Error("Interrupted; stopping with the model trained so far")
+		// Workers may be blocked waiting for stragglers, so their calls
+		// are cancelled rather than drained.
+		grpcServer.Stop()
+		if config.Checkpoints != nil {
+			checkpoint := Checkpoint{Epoch: -1, Reason: "interrupted", CreatedAt: time.Now()}
+			model.mu.Lock()
+			checkpoint.Weights = append([]float64(nil), model.Weights...)
+			checkpoint.Bias, checkpoint.Updates = model.Bias, model.Updates
+			model.mu.Unlock()
+			checkpoint.Metrics, _ = model.metricsUpTo(config.Epochs)
+			if err := config.Checkpoints.write(checkpoint); err != nil {
+				logger.Error("Failed to write checkpoint: %v", err)
+			} else {
+				logger.Info("Model so far checkpointed to %s", config.CheckpointPath)
+			}
+		}
+	}
+	trainingDuration := time.Since(trainingStartTime)
+	model.MeanStaleness, model.MaxStaleness = server.params.Staleness()
+	logger.Info("Gradient staleness: mean %.2f, max %d updates", model.MeanStaleness, model.MaxStaleness)
+	return model, trainingDuration, nil
+}
+
+// runRemoteWorker joins the master at addr and trains on the shard it is
+// given: every batch's gradient is computed against the latest model the
+// master returned and pushed back to it. Cancelling ctx ends the worker after
+// its current batch, reporting the partial epoch as its last.
+func runRemoteWorker(ctx context.Context, addr string, batchDelay time.Duration, cpuSets [][]int) error {
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMessageSize), grpc.MaxCallSendMsgSize(maxMessageSize)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	client := trainerpb.NewTrainerClient(conn)
+
+	hostname, _ := os.Hostname()
+	joinCtx, cancel := context.WithTimeout(ctx, joinTimeout)
+	assignment, err := client.Join(joinCtx, &trainerpb.JoinRequest{Hostname: hostname}, grpc.WaitForReady(true))
+	cancel()
+	if err != nil {
+		return fmt.Errorf("joining %s: %v", addr, err)
+	}
+	id := assignment.WorkerId
+	data := make([]DataPoint, len(assignment.Shard))
+	for i, dp := range assignment.Shard {
+		data[i] = DataPoint{Features: dp.Features, Label: dp.Label, Weight: dp.Weight}
+	}
+	model := &Model{Weights: assignment.Model.Weights, Bias: assignment.Model.Bias, Updates: assignment.Model.Updates}
+	batchSize := int(assignment.BatchSize)
+	logger.Info("Worker %d joined %s with %d samples", id, addr, len(data))
+	if len(cpuSets) > 0 {
+		cpus := cpuSets[int(id)%len(cpuSets)]
+		runtime.GOMAXPROCS(len(cpus))
+		pinWorker(int(id), cpuSets)
+	}
+
+	criteria := convergence.Criteria{LossTolerance: assignment.LossTolerance, GradientTolerance: assignment.GradientTolerance}
+	monitor := criteria.Monitor()
+
+	for epoch := 0; epoch < int(assignment.Epochs); epoch++ {
+		var errorSum, weightSum float64
+		for start := 0; start < len(data) && ctx.Err() == nil; start += batchSize {
+			batch := data[start:min(start+batchSize, len(data))]
+			g := computeGradient(model, batch)
+			if g.weight == 0 {
+				continue
+			}
+			snapshot, err := client.PushGradient(ctx, &trainerpb.Gradient{
+				WorkerId:    id,
+				Weights:     g.weights,
+				Bias:        g.bias,
+				BatchWeight: g.weight,
+				Version:     model.Updates,
+				Error:       g.error,
+			})
+			if err != nil {
+				if ctx.Err() != nil {
+					break
+				}
+				return fmt.Errorf("pushing gradient: %v", err)
+			}
+			model.Weights, model.Bias, model.Updates = snapshot.Weights, snapshot.Bias, snapshot.Updates
+			errorSum += g.error
+			weightSum += g.weight
+			time.Sleep(batchDelay)
+		}
+
+		var mse float64
+		if weightSum > 0 {
+			mse = errorSum / weightSum
+		}
+		gradientNorm := -1.0
+		if criteria.GradientTolerance > 0 {
+			gradientNorm = shardGradientNorm(model, data)
+		}
+		converged := monitor.Converged(mse, gradientNorm)
+		if ctx.Err() != nil {
+			// Tell the master to stop waiting for this worker, even though
+			// ctx no longer allows calls.
+			reportCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			_, err := client.ReportEpoch(reportCtx, &trainerpb.EpochReport{WorkerId: id, Epoch: int32(epoch), Mse: mse, Last: true})
+			cancel()
+			if err != nil {
+				return fmt.Errorf("reporting epoch: %v", err)
+			}
+			logger.With("worker_id", id, "epoch", epoch+1).Info("Worker %d interrupted in epoch %d", id, epoch+1)
+			return nil
+		}
+		last := epoch == int(assignment.Epochs)-1 || converged != ""
+		if _, err := client.ReportEpoch(ctx, &trainerpb.EpochReport{WorkerId: id, Epoch: int32(epoch), Mse: mse, Last: last}); err != nil {
+			return fmt.Errorf("reporting epoch: %v", err)
+		}
+		logger.With("worker_id", id, "epoch", epoch+1, "mse", mse).Info("Worker %d completed epoch %d with MSE: %.6f", id, epoch+1, mse)
+		if converged != "" {
+			logger.With("worker_id", id, "epoch", epoch+1).Info("Worker %d converged after epoch %d: %s", id, epoch+1, converged)
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package distributed
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RunSummary is the payload posted to webhooks when a run completes or fails.
+type RunSummary struct {
+	Job       string              `json:"job"`    // "train" or "retrain"
+	Status    string              `json:"status"` // "succeeded", "failed" or "interrupted"
+	StartedAt time.Time           `json:"started_at"`
+	Duration  time.Duration       `json:"duration_ns"`
+	TestMSE   float64             `json:"test_mse,omitempty"`
+	Updates   int64               `json:"updates,omitempty"`
+	Promoted  bool                `json:"promoted,omitempty"`
+	Dataset   *DatasetFingerprint `json:"dataset,omitempty"`
+	Error     string              `json:"error,omitempty"`
+}
+
+// webhookList collects repeated -webhook flags. URLs on hooks.slack.com get a
+// Slack message body; any other URL receives the RunSummary as JSON.
+type webhookList []string
+
+func (l *webhookList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *webhookList) Set(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid webhook URL %q", value)
+	}
+	*l = append(*l, value)
+	return nil
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// notifyWebhooks posts the summary to every hook. Delivery failures are
+// logged and never fail the run.
+func notifyWebhooks(hooks webhookList, summary RunSummary) {
+	for _, hook := range hooks {
+		var payload interface{} = summary
+		if isSlackWebhook(hook) {
+			payload = map[string]string{"text": slackText(summary)}
+		}
+
+		body, err := json.Marshal(payload)
+		if err != nil {
+			logger.Error("Failed to encode webhook payload: %v", err)
+			return
+		}
+		resp, err := webhookClient.Post(hook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			logger.Error("Webhook %s failed: %v", hook, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			logger.Error("Webhook %s returned %s", hook, resp.Status)
+			continue
+		}
+		logger.Debug("Webhook %s notified", hook)
+	}
+}
+
+func isSlackWebhook(hook string) bool {
+	u, err := url.Parse(hook)
+	return err == nil && u.Host == "hooks.slack.com"
+}
+
+func slackText(summary RunSummary) string {
+	if summary.Status == "failed" {
+		return fmt.Sprintf(":x: %s run failed after %v: %s",
+			summary.Job, summary.Duration.Round(time.Millisecond), summary.Error)
+	}
+	text := fmt.Sprintf(":white_check_mark: %s run finished in %v, test MSE %.6f",
+		summary.Job, summary.Duration.Round(time.Millisecond), summary.TestMSE)
+	if summary.Status == "interrupted" {
+		text = fmt.Sprintf(":warning: %s run interrupted after %v, test MSE %.6f",
+			summary.Job, summary.Duration.Round(time.Millisecond), summary.TestMSE)
+	}
+	if summary.Updates > 0 {
+		text += fmt.Sprintf(", %d updates", summary.Updates)
+	}
+	if summary.Promoted {
+		text += ", promoted to production"
+	}
+	return text
+}
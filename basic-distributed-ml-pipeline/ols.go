@@ -0,0 +1,138 @@
+package distributed
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// Coefficient is one fitted OLS term together with its inference statistics.
+type Coefficient struct {
+	Name     string
+	Estimate float64
+	StdError float64
+	TStat    float64
+	PValue   float64
+	CILow    float64
+	CIHigh   float64
+}
+
+// OLSResult is the closed-form least squares fit of the linear model.
+type OLSResult struct {
+	Coefficients []Coefficient // intercept first, then one per feature
+	Sigma        float64       // residual standard error
+	RSquared     float64
+	DoF          int
+}
+
+// fitOLS solves the normal equations for an intercept plus one weight per
+// feature and derives standard errors, t statistics, two-sided p-values and
+// confidence intervals at the given level (e.g. 0.95). With sample weights it
+// is weighted least squares: every row is scaled by the square root of its
+// weight, and rows of weight 0 do not count towards the degrees of freedom.
+func fitOLS(data []DataPoint, names []string, level float64) (*OLSResult, error) {
+	var weighted []DataPoint
+	for _, dp := range data {
+		if dp.Weight > 0 {
+			weighted = append(weighted, dp)
+		}
+	}
+	n := len(weighted)
+	p := len(data[0].Features) + 1
+	if n <= p {
+		return nil, fmt.Errorf("need more than %d samples of positive weight for %d coefficients, got %d", p, p, n)
+	}
+
+	X := mat.NewDense(n, p, nil)
+	y := mat.NewVecDense(n, nil)
+	sqrtWeights := make([]float64, n)
+	totalWeight := 0.0
+	for i, dp := range weighted {
+		scale := math.Sqrt(dp.Weight)
+		X.Set(i, 0, scale)
+		for j, f := range dp.Features {
+			X.Set(i, j+1, scale*f)
+		}
+		y.SetVec(i, scale*dp.Label)
+		sqrtWeights[i] = scale
+		totalWeight += dp.Weight
+	}
+
+	var xtx mat.Dense
+	xtx.Mul(X.T(), X)
+	var xtxInv mat.Dense
+	if err := xtxInv.Inverse(&xtx); err != nil {
+		return nil, fmt.Errorf("design matrix is singular: %v", err)
+	}
+
+	var xty mat.VecDense
+	xty.MulVec(X.T(), y)
+	var beta mat.VecDense
+	beta.MulVec(&xtxInv, &xty)
+
+	var fitted, residuals mat.VecDense
+	fitted.MulVec(X, &beta)
+	residuals.SubVec(y, &fitted)
+	rss := mat.Dot(&residuals, &residuals)
+
+	// y holds the labels scaled by the square roots of their weights.
+	meanY := 0.0
+	for i, scale := range sqrtWeights {
+		meanY += scale * y.AtVec(i) / totalWeight
+	}
+	tss := 0.0
+	for i, scale := range sqrtWeights {
+		tss += math.Pow(y.AtVec(i)-scale*meanY, 2)
+	}
+
+	dof := n - p
+	sigma2 := rss / float64(dof)
+	tDist := distuv.StudentsT{Mu: 0, Sigma: 1, Nu: float64(dof)}
+	critical := tDist.Quantile(1 - (1-level)/2)
+
+	result := &OLSResult{
+		Sigma:    math.Sqrt(sigma2),
+		RSquared: 1 - rss/tss,
+		DoF:      dof,
+	}
+	for j := 0; j < p; j++ {
+		name := "(intercept)"
+		if j > 0 {
+			name = fmt.Sprintf("x%d", j)
+			if j-1 < len(names) {
+				name = names[j-1]
+			}
+		}
+		estimate := beta.AtVec(j)
+		stdErr := math.Sqrt(sigma2 * xtxInv.At(j, j))
+		t := estimate / stdErr
+		result.Coefficients = append(result.Coefficients, Coefficient{
+			Name:     name,
+			Estimate: estimate,
+			StdError: stdErr,
+			TStat:    t,
+			PValue:   2 * tDist.Survival(math.Abs(t)),
+			CILow:    estimate - critical*stdErr,
+			CIHigh:   estimate + critical*stdErr,
+		})
+	}
+	return result, nil
+}
+
+// printOLS writes the coefficient table in the familiar regression-summary layout.
+func printOLS(result *OLSResult, level float64) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	ci := fmt.Sprintf("%.0f%% CI", level*100)
+	fmt.Fprintf(tw, "term\testimate\tstd.error\tt\tp-value\t%s low\t%s high\t\n", ci, ci)
+	for _, c := range result.Coefficients {
+		fmt.Fprintf(tw, "%s\t%.6f\t%.6f\t%.3f\t%.4g\t%.6f\t%.6f\t\n",
+			c.Name, c.Estimate, c.StdError, c.TStat, c.PValue, c.CILow, c.CIHigh)
+	}
+	tw.Flush()
+	fmt.Printf("Residual standard error: %.6f on %d degrees of freedom, R-squared: %.4f\n",
+		result.Sigma, result.DoF, result.RSquared)
+}
@@ -0,0 +1,95 @@
+package distributed
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Batch orderings a worker can walk its shard in each epoch.
+const (
+	// OrderSequential keeps the shard's order, as workers always did.
+	OrderSequential = "sequential"
+	// OrderRandom reshuffles the shard every epoch.
+	OrderRandom = "random"
+	// OrderEasyFirst sorts the shard by the current model's absolute
+	// residual, smallest first, so every epoch is a small curriculum.
+	OrderEasyFirst = "easy-first"
+	// OrderLossWeighted draws the epoch's samples with replacement, with
+	// probability proportional to their squared residual, and divides each
+	// drawn sample's weight by its odds of being drawn, so hard samples are
+	// seen more often without skewing what the weighted loss measures.
+	OrderLossWeighted = "loss-weighted"
+)
+
+var orderings = []string{OrderSequential, OrderRandom, OrderEasyFirst, OrderLossWeighted}
+
+func validOrdering(ordering string) bool {
+	for _, o := range orderings {
+		if o == ordering {
+			return true
+		}
+	}
+	return false
+}
+
+// epochData returns the samples of w's shard in the order w trains on them
+// in epoch. Residuals are taken against the weights the server hands out at
+// the start of the epoch. Random choices are seeded by the run's seed, worker
+// and epoch, so a run is reproducible up to the interleaving of the workers.
+func (w *Worker) epochData(epoch int) []DataPoint {
+	switch w.Ordering {
+	case OrderRandom, OrderEasyFirst, OrderLossWeighted:
+	default:
+		return w.Data
+	}
+	rng := rand.New(rand.NewSource(w.Seed + int64(epoch)<<16 + int64(w.ID)))
+	data := append([]DataPoint(nil), w.Data...)
+
+	if w.Ordering == OrderRandom {
+		rng.Shuffle(len(data), func(i, j int) {
+			data[i], data[j] = data[j], data[i]
+		})
+		return data
+	}
+
+	model := w.Server.Pull(w.ID)
+	residuals := make([]float64, len(data))
+	for i, dp := range data {
+		residuals[i] = math.Abs(model.predict(dp.Features) - dp.Label)
+	}
+
+	if w.Ordering == OrderEasyFirst {
+		order := make([]int, len(data))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return residuals[order[a]] < residuals[order[b]]
+		})
+		sorted := make([]DataPoint, len(data))
+		for i, j := range order {
+			sorted[i] = data[j]
+		}
+		return sorted
+	}
+
+	// A floor on every probability keeps well-fit samples in play and their
+	// importance weights bounded.
+	cumulative := make([]float64, len(data))
+	total := 0.0
+	for i, r := range residuals {
+		total += r*r + 1e-3
+		cumulative[i] = total
+	}
+	resampled := make([]DataPoint, len(data))
+	for k := range resampled {
+		i := sort.SearchFloat64s(cumulative, rng.Float64()*total)
+		i = min(i, len(data)-1)
+		p := (residuals[i]*residuals[i] + 1e-3) / total
+		dp := data[i]
+		dp.Weight /= p * float64(len(data))
+		resampled[k] = dp
+	}
+	return resampled
+}
@@ -0,0 +1,240 @@
+package distributed
+
+import (
+	"math"
+	"sync"
+
+	"gopherconAU/regularization"
+)
+
+// ParameterServer holds the weights that workers train together. A worker
+// pulls the weights, computes the gradient of one batch against them and
+// pushes it back; the server decides how far the weights one worker sees may
+// lag behind the progress of the others.
+type ParameterServer interface {
+	// Pull returns a copy of the weights worker should compute its next
+	// gradient against. Updates holds the version they were read at. Pull
+	// may block until slower workers catch up.
+	Pull(worker int) *Model
+	// Push applies a gradient computed against the weights of version.
+	Push(worker int, g batchGradient, version int64, learningRate float64)
+	// Advance marks the end of one of worker's epochs.
+	Advance(worker int)
+	// Leave removes a worker that stopped early so that no one waits for it.
+	Leave(worker int)
+	// Staleness reports how many updates other workers applied, on average
+	// and at most, between a gradient's pull and its push.
+	Staleness() (mean float64, max int64)
+}
+
+// boundedServer is a ParameterServer whose workers may be at most bound
+// epochs apart: 0 is synchronous training with a barrier after every epoch,
+// a negative bound lets every worker run free, as the shared model always
+// did, and anything in between is stale-synchronous parallel.
+type boundedServer struct {
+	models  []*Model // the model each worker trains; shared unless gossiping
+	bound   int
+	penalty regularization.Penalty
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	clocks []int // epochs completed per worker
+
+	staleSum   int64
+	staleMax   int64
+	staleCount int64
+}
+
+// newParameterServer returns the server for config's aggregation: an
+// allReduceServer for allreduce, otherwise a boundedServer applying every
+// gradient as it arrives under config's consistency model: sync, ssp with
+// its staleness bound, or async for anything else. models holds the model of
+// every worker. Either server applies config's penalty with every update.
+func newParameterServer(config TrainConfig, models []*Model) ParameterServer {
+	if config.Aggregation == "allreduce" {
+		return newAllReduceServer(models[0], len(models), config.Penalty)
+	}
+	s := &boundedServer{models: models, bound: -1, penalty: config.Penalty, clocks: make([]int, len(models))}
+	s.cond = sync.NewCond(&s.mu)
+	switch config.Consistency {
+	case "sync":
+		s.bound = 0
+	case "ssp":
+		s.bound = config.Staleness
+	}
+	return s
+}
+
+// slowest returns the fewest epochs any remaining worker has completed.
+func (s *boundedServer) slowest() int {
+	slowest := math.MaxInt
+	for _, clock := range s.clocks {
+		slowest = min(slowest, clock)
+	}
+	return slowest
+}
+
+func (s *boundedServer) Pull(worker int) *Model {
+	if s.bound >= 0 {
+		s.mu.Lock()
+		for s.clocks[worker]-s.slowest() > s.bound {
+			s.cond.Wait()
+		}
+		s.mu.Unlock()
+	}
+
+	m := s.models[worker]
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return &Model{
+		Weights: append([]float64(nil), m.Weights...),
+		Bias:    m.Bias,
+		Updates: m.Updates,
+	}
+}
+
+func (s *boundedServer) Push(worker int, g batchGradient, version int64, learningRate float64) {
+	previous := s.models[worker].applyGradient(g.weights, g.bias, g.weight, learningRate, s.penalty)
+
+	stale := previous - version
+	s.mu.Lock()
+	s.staleSum += stale
+	s.staleMax = max(s.staleMax, stale)
+	s.staleCount++
+	s.mu.Unlock()
+}
+
+func (s *boundedServer) Advance(worker int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clocks[worker]++
+	s.cond.Broadcast()
+}
+
+func (s *boundedServer) Leave(worker int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clocks[worker] = math.MaxInt
+	s.cond.Broadcast()
+}
+
+func (s *boundedServer) Staleness() (float64, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.staleCount == 0 {
+		return 0, 0
+	}
+	return float64(s.staleSum) / float64(s.staleCount), s.staleMax
+}
+
+// allReduceServer trains in rounds: every worker still training computes the
+// gradient of one batch against the same weights, and once the last of them
+// pushes, the gradients are averaged by sample weight and applied in a single
+// update. Unlike the hogwild servers above, the result does not depend on the
+// order in which gradients arrive, down to the last bit: each is held in its
+// worker's slot and they are summed in worker order. No gradient is ever
+// stale.
+type allReduceServer struct {
+	model   *Model
+	penalty regularization.Penalty
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	active    []bool          // workers still taking part in rounds
+	pushed    []bool          // workers whose gradient is in the current round
+	gradients []batchGradient // the gradient each worker pushed this round
+	round     int64           // rounds applied so far
+	// lastRate is the learning rate of the latest push, used to apply a
+	// round that completes when a worker leaves.
+	lastRate float64
+}
+
+func newAllReduceServer(model *Model, workers int, penalty regularization.Penalty) *allReduceServer {
+	s := &allReduceServer{
+		model:     model,
+		penalty:   penalty,
+		active:    make([]bool, workers),
+		pushed:    make([]bool, workers),
+		gradients: make([]batchGradient, workers),
+	}
+	for i := range s.active {
+		s.active[i] = true
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *allReduceServer) Pull(worker int) *Model {
+	s.model.mu.Lock()
+	defer s.model.mu.Unlock()
+	return &Model{
+		Weights: append([]float64(nil), s.model.Weights...),
+		Bias:    s.model.Bias,
+		Updates: s.model.Updates,
+	}
+}
+
+// Push adds the gradient to the current round and blocks until the round is
+// applied, so the worker's next Pull sees the averaged update.
+func (s *allReduceServer) Push(worker int, g batchGradient, version int64, learningRate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gradients[worker] = g
+	s.pushed[worker] = true
+	s.lastRate = learningRate
+
+	round := s.round
+	s.reduce()
+	for s.round == round {
+		s.cond.Wait()
+	}
+}
+
+// reduce applies the round once every active worker has pushed. It is called
+// with s.mu held.
+func (s *allReduceServer) reduce() {
+	weights := make([]float64, len(s.model.Weights))
+	bias, weight := 0.0, 0.0
+	for i := range s.active {
+		if s.active[i] && !s.pushed[i] {
+			return
+		}
+		if !s.pushed[i] {
+			continue
+		}
+		for j, w := range s.gradients[i].weights {
+			weights[j] += w
+		}
+		bias += s.gradients[i].bias
+		weight += s.gradients[i].weight
+	}
+	if weight == 0 {
+		return
+	}
+
+	s.model.applyGradient(weights, bias, weight, s.lastRate, s.penalty)
+	for i := range s.pushed {
+		s.pushed[i] = false
+		s.gradients[i] = batchGradient{}
+	}
+	s.round++
+	s.cond.Broadcast()
+}
+
+// Advance does nothing: rounds already keep the workers in step.
+func (s *allReduceServer) Advance(worker int) {}
+
+// Leave stops waiting for worker, completing the round if it was the last one
+// outstanding.
+func (s *allReduceServer) Leave(worker int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active[worker] = false
+	s.reduce()
+}
+
+// Staleness is always zero: every gradient of a round is computed against
+// the weights the round updates.
+func (s *allReduceServer) Staleness() (float64, int64) {
+	return 0, 0
+}
@@ -0,0 +1,180 @@
+package distributed
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopherconAU/cli"
+	"gopherconAU/dataset"
+	"gopherconAU/logging"
+)
+
+// artifact returns the model's current weights, with the scaler it was
+// trained with, ready to be written to disk.
+func (m *Model) artifact() ModelArtifact {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return ModelArtifact{
+		Kind:      linearKind,
+		Weights:   append([]float64(nil), m.Weights...),
+		Bias:      m.Bias,
+		Scaler:    m.Scaler,
+		Dataset:   m.Dataset,
+		Features:  m.Features,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Save writes the model, including the means and standard deviations that
+// standardized its training data and the fingerprint of that data, to path
+// as JSON.
+func (m *Model) Save(path string) error {
+	return writeJSON(path, m.artifact())
+}
+
+// Load replaces the model's weights and scaler with those saved at path by
+// Save, -save-model or the watch and schedule commands.
+func (m *Model) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var artifact ModelArtifact
+	if err := json.Unmarshal(data, &artifact); err != nil {
+		return fmt.Errorf("decoding %s: %v", path, err)
+	}
+	if err := artifact.validate(); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Weights, m.Bias, m.Scaler = artifact.Weights, artifact.Bias, artifact.Scaler
+	m.Dataset, m.Features = artifact.Dataset, artifact.Features
+	return nil
+}
+
+// validate checks that the artifact holds a usable model.
+func (a ModelArtifact) validate() error {
+	if len(a.Weights) == 0 {
+		return fmt.Errorf("no model weights")
+	}
+	if s := a.Scaler; s != nil && (len(s.Means) != len(a.Weights) || len(s.Stds) != len(a.Weights)) {
+		return fmt.Errorf("scaler has %d features, the weights %d", len(s.Means), len(a.Weights))
+	}
+	return nil
+}
+
+// checkSchema checks that rows with the given header, from which the mapping
+// took the given feature columns, are laid out as the model's training data.
+// A header with the label column must have the schema hash of the training
+// data; with or without it, the feature columns must be the training ones in
+// the same order, which also catches a change of label column.
+func (a ModelArtifact) checkSchema(header, features []string, label string) error {
+	if a.Dataset.SchemaHash == "" {
+		return fmt.Errorf("the model records no dataset schema to check the columns against")
+	}
+	if slices.ContainsFunc(header, func(column string) bool { return strings.TrimSpace(column) == label }) {
+		if hash := schemaHash(header); hash != a.Dataset.SchemaHash {
+			return fmt.Errorf("schema hash %.12s differs from %.12s of the training data %s", hash, a.Dataset.SchemaHash, a.Dataset.Path)
+		}
+	} else if a.Features == nil {
+		return fmt.Errorf("the model records no feature columns to check rows without the label column %q against", label)
+	}
+	if a.Features != nil && !slices.Equal(features, a.Features) {
+		return fmt.Errorf("feature columns %s differ from %s of the training data", strings.Join(features, ", "), strings.Join(a.Features, ", "))
+	}
+	return nil
+}
+
+// runPredict implements the "predict" command: it loads a saved model and
+// prints its prediction for every row of a CSV, standardized with the
+// model's own scaler. The label column may be left out of the file. Rows
+// whose columns differ from the model's training data are refused unless
+// -allow-schema-mismatch is set.
+func runPredict(args []string) {
+	fs := flag.NewFlagSet("predict", flag.ExitOnError)
+	modelPath := fs.String("model", "model.json", "model saved with -save-model")
+	dataPath := fs.String("data", "winequality-dataset.csv", "CSV or .xlsx file of rows to score")
+	out := fs.String("out", "", "write the predictions to this CSV file instead of stdout")
+	allowSchemaMismatch := fs.Bool("allow-schema-mismatch", false, "score rows whose columns differ from the model's training data, with a warning, instead of refusing them")
+	mapping := defaultMapping()
+	mapping.RegisterFlags(fs)
+	var parseOptions dataset.Options
+	parseOptions.RegisterFlags(fs)
+	var logOptions logging.Options
+	logOptions.RegisterFlags(fs)
+	cli.Parse(fs, args)
+	configureLogging(logOptions)
+	defer logger.Close()
+
+	var model Model
+	if err := model.Load(*modelPath); err != nil {
+		logger.Error("Failed to load model: %v", err)
+		os.Exit(1)
+	}
+	if model.Scaler == nil {
+		logger.Warn("%s has no scaler; scoring the rows unstandardized", *modelPath)
+	}
+
+	loaded, err := dataset.CSVLoader{Path: *dataPath, Mapping: mapping, Options: parseOptions, Unlabeled: true}.Load()
+	if err != nil {
+		logger.Error("Failed to load rows: %v", err)
+		os.Exit(1)
+	}
+	if summary := loaded.Summary(); summary != "" {
+		logger.Warn("%s: %s", *dataPath, summary)
+	}
+	if len(loaded.FeatureNames) != len(model.Weights) {
+		logger.Error("%s has %d feature columns, the model was trained on %d", *dataPath, len(loaded.FeatureNames), len(model.Weights))
+		os.Exit(1)
+	}
+	header, err := dataset.ReadHeader(*dataPath, parseOptions)
+	if err != nil {
+		logger.Error("Failed to read header: %v", err)
+		os.Exit(1)
+	}
+	if err := model.artifact().checkSchema(header, loaded.FeatureNames, mapping.Label); err != nil {
+		if !*allowSchemaMismatch {
+			logger.Error("%s does not match %s: %v", *dataPath, *modelPath, err)
+			os.Exit(1)
+		}
+		logger.Warn("%s does not match %s: %v; scoring it anyway", *dataPath, *modelPath, err)
+	}
+
+	rows := make([]DataPoint, loaded.Len())
+	for i, features := range loaded.X {
+		rows[i] = DataPoint{Features: features, ID: strconv.Itoa(i)}
+		if loaded.IDs != nil {
+			rows[i].ID = loaded.IDs[i]
+		}
+	}
+	if model.Scaler != nil {
+		rows = model.Scaler.transform(rows)
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		if w, err = os.Create(*out); err != nil {
+			logger.Error("Failed to create %s: %v", *out, err)
+			os.Exit(1)
+		}
+		defer w.Close()
+	}
+	features := make([][]float64, len(rows))
+	for i, row := range rows {
+		features[i] = row.Features
+	}
+	predictions := model.PredictBatch(features)
+	fmt.Fprintln(w, "id,prediction")
+	for i, row := range rows {
+		fmt.Fprintf(w, "%s,%g\n", row.ID, predictions[i])
+	}
+	logger.Info("Scored %d rows with %s", len(rows), *modelPath)
+}
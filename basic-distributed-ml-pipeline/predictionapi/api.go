@@ -0,0 +1,102 @@
+// Package predictionapi is the HTTP API of the serve command: the bodies
+// of its requests and responses, and a client for it. The types here are
+// the source of both the OpenAPI document in openapi.json and the client's
+// methods in client_gen.go, which go generate writes; edit the types or the
+// operations in internal/gen, never the generated files.
+package predictionapi
+
+//go:generate go run ./internal/gen
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// PredictRequest holds rows of raw, unstandardized features in the order
+// the model was trained on.
+type PredictRequest struct {
+	Instances [][]float64 `json:"instances"`
+}
+
+// PredictResponse holds one prediction per instance, in order.
+type PredictResponse struct {
+	RequestID   string    `json:"request_id"` // the X-Request-ID of the request, generated if it had none; feedback refers to it
+	Model       string    `json:"model"`
+	Version     string    `json:"version"` // registry key of the version that made the predictions
+	Predictions []float64 `json:"predictions"`
+}
+
+// ModelInfo describes a served model and the version it serves.
+type ModelInfo struct {
+	Name      string              `json:"name"`
+	Registry  string              `json:"registry"`
+	Version   string              `json:"version,omitempty"` // empty until a version loads
+	Kind      string              `json:"kind,omitempty"`    // linear, logistic or kmeans
+	Features  int                 `json:"features,omitempty"`
+	TestMSE   float64             `json:"test_mse,omitempty"`
+	Dataset   *DatasetFingerprint `json:"dataset,omitempty"`
+	CreatedAt *time.Time          `json:"created_at,omitempty"`
+	LoadedAt  *time.Time          `json:"loaded_at,omitempty"`
+	Online    *OnlineMetrics      `json:"online,omitempty"` // error on the latest labelled predictions, if feedback is accepted
+}
+
+// DatasetFingerprint identifies the exact data a model was trained on. The
+// content hash changes with any edit to the file; the schema hash only when
+// the columns change, which is what makes a model unusable.
+type DatasetFingerprint struct {
+	Path        string `json:"path"`
+	ContentHash string `json:"content_hash"`
+	SchemaHash  string `json:"schema_hash"`
+	Rows        int    `json:"rows"`
+}
+
+// FeedbackRequest carries the ground truth of an earlier prediction: one
+// label per instance, in the order the instances were sent.
+type FeedbackRequest struct {
+	RequestID string    `json:"request_id"`
+	Labels    []float64 `json:"labels"`
+}
+
+// FeedbackResponse reports the model's error once the feedback is counted.
+type FeedbackResponse struct {
+	Model   string        `json:"model"`
+	Version string        `json:"version"` // the version that made the prediction
+	Online  OnlineMetrics `json:"online"`
+}
+
+// OnlineMetrics summarize a model's latest labelled predictions.
+type OnlineMetrics struct {
+	Samples  int     `json:"samples"`
+	MSE      float64 `json:"mse"`
+	MAE      float64 `json:"mae"`
+	Accuracy float64 `json:"accuracy"` // share of predictions that round to their label
+}
+
+// ReloadResponse reports the version a model serves after a reload.
+type ReloadResponse struct {
+	Model    string `json:"model"`
+	Version  string `json:"version"`
+	Reloaded bool   `json:"reloaded"` // false if it already served the newest version
+}
+
+// Health reports that every model serves a version.
+type Health struct {
+	Status string            `json:"status"` // always "ok"; a server not ready answers 503
+	Models map[string]string `json:"models"` // the version each model serves
+}
+
+// Error is the body of every response other than 200. The client returns
+// it as the error of a failed call.
+type Error struct {
+	Message    string        `json:"error"`
+	StatusCode int           `json:"-"`
+	RetryAfter time.Duration `json:"-"` // from the Retry-After header of a 429
+}
+
+func (e *Error) Error() string {
+	if e.StatusCode == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
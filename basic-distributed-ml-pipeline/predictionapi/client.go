@@ -0,0 +1,88 @@
+package predictionapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls a prediction server. Its methods, one per operation of the
+// API, are in client_gen.go.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient returns a client of the server at baseURL, such as
+// http://localhost:8080, making its requests with httpClient, or
+// http.DefaultClient if it is nil.
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), http: httpClient}
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose requests carry id as their
+// X-Request-ID, so a prediction can be given its feedback under an ID the
+// caller chose.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// do sends body, if not nil, as JSON and decodes the response into out: as
+// JSON, or as text if out is a *string. A response other than 200 is
+// returned as an *Error.
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		req.Header.Set("X-Request-ID", id)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if json.NewDecoder(resp.Body).Decode(apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = "unexpected response"
+		}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return apiErr
+	}
+	if text, ok := out.(*string); ok {
+		data, err := io.ReadAll(resp.Body)
+		*text = string(data)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding the response of %s %s: %v", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Code generated by internal/gen from the operations of the prediction API. DO NOT EDIT.
+
+package predictionapi
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ListModels calls GET /models: list the served models.
+func (c *Client) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	var response []ModelInfo
+	err := c.do(ctx, http.MethodGet, "/models", nil, &response)
+	return response, err
+}
+
+// GetModel calls GET /models/{name}: describe a served model.
+func (c *Client) GetModel(ctx context.Context, name string) (*ModelInfo, error) {
+	var response ModelInfo
+	if err := c.do(ctx, http.MethodGet, "/models/"+url.PathEscape(name), nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Predict calls POST /models/{name}/predict: score instances with the version the model serves.
+func (c *Client) Predict(ctx context.Context, name string, request PredictRequest) (*PredictResponse, error) {
+	var response PredictResponse
+	if err := c.do(ctx, http.MethodPost, "/models/"+url.PathEscape(name)+"/predict", request, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// SendFeedback calls POST /models/{name}/feedback: give an earlier prediction its ground truth.
+func (c *Client) SendFeedback(ctx context.Context, name string, request FeedbackRequest) (*FeedbackResponse, error) {
+	var response FeedbackResponse
+	if err := c.do(ctx, http.MethodPost, "/models/"+url.PathEscape(name)+"/feedback", request, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// ReloadModel calls POST /admin/models/{name}/reload: load the newest version of a model now rather than at the next poll.
+func (c *Client) ReloadModel(ctx context.Context, name string) (*ReloadResponse, error) {
+	var response ReloadResponse
+	if err := c.do(ctx, http.MethodPost, "/admin/models/"+url.PathEscape(name)+"/reload", nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Health calls GET /healthz: check that every model serves a version.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var response Health
+	if err := c.do(ctx, http.MethodGet, "/healthz", nil, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// Metrics calls GET /metrics: read the serving metrics in the Prometheus text format.
+func (c *Client) Metrics(ctx context.Context) (string, error) {
+	var response string
+	err := c.do(ctx, http.MethodGet, "/metrics", nil, &response)
+	return response, err
+}
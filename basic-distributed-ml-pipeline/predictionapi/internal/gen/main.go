@@ -0,0 +1,385 @@
+// Command gen writes the OpenAPI document of the prediction API and the
+// methods of its Go client, both from the operations below and the types
+// of package predictionapi, whose doc comments become the descriptions of
+// the schemas. It runs in the package directory, by go generate.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopherconAU/basic-distributed-ml-pipeline/predictionapi"
+)
+
+// operation is one route of the prediction server.
+type operation struct {
+	name        string // of the client method; the operationId is the same in lower camel case
+	method      string
+	path        string // with {name} for the model name
+	summary     string
+	request     reflect.Type      // nil if the request has no body
+	response    reflect.Type      // nil for a text/plain response
+	errors      map[int]string    // statuses other than 200, each with an Error body
+	headers     map[string]string // optional request headers and what they do
+	description string
+}
+
+var operations = []operation{
+	{
+		name: "ListModels", method: http.MethodGet, path: "/models",
+		summary:  "List the served models.",
+		response: reflect.TypeOf([]predictionapi.ModelInfo{}),
+	},
+	{
+		name: "GetModel", method: http.MethodGet, path: "/models/{name}",
+		summary:  "Describe a served model.",
+		response: reflect.TypeOf(predictionapi.ModelInfo{}),
+		errors:   map[int]string{404: "No model has the name."},
+	},
+	{
+		name: "Predict", method: http.MethodPost, path: "/models/{name}/predict",
+		summary:     "Score instances with the version the model serves.",
+		description: "Requests may be sampled into the request log, and beyond the server's rate or concurrency limits are answered 429.",
+		request:     reflect.TypeOf(predictionapi.PredictRequest{}),
+		response:    reflect.TypeOf(predictionapi.PredictResponse{}),
+		headers:     map[string]string{"X-Request-ID": "ID of the request, echoed in the response; one is generated if it is missing."},
+		errors: map[int]string{
+			400: "The body is invalid, or an instance has the wrong number of features.",
+			404: "No model has the name.",
+			429: "Over the rate or concurrency limit; retry after the Retry-After header.",
+			503: "No version of the model has loaded yet.",
+		},
+	},
+	{
+		name: "SendFeedback", method: http.MethodPost, path: "/models/{name}/feedback",
+		summary:  "Give an earlier prediction its ground truth.",
+		request:  reflect.TypeOf(predictionapi.FeedbackRequest{}),
+		response: reflect.TypeOf(predictionapi.FeedbackResponse{}),
+		errors: map[int]string{
+			400: "The body is invalid, or the labels do not match the instances.",
+			404: "No model has the name, it takes no feedback, or no prediction with the request ID awaits feedback.",
+		},
+	},
+	{
+		name: "ReloadModel", method: http.MethodPost, path: "/admin/models/{name}/reload",
+		summary:  "Load the newest version of a model now rather than at the next poll.",
+		response: reflect.TypeOf(predictionapi.ReloadResponse{}),
+		errors: map[int]string{
+			404: "No model has the name, or no version has been published.",
+			500: "The newest version failed to load; the model keeps serving the version it has.",
+		},
+	},
+	{
+		name: "Health", method: http.MethodGet, path: "/healthz",
+		summary:  "Check that every model serves a version.",
+		response: reflect.TypeOf(predictionapi.Health{}),
+		errors:   map[int]string{503: "A model has no version loaded yet."},
+	},
+	{
+		name: "Metrics", method: http.MethodGet, path: "/metrics",
+		summary: "Read the serving metrics in the Prometheus text format.",
+	},
+}
+
+func main() {
+	log.SetFlags(0)
+	docs, err := typeDocs(".")
+	if err != nil {
+		log.Fatal(err)
+	}
+	spec, err := json.MarshalIndent(openAPI(docs), "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("openapi.json", append(spec, '\n'), 0o644); err != nil {
+		log.Fatal(err)
+	}
+	client, err := clientMethods()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("client_gen.go", client, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// docs holds the doc comments of the package's types, and of their fields
+// by "Type.Field".
+type docs map[string]string
+
+// typeDocs reads the doc comments of the types declared in dir.
+func typeDocs(dir string) (docs, error) {
+	fset := token.NewFileSet()
+	packages, err := parser.ParseDir(fset, dir, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	d := make(docs)
+	for _, pkg := range packages {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					spec := spec.(*ast.TypeSpec)
+					d[spec.Name.Name] = sentence(gen.Doc.Text())
+					structType, ok := spec.Type.(*ast.StructType)
+					if !ok {
+						continue
+					}
+					for _, field := range structType.Fields.List {
+						comment := field.Doc.Text() + field.Comment.Text()
+						for _, name := range field.Names {
+							d[spec.Name.Name+"."+name.Name] = sentence(comment)
+						}
+					}
+				}
+			}
+		}
+	}
+	return d, nil
+}
+
+// sentence joins the lines of a comment and starts it with a capital.
+func sentence(comment string) string {
+	s := strings.Join(strings.Fields(comment), " ")
+	if s == "" {
+		return ""
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+type object = map[string]interface{}
+
+// openAPI returns the OpenAPI 3.0 document of the operations.
+func openAPI(d docs) object {
+	schemas := object{}
+	paths := object{}
+	for _, op := range operations {
+		operation := object{
+			"operationId": strings.ToLower(op.name[:1]) + op.name[1:],
+			"summary":     op.summary,
+		}
+		if op.description != "" {
+			operation["description"] = op.description
+		}
+		var parameters []object
+		if strings.Contains(op.path, "{name}") {
+			parameters = append(parameters, object{
+				"name": "name", "in": "path", "required": true,
+				"description": "Name the model is served under.",
+				"schema":      object{"type": "string"},
+			})
+		}
+		for _, header := range sortedKeys(op.headers) {
+			parameters = append(parameters, object{
+				"name": header, "in": "header", "description": op.headers[header],
+				"schema": object{"type": "string"},
+			})
+		}
+		if parameters != nil {
+			operation["parameters"] = parameters
+		}
+		if op.request != nil {
+			operation["requestBody"] = object{
+				"required": true,
+				"content":  object{"application/json": object{"schema": schema(op.request, d, schemas)}},
+			}
+		}
+
+		ok := object{"description": "OK"}
+		if op.response != nil {
+			ok["content"] = object{"application/json": object{"schema": schema(op.response, d, schemas)}}
+		} else {
+			ok["content"] = object{"text/plain": object{"schema": object{"type": "string"}}}
+		}
+		responses := object{"200": ok}
+		errorSchema := schema(reflect.TypeOf(predictionapi.Error{}), d, schemas)
+		for status, description := range op.errors {
+			response := object{
+				"description": description,
+				"content":     object{"application/json": object{"schema": errorSchema}},
+			}
+			if status == http.StatusTooManyRequests {
+				response["headers"] = object{"Retry-After": object{
+					"description": "Seconds to wait before retrying.",
+					"schema":      object{"type": "integer"},
+				}}
+			}
+			responses[fmt.Sprint(status)] = response
+		}
+		operation["responses"] = responses
+
+		if paths[op.path] == nil {
+			paths[op.path] = object{}
+		}
+		paths[op.path].(object)[strings.ToLower(op.method)] = operation
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "Prediction API",
+			"version":     "1",
+			"description": "Served by the serve command of the distributed ML pipeline: predictions from several named models, each following the newest version published to its registry.",
+		},
+		"paths":      paths,
+		"components": object{"schemas": schemas},
+	}
+}
+
+// schema returns the JSON schema of t, adding the schemas of the named
+// structs it refers to to schemas.
+func schema(t reflect.Type, d docs, schemas object) object {
+	if t == reflect.TypeOf(time.Time{}) {
+		return object{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schema(t.Elem(), d, schemas)
+	case reflect.Slice:
+		return object{"type": "array", "items": schema(t.Elem(), d, schemas)}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": schema(t.Elem(), d, schemas)}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return object{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number", "format": "double"}
+	case reflect.Struct:
+		ref := object{"$ref": "#/components/schemas/" + t.Name()}
+		if schemas[t.Name()] != nil {
+			return ref
+		}
+		s := object{"type": "object"}
+		schemas[t.Name()] = s // before the fields, in case they refer back to t
+		if doc := d[t.Name()]; doc != "" {
+			s["description"] = doc
+		}
+		properties := object{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" || !field.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			property := schema(field.Type, d, schemas)
+			if doc := d[t.Name()+"."+field.Name]; doc != "" {
+				if property["$ref"] != nil {
+					// A $ref ignores its siblings, so the description
+					// goes on a wrapper.
+					property = object{"allOf": []object{property}}
+				}
+				property["description"] = doc
+			}
+			properties[name] = property
+			if !strings.Contains(options, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		s["properties"] = properties
+		if required != nil {
+			s["required"] = required
+		}
+		return ref
+	}
+	log.Fatalf("no schema for %s", t)
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var clientTemplate = template.Must(template.New("client").Parse(`// Code generated by internal/gen from the operations of the prediction API. DO NOT EDIT.
+
+package predictionapi
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+{{range .}}
+// {{.Name}} calls {{.Route}}: {{.Summary}}
+func (c *Client) {{.Name}}(ctx context.Context{{if .Model}}, name string{{end}}{{if .Request}}, request {{.Request}}{{end}}) ({{.Result}}, error) {
+	var response {{.Response}}
+	{{if .Pointer}}if err := c.do(ctx, http.Method{{.Method}}, {{.Path}}, {{if .Request}}request{{else}}nil{{end}}, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil{{else}}err := c.do(ctx, http.Method{{.Method}}, {{.Path}}, {{if .Request}}request{{else}}nil{{end}}, &response)
+	return response, err{{end}}
+}
+{{end}}`))
+
+// clientMethods returns the source of a client method for every operation.
+func clientMethods() ([]byte, error) {
+	type method struct {
+		Name, Summary, Route, Method, Path string
+		Model                              bool
+		Request, Response, Result          string
+		Pointer                            bool // the result is a pointer to the response
+	}
+	var methods []method
+	for _, op := range operations {
+		m := method{
+			Name:    op.name,
+			Summary: strings.ToLower(op.summary[:1]) + op.summary[1:],
+			Route:   op.method + " " + op.path,
+			Method:  strings.ToUpper(op.method[:1]) + strings.ToLower(op.method[1:]),
+			Path:    fmt.Sprintf("%q", op.path),
+			Model:   strings.Contains(op.path, "{name}"),
+		}
+		if m.Model {
+			before, after, _ := strings.Cut(op.path, "{name}")
+			m.Path = fmt.Sprintf("%q + url.PathEscape(name) + %q", before, after)
+			m.Path = strings.TrimSuffix(m.Path, ` + ""`)
+		}
+		if op.request != nil {
+			m.Request = op.request.Name()
+		}
+		switch {
+		case op.response == nil:
+			m.Response, m.Result = "string", "string"
+		case op.response.Kind() == reflect.Struct:
+			m.Response, m.Result, m.Pointer = op.response.Name(), "*"+op.response.Name(), true
+		default:
+			m.Response = strings.ReplaceAll(op.response.String(), "predictionapi.", "")
+			m.Result = m.Response
+		}
+		methods = append(methods, m)
+	}
+
+	var buf bytes.Buffer
+	if err := clientTemplate.Execute(&buf, methods); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
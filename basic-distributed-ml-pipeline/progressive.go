@@ -0,0 +1,152 @@
+package distributed
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"gopherconAU/metrics"
+	"gopherconAU/profiling"
+)
+
+// EvalPoint is one test-set evaluation taken while training was running.
+type EvalPoint struct {
+	Updates int64         `json:"updates"`
+	Elapsed time.Duration `json:"elapsed_ns"`
+	TestMSE float64       `json:"test_mse"`
+	// Metric is the value of TrainConfig.EvalMetric, if set.
+	Metric float64 `json:"metric,omitempty"`
+}
+
+type weightSnapshot struct {
+	weights []float64
+	bias    float64
+	updates int64
+	taken   time.Time
+}
+
+// progressiveEvaluator scores weight snapshots against held-out data on its
+// own goroutine, so workers only pay for copying the weights. When it falls
+// behind, new snapshots are dropped rather than making workers wait.
+//
+// With a patience it also stops training early, through stop, once the
+// metric (the test MSE if none) has not improved on its best for that many
+// evaluations in a row.
+type progressiveEvaluator struct {
+	every     int64
+	data      []DataPoint
+	start     time.Time
+	snapshots chan weightSnapshot
+	done      chan struct{}
+
+	metric   *metrics.Metric
+	patience int
+	stop     func(reason string)
+
+	mu         sync.Mutex
+	trajectory []EvalPoint
+	dropped    int
+}
+
+func newProgressiveEvaluator(every int64, data []DataPoint, start time.Time, metric *metrics.Metric, patience int, stop func(reason string)) *progressiveEvaluator {
+	e := &progressiveEvaluator{
+		every:     every,
+		data:      data,
+		start:     start,
+		snapshots: make(chan weightSnapshot, 16),
+		done:      make(chan struct{}),
+		metric:    metric,
+		patience:  patience,
+		stop:      stop,
+	}
+	go e.run()
+	return e
+}
+
+func (e *progressiveEvaluator) run() {
+	defer close(e.done)
+	profiling.Label(context.Background(), "phase", "evaluate")
+	best, since := math.NaN(), 0
+	for s := range e.snapshots {
+		point := EvalPoint{
+			Updates: s.updates,
+			Elapsed: s.taken.Sub(e.start),
+			TestMSE: meanSquaredError(s.weights, s.bias, e.data),
+		}
+		value, better := point.TestMSE, func(a, b float64) bool { return a < b }
+		if e.metric != nil {
+			point.Metric = metricScore(*e.metric, s.weights, s.bias, e.data)
+			value, better = point.Metric, e.metric.Better
+		}
+		if e.patience > 0 {
+			if math.IsNaN(best) || better(value, best) {
+				best, since = value, 0
+			} else if since++; since == e.patience {
+				e.stop(fmt.Sprintf("no improvement in %d evaluations after %d updates", e.patience, s.updates))
+			}
+		}
+		e.mu.Lock()
+		e.trajectory = append(e.trajectory, point)
+		e.mu.Unlock()
+	}
+}
+
+// observe is called after every update with the global update count and
+// snapshots the model on every Nth one. In gossip mode that is the replica
+// of the worker that made the update.
+func (e *progressiveEvaluator) observe(model *Model, updates int64) {
+	if updates%e.every != 0 {
+		return
+	}
+
+	model.mu.Lock()
+	s := weightSnapshot{
+		weights: append([]float64(nil), model.Weights...),
+		bias:    model.Bias,
+		updates: updates,
+		taken:   time.Now(),
+	}
+	model.mu.Unlock()
+
+	select {
+	case e.snapshots <- s:
+	default:
+		e.mu.Lock()
+		e.dropped++
+		e.mu.Unlock()
+	}
+}
+
+// metricScore scores a weight vector on data by m, as meanSquaredError does
+// by the MSE; the weights of the data points are not used.
+func metricScore(m metrics.Metric, weights []float64, bias float64, data []DataPoint) float64 {
+	labels, predictions := make([]float64, len(data)), make([]float64, len(data))
+	for i, dp := range data {
+		predictions[i] = bias
+		for j, w := range weights {
+			predictions[i] += w * dp.Features[j]
+		}
+		labels[i] = dp.Label
+	}
+	return m.Func(labels, predictions)
+}
+
+// finish waits for queued evaluations and returns the trajectory in update
+// order.
+func (e *progressiveEvaluator) finish() []EvalPoint {
+	close(e.snapshots)
+	<-e.done
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.dropped > 0 {
+		logger.Info("Progressive evaluation skipped %d snapshots while busy", e.dropped)
+	}
+	sort.Slice(e.trajectory, func(i, j int) bool {
+		return e.trajectory[i].Updates < e.trajectory[j].Updates
+	})
+	return e.trajectory
+}
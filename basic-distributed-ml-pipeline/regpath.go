@@ -0,0 +1,357 @@
+package distributed
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/components"
+	"github.com/go-echarts/go-echarts/v2/opts"
+	"gonum.org/v1/gonum/mat"
+)
+
+// PathPoint is the fit at one lambda of a regularization path.
+type PathPoint struct {
+	Lambda  float64
+	Weights []float64
+	Bias    float64
+	CVMSE   float64 // mean validation MSE across folds
+	CVStd   float64 // standard deviation of the fold MSEs
+}
+
+// RegularizationPath holds the fits over the whole lambda grid and the index
+// of the lambda with the lowest cross-validated error.
+type RegularizationPath struct {
+	Penalty string
+	L1Ratio float64 // share of the elastic net penalty that is L1
+	Points  []PathPoint
+	Best    int
+}
+
+// centered splits data into a design matrix and target centered on their
+// weighted means, and returns the means needed to recover the intercept.
+// Every row is scaled by the square root of its sample weight, so sums of
+// squares over them are weighted sums, and the total weight returned takes
+// the place of the sample count.
+func centered(data []DataPoint) (X [][]float64, y []float64, featureMeans []float64, labelMean, totalWeight float64) {
+	featureCount := len(data[0].Features)
+	featureMeans = make([]float64, featureCount)
+	for _, dp := range data {
+		totalWeight += dp.Weight
+	}
+	for _, dp := range data {
+		share := dp.Weight / totalWeight
+		for j, f := range dp.Features {
+			featureMeans[j] += share * f
+		}
+		labelMean += share * dp.Label
+	}
+
+	X = make([][]float64, len(data))
+	y = make([]float64, len(data))
+	for i, dp := range data {
+		scale := math.Sqrt(dp.Weight)
+		X[i] = make([]float64, featureCount)
+		for j, f := range dp.Features {
+			X[i][j] = scale * (f - featureMeans[j])
+		}
+		y[i] = scale * (dp.Label - labelMean)
+	}
+	return X, y, featureMeans, labelMean, totalWeight
+}
+
+func interceptFor(weights, featureMeans []float64, labelMean float64) float64 {
+	bias := labelMean
+	for j, w := range weights {
+		bias -= w * featureMeans[j]
+	}
+	return bias
+}
+
+func softThreshold(x, lambda float64) float64 {
+	switch {
+	case x > lambda:
+		return x - lambda
+	case x < -lambda:
+		return x + lambda
+	default:
+		return 0
+	}
+}
+
+// fitLasso minimizes (1/2n)||y - Xw||^2 + lambda*||w||_1 by cyclic coordinate
+// descent, starting from warm (which may be nil) so a path can be traced cheaply.
+// Here and below, the squared error of every sample counts by its weight and
+// n is the total weight.
+func fitLasso(data []DataPoint, lambda float64, warm []float64) ([]float64, float64) {
+	return fitElasticNet(data, lambda, 1, warm)
+}
+
+// fitElasticNet minimizes
+//
+//	(1/2n)||y - Xw||^2 + lambda*(l1Ratio*||w||_1 + (1-l1Ratio)/2*||w||^2)
+//
+// by cyclic coordinate descent. The L2 part keeps groups of correlated
+// features in the model together where the lasso would pick one of them.
+func fitElasticNet(data []DataPoint, lambda, l1Ratio float64, warm []float64) ([]float64, float64) {
+	X, y, featureMeans, labelMean, n := centered(data)
+	featureCount := len(featureMeans)
+
+	weights := make([]float64, featureCount)
+	copy(weights, warm)
+
+	columnNorms := make([]float64, featureCount)
+	for _, row := range X {
+		for j, x := range row {
+			columnNorms[j] += x * x / n
+		}
+	}
+
+	residuals := make([]float64, len(X))
+	for i, row := range X {
+		residuals[i] = y[i]
+		for j, x := range row {
+			residuals[i] -= weights[j] * x
+		}
+	}
+
+	for sweep := 0; sweep < 1000; sweep++ {
+		maxChange := 0.0
+		for j := 0; j < featureCount; j++ {
+			if columnNorms[j] == 0 && l1Ratio == 1 {
+				continue
+			}
+			rho := 0.0
+			for i, row := range X {
+				rho += row[j] * (residuals[i] + row[j]*weights[j]) / n
+			}
+			updated := softThreshold(rho, lambda*l1Ratio) / (columnNorms[j] + lambda*(1-l1Ratio))
+			if delta := updated - weights[j]; delta != 0 {
+				for i, row := range X {
+					residuals[i] -= delta * row[j]
+				}
+				maxChange = math.Max(maxChange, math.Abs(delta))
+				weights[j] = updated
+			}
+		}
+		if maxChange < 1e-7 {
+			break
+		}
+	}
+	return weights, interceptFor(weights, featureMeans, labelMean)
+}
+
+// fitRidge solves (X'X/n + lambda*I) w = X'y/n on centered data.
+func fitRidge(data []DataPoint, lambda float64) ([]float64, float64) {
+	X, y, featureMeans, labelMean, n := centered(data)
+	featureCount := len(featureMeans)
+
+	design := mat.NewDense(len(X), featureCount, nil)
+	for i, row := range X {
+		design.SetRow(i, row)
+	}
+	var gram mat.Dense
+	gram.Mul(design.T(), design)
+	gram.Scale(1/n, &gram)
+	for j := 0; j < featureCount; j++ {
+		gram.Set(j, j, gram.At(j, j)+lambda)
+	}
+
+	var moment mat.VecDense
+	moment.MulVec(design.T(), mat.NewVecDense(len(y), y))
+	moment.ScaleVec(1/n, &moment)
+
+	var solution mat.VecDense
+	if err := solution.SolveVec(&gram, &moment); err != nil {
+		logger.Error("Ridge solve at lambda %g: %v", lambda, err)
+	}
+	weights := mat.Col(nil, 0, &solution)
+	return weights, interceptFor(weights, featureMeans, labelMean)
+}
+
+func pathTitle(result *RegularizationPath) string {
+	if result.Penalty == "elasticnet" {
+		return fmt.Sprintf("elastic net (L1 ratio %g) coefficient path", result.L1Ratio)
+	}
+	return fmt.Sprintf("%s coefficient path", result.Penalty)
+}
+
+// lambdaGrid returns count log-spaced values from max down to max*ratio.
+func lambdaGrid(max, ratio float64, count int) []float64 {
+	grid := make([]float64, count)
+	for i := range grid {
+		grid[i] = max * math.Pow(ratio, float64(i)/float64(count-1))
+	}
+	return grid
+}
+
+// lassoLambdaMax is the smallest lambda at which every lasso weight is zero.
+func lassoLambdaMax(data []DataPoint) float64 {
+	X, y, _, _, n := centered(data)
+	max := 0.0
+	for j := range X[0] {
+		dot := 0.0
+		for i, row := range X {
+			dot += row[j] * y[i]
+		}
+		max = math.Max(max, math.Abs(dot)/n)
+	}
+	return max
+}
+
+// computeRegularizationPath fits the penalty ("lasso", "ridge" or
+// "elasticnet" with the given L1 ratio) over a grid of lambdas and scores
+// each one by cross-validation over the given folds, keyed by row ID.
+func computeRegularizationPath(data []DataPoint, penalty string, l1Ratio float64, count int, foldOf map[string]int) (*RegularizationPath, error) {
+	if count < 2 {
+		return nil, fmt.Errorf("need at least 2 lambdas, got %d", count)
+	}
+	total := 0.0
+	for _, dp := range data {
+		total += dp.Weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("every sample has weight 0")
+	}
+
+	var lambdas []float64
+	switch penalty {
+	case "lasso":
+		lambdas = lambdaGrid(lassoLambdaMax(data), 1e-3, count)
+	case "ridge":
+		lambdas = lambdaGrid(100, 1e-6, count)
+	case "elasticnet":
+		if l1Ratio <= 0 || l1Ratio > 1 {
+			return nil, fmt.Errorf("elastic net L1 ratio must be in (0, 1], got %g", l1Ratio)
+		}
+		lambdas = lambdaGrid(lassoLambdaMax(data)/l1Ratio, 1e-3, count)
+	default:
+		return nil, fmt.Errorf("unknown penalty %q, want lasso, ridge or elasticnet", penalty)
+	}
+	assign, folds, err := foldsFor(data, foldOf)
+	if err != nil {
+		return nil, err
+	}
+
+	fit := func(train []DataPoint, lambda float64, warm []float64) ([]float64, float64) {
+		switch penalty {
+		case "lasso":
+			return fitLasso(train, lambda, warm)
+		case "elasticnet":
+			return fitElasticNet(train, lambda, l1Ratio, warm)
+		}
+		return fitRidge(train, lambda)
+	}
+
+	path := &RegularizationPath{Penalty: penalty, L1Ratio: l1Ratio}
+	foldWarm := make([][]float64, folds)
+	var warm []float64
+	for _, lambda := range lambdas {
+		weights, bias := fit(data, lambda, warm)
+		warm = weights
+
+		foldMSE := make([]float64, folds)
+		for k := 0; k < folds; k++ {
+			var train, validation []DataPoint
+			for i, dp := range data {
+				if assign[i] == k {
+					validation = append(validation, dp)
+				} else {
+					train = append(train, dp)
+				}
+			}
+
+			w, b := fit(train, lambda, foldWarm[k])
+			foldWarm[k] = w
+			foldMSE[k] = meanSquaredError(w, b, validation)
+		}
+
+		mean, std := meanStd(foldMSE)
+		path.Points = append(path.Points, PathPoint{
+			Lambda:  lambda,
+			Weights: weights,
+			Bias:    bias,
+			CVMSE:   mean,
+			CVStd:   std,
+		})
+		if mean < path.Points[path.Best].CVMSE {
+			path.Best = len(path.Points) - 1
+		}
+	}
+	return path, nil
+}
+
+func meanStd(values []float64) (float64, float64) {
+	mean := 0.0
+	for _, v := range values {
+		mean += v / float64(len(values))
+	}
+	variance := 0.0
+	for _, v := range values {
+		variance += math.Pow(v-mean, 2) / float64(len(values))
+	}
+	return mean, math.Sqrt(variance)
+}
+
+// renderRegularizationPath charts every coefficient against log10(lambda) and
+// the cross-validated MSE curve, naming the selected lambda in the subtitle.
+func renderRegularizationPath(path string, result *RegularizationPath, names []string) error {
+	best := result.Points[result.Best]
+	logLambda := func(p PathPoint) float64 { return math.Log10(p.Lambda) }
+
+	coefficients := charts.NewLine()
+	coefficients.SetGlobalOptions(
+		charts.WithInitializationOpts(opts.Initialization{ChartID: "coefficients"}),
+		charts.WithTitleOpts(opts.Title{
+			Title:    pathTitle(result),
+			Subtitle: fmt.Sprintf("selected lambda %.4g by cross-validation", best.Lambda),
+		}),
+		charts.WithXAxisOpts(opts.XAxis{Name: "log10(lambda)", Type: "value"}),
+		charts.WithYAxisOpts(opts.YAxis{Name: "coefficient"}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: pointer(true)}),
+		charts.WithLegendOpts(opts.Legend{Show: pointer(true), Type: "scroll", Top: "bottom"}),
+	)
+	for j := range best.Weights {
+		name := fmt.Sprintf("x%d", j+1)
+		if j < len(names) {
+			name = names[j]
+		}
+		points := make([]opts.LineData, len(result.Points))
+		for i, p := range result.Points {
+			points[i] = opts.LineData{Value: []interface{}{logLambda(p), p.Weights[j]}}
+		}
+		coefficients.AddSeries(name, points)
+	}
+
+	cv := charts.NewLine()
+	cv.SetGlobalOptions(
+		charts.WithInitializationOpts(opts.Initialization{ChartID: "cv"}),
+		charts.WithTitleOpts(opts.Title{Title: "Cross-validated MSE"}),
+		charts.WithXAxisOpts(opts.XAxis{Name: "log10(lambda)", Type: "value"}),
+		charts.WithYAxisOpts(opts.YAxis{Name: "MSE", Scale: pointer(true)}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: pointer(true)}),
+	)
+	mean := make([]opts.LineData, len(result.Points))
+	upper := make([]opts.LineData, len(result.Points))
+	lower := make([]opts.LineData, len(result.Points))
+	for i, p := range result.Points {
+		mean[i] = opts.LineData{Value: []interface{}{logLambda(p), p.CVMSE}}
+		upper[i] = opts.LineData{Value: []interface{}{logLambda(p), p.CVMSE + p.CVStd}}
+		lower[i] = opts.LineData{Value: []interface{}{logLambda(p), p.CVMSE - p.CVStd}}
+	}
+	cv.AddSeries("mean", mean).
+		AddSeries("+1 std", upper).
+		AddSeries("-1 std", lower)
+
+	page := components.NewPage()
+	page.PageTitle = "Regularization path"
+	page.AddCharts(coefficients, cv)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return page.Render(f)
+}
@@ -0,0 +1,268 @@
+package distributed
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/components"
+	"github.com/go-echarts/go-echarts/v2/opts"
+
+	"gopherconAU/cli"
+	"gopherconAU/dataset"
+	"gopherconAU/logging"
+)
+
+// reportRun is the outcome of one configuration in the comparison report.
+type reportRun struct {
+	Name         string
+	EpochMSE     []float64
+	TestMSE      float64
+	TrainingTime time.Duration
+	Updates      int64
+	Staleness    float64 // mean gradient staleness in updates
+	Resources    []ResourceUsage
+}
+
+// runReport implements the "report" command: it trains the same model under
+// several worker counts, parameter server consistency models, allreduce
+// aggregation and batch orderings, then writes an HTML report overlaying
+// their loss curves.
+func runReport(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	out := fs.String("out", "convergence-report.html", "path of the generated HTML report")
+	workerList := fs.String("workers", "1,4,8", "comma-separated worker counts to compare")
+	epochs := fs.Int("epochs", 10, "epochs per run")
+	batchDelay := fs.Duration("batch-delay", 100*time.Millisecond, "simulated per-batch compute cost")
+	seed := fs.Int64("seed", 42, "seed for the shared train/test split")
+	staleness := fs.Int("staleness", 1, "staleness bound of the ssp runs, in epochs")
+	cpuSetList := fs.String("cpu-sets", "", "also run async with workers pinned to these CPU sets (see the -cpu-sets training flag) to measure the throughput difference")
+	orderingList := fs.String("orderings", "random,easy-first,loss-weighted", "comma-separated batch orderings to compare against sequential, with async updates")
+	timings := fs.Bool("timings", true, "chart training times, staleness and resource usage, which differ between runs; without them the runs of one worker and the allreduce runs give the same report byte for byte for the same -seed")
+	dataPath := fs.String("data", "winequality-dataset.csv", "CSV or .xlsx file to train on")
+	mapping := defaultMapping()
+	mapping.RegisterFlags(fs)
+	var parseOptions dataset.Options
+	parseOptions.RegisterFlags(fs)
+	var noise dataset.Noise
+	noise.RegisterFlags(fs)
+	var logOptions logging.Options
+	logOptions.RegisterFlags(fs)
+	cli.Parse(fs, args)
+	configureLogging(logOptions)
+	defer logger.Close()
+
+	var workerCounts []int
+	for _, field := range strings.Split(*workerList, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 1 {
+			logger.Error("Invalid worker count %q", field)
+			return
+		}
+		workerCounts = append(workerCounts, n)
+	}
+
+	// The hogwild runs under each consistency model, then allreduce, all
+	// with sequential batches, then the other orderings and pinned workers.
+	type strategy struct {
+		name, consistency, aggregation, ordering string
+		cpuSets                                  [][]int
+	}
+	strategies := []strategy{
+		{"async", "async", "hogwild", OrderSequential, nil},
+		{"ssp", "ssp", "hogwild", OrderSequential, nil},
+		{"sync", "sync", "hogwild", OrderSequential, nil},
+		{"allreduce", "sync", "allreduce", OrderSequential, nil},
+	}
+	for _, ordering := range dataset.SplitList(*orderingList) {
+		if !validOrdering(ordering) {
+			logger.Error("Unknown batch ordering %q", ordering)
+			return
+		}
+		if ordering != OrderSequential {
+			strategies = append(strategies, strategy{"async, " + ordering, "async", "hogwild", ordering, nil})
+		}
+	}
+	if *cpuSetList != "" {
+		cpuSets, err := parseCPUSets(*cpuSetList)
+		if err != nil {
+			logger.Error("Invalid -cpu-sets: %v", err)
+			return
+		}
+		strategies = append(strategies, strategy{"async, pinned", "async", "hogwild", OrderSequential, cpuSets})
+	}
+
+	data, err := loadData(*dataPath, mapping, parseOptions)
+	if err != nil {
+		logger.Error("Failed to load data: %v", err)
+		return
+	}
+	data, _ = normalize(data)
+
+	// Every configuration trains and evaluates on the same split.
+	rng := rand.New(rand.NewSource(*seed))
+	rng.Shuffle(len(data), func(i, j int) {
+		data[i], data[j] = data[j], data[i]
+	})
+	splitIndex := int(float64(len(data)) * 0.8)
+	trainData, testData := data[:splitIndex], data[splitIndex:]
+
+	var runs []reportRun
+	for _, workers := range workerCounts {
+		for _, strategy := range strategies {
+			name := fmt.Sprintf("%d workers, %s", workers, strategy.name)
+			logger.Info("Report run: %s", name)
+
+			config := TrainConfig{
+				Workers:      workers,
+				BatchSize:    32,
+				Epochs:       *epochs,
+				LearningRate: 0.01,
+				BatchDelay:   *batchDelay,
+				Consistency:  strategy.consistency,
+				Staleness:    *staleness,
+				Aggregation:  strategy.aggregation,
+				Ordering:     strategy.ordering,
+				Seed:         *seed,
+				CPUSets:      strategy.cpuSets,
+				Noise:        noise,
+				Mode:         "shared",
+			}
+			model, trainingTime, err := train(context.Background(), config, trainData)
+			if err != nil {
+				logger.Error("Report run %s failed: %v", name, err)
+				return
+			}
+
+			run := reportRun{
+				Name:         name,
+				TestMSE:      evaluate(model, testData),
+				TrainingTime: trainingTime,
+				Updates:      model.Updates,
+				Staleness:    model.MeanStaleness,
+				Resources:    model.Resources,
+			}
+			for epoch := 0; epoch < *epochs; epoch++ {
+				run.EpochMSE = append(run.EpochMSE, model.Metrics[epoch])
+			}
+			runs = append(runs, run)
+		}
+	}
+
+	if err := renderReport(*out, runs, *epochs, *timings); err != nil {
+		logger.Error("Failed to write report: %v", err)
+		return
+	}
+
+	logger.Info("Convergence report written to %s", *out)
+	for _, run := range runs {
+		logger.Info("- %-32s test MSE %.6f, %d updates in %v (%.0f/s), mean staleness %.2f",
+			run.Name, run.TestMSE, run.Updates, run.TrainingTime, float64(run.Updates)/run.TrainingTime.Seconds(), run.Staleness)
+	}
+}
+
+// renderReport writes the loss curves and final scores of runs as HTML. The
+// charts get fixed ids, so the page depends only on runs.
+func renderReport(path string, runs []reportRun, epochs int, timings bool) error {
+	epochAxis := make([]int, epochs)
+	for i := range epochAxis {
+		epochAxis[i] = i + 1
+	}
+
+	loss := charts.NewLine()
+	loss.SetGlobalOptions(
+		charts.WithInitializationOpts(opts.Initialization{ChartID: "loss"}),
+		charts.WithTitleOpts(opts.Title{Title: "Training loss per epoch", Subtitle: "Average batch MSE"}),
+		charts.WithXAxisOpts(opts.XAxis{Name: "epoch"}),
+		charts.WithYAxisOpts(opts.YAxis{Name: "MSE", Type: "log"}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: pointer(true), Trigger: "axis"}),
+	)
+	loss.SetXAxis(epochAxis)
+	for _, run := range runs {
+		points := make([]opts.LineData, len(run.EpochMSE))
+		for i, mse := range run.EpochMSE {
+			points[i] = opts.LineData{Value: mse}
+		}
+		loss.AddSeries(run.Name, points)
+	}
+
+	names := make([]string, len(runs))
+	testMSE := make([]opts.BarData, len(runs))
+	seconds := make([]opts.BarData, len(runs))
+	staleness := make([]opts.BarData, len(runs))
+	for i, run := range runs {
+		names[i] = run.Name
+		testMSE[i] = opts.BarData{Value: run.TestMSE}
+		seconds[i] = opts.BarData{Value: run.TrainingTime.Seconds()}
+		staleness[i] = opts.BarData{Value: run.Staleness}
+	}
+
+	title := "Final test MSE"
+	if timings {
+		title = "Final test MSE, training time and staleness"
+	}
+	summary := charts.NewBar()
+	summary.SetGlobalOptions(
+		charts.WithInitializationOpts(opts.Initialization{ChartID: "summary"}),
+		charts.WithTitleOpts(opts.Title{Title: title}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: pointer(true), Trigger: "axis"}),
+	)
+	summary.SetXAxis(names).AddSeries("test MSE", testMSE)
+	if timings {
+		summary.AddSeries("training seconds", seconds).
+			AddSeries("mean staleness (updates)", staleness)
+	}
+
+	page := components.NewPage()
+	page.PageTitle = "Convergence comparison"
+	page.AddCharts(loss, summary)
+	if timings {
+		page.AddCharts(resourceChart("memory", "Resident memory per epoch", "MiB", epochAxis, runs, func(u ResourceUsage) float64 {
+			return mebibytes(u.RSSBytes)
+		}), resourceChart("goroutines", "Goroutines per epoch", "goroutines", epochAxis, runs, func(u ResourceUsage) float64 {
+			return float64(u.Goroutines)
+		}), resourceChart("gc", "Garbage collections so far", "GCs", epochAxis, runs, func(u ResourceUsage) float64 {
+			return float64(u.NumGC)
+		}))
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return page.Render(f)
+}
+
+// resourceChart draws value of the resource usage of every run after each
+// epoch, on the same epoch axis as the loss curves.
+func resourceChart(id, title, unit string, epochAxis []int, runs []reportRun, value func(ResourceUsage) float64) *charts.Line {
+	line := charts.NewLine()
+	line.SetGlobalOptions(
+		charts.WithInitializationOpts(opts.Initialization{ChartID: id}),
+		charts.WithTitleOpts(opts.Title{Title: title, Subtitle: "Sampled once every worker has finished the epoch"}),
+		charts.WithXAxisOpts(opts.XAxis{Name: "epoch"}),
+		charts.WithYAxisOpts(opts.YAxis{Name: unit}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: pointer(true), Trigger: "axis"}),
+	)
+	line.SetXAxis(epochAxis)
+	for _, run := range runs {
+		points := make([]opts.LineData, len(epochAxis))
+		for i := range points {
+			points[i] = opts.LineData{Value: "-"} // not sampled
+		}
+		for _, u := range run.Resources {
+			if u.Epoch >= 1 && u.Epoch <= len(points) {
+				points[u.Epoch-1] = opts.LineData{Value: value(u)}
+			}
+		}
+		line.AddSeries(run.Name, points)
+	}
+	return line
+}
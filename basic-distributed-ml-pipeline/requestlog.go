@@ -0,0 +1,310 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	mathrand "math/rand"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// requestRecord is one prediction request as written to the request log,
+// for monitoring the inputs for drift and for backtesting the predictions
+// once the ground truth is known.
+type requestRecord struct {
+	Time        time.Time     `json:"time"`
+	RequestID   string        `json:"request_id"`
+	Model       string        `json:"model"`
+	Version     string        `json:"version,omitempty"`
+	Client      string        `json:"client,omitempty"`
+	Instances   []redactedRow `json:"instances,omitempty"`
+	Predictions []float64     `json:"predictions,omitempty"`
+	Status      int           `json:"status"`
+	Error       string        `json:"error,omitempty"`
+	DurationMS  float64       `json:"duration_ms"`
+	Redacted    []string      `json:"redacted,omitempty"` // what the redactors removed
+}
+
+// redactedRow is a row of raw features in which redacted features are NaN,
+// written as null.
+type redactedRow []float64
+
+func (r redactedRow) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, v := range r {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			buf.WriteString("null")
+		} else {
+			buf.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// A redactor removes personal data from a record before it leaves the
+// server. Redactors must not modify the slices the record shares with the
+// request.
+type redactor func(*requestRecord)
+
+// redactClient drops the client's address.
+func redactClient(r *requestRecord) {
+	r.Client = ""
+	r.Redacted = append(r.Redacted, "client")
+}
+
+// redactFeatures blanks the features at the given positions of every
+// instance.
+func redactFeatures(indices []int) redactor {
+	return func(r *requestRecord) {
+		for i, row := range r.Instances {
+			redacted := append(redactedRow(nil), row...)
+			for _, j := range indices {
+				if j < len(redacted) {
+					redacted[j] = math.NaN()
+				}
+			}
+			r.Instances[i] = redacted
+		}
+		for _, j := range indices {
+			r.Redacted = append(r.Redacted, fmt.Sprintf("feature %d", j))
+		}
+	}
+}
+
+// parseRedactors parses the -request-log-redact flag: a comma-separated
+// list of "client" and feature positions.
+func parseRedactors(value string) ([]redactor, error) {
+	var redactors []redactor
+	var features []int
+	for _, field := range strings.Split(value, ",") {
+		switch field = strings.TrimSpace(field); field {
+		case "":
+		case "client":
+			redactors = append(redactors, redactClient)
+		default:
+			j, err := strconv.Atoi(field)
+			if err != nil || j < 0 {
+				return nil, fmt.Errorf("cannot redact %q: want client or a feature position", field)
+			}
+			features = append(features, j)
+		}
+	}
+	if len(features) > 0 {
+		redactors = append(redactors, redactFeatures(features))
+	}
+	return redactors, nil
+}
+
+// requestSink receives batches of logged requests.
+type requestSink interface {
+	Write(ctx context.Context, records []requestRecord) error
+	Close() error
+	// String describes the sink, for logs.
+	String() string
+}
+
+// openRequestSink returns the sink for location: kafka://broker[,broker]/topic
+// or the path of a file that receives one JSON record per line.
+func openRequestSink(location string) (requestSink, error) {
+	if !strings.HasPrefix(location, "kafka://") {
+		file, err := os.OpenFile(strings.TrimPrefix(location, "file://"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		return &fileSink{file: file}, nil
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request log %q: %v", location, err)
+	}
+	topic := strings.Trim(u.Path, "/")
+	if u.Host == "" || topic == "" {
+		return nil, fmt.Errorf("invalid request log %q, want kafka://broker[,broker]/topic", location)
+	}
+	return &kafkaSink{
+		location: location,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(strings.Split(u.Host, ",")...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireOne,
+		},
+	}, nil
+}
+
+// fileSink appends records to a file as JSON lines.
+type fileSink struct {
+	file *os.File
+}
+
+func (s *fileSink) Write(ctx context.Context, records []requestRecord) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	_, err := s.file.Write(buf.Bytes())
+	return err
+}
+
+func (s *fileSink) Close() error   { return s.file.Close() }
+func (s *fileSink) String() string { return s.file.Name() }
+
+// kafkaSink produces every record as a message keyed by its model, so the
+// records of a model stay in order within their partition.
+type kafkaSink struct {
+	location string
+	writer   *kafka.Writer
+}
+
+func (s *kafkaSink) Write(ctx context.Context, records []requestRecord) error {
+	messages := make([]kafka.Message, len(records))
+	for i, record := range records {
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		messages[i] = kafka.Message{Key: []byte(record.Model), Value: value, Time: record.Time}
+	}
+	return s.writer.WriteMessages(ctx, messages...)
+}
+
+func (s *kafkaSink) Close() error   { return s.writer.Close() }
+func (s *kafkaSink) String() string { return s.location }
+
+// requestLog samples prediction requests, redacts them and writes them to
+// a sink in the background. Requests never wait for the sink: when its
+// queue is full, records are dropped and counted.
+type requestLog struct {
+	sink      requestSink
+	sample    float64
+	redactors []redactor
+	records   chan requestRecord
+	done      chan struct{}
+
+	mu            sync.Mutex
+	written       int64
+	dropped       int64
+	writeFailures int64
+}
+
+// requestLogBatch is the most records written to the sink at once.
+const requestLogBatch = 100
+
+func newRequestLog(sink requestSink, sample float64, redactors []redactor, queue int) *requestLog {
+	l := &requestLog{
+		sink:      sink,
+		sample:    sample,
+		redactors: redactors,
+		records:   make(chan requestRecord, queue),
+		done:      make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// record queues record, if it is sampled.
+func (l *requestLog) record(record requestRecord) {
+	if mathrand.Float64() >= l.sample {
+		return
+	}
+	for _, redact := range l.redactors {
+		redact(&record)
+	}
+	select {
+	case l.records <- record:
+	default:
+		l.count(func() { l.dropped++ })
+	}
+}
+
+func (l *requestLog) count(update func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	update()
+}
+
+// run writes the queued records in batches until the queue is closed. A
+// failing sink is reported once, when it starts failing, and again once it
+// recovers.
+func (l *requestLog) run() {
+	defer close(l.done)
+	lost := 0 // records lost since the sink started failing
+	for record := range l.records {
+		batch := []requestRecord{record}
+	drain:
+		for len(batch) < requestLogBatch {
+			select {
+			case record, ok := <-l.records:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, record)
+			default:
+				break drain
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := l.sink.Write(ctx, batch)
+		cancel()
+		if err != nil {
+			if lost == 0 {
+				logger.Warn("Failed to write to the request log %s, dropping records until it recovers: %v", l.sink, err)
+			}
+			lost += len(batch)
+			l.count(func() { l.writeFailures++; l.dropped += int64(len(batch)) })
+			continue
+		}
+		if lost > 0 {
+			logger.Info("Request log %s recovered after %d records were lost", l.sink, lost)
+			lost = 0
+		}
+		l.count(func() { l.written += int64(len(batch)) })
+	}
+}
+
+// Close writes the records still queued and closes the sink. No record may
+// be queued once Close is called.
+func (l *requestLog) Close() error {
+	close(l.records)
+	<-l.done
+	return l.sink.Close()
+}
+
+// writeMetrics writes the log's counters in the Prometheus text format.
+func (l *requestLog) writeMetrics(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(w, "serving_request_log_records_total %d\n", l.written)
+	fmt.Fprintf(w, "serving_request_log_dropped_total %d\n", l.dropped)
+	fmt.Fprintf(w, "serving_request_log_write_failures_total %d\n", l.writeFailures)
+}
+
+// newRequestID returns a random identifier for a request that did not
+// bring its own.
+func newRequestID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,41 @@
+package distributed
+
+import (
+	"runtime"
+	"time"
+)
+
+// ResourceUsage is what the process used once every worker had finished an
+// epoch. Read along the epoch losses, a resident set or goroutine count that
+// keeps growing from epoch to epoch points to a leak long before a run
+// fails.
+type ResourceUsage struct {
+	Epoch      int    `json:"epoch"`     // epochs completed
+	RSSBytes   uint64 `json:"rss_bytes"` // resident set size, 0 where unknown
+	HeapBytes  uint64 `json:"heap_bytes"`
+	Goroutines int    `json:"goroutines"`
+	// NumGC and GCPause are totals since the process started.
+	NumGC         uint32        `json:"num_gc"`
+	GCPause       time.Duration `json:"gc_pause_ns"`
+	GCCPUFraction float64       `json:"gc_cpu_fraction"`
+}
+
+// sampleResources measures the process after epoch epochs.
+func sampleResources(epoch int) ResourceUsage {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return ResourceUsage{
+		Epoch:         epoch,
+		RSSBytes:      residentBytes(),
+		HeapBytes:     stats.HeapAlloc,
+		Goroutines:    runtime.NumGoroutine(),
+		NumGC:         stats.NumGC,
+		GCPause:       time.Duration(stats.PauseTotalNs),
+		GCCPUFraction: stats.GCCPUFraction,
+	}
+}
+
+// mebibytes converts bytes for logs and charts.
+func mebibytes(bytes uint64) float64 {
+	return float64(bytes) / (1 << 20)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package distributed
+
+// residentBytes is only implemented on Linux; elsewhere the resident set
+// size is reported as unknown.
+func residentBytes() uint64 {
+	return 0
+}
@@ -0,0 +1,282 @@
+package distributed
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"gopherconAU/blobstore"
+	"gopherconAU/cli"
+	"gopherconAU/dataset"
+	"gopherconAU/logging"
+)
+
+// RetrainEvent records the outcome of one scheduled retraining run.
+type RetrainEvent struct {
+	Time          time.Time `json:"time"`
+	CandidateMSE  float64   `json:"candidate_mse"`
+	ProductionMSE *float64  `json:"production_mse,omitempty"` // nil when there was no comparable production model
+	Promoted      bool      `json:"promoted"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// eventLog keeps the most recent retraining events and serves them, together
+// with running totals, over HTTP.
+type eventLog struct {
+	mu         sync.Mutex
+	events     []RetrainEvent
+	limit      int
+	runs       int
+	failures   int
+	promotions int
+	production float64
+}
+
+func newEventLog(limit int) *eventLog {
+	return &eventLog{limit: limit, production: math.Inf(1)}
+}
+
+func (l *eventLog) record(event RetrainEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.runs++
+	if event.Error != "" {
+		l.failures++
+	}
+	if event.Promoted {
+		l.promotions++
+		l.production = event.CandidateMSE
+	}
+	l.events = append(l.events, event)
+	if len(l.events) > l.limit {
+		l.events = l.events[len(l.events)-l.limit:]
+	}
+}
+
+// serveMetrics writes the counters in the Prometheus text format.
+func (l *eventLog) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "retrain_runs_total %d\n", l.runs)
+	fmt.Fprintf(w, "retrain_failures_total %d\n", l.failures)
+	fmt.Fprintf(w, "retrain_promotions_total %d\n", l.promotions)
+	if !math.IsInf(l.production, 1) {
+		fmt.Fprintf(w, "production_model_mse %g\n", l.production)
+	}
+	if n := len(l.events); n > 0 {
+		fmt.Fprintf(w, "retrain_last_run_timestamp_seconds %d\n", l.events[n-1].Time.Unix())
+	}
+}
+
+// serveEvents writes the recent events as JSON, oldest first.
+func (l *eventLog) serveEvents(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l.events)
+}
+
+// retrain trains a candidate on a fresh load of the dataset and scores it
+// and the production model on the same held-out rows. The production model
+// is scored with its own scaler; it is left unscored when it was trained on a
+// different schema or predates stored scalers. Cancelling ctx abandons the
+// candidate.
+func retrain(ctx context.Context, dataPath string, mapping dataset.Mapping, parseOptions dataset.Options, config TrainConfig, seed int64, production *ModelArtifact) (ModelArtifact, RetrainEvent, error) {
+	event := RetrainEvent{Time: time.Now()}
+
+	raw, err := loadData(dataPath, mapping, parseOptions)
+	if err != nil {
+		return ModelArtifact{}, event, err
+	}
+	fingerprint, err := fingerprintDataset(dataPath, len(raw), parseOptions)
+	if err != nil {
+		return ModelArtifact{}, event, err
+	}
+	header, err := dataset.ReadHeader(dataPath, parseOptions)
+	if err != nil {
+		return ModelArtifact{}, event, err
+	}
+	columns, err := mapping.Resolve(header)
+	if err != nil {
+		return ModelArtifact{}, event, err
+	}
+
+	rand.New(rand.NewSource(seed)).Shuffle(len(raw), func(i, j int) {
+		raw[i], raw[j] = raw[j], raw[i]
+	})
+	splitIndex := int(float64(len(raw)) * 0.8)
+	trainRaw, testRaw := raw[:splitIndex], raw[splitIndex:]
+
+	scaler := fitScaler(trainRaw)
+	model, _, err := train(ctx, config, scaler.transform(trainRaw))
+	if err != nil {
+		return ModelArtifact{}, event, err
+	}
+	if ctx.Err() != nil {
+		return ModelArtifact{}, event, fmt.Errorf("interrupted during training")
+	}
+	event.CandidateMSE = meanSquaredError(model.Weights, model.Bias, scaler.transform(testRaw))
+
+	if production != nil && production.Scaler != nil && production.Dataset.SchemaHash == fingerprint.SchemaHash {
+		mse := meanSquaredError(production.Weights, production.Bias, production.Scaler.transform(testRaw))
+		event.ProductionMSE = &mse
+	}
+
+	return ModelArtifact{
+		Kind:      linearKind,
+		Weights:   model.Weights,
+		Bias:      model.Bias,
+		Scaler:    &scaler,
+		Dataset:   fingerprint,
+		Features:  columns.FeatureNames,
+		TestMSE:   event.CandidateMSE,
+		CreatedAt: event.Time,
+	}, event, nil
+}
+
+// runSchedule implements the "schedule" command: a long-running daemon that
+// retrains on a cron schedule and promotes the candidate to production.json
+// in the model directory whenever it beats the current production model on
+// held-out data.
+func runSchedule(args []string) {
+	fs := flag.NewFlagSet("schedule", flag.ExitOnError)
+	spec := fs.String("cron", "0 * * * *", "retraining schedule as a standard 5-field cron expression")
+	dataPath := fs.String("data", "winequality-dataset.csv", "training CSV, re-read on every run")
+	modelDir := fs.String("model-dir", "models", "model registry holding production.json and promoted versions: a directory, s3://bucket/prefix or gs://bucket/prefix")
+	metricsAddr := fs.String("metrics-addr", ":9090", "address serving /metrics and /events (empty to disable)")
+	epochs := fs.Int("epochs", 10, "epochs per retraining run")
+	seed := fs.Int64("seed", 42, "seed for the held-out split shared by candidate and production")
+	runNow := fs.Bool("run-now", false, "retrain once immediately instead of waiting for the first scheduled time")
+	mapping := defaultMapping()
+	mapping.RegisterFlags(fs)
+	var parseOptions dataset.Options
+	parseOptions.RegisterFlags(fs)
+	var webhooks webhookList
+	fs.Var(&webhooks, "webhook", "URL notified after every retraining run (repeatable; Slack URLs get a chat message)")
+	var logOptions logging.Options
+	logOptions.RegisterFlags(fs)
+	cli.Parse(fs, args)
+	configureLogging(logOptions)
+	defer logger.Close()
+
+	schedule, err := cron.ParseStandard(*spec)
+	if err != nil {
+		logger.Error("Invalid cron expression %q: %v", *spec, err)
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	registry, err := blobstore.Open(ctx, *modelDir)
+	if err != nil {
+		logger.Error("Failed to open model registry: %v", err)
+		return
+	}
+	defer registry.Close()
+
+	events := newEventLog(100)
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", events.serveMetrics)
+		mux.HandleFunc("/events", events.serveEvents)
+		server := &http.Server{Addr: *metricsAddr, Handler: mux}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Metrics server: %v", err)
+			}
+		}()
+		defer server.Close()
+		logger.Info("Serving retraining metrics on %s", *metricsAddr)
+	}
+
+	config := TrainConfig{
+		Workers:      4,
+		BatchSize:    32,
+		Epochs:       *epochs,
+		LearningRate: 0.01,
+		Mode:         "shared",
+	}
+
+	runOnce := func() {
+		production, err := getArtifact(ctx, registry, "production.json")
+		if err != nil && err != blobstore.ErrNotFound {
+			logger.Error("Failed to load production model: %v", err)
+		}
+
+		candidate, event, err := retrain(ctx, *dataPath, mapping, parseOptions, config, *seed, production)
+		summary := RunSummary{Job: "retrain", StartedAt: event.Time}
+		if err != nil {
+			event.Error = err.Error()
+			events.record(event)
+			logger.Error("Retraining failed: %v", err)
+			summary.Status, summary.Error, summary.Duration = "failed", event.Error, time.Since(event.Time)
+			notifyWebhooks(webhooks, summary)
+			return
+		}
+
+		if event.ProductionMSE == nil || event.CandidateMSE < *event.ProductionMSE {
+			versionKey := fmt.Sprintf("model-%s.json", event.Time.Format("20060102T150405"))
+			if err := putArtifact(ctx, registry, versionKey, candidate); err != nil {
+				event.Error = err.Error()
+			} else if err := putArtifact(ctx, registry, "production.json", candidate); err != nil {
+				event.Error = err.Error()
+			} else {
+				event.Promoted = true
+			}
+		}
+		events.record(event)
+
+		switch {
+		case event.Error != "":
+			logger.Error("Failed to promote candidate: %s", event.Error)
+		case event.Promoted && event.ProductionMSE == nil:
+			logger.Info("Promoted candidate (MSE %.6f), no comparable production model", event.CandidateMSE)
+		case event.Promoted:
+			logger.Info("Promoted candidate (MSE %.6f, production was %.6f)", event.CandidateMSE, *event.ProductionMSE)
+		default:
+			logger.Info("Kept production model (MSE %.6f, candidate %.6f)", *event.ProductionMSE, event.CandidateMSE)
+		}
+
+		summary.Status = "succeeded"
+		if event.Error != "" {
+			summary.Status, summary.Error = "failed", event.Error
+		}
+		summary.Duration = time.Since(event.Time)
+		summary.TestMSE = event.CandidateMSE
+		summary.Promoted = event.Promoted
+		summary.Dataset = &candidate.Dataset
+		notifyWebhooks(webhooks, summary)
+	}
+
+	if *runNow {
+		runOnce()
+	}
+	for {
+		next := schedule.Next(time.Now())
+		logger.Info("Next retraining at %s", next.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Info("Retraining daemon stopped")
+			return
+		case <-timer.C:
+			runOnce()
+		}
+	}
+}
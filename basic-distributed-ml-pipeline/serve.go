@@ -0,0 +1,687 @@
+package distributed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"gopherconAU/basic-distributed-ml-pipeline/predictionapi"
+	"gopherconAU/blobstore"
+	"gopherconAU/cli"
+	"gopherconAU/logging"
+)
+
+// modelSource is a -model flag: the name a model is served under and the
+// registry its versions are published to.
+type modelSource struct {
+	name     string
+	location string
+}
+
+// modelSources collects repeated -model flags of the form name=registry.
+type modelSources []modelSource
+
+func (l *modelSources) String() string {
+	fields := make([]string, len(*l))
+	for i, source := range *l {
+		fields[i] = source.name + "=" + source.location
+	}
+	return strings.Join(fields, ",")
+}
+
+func (l *modelSources) Set(value string) error {
+	name, location, ok := strings.Cut(value, "=")
+	if !ok || name == "" || location == "" || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid model %q, want name=registry", value)
+	}
+	for _, source := range *l {
+		if source.name == name {
+			return fmt.Errorf("model %q is listed twice", name)
+		}
+	}
+	*l = append(*l, modelSource{name: name, location: location})
+	return nil
+}
+
+// servedModel is one named model of the prediction server. It serves the
+// newest version published to its registry, and keeps serving the version
+// it has whenever a newer one fails to load. A new version replaces the old
+// one with a single pointer swap: requests in flight finish on the version
+// they started with, and no request waits for a reload.
+type servedModel struct {
+	name     string
+	registry blobstore.Store
+	log      *logging.Logger
+
+	current atomic.Pointer[modelVersion] // nil until a version loads
+
+	reloadMu sync.Mutex // serializes reloads by the poller and the admin endpoint
+	rejected string     // newest version that failed to load, not retried by polling
+
+	statsMu sync.Mutex
+	stats   servingStats
+
+	feedback *feedbackTracker // nil unless feedback is accepted
+
+	// allowSchemaMismatch serves, with a warning, a version whose columns
+	// differ from the served version's instead of rejecting it.
+	allowSchemaMismatch bool
+}
+
+// modelVersion is one loaded version of a served model. It is not modified
+// once it is served.
+type modelVersion struct {
+	key       string // registry key of the artifact
+	predictor predictor
+	artifact  ModelArtifact // of the other kinds, only the kind and features
+	loadedAt  time.Time
+}
+
+// servingStats are the counters behind a model's metrics.
+type servingStats struct {
+	requests       int64
+	failures       int64
+	predictions    int64
+	duration       time.Duration
+	reloads        int64
+	reloadFailures int64
+}
+
+// latestVersion returns the key of the newest version in the registry. Both
+// the watch and schedule commands publish versions as model-*.json under
+// keys that sort in publishing order.
+func latestVersion(ctx context.Context, registry blobstore.Store) (string, error) {
+	keys, err := registry.List(ctx, "model-")
+	if err != nil {
+		return "", err
+	}
+	for i := len(keys) - 1; i >= 0; i-- {
+		if strings.HasSuffix(keys[i], ".json") {
+			return keys[i], nil
+		}
+	}
+	return "", blobstore.ErrNotFound
+}
+
+// reload loads and warms up the newest version if it is not the one being
+// served, then swaps it in, and returns it; it returns nil if the served
+// version is the newest. A version that fails to load is not tried again
+// unless force is set.
+func (m *servedModel) reload(ctx context.Context, force bool) (*modelVersion, error) {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	key, err := latestVersion(ctx, m.registry)
+	if err != nil {
+		return nil, err
+	}
+	if current := m.current.Load(); current != nil && current.key == key {
+		return nil, nil
+	}
+	if key == m.rejected && !force {
+		return nil, nil
+	}
+
+	version, err := m.loadVersion(ctx, key)
+	if err != nil {
+		if ctx.Err() == nil {
+			m.rejected = key
+		}
+		return nil, fmt.Errorf("%s: %v", key, err)
+	}
+	m.current.Store(version)
+	m.rejected = ""
+	return version, nil
+}
+
+// loadVersion reads the model under key, of any kind decodeModel knows,
+// checks it was trained on data laid out as the served version's, and warms
+// it up, so it is ready to take traffic the moment it is swapped in.
+func (m *servedModel) loadVersion(ctx context.Context, key string) (*modelVersion, error) {
+	r, err := m.registry.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return nil, err
+	}
+	predictor, artifact, err := decodeModel(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkSchema(artifact); err != nil {
+		if !m.allowSchemaMismatch {
+			return nil, err
+		}
+		m.log.Warn("Serving %s of %s despite its schema: %v", key, m.name, err)
+	}
+	version := &modelVersion{
+		key:       key,
+		predictor: predictor,
+		artifact:  artifact,
+	}
+	if err := version.warmUp(); err != nil {
+		return nil, err
+	}
+	version.loadedAt = time.Now()
+	return version, nil
+}
+
+// checkSchema checks that a version is of the served version's kind and was
+// trained on data with its schema hash and feature columns, which are how
+// clients lay out the rows they send. The first version only needs to
+// record a schema hash or its feature columns; the logistic regression and
+// k-means models of the other programs record only the columns.
+func (m *servedModel) checkSchema(artifact ModelArtifact) error {
+	if artifact.Dataset.SchemaHash == "" && artifact.Features == nil {
+		return fmt.Errorf("no dataset schema or feature columns recorded to check the columns against")
+	}
+	current := m.current.Load()
+	if current == nil {
+		return nil
+	}
+	served := current.artifact
+	if artifact.Kind != served.Kind {
+		return fmt.Errorf("a %s model cannot replace the %s model of the served version %s", artifact.Kind, served.Kind, current.key)
+	}
+	if artifact.Dataset.SchemaHash != "" && served.Dataset.SchemaHash != "" && artifact.Dataset.SchemaHash != served.Dataset.SchemaHash {
+		return fmt.Errorf("schema hash %.12s differs from %.12s of the served version %s", artifact.Dataset.SchemaHash, served.Dataset.SchemaHash, current.key)
+	}
+	if artifact.Features != nil && served.Features != nil && !slices.Equal(artifact.Features, served.Features) {
+		return fmt.Errorf("feature columns %s differ from %s of the served version %s", strings.Join(artifact.Features, ", "), strings.Join(served.Features, ", "), current.key)
+	}
+	return nil
+}
+
+// warmUp scores validation examples typical of the training data, such as
+// the mean of the training features, through the same path as a request. A
+// version that cannot predict them is rejected.
+func (v *modelVersion) warmUp() error {
+	if _, err := v.predict(v.predictor.warmUpRows()); err != nil {
+		return fmt.Errorf("warming up: %v", err)
+	}
+	return nil
+}
+
+// predict scores raw instances, standardized as the version's model does.
+// A prediction that is not finite is an error rather than a response.
+func (v *modelVersion) predict(instances [][]float64) ([]float64, error) {
+	for i, features := range instances {
+		if len(features) != v.predictor.inputs() {
+			return nil, fmt.Errorf("instance %d has %d features, version %s takes %d", i, len(features), v.key, v.predictor.inputs())
+		}
+	}
+	predictions := v.predictor.predict(instances)
+	for i, p := range predictions {
+		if math.IsNaN(p) || math.IsInf(p, 0) {
+			return nil, fmt.Errorf("version %s predicts %g for instance %d", v.key, p, i)
+		}
+	}
+	return predictions, nil
+}
+
+// follow polls the registry every interval until ctx is cancelled, loading
+// each new version as it is published.
+func (m *servedModel) follow(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		version, err := m.reload(ctx, false)
+		m.noteReload(ctx, version, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// noteReload counts and logs the outcome of a reload.
+func (m *servedModel) noteReload(ctx context.Context, version *modelVersion, err error) {
+	switch {
+	case err == blobstore.ErrNotFound:
+		m.log.Debug("No version of %s published to %s yet", m.name, m.registry)
+	case err != nil && ctx.Err() == nil:
+		m.record(func(s *servingStats) { s.reloadFailures++ })
+		m.log.Warn("Failed to load the newest version of %s: %v", m.name, err)
+	case version != nil:
+		m.record(func(s *servingStats) { s.reloads++ })
+		if version.artifact.Kind == linearKind {
+			m.log.With("version", version.key).Info("Serving %s version %s (test MSE %.6f)", m.name, version.key, version.artifact.TestMSE)
+		} else {
+			m.log.With("version", version.key).Info("Serving %s version %s, a %s model", m.name, version.key, version.artifact.Kind)
+		}
+	}
+}
+
+// record updates the model's counters.
+func (m *servedModel) record(update func(*servingStats)) {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	update(&m.stats)
+}
+
+func (m *servedModel) snapshot() servingStats {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	return m.stats
+}
+
+func (m *servedModel) info() predictionapi.ModelInfo {
+	info := predictionapi.ModelInfo{Name: m.name, Registry: m.registry.String()}
+	if version := m.current.Load(); version != nil {
+		artifact := version.artifact
+		info.Version = version.key
+		info.Kind = artifact.Kind
+		info.Features = version.predictor.inputs()
+		info.LoadedAt = &version.loadedAt
+		if artifact.Kind == linearKind {
+			info.TestMSE = artifact.TestMSE
+			info.Dataset = &artifact.Dataset
+			info.CreatedAt = &artifact.CreatedAt
+		}
+	}
+	if m.feedback != nil {
+		online := m.feedback.metrics()
+		info.Online = &online
+	}
+	return info
+}
+
+// predict scores the instances with the served version.
+func (m *servedModel) predict(instances [][]float64) (predictionapi.PredictResponse, int, error) {
+	version := m.current.Load()
+	if version == nil {
+		return predictionapi.PredictResponse{}, http.StatusServiceUnavailable, fmt.Errorf("no version of %s has been loaded yet", m.name)
+	}
+	if len(instances) == 0 {
+		return predictionapi.PredictResponse{}, http.StatusBadRequest, fmt.Errorf("no instances to predict")
+	}
+	predictions, err := version.predict(instances)
+	if err != nil {
+		return predictionapi.PredictResponse{}, http.StatusBadRequest, fmt.Errorf("%s: %v", m.name, err)
+	}
+	return predictionapi.PredictResponse{Model: m.name, Version: version.key, Predictions: predictions}, http.StatusOK, nil
+}
+
+// predictionServer routes requests to its models by name.
+type predictionServer struct {
+	models     map[string]*servedModel
+	names      []string    // sorted
+	requestLog *requestLog // nil unless requests are logged
+	admission  *admission  // limits on the prediction requests
+}
+
+func newPredictionServer(models []*servedModel, requestLog *requestLog, admission *admission) *predictionServer {
+	s := &predictionServer{models: make(map[string]*servedModel), requestLog: requestLog, admission: admission}
+	for _, m := range models {
+		s.models[m.name] = m
+		s.names = append(s.names, m.name)
+	}
+	sort.Strings(s.names)
+	return s
+}
+
+func (s *predictionServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /models", s.serveModels)
+	mux.HandleFunc("GET /models/{name}", s.serveModel)
+	mux.HandleFunc("POST /models/{name}/predict", s.admission.limit(s.servePredict))
+	mux.HandleFunc("POST /models/{name}/feedback", s.serveFeedback)
+	mux.HandleFunc("POST /admin/models/{name}/reload", s.serveReload)
+	mux.HandleFunc("GET /healthz", s.serveHealth)
+	mux.HandleFunc("GET /metrics", s.serveMetrics)
+	return mux
+}
+
+// lookup returns the model named in the request path, answering 404 when
+// there is none.
+func (s *predictionServer) lookup(w http.ResponseWriter, r *http.Request) *servedModel {
+	m := s.models[r.PathValue("name")]
+	if m == nil {
+		writeHTTPError(w, http.StatusNotFound, fmt.Errorf("unknown model %q", r.PathValue("name")))
+	}
+	return m
+}
+
+func (s *predictionServer) serveModels(w http.ResponseWriter, r *http.Request) {
+	infos := make([]predictionapi.ModelInfo, len(s.names))
+	for i, name := range s.names {
+		infos[i] = s.models[name].info()
+	}
+	writeHTTPJSON(w, http.StatusOK, infos)
+}
+
+func (s *predictionServer) serveModel(w http.ResponseWriter, r *http.Request) {
+	if m := s.lookup(w, r); m != nil {
+		writeHTTPJSON(w, http.StatusOK, m.info())
+	}
+}
+
+func (s *predictionServer) servePredict(w http.ResponseWriter, r *http.Request) {
+	m := s.lookup(w, r)
+	if m == nil {
+		return
+	}
+	start := time.Now()
+	requestID := r.Header.Get("X-Request-ID")
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+	w.Header().Set("X-Request-ID", requestID)
+
+	var response predictionapi.PredictResponse
+	status := http.StatusBadRequest
+	var req predictionapi.PredictRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10<<20)).Decode(&req)
+	if err != nil {
+		err = fmt.Errorf("decoding request: %v", err)
+	} else {
+		response, status, err = m.predict(req.Instances)
+	}
+	response.RequestID = requestID
+	if err == nil && m.feedback != nil {
+		m.feedback.remember(requestID, response.Version, response.Predictions, start)
+	}
+	if s.requestLog != nil {
+		s.logRequest(r, m, req, response, status, err, start)
+	}
+
+	m.record(func(stats *servingStats) {
+		stats.requests++
+		stats.duration += time.Since(start)
+		if err != nil {
+			stats.failures++
+		} else {
+			stats.predictions += int64(len(response.Predictions))
+		}
+	})
+	if err != nil {
+		writeHTTPError(w, status, err)
+		return
+	}
+	writeHTTPJSON(w, status, response)
+}
+
+// logRequest passes a prediction request and its outcome to the request log.
+func (s *predictionServer) logRequest(r *http.Request, m *servedModel, req predictionapi.PredictRequest, response predictionapi.PredictResponse, status int, err error, start time.Time) {
+	record := requestRecord{
+		Time:        start,
+		RequestID:   response.RequestID,
+		Model:       m.name,
+		Version:     response.Version,
+		Client:      r.RemoteAddr,
+		Predictions: response.Predictions,
+		Status:      status,
+		DurationMS:  logging.Milliseconds(time.Since(start)),
+	}
+	if host, _, splitErr := net.SplitHostPort(r.RemoteAddr); splitErr == nil {
+		record.Client = host
+	}
+	for _, row := range req.Instances {
+		record.Instances = append(record.Instances, row)
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	s.requestLog.record(record)
+}
+
+// serveFeedback scores a prediction against the labels that have become
+// known since it was served.
+func (s *predictionServer) serveFeedback(w http.ResponseWriter, r *http.Request) {
+	m := s.lookup(w, r)
+	if m == nil {
+		return
+	}
+	if m.feedback == nil {
+		writeHTTPError(w, http.StatusNotFound, fmt.Errorf("feedback is not accepted for %s", m.name))
+		return
+	}
+	var req predictionapi.FeedbackRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10<<20)).Decode(&req); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, fmt.Errorf("decoding feedback: %v", err))
+		return
+	}
+	version, err := m.feedback.label(req.RequestID, req.Labels, time.Now())
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errNotPending) {
+			status = http.StatusNotFound
+		}
+		writeHTTPError(w, status, err)
+		return
+	}
+	writeHTTPJSON(w, http.StatusOK, predictionapi.FeedbackResponse{Model: m.name, Version: version, Online: m.feedback.metrics()})
+}
+
+// serveReload loads the newest version of a model now instead of at the
+// next poll, trying it again even if it failed to load before.
+func (s *predictionServer) serveReload(w http.ResponseWriter, r *http.Request) {
+	m := s.lookup(w, r)
+	if m == nil {
+		return
+	}
+	version, err := m.reload(r.Context(), true)
+	m.noteReload(r.Context(), version, err)
+	switch {
+	case err == blobstore.ErrNotFound:
+		writeHTTPError(w, http.StatusNotFound, fmt.Errorf("no version of %s has been published to %s", m.name, m.registry))
+		return
+	case err != nil:
+		writeHTTPError(w, http.StatusInternalServerError, err)
+		return
+	}
+	response := predictionapi.ReloadResponse{Model: m.name, Reloaded: version != nil}
+	if current := m.current.Load(); current != nil {
+		response.Version = current.key
+	}
+	writeHTTPJSON(w, http.StatusOK, response)
+}
+
+// serveHealth answers 200 once every model serves a version, and 503 until
+// then.
+func (s *predictionServer) serveHealth(w http.ResponseWriter, r *http.Request) {
+	health := predictionapi.Health{Status: "ok", Models: make(map[string]string)}
+	for _, name := range s.names {
+		version := s.models[name].current.Load()
+		if version == nil {
+			writeHTTPError(w, http.StatusServiceUnavailable, fmt.Errorf("no version of %s has been loaded yet", name))
+			return
+		}
+		health.Models[name] = version.key
+	}
+	writeHTTPJSON(w, http.StatusOK, health)
+}
+
+// serveMetrics writes every model's counters in the Prometheus text format,
+// labelled with the model name.
+func (s *predictionServer) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, name := range s.names {
+		m := s.models[name]
+		stats := m.snapshot()
+		fmt.Fprintf(w, "serving_requests_total{model=%q} %d\n", name, stats.requests)
+		fmt.Fprintf(w, "serving_request_failures_total{model=%q} %d\n", name, stats.failures)
+		fmt.Fprintf(w, "serving_predictions_total{model=%q} %d\n", name, stats.predictions)
+		fmt.Fprintf(w, "serving_request_duration_seconds_sum{model=%q} %g\n", name, stats.duration.Seconds())
+		fmt.Fprintf(w, "serving_model_reloads_total{model=%q} %d\n", name, stats.reloads)
+		fmt.Fprintf(w, "serving_model_reload_failures_total{model=%q} %d\n", name, stats.reloadFailures)
+
+		if version := m.current.Load(); version != nil {
+			fmt.Fprintf(w, "serving_model_info{model=%q,version=%q} 1\n", name, version.key)
+			fmt.Fprintf(w, "serving_model_loaded_timestamp_seconds{model=%q} %d\n", name, version.loadedAt.Unix())
+		}
+		if m.feedback != nil {
+			labelled, unmatched, expired := m.feedback.counts()
+			fmt.Fprintf(w, "serving_feedback_labels_total{model=%q} %d\n", name, labelled)
+			fmt.Fprintf(w, "serving_feedback_unmatched_total{model=%q} %d\n", name, unmatched)
+			fmt.Fprintf(w, "serving_feedback_expired_total{model=%q} %d\n", name, expired)
+			if online := m.feedback.metrics(); online.Samples > 0 {
+				fmt.Fprintf(w, "serving_online_samples{model=%q} %d\n", name, online.Samples)
+				fmt.Fprintf(w, "serving_online_mse{model=%q} %g\n", name, online.MSE)
+				fmt.Fprintf(w, "serving_online_mae{model=%q} %g\n", name, online.MAE)
+				fmt.Fprintf(w, "serving_online_accuracy{model=%q} %g\n", name, online.Accuracy)
+			}
+		}
+	}
+	s.admission.writeMetrics(w)
+	if s.requestLog != nil {
+		s.requestLog.writeMetrics(w)
+	}
+}
+
+func writeHTTPJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeHTTPError(w http.ResponseWriter, status int, err error) {
+	writeHTTPJSON(w, status, predictionapi.Error{Message: err.Error()})
+}
+
+// runServe implements the "serve" command: an HTTP prediction server for
+// several named models at once, each following the newest version published
+// to its own registry by the watch or schedule command. A version may also
+// be a logistic regression saved by train-logreg -save-model or a k-means
+// clustering saved by cluster -save-model, copied into the registry as
+// model-*.json, which predict a class or a cluster. A POST to
+// /admin/models/{name}/reload picks up a new version without waiting for
+// the next poll. The ground truth of a prediction, posted to
+// /models/{name}/feedback with the prediction's request ID once it is known,
+// keeps the model's online accuracy and MSE. -rate-limit and
+// -max-concurrent bound the prediction traffic, answering 429 beyond it.
+// The API is described by predictionapi/openapi.json, and package
+// predictionapi is its Go client.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "address serving /models, /models/{name}/predict, /models/{name}/feedback, /admin/models/{name}/reload, /healthz and /metrics")
+	poll := fs.Duration("poll", 30*time.Second, "how often every model's registry is checked for a new version")
+	var sources modelSources
+	fs.Var(&sources, "model", "model to serve as name=registry, the registry a directory, s3://bucket/prefix or gs://bucket/prefix (repeatable)")
+	requestLogLocation := fs.String("request-log", "", "log sampled prediction requests and responses to a file of JSON lines or to kafka://broker[,broker]/topic")
+	requestLogSample := fs.Float64("request-log-sample", 0.1, "fraction of prediction requests written to the request log")
+	requestLogRedact := fs.String("request-log-redact", "", "comma-separated data left out of the request log: client, and positions of features such as 0,3")
+	feedbackRetention := fs.Duration("feedback-retention", time.Hour, "how long a prediction accepts its ground truth at /models/{name}/feedback; 0 turns feedback off")
+	feedbackWindow := fs.Int("feedback-window", 1000, "number of the latest labelled predictions behind the online accuracy and MSE")
+	rateLimit := fs.Float64("rate-limit", 0, "prediction requests a second accepted across all models, beyond which they are answered 429; 0 for no limit")
+	rateBurst := fs.Int("rate-burst", 0, "prediction requests accepted at once above -rate-limit; 0 for one second's worth")
+	maxConcurrent := fs.Int("max-concurrent", 0, "prediction requests scored at once across all models; 0 for no limit")
+	allowSchemaMismatch := fs.Bool("allow-schema-mismatch", false, "serve, with a warning, a new version whose dataset schema differs from the served version's, or is not recorded, instead of rejecting it")
+	queueTimeout := fs.Duration("queue-timeout", 100*time.Millisecond, "how long a prediction request waits for one of the -max-concurrent slots before it is answered 429")
+	var logOptions logging.Options
+	logOptions.RegisterFlags(fs)
+	cli.Parse(fs, args)
+	configureLogging(logOptions)
+	defer logger.Close()
+
+	if len(sources) == 0 {
+		logger.Error("No models to serve; name at least one with -model name=registry")
+		os.Exit(2)
+	}
+	redactors, err := parseRedactors(*requestLogRedact)
+	if err != nil {
+		logger.Error("Invalid -request-log-redact: %v", err)
+		os.Exit(2)
+	}
+	if *requestLogSample < 0 || *requestLogSample > 1 {
+		logger.Error("-request-log-sample must be between 0 and 1")
+		os.Exit(2)
+	}
+	if *rateLimit < 0 || *rateBurst < 0 || *maxConcurrent < 0 {
+		logger.Error("-rate-limit, -rate-burst and -max-concurrent cannot be negative")
+		os.Exit(2)
+	}
+	if *feedbackWindow < 1 {
+		logger.Error("-feedback-window must be at least 1")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	models := make([]*servedModel, len(sources))
+	for i, source := range sources {
+		registry, err := blobstore.Open(ctx, source.location)
+		if err != nil {
+			logger.Error("Failed to open the registry of %s: %v", source.name, err)
+			os.Exit(1)
+		}
+		defer registry.Close()
+		models[i] = &servedModel{name: source.name, registry: registry, log: logger.With("model", source.name), allowSchemaMismatch: *allowSchemaMismatch}
+		if *feedbackRetention > 0 {
+			models[i].feedback = newFeedbackTracker(*feedbackRetention, *feedbackWindow)
+		}
+	}
+	var followers sync.WaitGroup
+	for _, m := range models {
+		followers.Add(1)
+		go func() {
+			defer followers.Done()
+			m.follow(ctx, *poll)
+		}()
+	}
+
+	var requests *requestLog
+	if *requestLogLocation != "" {
+		sink, err := openRequestSink(*requestLogLocation)
+		if err != nil {
+			logger.Error("Failed to open the request log: %v", err)
+			os.Exit(1)
+		}
+		requests = newRequestLog(sink, *requestLogSample, redactors, 10000)
+		logger.Info("Logging %.4g of prediction requests to %s", *requestLogSample, sink)
+	}
+
+	admission := newAdmission(*rateLimit, *rateBurst, *maxConcurrent, *queueTimeout)
+	if admission.limiter != nil {
+		logger.Info("Limiting predictions to %g requests a second in bursts of %d", *rateLimit, admission.limiter.Burst())
+	}
+	if admission.slots != nil {
+		logger.Info("Scoring at most %d prediction requests at once, each waiting up to %v for its turn", *maxConcurrent, *queueTimeout)
+	}
+
+	server := &http.Server{Addr: *addr, Handler: newPredictionServer(models, requests, admission).handler()}
+	// Shutdown lets the requests in flight finish; stopped is closed once
+	// they have.
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	logger.Info("Serving %d models on %s", len(models), *addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Error("Prediction server: %v", err)
+		stop()
+	}
+	<-stopped
+	followers.Wait()
+	if requests != nil {
+		if err := requests.Close(); err != nil {
+			logger.Error("Failed to close the request log: %v", err)
+		}
+	}
+	logger.Info("Prediction server stopped")
+}
@@ -0,0 +1,379 @@
+package distributed
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/opts"
+)
+
+// SimConfig describes one simulated cluster. Time is virtual: compute and
+// network costs advance a simulated clock instead of sleeping, so a run is
+// fast and fully deterministic for a given dataset order.
+type SimConfig struct {
+	Workers      int
+	ComputeTimes []time.Duration // per-batch compute cost, cycled over workers
+	Latencies    []time.Duration // one-way network latency, cycled over workers
+	Strategy     string          // sync, async or ssp
+	Staleness    int             // SSP bound on how far a worker may run ahead
+	BatchSize    int
+	Epochs       int
+	LearningRate float64
+}
+
+// SimPoint is the test MSE observed right after the server applied an update.
+type SimPoint struct {
+	Time time.Duration
+	MSE  float64
+}
+
+// SimResult is the trajectory of one strategy.
+type SimResult struct {
+	Strategy string
+	Points   []SimPoint
+	Updates  int
+}
+
+// timeToTarget returns the first virtual time at which the test MSE reached
+// target, or false if it never did.
+func (r SimResult) timeToTarget(target float64) (time.Duration, bool) {
+	for _, p := range r.Points {
+		if p.MSE <= target {
+			return p.Time, true
+		}
+	}
+	return 0, false
+}
+
+type simEventKind int
+
+const (
+	simSnapshot simEventKind = iota // pull request reaches the server
+	simApply                        // gradient push reaches the server
+)
+
+type simEvent struct {
+	at       time.Duration
+	seq      int
+	kind     simEventKind
+	worker   int
+	grads    []float64
+	biasGrad float64
+}
+
+type simQueue []simEvent
+
+func (q simQueue) Len() int { return len(q) }
+func (q simQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].seq < q[j].seq
+}
+func (q simQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *simQueue) Push(x interface{}) { *q = append(*q, x.(simEvent)) }
+func (q *simQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+type simWorker struct {
+	data      []DataPoint
+	compute   time.Duration
+	latency   time.Duration
+	iteration int // iterations whose gradient has been applied
+	started   int // iterations started
+	waiting   bool
+}
+
+func (w *simWorker) batch(iteration, batchSize int) []DataPoint {
+	batches := (len(w.data) + batchSize - 1) / batchSize
+	start := (iteration % batches) * batchSize
+	end := start + batchSize
+	if end > len(w.data) {
+		end = len(w.data)
+	}
+	return w.data[start:end]
+}
+
+// computeGradients returns the weighted mean squared error gradient of a batch.
+func computeGradients(weights []float64, bias float64, batch []DataPoint) ([]float64, float64) {
+	weightGradients := make([]float64, len(weights))
+	biasGradient := 0.0
+	totalWeight := 0.0
+	for _, dp := range batch {
+		totalWeight += dp.Weight
+	}
+	if totalWeight == 0 {
+		return weightGradients, biasGradient
+	}
+	for _, dp := range batch {
+		prediction := bias
+		for j, w := range weights {
+			prediction += w * dp.Features[j]
+		}
+		error := dp.Weight * (prediction - dp.Label) / totalWeight
+		for j, feature := range dp.Features {
+			weightGradients[j] += error * feature
+		}
+		biasGradient += error
+	}
+	return weightGradients, biasGradient
+}
+
+// meanSquaredError scores a weight vector without the logging done by evaluate.
+func meanSquaredError(weights []float64, bias float64, data []DataPoint) float64 {
+	total, totalWeight := 0.0, 0.0
+	for _, dp := range data {
+		prediction := bias
+		for j, w := range weights {
+			prediction += w * dp.Features[j]
+		}
+		total += dp.Weight * math.Pow(prediction-dp.Label, 2)
+		totalWeight += dp.Weight
+	}
+	return total / totalWeight
+}
+
+// simulate replays training under the configured strategy on a virtual clock.
+func simulate(config SimConfig, trainData, testData []DataPoint) (SimResult, error) {
+	if len(trainData) == 0 {
+		return SimResult{}, fmt.Errorf("no training samples")
+	}
+	if config.Workers < 1 || config.Workers > len(trainData) {
+		return SimResult{}, fmt.Errorf("cannot split %d samples between %d workers", len(trainData), config.Workers)
+	}
+	workers := make([]*simWorker, config.Workers)
+	chunkSize := len(trainData) / config.Workers
+	for i := range workers {
+		start := i * chunkSize
+		end := start + chunkSize
+		if i == config.Workers-1 {
+			end = len(trainData)
+		}
+		workers[i] = &simWorker{
+			data:    trainData[start:end],
+			compute: config.ComputeTimes[i%len(config.ComputeTimes)],
+			latency: config.Latencies[i%len(config.Latencies)],
+		}
+	}
+	batchesPerEpoch := (chunkSize + config.BatchSize - 1) / config.BatchSize
+	iterations := config.Epochs * batchesPerEpoch
+
+	weights := make([]float64, len(trainData[0].Features))
+	bias := 0.0
+	result := SimResult{Strategy: config.Strategy}
+	record := func(at time.Duration) {
+		result.Updates++
+		result.Points = append(result.Points, SimPoint{Time: at, MSE: meanSquaredError(weights, bias, testData)})
+	}
+
+	if config.Strategy == "sync" {
+		// Every round all workers pull the same weights, and the server waits
+		// for the slowest push before applying the averaged gradient.
+		var now time.Duration
+		for round := 0; round < iterations; round++ {
+			var roundTime time.Duration
+			avgGrads := make([]float64, len(weights))
+			avgBias := 0.0
+			for _, w := range workers {
+				grads, biasGrad := computeGradients(weights, bias, w.batch(round, config.BatchSize))
+				for j := range grads {
+					avgGrads[j] += grads[j] / float64(len(workers))
+				}
+				avgBias += biasGrad / float64(len(workers))
+				if cost := 3*w.latency + w.compute; cost > roundTime {
+					roundTime = cost
+				}
+			}
+			for j := range weights {
+				weights[j] -= config.LearningRate * avgGrads[j]
+			}
+			bias -= config.LearningRate * avgBias
+			now += roundTime
+			record(now)
+		}
+		return result, nil
+	}
+
+	staleness := config.Staleness
+	if config.Strategy == "async" {
+		staleness = math.MaxInt32
+	}
+
+	queue := &simQueue{}
+	seq := 0
+	schedule := func(e simEvent) {
+		e.seq = seq
+		heap.Push(queue, e)
+		seq++
+	}
+	slowest := func() int {
+		min := math.MaxInt32
+		for _, w := range workers {
+			if w.iteration < min {
+				min = w.iteration
+			}
+		}
+		return min
+	}
+	// start begins the next iteration of worker id at time at, unless the SSP
+	// bound makes it wait for the slowest worker.
+	start := func(id int, at time.Duration) {
+		w := workers[id]
+		if w.started >= iterations {
+			return
+		}
+		if w.started-slowest() > staleness {
+			w.waiting = true
+			return
+		}
+		w.waiting = false
+		w.started++
+		schedule(simEvent{at: at + w.latency, kind: simSnapshot, worker: id})
+	}
+
+	for i := range workers {
+		start(i, 0)
+	}
+	for queue.Len() > 0 {
+		event := heap.Pop(queue).(simEvent)
+		w := workers[event.worker]
+		switch event.kind {
+		case simSnapshot:
+			// The gradient is computed on the weights as they were when the
+			// pull reached the server; it lands one compute + two hops later.
+			grads, biasGrad := computeGradients(weights, bias, w.batch(w.started-1, config.BatchSize))
+			schedule(simEvent{
+				at:       event.at + 2*w.latency + w.compute,
+				kind:     simApply,
+				worker:   event.worker,
+				grads:    grads,
+				biasGrad: biasGrad,
+			})
+			start(event.worker, event.at+w.latency+w.compute)
+		case simApply:
+			for j := range weights {
+				weights[j] -= config.LearningRate * event.grads[j]
+			}
+			bias -= config.LearningRate * event.biasGrad
+			w.iteration++
+			record(event.at)
+			for id, other := range workers {
+				if other.waiting {
+					start(id, event.at)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// parseDurations parses a comma-separated list such as "50ms,80ms".
+func parseDurations(list string) ([]time.Duration, error) {
+	var durations []time.Duration
+	for _, field := range strings.Split(list, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q: %v", field, err)
+		}
+		durations = append(durations, d)
+	}
+	return durations, nil
+}
+
+// renderSimulation writes a time-to-accuracy chart with one line per strategy.
+func renderSimulation(path string, results []SimResult) error {
+	line := charts.NewLine()
+	line.SetGlobalOptions(
+		charts.WithInitializationOpts(opts.Initialization{ChartID: "simulation"}),
+		charts.WithTitleOpts(opts.Title{Title: "Simulated time-to-accuracy", Subtitle: "Test MSE over virtual time"}),
+		charts.WithXAxisOpts(opts.XAxis{Name: "virtual seconds", Type: "value"}),
+		charts.WithYAxisOpts(opts.YAxis{Name: "test MSE", Type: "log"}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: pointer(true), Trigger: "axis"}),
+	)
+
+	for _, r := range results {
+		points := make([]opts.LineData, len(r.Points))
+		for i, p := range r.Points {
+			points[i] = opts.LineData{Value: []interface{}{p.Time.Seconds(), p.MSE}}
+		}
+		line.AddSeries(r.Strategy, points).
+			SetSeriesOptions(charts.WithLineChartOpts(opts.LineChart{ShowSymbol: pointer(false)}))
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return line.Render(f)
+}
+
+func pointer(b bool) *bool {
+	return &b
+}
+
+// runSimulation compares sync, async and SSP on the same deterministic data
+// order and writes the resulting chart.
+func runSimulation(data []DataPoint, workers int, compute, latency string, staleness int, target float64, out string) {
+	computeTimes, err := parseDurations(compute)
+	if err != nil {
+		logger.Error("Invalid -sim-compute: %v", err)
+		return
+	}
+	latencies, err := parseDurations(latency)
+	if err != nil {
+		logger.Error("Invalid -sim-latency: %v", err)
+		return
+	}
+
+	// The dataset is used in file order so every run sees identical batches.
+	splitIndex := int(float64(len(data)) * 0.8)
+	trainData, testData := data[:splitIndex], data[splitIndex:]
+
+	var results []SimResult
+	for _, strategy := range []string{"sync", "async", "ssp"} {
+		result, err := simulate(SimConfig{
+			Workers:      workers,
+			ComputeTimes: computeTimes,
+			Latencies:    latencies,
+			Strategy:     strategy,
+			Staleness:    staleness,
+			BatchSize:    32,
+			Epochs:       10,
+			LearningRate: 0.01,
+		}, trainData, testData)
+		if err != nil {
+			logger.Error("Simulation failed: %v", err)
+			return
+		}
+		results = append(results, result)
+
+		if len(result.Points) == 0 {
+			logger.Info("Strategy %-5s: no updates", strategy)
+			continue
+		}
+		final := result.Points[len(result.Points)-1]
+		if at, ok := result.timeToTarget(target); ok {
+			logger.Info("Strategy %-5s: %d updates, finished at %v, final MSE %.6f, reached MSE %.2f at %v",
+				strategy, result.Updates, final.Time, final.MSE, target, at)
+		} else {
+			logger.Info("Strategy %-5s: %d updates, finished at %v, final MSE %.6f, never reached MSE %.2f",
+				strategy, result.Updates, final.Time, final.MSE, target)
+		}
+	}
+
+	if err := renderSimulation(out, results); err != nil {
+		logger.Error("Failed to render simulation chart: %v", err)
+		return
+	}
+	logger.Info("Simulation chart written to %s", out)
+}
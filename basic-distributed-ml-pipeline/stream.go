@@ -0,0 +1,149 @@
+package distributed
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gopherconAU/basic-distributed-ml-pipeline/trainerpb"
+	"gopherconAU/cli"
+	"gopherconAU/logging"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// metricsStreamServer streams the events of a run's trainingMetrics to
+// every subscriber.
+type metricsStreamServer struct {
+	trainerpb.UnimplementedTrainingMetricsServer
+
+	metrics *trainingMetrics
+}
+
+func (s *metricsStreamServer) Subscribe(req *trainerpb.SubscribeRequest, stream trainerpb.TrainingMetrics_SubscribeServer) error {
+	subscriber := s.metrics.subscribe(req.Batches)
+	defer s.metrics.unsubscribe(subscriber)
+	// The header tells the subscriber it is in, even before any event.
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+	for {
+		select {
+		case event, ok := <-subscriber.events:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// serveMetricsStream serves m's events over gRPC on addr until the returned
+// server is stopped.
+func serveMetricsStream(addr string, m *trainingMetrics) (*grpc.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	server := grpc.NewServer()
+	trainerpb.RegisterTrainingMetricsServer(server, &metricsStreamServer{metrics: m})
+	go server.Serve(listener)
+	logger.Info("Streaming training metrics over gRPC on %s", listener.Addr())
+	return server, nil
+}
+
+// runFollow implements the "follow" command: it subscribes to the metrics
+// stream of a training run started with -stream-addr, possibly on another
+// machine, and prints its events as they happen until the run is done.
+func runFollow(args []string) {
+	fs := flag.NewFlagSet("follow", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:50052", "address the training run streams its metrics on")
+	batches := fs.Bool("batches", false, "print every batch, not only every epoch")
+	format := fs.String("format", "text", "output format: text, or json for one event per line")
+	wait := fs.Duration("wait", joinTimeout, "how long to wait for the run to come up")
+	var logOptions logging.Options
+	logOptions.RegisterFlags(fs)
+	cli.Parse(fs, args)
+	configureLogging(logOptions)
+	defer logger.Close()
+	if *format != "text" && *format != "json" {
+		logger.Error("Unknown format %q, want text or json", *format)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		logger.Error("Failed to connect to %s: %v", *addr, err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	// The wait only bounds opening the stream, which the server confirms
+	// with its header; the stream itself lasts as long as the run.
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	timer := time.AfterFunc(*wait, cancel)
+	stream, err := trainerpb.NewTrainingMetricsClient(conn).Subscribe(streamCtx, &trainerpb.SubscribeRequest{Batches: *batches}, grpc.WaitForReady(true))
+	if err == nil {
+		_, err = stream.Header()
+	}
+	if !timer.Stop() && err != nil && ctx.Err() == nil {
+		logger.Error("No training run on %s after %v", *addr, *wait)
+		os.Exit(1)
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Error("Failed to subscribe to %s: %v", *addr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("Metrics stream from %s ended: %v", *addr, err)
+				os.Exit(1)
+			}
+			return
+		}
+		if *format == "json" {
+			line, _ := protojson.Marshal(event)
+			fmt.Println(string(line))
+		} else {
+			printMetricEvent(event)
+		}
+		if event.Kind == trainerpb.MetricEvent_DONE {
+			return
+		}
+	}
+}
+
+func printMetricEvent(event *trainerpb.MetricEvent) {
+	at := time.Unix(0, event.TimeUnixNano).Format("15:04:05.000")
+	switch event.Kind {
+	case trainerpb.MetricEvent_BATCH:
+		fmt.Printf("%s  worker %d  epoch %d  batch %d  MSE %.6f  (%d updates)\n",
+			at, event.WorkerId, event.Epoch+1, event.WorkerBatches, event.Mse, event.Updates)
+	case trainerpb.MetricEvent_EPOCH:
+		fmt.Printf("%s  worker %d  completed epoch %d  MSE %.6f  epoch mean %.6f  (%d updates)\n",
+			at, event.WorkerId, event.Epoch+1, event.Mse, event.EpochMeanMse, event.Updates)
+	case trainerpb.MetricEvent_DONE:
+		fmt.Printf("%s  training %s after %d updates\n", at, event.Status, event.Updates)
+	}
+}
@@ -0,0 +1,324 @@
+package distributed
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"gopherconAU/convergence"
+	"gopherconAU/dataset"
+	"gopherconAU/metrics"
+	"gopherconAU/regularization"
+)
+
+// TrainConfig collects the knobs of one distributed training run.
+type TrainConfig struct {
+	Workers      int
+	BatchSize    int
+	Epochs       int
+	LearningRate float64
+	BatchDelay   time.Duration // simulated per-batch compute cost
+	Mode         string        // shared or gossip
+	Gossip       GossipConfig
+	// Consistency is the parameter server's consistency model: async, sync
+	// (a barrier after every epoch) or ssp, which lets workers run at most
+	// Staleness epochs ahead of the slowest.
+	Consistency string
+	Staleness   int
+	// Aggregation is hogwild, which applies each gradient as soon as it is
+	// pushed, or allreduce, which averages one batch gradient from every
+	// worker into a single update; Consistency then does not apply.
+	Aggregation string
+	// Ordering is the order in which workers take their batches each epoch:
+	// sequential (the default), random, easy-first or loss-weighted.
+	Ordering string
+	// Seed seeds the random orderings, mixed with the worker and epoch.
+	Seed int64
+	// Noise corrupts the training data, every shard with its own seed, to
+	// study how training degrades; the test data stays clean.
+	Noise dataset.Noise
+	// AdaptiveBatch enables batch size adaptation; nil keeps BatchSize fixed.
+	AdaptiveBatch *AdaptiveBatchConfig
+	// MaxDuration and MaxUpdates stop training gracefully when exceeded;
+	// zero means no limit. The best model so far is then written beside
+	// CheckpointPath, to checkpoint.best.json for checkpoint.json.
+	MaxDuration time.Duration
+	MaxUpdates  int64
+	// CheckpointPath is a file path or a blobstore URL such as
+	// s3://bucket/prefix/checkpoint.json; Checkpoints is the store it
+	// names, nil for no checkpoints.
+	CheckpointPath string
+	Checkpoints    *checkpointStore `json:"-"`
+	// CheckpointEvery > 0 also writes the model to CheckpointPath whenever
+	// every worker has completed another CheckpointEvery epochs; in gossip
+	// mode that is the replica of the worker finishing the epoch last.
+	CheckpointEvery int
+	// Resume, if set, restores the model from a checkpoint and trains only
+	// the epochs after the ones it completed.
+	Resume *Checkpoint `json:"-"`
+	// DiagnosticsDir receives a bundle for every recovered worker panic;
+	// empty only logs them.
+	DiagnosticsDir string
+	// EvalEvery > 0 scores a weight snapshot on EvalData every EvalEvery
+	// updates without pausing the workers.
+	EvalEvery int64
+	EvalData  []DataPoint `json:"-"`
+	// EvalMetric names a registered metric also scored on every snapshot.
+	// With EvalPatience > 0, training stops once it, or the test MSE if
+	// empty, has not improved for EvalPatience evaluations in a row.
+	EvalMetric   string
+	EvalPatience int
+	// ShardByFile gives every worker whole input files instead of an equal
+	// slice of the rows; Shards then holds one slice per worker.
+	ShardByFile bool
+	Shards      [][]DataPoint `json:"-"`
+	// CPUSets pins worker i to CPUSets[i%len(CPUSets)], with GOMAXPROCS
+	// set to the CPUs they cover; nil leaves scheduling to Go.
+	CPUSets [][]int
+	// Convergence stops each worker before Epochs once its epoch loss or the
+	// gradient over its shard settles.
+	Convergence convergence.Criteria
+	// Penalty regularizes the weights: the parameter server shrinks them
+	// after applying every gradient.
+	Penalty regularization.Penalty
+	// Metrics, if set, receives the progress of the run for the /metrics
+	// endpoint.
+	Metrics *trainingMetrics `json:"-"`
+}
+
+// train shards trainData across config.Workers goroutines and runs them to
+// completion, returning the trained model and the wall-clock training time.
+// Cancelling ctx stops the workers before their next batch; the best model so
+// far is then checkpointed as when a budget runs out. It fails only when there
+// is nothing to train on.
+func train(ctx context.Context, config TrainConfig, trainData []DataPoint) (*Model, time.Duration, error) {
+	if len(trainData) == 0 {
+		return nil, 0, fmt.Errorf("no training samples")
+	}
+	if config.Consistency == "" {
+		config.Consistency = "async"
+	}
+	featureCount := len(trainData[0].Features)
+	model := &Model{
+		Weights:   make([]float64, featureCount),
+		Bias:      0.0,
+		StartTime: time.Now(),
+		Metrics:   make(map[int]float64),
+	}
+	firstEpoch, resumedUpdates := 0, int64(0)
+	if config.Resume != nil {
+		model.Weights = append([]float64(nil), config.Resume.Weights...)
+		model.Bias = config.Resume.Bias
+		model.Updates = config.Resume.Updates
+		for epoch, mse := range config.Resume.Metrics {
+			model.Metrics[epoch] = mse
+		}
+		firstEpoch, resumedUpdates = config.Resume.Completed, config.Resume.Updates
+		logger.Info("Resuming after epoch %d with %d updates", firstEpoch, model.Updates)
+	}
+
+	logger.Info("Training configuration:")
+	logger.Info("- Number of workers: %d", config.Workers)
+	logger.Info("- Batch size: %d", config.BatchSize)
+	logger.Info("- Epochs: %d", config.Epochs)
+	logger.Info("- Learning rate: %f", config.LearningRate)
+	if config.Aggregation == "allreduce" {
+		logger.Info("- Aggregation: allreduce")
+	} else if config.Consistency == "ssp" {
+		logger.Info("- Consistency: ssp (staleness bound %d epochs)", config.Staleness)
+	} else {
+		logger.Info("- Consistency: %s", config.Consistency)
+	}
+	if len(config.CPUSets) > 0 {
+		procs := distinctCPUs(config.CPUSets)
+		previous := runtime.GOMAXPROCS(procs)
+		defer runtime.GOMAXPROCS(previous)
+		logger.Info("- CPU sets: %d, GOMAXPROCS %d", len(config.CPUSets), procs)
+	}
+	if config.Convergence.Enabled() {
+		logger.Info("- Convergence: %s", config.Convergence)
+	}
+	if config.Penalty.Enabled() {
+		logger.Info("- Penalty: %s", config.Penalty)
+	}
+	if config.Ordering != "" && config.Ordering != OrderSequential {
+		logger.Info("- Batch ordering: %s", config.Ordering)
+	}
+
+	workersData := config.Shards
+	if workersData == nil {
+		workersData = make([][]DataPoint, config.Workers)
+		chunkSize := len(trainData) / config.Workers
+		for i := 0; i < config.Workers; i++ {
+			start := i * chunkSize
+			end := start + chunkSize
+			if i == config.Workers-1 {
+				end = len(trainData)
+			}
+			workersData[i] = trainData[start:end]
+		}
+	}
+	for i := range workersData {
+		if config.Noise.Enabled() {
+			noise := config.Noise
+			noise.Seed += int64(i)
+			var corrupted int
+			workersData[i], corrupted = addNoise(noise, workersData[i])
+			logger.Info("Worker %d data corrupted: feature noise %.2f std, %d labels replaced",
+				i, noise.Features, corrupted)
+		}
+		logger.Info("Worker %d assigned %d samples", i, len(workersData[i]))
+	}
+
+	var wg sync.WaitGroup
+	workers := make([]*Worker, config.Workers)
+
+	// In gossip mode every worker trains its own replica of the model.
+	workerModels := make([]*Model, config.Workers)
+	for i := range workerModels {
+		workerModels[i] = model
+		if config.Mode == "gossip" {
+			workerModels[i] = &Model{
+				Weights:   append([]float64(nil), model.Weights...),
+				Bias:      model.Bias,
+				StartTime: model.StartTime,
+				Metrics:   make(map[int]float64),
+			}
+		}
+	}
+
+	var gossip *gossipNetwork
+	var gossipWg sync.WaitGroup
+	stopGossip := make(chan struct{})
+	if config.Mode == "gossip" {
+		gossip = newGossipNetwork(workerModels, config.Gossip)
+		for i := 0; i < config.Workers; i++ {
+			gossipWg.Add(1)
+			go gossip.run(i, stopGossip, &gossipWg)
+		}
+	}
+
+	server := newParameterServer(config, workerModels)
+
+	diag := newDiagnostics(config.DiagnosticsDir)
+	checkpointer := newEpochCheckpointer(config.Checkpoints, config.CheckpointEvery, config.Workers, firstEpoch)
+
+	logger.Info("Starting distributed training")
+	trainingStartTime := time.Now()
+	limits := newBudget(config.MaxDuration, config.MaxUpdates, trainingStartTime)
+	best := newBestModel()
+	var evaluator *progressiveEvaluator
+	if config.EvalEvery > 0 && len(config.EvalData) > 0 {
+		var metric *metrics.Metric
+		if config.EvalMetric != "" {
+			if m, err := metrics.Lookup(config.EvalMetric); err != nil {
+				logger.Error("%v", err)
+			} else {
+				metric = &m
+			}
+		}
+		evaluator = newProgressiveEvaluator(config.EvalEvery, config.EvalData, trainingStartTime, metric, config.EvalPatience, limits.stop)
+	}
+	config.Metrics.begin(config.Workers, evaluator)
+
+	for i := 0; i < config.Workers; i++ {
+		workers[i] = &Worker{
+			ID:          i,
+			Data:        workersData[i],
+			BatchSize:   config.BatchSize,
+			BatchDelay:  config.BatchDelay,
+			Server:      server,
+			Model:       workerModels[i],
+			Diagnostics: diag,
+			Budget:      limits,
+			Best:        best,
+			Evaluator:   evaluator,
+			FirstEpoch:  firstEpoch,
+			Checkpoints: checkpointer,
+			Ordering:    config.Ordering,
+			Seed:        config.Seed,
+			Metrics:     config.Metrics,
+			CPUSets:     config.CPUSets,
+			Convergence: config.Convergence,
+			Penalty:     config.Penalty,
+		}
+		if config.AdaptiveBatch != nil {
+			workers[i].Controller = newBatchController(*config.AdaptiveBatch)
+		}
+		wg.Add(1)
+		go workers[i].trainWorker(ctx, config.Epochs, config.LearningRate, &wg)
+	}
+
+	wg.Wait()
+	trainingDuration := time.Since(trainingStartTime)
+	if n := diag.panics(); n > 0 {
+		logger.Error("Recovered from %d worker panics during training", n)
+	}
+
+	if gossip != nil {
+		close(stopGossip)
+		gossipWg.Wait()
+		model = gossip.consensus()
+		if config.Resume != nil {
+			model.Updates += config.Resume.Updates
+			for epoch, mse := range config.Resume.Metrics {
+				model.Metrics[epoch] = mse
+			}
+		}
+		logger.Info("Gossip exchanges: %d", gossip.exchanges)
+		logger.Info("Max worker distance from consensus: %.6f", gossip.disagreement(model))
+	}
+
+	if evaluator != nil {
+		model.EvalTrajectory = evaluator.finish()
+	}
+	model.Resources = checkpointer.resources()
+	model.MeanStaleness, model.MaxStaleness = server.Staleness()
+	logger.Info("Gradient staleness: mean %.2f, max %d updates", model.MeanStaleness, model.MaxStaleness)
+
+	reason := limits.stopReason()
+	if reason == "" && ctx.Err() != nil {
+		reason = "interrupted"
+	}
+	if reason != "" {
+		logger.Info("Training stopped early: %s", reason)
+		checkpoint := best.checkpoint(model, resumedUpdates+limits.updates.Load(), checkpointer.completedEpochs(), reason)
+		checkpoint.Metrics, _ = model.metricsUpTo(checkpoint.Completed)
+		if config.Checkpoints != nil {
+			// The best model may be older than the last checkpoint, which
+			// resuming must continue from, so it is kept beside it.
+			store := config.Checkpoints.best()
+			if err := store.write(checkpoint); err != nil {
+				logger.Error("Failed to write checkpoint: %v", err)
+			} else {
+				logger.Info("Best model so far (epoch %d, train MSE %.6f) checkpointed to %s",
+					checkpoint.Epoch+1, checkpoint.TrainMSE, store)
+			}
+		}
+	}
+
+	return model, trainingDuration, nil
+}
+
+// addNoise returns a copy of points corrupted as noise describes, and the
+// number of labels it replaced. Weights, groups and ids are kept.
+func addNoise(noise dataset.Noise, points []DataPoint) ([]DataPoint, int) {
+	if len(points) == 0 {
+		return points, 0
+	}
+	clean := &dataset.Dataset{}
+	for _, dp := range points {
+		clean.X = append(clean.X, dp.Features)
+		clean.Y = append(clean.Y, dp.Label)
+	}
+	noisy, corrupted := noise.Apply(clean)
+
+	corruptedPoints := make([]DataPoint, len(points))
+	for i, dp := range points {
+		dp.Features, dp.Label = noisy.X[i], noisy.Y[i]
+		corruptedPoints[i] = dp
+	}
+	return corruptedPoints, corrupted
+}
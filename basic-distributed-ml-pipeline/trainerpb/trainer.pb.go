@@ -0,0 +1,1069 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.34.2
+// 	protoc        (unknown)
+// source: trainer.proto
+
+package trainerpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type MetricEvent_Kind int32
+
+const (
+	MetricEvent_KIND_UNSPECIFIED MetricEvent_Kind = 0
+	MetricEvent_BATCH            MetricEvent_Kind = 1
+	MetricEvent_EPOCH            MetricEvent_Kind = 2
+	MetricEvent_DONE             MetricEvent_Kind = 3
+)
+
+// Enum value maps for MetricEvent_Kind.
+var (
+	MetricEvent_Kind_name = map[int32]string{
+		0: "KIND_UNSPECIFIED",
+		1: "BATCH",
+		2: "EPOCH",
+		3: "DONE",
+	}
+	MetricEvent_Kind_value = map[string]int32{
+		"KIND_UNSPECIFIED": 0,
+		"BATCH":            1,
+		"EPOCH":            2,
+		"DONE":             3,
+	}
+)
+
+func (x MetricEvent_Kind) Enum() *MetricEvent_Kind {
+	p := new(MetricEvent_Kind)
+	*p = x
+	return p
+}
+
+func (x MetricEvent_Kind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (MetricEvent_Kind) Descriptor() protoreflect.EnumDescriptor {
+	return file_trainer_proto_enumTypes[0].Descriptor()
+}
+
+func (MetricEvent_Kind) Type() protoreflect.EnumType {
+	return &file_trainer_proto_enumTypes[0]
+}
+
+func (x MetricEvent_Kind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use MetricEvent_Kind.Descriptor instead.
+func (MetricEvent_Kind) EnumDescriptor() ([]byte, []int) {
+	return file_trainer_proto_rawDescGZIP(), []int{9, 0}
+}
+
+type DataPoint struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Features []float64 `protobuf:"fixed64,1,rep,packed,name=features,proto3" json:"features,omitempty"`
+	Label    float64   `protobuf:"fixed64,2,opt,name=label,proto3" json:"label,omitempty"`
+	Weight   float64   `protobuf:"fixed64,3,opt,name=weight,proto3" json:"weight,omitempty"`
+}
+
+func (x *DataPoint) Reset() {
+	*x = DataPoint{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_trainer_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DataPoint) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DataPoint) ProtoMessage() {}
+
+func (x *DataPoint) ProtoReflect() protoreflect.Message {
+	mi := &file_trainer_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DataPoint.ProtoReflect.Descriptor instead.
+func (*DataPoint) Descriptor() ([]byte, []int) {
+	return file_trainer_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *DataPoint) GetFeatures() []float64 {
+	if x != nil {
+		return x.Features
+	}
+	return nil
+}
+
+func (x *DataPoint) GetLabel() float64 {
+	if x != nil {
+		return x.Label
+	}
+	return 0
+}
+
+func (x *DataPoint) GetWeight() float64 {
+	if x != nil {
+		return x.Weight
+	}
+	return 0
+}
+
+type JoinRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Hostname string `protobuf:"bytes,1,opt,name=hostname,proto3" json:"hostname,omitempty"`
+}
+
+func (x *JoinRequest) Reset() {
+	*x = JoinRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_trainer_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *JoinRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JoinRequest) ProtoMessage() {}
+
+func (x *JoinRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_trainer_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JoinRequest.ProtoReflect.Descriptor instead.
+func (*JoinRequest) Descriptor() ([]byte, []int) {
+	return file_trainer_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *JoinRequest) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+type Assignment struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	WorkerId     int32          `protobuf:"varint,1,opt,name=worker_id,json=workerId,proto3" json:"worker_id,omitempty"`
+	Shard        []*DataPoint   `protobuf:"bytes,2,rep,name=shard,proto3" json:"shard,omitempty"`
+	Epochs       int32          `protobuf:"varint,3,opt,name=epochs,proto3" json:"epochs,omitempty"`
+	BatchSize    int32          `protobuf:"varint,4,opt,name=batch_size,json=batchSize,proto3" json:"batch_size,omitempty"`
+	LearningRate float64        `protobuf:"fixed64,5,opt,name=learning_rate,json=learningRate,proto3" json:"learning_rate,omitempty"`
+	Model        *ModelSnapshot `protobuf:"bytes,6,opt,name=model,proto3" json:"model,omitempty"`
+	// A worker stops before epochs once its loss or gradient settles below
+	// these tolerances; zero disables the check.
+	LossTolerance     float64 `protobuf:"fixed64,7,opt,name=loss_tolerance,json=lossTolerance,proto3" json:"loss_tolerance,omitempty"`
+	GradientTolerance float64 `protobuf:"fixed64,8,opt,name=gradient_tolerance,json=gradientTolerance,proto3" json:"gradient_tolerance,omitempty"`
+}
+
+func (x *Assignment) Reset() {
+	*x = Assignment{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_trainer_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Assignment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Assignment) ProtoMessage() {}
+
+func (x *Assignment) ProtoReflect() protoreflect.Message {
+	mi := &file_trainer_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Assignment.ProtoReflect.Descriptor instead.
+func (*Assignment) Descriptor() ([]byte, []int) {
+	return file_trainer_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Assignment) GetWorkerId() int32 {
+	if x != nil {
+		return x.WorkerId
+	}
+	return 0
+}
+
+func (x *Assignment) GetShard() []*DataPoint {
+	if x != nil {
+		return x.Shard
+	}
+	return nil
+}
+
+func (x *Assignment) GetEpochs() int32 {
+	if x != nil {
+		return x.Epochs
+	}
+	return 0
+}
+
+func (x *Assignment) GetBatchSize() int32 {
+	if x != nil {
+		return x.BatchSize
+	}
+	return 0
+}
+
+func (x *Assignment) GetLearningRate() float64 {
+	if x != nil {
+		return x.LearningRate
+	}
+	return 0
+}
+
+func (x *Assignment) GetModel() *ModelSnapshot {
+	if x != nil {
+		return x.Model
+	}
+	return nil
+}
+
+func (x *Assignment) GetLossTolerance() float64 {
+	if x != nil {
+		return x.LossTolerance
+	}
+	return 0
+}
+
+func (x *Assignment) GetGradientTolerance() float64 {
+	if x != nil {
+		return x.GradientTolerance
+	}
+	return 0
+}
+
+// Gradient holds the sample-weighted sums over one batch; the master divides
+// by batch_weight when applying it. version is the updates count of the
+// snapshot the gradient was computed against. error, the weighted sum of
+// squared errors, is only reported in metrics.
+type Gradient struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	WorkerId    int32     `protobuf:"varint,1,opt,name=worker_id,json=workerId,proto3" json:"worker_id,omitempty"`
+	Weights     []float64 `protobuf:"fixed64,2,rep,packed,name=weights,proto3" json:"weights,omitempty"`
+	Bias        float64   `protobuf:"fixed64,3,opt,name=bias,proto3" json:"bias,omitempty"`
+	BatchWeight float64   `protobuf:"fixed64,4,opt,name=batch_weight,json=batchWeight,proto3" json:"batch_weight,omitempty"`
+	Version     int64     `protobuf:"varint,5,opt,name=version,proto3" json:"version,omitempty"`
+	Error       float64   `protobuf:"fixed64,6,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (x *Gradient) Reset() {
+	*x = Gradient{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_trainer_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Gradient) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Gradient) ProtoMessage() {}
+
+func (x *Gradient) ProtoReflect() protoreflect.Message {
+	mi := &file_trainer_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Gradient.ProtoReflect.Descriptor instead.
+func (*Gradient) Descriptor() ([]byte, []int) {
+	return file_trainer_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Gradient) GetWorkerId() int32 {
+	if x != nil {
+		return x.WorkerId
+	}
+	return 0
+}
+
+func (x *Gradient) GetWeights() []float64 {
+	if x != nil {
+		return x.Weights
+	}
+	return nil
+}
+
+func (x *Gradient) GetBias() float64 {
+	if x != nil {
+		return x.Bias
+	}
+	return 0
+}
+
+func (x *Gradient) GetBatchWeight() float64 {
+	if x != nil {
+		return x.BatchWeight
+	}
+	return 0
+}
+
+func (x *Gradient) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Gradient) GetError() float64 {
+	if x != nil {
+		return x.Error
+	}
+	return 0
+}
+
+type PullRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	WorkerId int32 `protobuf:"varint,1,opt,name=worker_id,json=workerId,proto3" json:"worker_id,omitempty"`
+}
+
+func (x *PullRequest) Reset() {
+	*x = PullRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_trainer_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PullRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PullRequest) ProtoMessage() {}
+
+func (x *PullRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_trainer_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PullRequest.ProtoReflect.Descriptor instead.
+func (*PullRequest) Descriptor() ([]byte, []int) {
+	return file_trainer_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PullRequest) GetWorkerId() int32 {
+	if x != nil {
+		return x.WorkerId
+	}
+	return 0
+}
+
+type ModelSnapshot struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Weights []float64 `protobuf:"fixed64,1,rep,packed,name=weights,proto3" json:"weights,omitempty"`
+	Bias    float64   `protobuf:"fixed64,2,opt,name=bias,proto3" json:"bias,omitempty"`
+	Updates int64     `protobuf:"varint,3,opt,name=updates,proto3" json:"updates,omitempty"`
+}
+
+func (x *ModelSnapshot) Reset() {
+	*x = ModelSnapshot{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_trainer_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ModelSnapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ModelSnapshot) ProtoMessage() {}
+
+func (x *ModelSnapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_trainer_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ModelSnapshot.ProtoReflect.Descriptor instead.
+func (*ModelSnapshot) Descriptor() ([]byte, []int) {
+	return file_trainer_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ModelSnapshot) GetWeights() []float64 {
+	if x != nil {
+		return x.Weights
+	}
+	return nil
+}
+
+func (x *ModelSnapshot) GetBias() float64 {
+	if x != nil {
+		return x.Bias
+	}
+	return 0
+}
+
+func (x *ModelSnapshot) GetUpdates() int64 {
+	if x != nil {
+		return x.Updates
+	}
+	return 0
+}
+
+type EpochReport struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	WorkerId int32   `protobuf:"varint,1,opt,name=worker_id,json=workerId,proto3" json:"worker_id,omitempty"`
+	Epoch    int32   `protobuf:"varint,2,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	Mse      float64 `protobuf:"fixed64,3,opt,name=mse,proto3" json:"mse,omitempty"`
+	Last     bool    `protobuf:"varint,4,opt,name=last,proto3" json:"last,omitempty"`
+}
+
+func (x *EpochReport) Reset() {
+	*x = EpochReport{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_trainer_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *EpochReport) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EpochReport) ProtoMessage() {}
+
+func (x *EpochReport) ProtoReflect() protoreflect.Message {
+	mi := &file_trainer_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EpochReport.ProtoReflect.Descriptor instead.
+func (*EpochReport) Descriptor() ([]byte, []int) {
+	return file_trainer_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *EpochReport) GetWorkerId() int32 {
+	if x != nil {
+		return x.WorkerId
+	}
+	return 0
+}
+
+func (x *EpochReport) GetEpoch() int32 {
+	if x != nil {
+		return x.Epoch
+	}
+	return 0
+}
+
+func (x *EpochReport) GetMse() float64 {
+	if x != nil {
+		return x.Mse
+	}
+	return 0
+}
+
+func (x *EpochReport) GetLast() bool {
+	if x != nil {
+		return x.Last
+	}
+	return false
+}
+
+type Ack struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *Ack) Reset() {
+	*x = Ack{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_trainer_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Ack) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ack) ProtoMessage() {}
+
+func (x *Ack) ProtoReflect() protoreflect.Message {
+	mi := &file_trainer_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ack.ProtoReflect.Descriptor instead.
+func (*Ack) Descriptor() ([]byte, []int) {
+	return file_trainer_proto_rawDescGZIP(), []int{7}
+}
+
+type SubscribeRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Also stream an event for every batch, not only for every epoch.
+	Batches bool `protobuf:"varint,1,opt,name=batches,proto3" json:"batches,omitempty"`
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_trainer_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_trainer_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_trainer_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *SubscribeRequest) GetBatches() bool {
+	if x != nil {
+		return x.Batches
+	}
+	return false
+}
+
+// MetricEvent is one step of a training run. Counters are totals, so a
+// subscriber that misses events, because it fell behind, stays consistent.
+type MetricEvent struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Kind         MetricEvent_Kind `protobuf:"varint,1,opt,name=kind,proto3,enum=trainer.MetricEvent_Kind" json:"kind,omitempty"`
+	TimeUnixNano int64            `protobuf:"varint,2,opt,name=time_unix_nano,json=timeUnixNano,proto3" json:"time_unix_nano,omitempty"`
+	WorkerId     int32            `protobuf:"varint,3,opt,name=worker_id,json=workerId,proto3" json:"worker_id,omitempty"`
+	// Zero-based epoch the batch belongs to, or that was completed.
+	Epoch int32 `protobuf:"varint,4,opt,name=epoch,proto3" json:"epoch,omitempty"`
+	// MSE of the worker's batch or epoch.
+	Mse float64 `protobuf:"fixed64,5,opt,name=mse,proto3" json:"mse,omitempty"`
+	// Batches the worker has trained on, and updates across all workers.
+	WorkerBatches int64 `protobuf:"varint,6,opt,name=worker_batches,json=workerBatches,proto3" json:"worker_batches,omitempty"`
+	Updates       int64 `protobuf:"varint,7,opt,name=updates,proto3" json:"updates,omitempty"`
+	// For EPOCH, the mean MSE of the workers that have completed the epoch.
+	EpochMeanMse float64 `protobuf:"fixed64,8,opt,name=epoch_mean_mse,json=epochMeanMse,proto3" json:"epoch_mean_mse,omitempty"`
+	// For DONE: succeeded or interrupted.
+	Status string `protobuf:"bytes,9,opt,name=status,proto3" json:"status,omitempty"`
+}
+
+func (x *MetricEvent) Reset() {
+	*x = MetricEvent{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_trainer_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *MetricEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MetricEvent) ProtoMessage() {}
+
+func (x *MetricEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_trainer_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MetricEvent.ProtoReflect.Descriptor instead.
+func (*MetricEvent) Descriptor() ([]byte, []int) {
+	return file_trainer_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *MetricEvent) GetKind() MetricEvent_Kind {
+	if x != nil {
+		return x.Kind
+	}
+	return MetricEvent_KIND_UNSPECIFIED
+}
+
+func (x *MetricEvent) GetTimeUnixNano() int64 {
+	if x != nil {
+		return x.TimeUnixNano
+	}
+	return 0
+}
+
+func (x *MetricEvent) GetWorkerId() int32 {
+	if x != nil {
+		return x.WorkerId
+	}
+	return 0
+}
+
+func (x *MetricEvent) GetEpoch() int32 {
+	if x != nil {
+		return x.Epoch
+	}
+	return 0
+}
+
+func (x *MetricEvent) GetMse() float64 {
+	if x != nil {
+		return x.Mse
+	}
+	return 0
+}
+
+func (x *MetricEvent) GetWorkerBatches() int64 {
+	if x != nil {
+		return x.WorkerBatches
+	}
+	return 0
+}
+
+func (x *MetricEvent) GetUpdates() int64 {
+	if x != nil {
+		return x.Updates
+	}
+	return 0
+}
+
+func (x *MetricEvent) GetEpochMeanMse() float64 {
+	if x != nil {
+		return x.EpochMeanMse
+	}
+	return 0
+}
+
+func (x *MetricEvent) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+var File_trainer_proto protoreflect.FileDescriptor
+
+var file_trainer_proto_rawDesc = []byte{
+	0x0a, 0x0d, 0x74, 0x72, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12,
+	0x07, 0x74, 0x72, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x22, 0x55, 0x0a, 0x09, 0x44, 0x61, 0x74, 0x61,
+	0x50, 0x6f, 0x69, 0x6e, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x66, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65,
+	0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x01, 0x52, 0x08, 0x66, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65,
+	0x73, 0x12, 0x14, 0x0a, 0x05, 0x6c, 0x61, 0x62, 0x65, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01,
+	0x52, 0x05, 0x6c, 0x61, 0x62, 0x65, 0x6c, 0x12, 0x16, 0x0a, 0x06, 0x77, 0x65, 0x69, 0x67, 0x68,
+	0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52, 0x06, 0x77, 0x65, 0x69, 0x67, 0x68, 0x74, 0x22,
+	0x29, 0x0a, 0x0b, 0x4a, 0x6f, 0x69, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1a,
+	0x0a, 0x08, 0x68, 0x6f, 0x73, 0x74, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x08, 0x68, 0x6f, 0x73, 0x74, 0x6e, 0x61, 0x6d, 0x65, 0x22, 0xb3, 0x02, 0x0a, 0x0a, 0x41,
+	0x73, 0x73, 0x69, 0x67, 0x6e, 0x6d, 0x65, 0x6e, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x77, 0x6f, 0x72,
+	0x6b, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x77, 0x6f,
+	0x72, 0x6b, 0x65, 0x72, 0x49, 0x64, 0x12, 0x28, 0x0a, 0x05, 0x73, 0x68, 0x61, 0x72, 0x64, 0x18,
+	0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x74, 0x72, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x2e,
+	0x44, 0x61, 0x74, 0x61, 0x50, 0x6f, 0x69, 0x6e, 0x74, 0x52, 0x05, 0x73, 0x68, 0x61, 0x72, 0x64,
+	0x12, 0x16, 0x0a, 0x06, 0x65, 0x70, 0x6f, 0x63, 0x68, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05,
+	0x52, 0x06, 0x65, 0x70, 0x6f, 0x63, 0x68, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x62, 0x61, 0x74, 0x63,
+	0x68, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x09, 0x62, 0x61,
+	0x74, 0x63, 0x68, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x23, 0x0a, 0x0d, 0x6c, 0x65, 0x61, 0x72, 0x6e,
+	0x69, 0x6e, 0x67, 0x5f, 0x72, 0x61, 0x74, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0c,
+	0x6c, 0x65, 0x61, 0x72, 0x6e, 0x69, 0x6e, 0x67, 0x52, 0x61, 0x74, 0x65, 0x12, 0x2c, 0x0a, 0x05,
+	0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x74, 0x72,
+	0x61, 0x69, 0x6e, 0x65, 0x72, 0x2e, 0x4d, 0x6f, 0x64, 0x65, 0x6c, 0x53, 0x6e, 0x61, 0x70, 0x73,
+	0x68, 0x6f, 0x74, 0x52, 0x05, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x12, 0x25, 0x0a, 0x0e, 0x6c, 0x6f,
+	0x73, 0x73, 0x5f, 0x74, 0x6f, 0x6c, 0x65, 0x72, 0x61, 0x6e, 0x63, 0x65, 0x18, 0x07, 0x20, 0x01,
+	0x28, 0x01, 0x52, 0x0d, 0x6c, 0x6f, 0x73, 0x73, 0x54, 0x6f, 0x6c, 0x65, 0x72, 0x61, 0x6e, 0x63,
+	0x65, 0x12, 0x2d, 0x0a, 0x12, 0x67, 0x72, 0x61, 0x64, 0x69, 0x65, 0x6e, 0x74, 0x5f, 0x74, 0x6f,
+	0x6c, 0x65, 0x72, 0x61, 0x6e, 0x63, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x01, 0x52, 0x11, 0x67,
+	0x72, 0x61, 0x64, 0x69, 0x65, 0x6e, 0x74, 0x54, 0x6f, 0x6c, 0x65, 0x72, 0x61, 0x6e, 0x63, 0x65,
+	0x22, 0xa8, 0x01, 0x0a, 0x08, 0x47, 0x72, 0x61, 0x64, 0x69, 0x65, 0x6e, 0x74, 0x12, 0x1b, 0x0a,
+	0x09, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05,
+	0x52, 0x08, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x49, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x77, 0x65,
+	0x69, 0x67, 0x68, 0x74, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x01, 0x52, 0x07, 0x77, 0x65, 0x69,
+	0x67, 0x68, 0x74, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x62, 0x69, 0x61, 0x73, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x01, 0x52, 0x04, 0x62, 0x69, 0x61, 0x73, 0x12, 0x21, 0x0a, 0x0c, 0x62, 0x61, 0x74, 0x63,
+	0x68, 0x5f, 0x77, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0b,
+	0x62, 0x61, 0x74, 0x63, 0x68, 0x57, 0x65, 0x69, 0x67, 0x68, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x76,
+	0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x76, 0x65,
+	0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x06,
+	0x20, 0x01, 0x28, 0x01, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x22, 0x2a, 0x0a, 0x0b, 0x50,
+	0x75, 0x6c, 0x6c, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x77, 0x6f,
+	0x72, 0x6b, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x77,
+	0x6f, 0x72, 0x6b, 0x65, 0x72, 0x49, 0x64, 0x22, 0x57, 0x0a, 0x0d, 0x4d, 0x6f, 0x64, 0x65, 0x6c,
+	0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x77, 0x65, 0x69, 0x67,
+	0x68, 0x74, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x01, 0x52, 0x07, 0x77, 0x65, 0x69, 0x67, 0x68,
+	0x74, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x62, 0x69, 0x61, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01,
+	0x52, 0x04, 0x62, 0x69, 0x61, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65,
+	0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x73,
+	0x22, 0x66, 0x0a, 0x0b, 0x45, 0x70, 0x6f, 0x63, 0x68, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x12,
+	0x1b, 0x0a, 0x09, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x05, 0x52, 0x08, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x49, 0x64, 0x12, 0x14, 0x0a, 0x05,
+	0x65, 0x70, 0x6f, 0x63, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x65, 0x70, 0x6f,
+	0x63, 0x68, 0x12, 0x10, 0x0a, 0x03, 0x6d, 0x73, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52,
+	0x03, 0x6d, 0x73, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x6c, 0x61, 0x73, 0x74, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x04, 0x6c, 0x61, 0x73, 0x74, 0x22, 0x05, 0x0a, 0x03, 0x41, 0x63, 0x6b, 0x22,
+	0x2c, 0x0a, 0x10, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x62, 0x61, 0x74, 0x63, 0x68, 0x65, 0x73, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x62, 0x61, 0x74, 0x63, 0x68, 0x65, 0x73, 0x22, 0xe4, 0x02,
+	0x0a, 0x0b, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12, 0x2d, 0x0a,
+	0x04, 0x6b, 0x69, 0x6e, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x19, 0x2e, 0x74, 0x72,
+	0x61, 0x69, 0x6e, 0x65, 0x72, 0x2e, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x45, 0x76, 0x65, 0x6e,
+	0x74, 0x2e, 0x4b, 0x69, 0x6e, 0x64, 0x52, 0x04, 0x6b, 0x69, 0x6e, 0x64, 0x12, 0x24, 0x0a, 0x0e,
+	0x74, 0x69, 0x6d, 0x65, 0x5f, 0x75, 0x6e, 0x69, 0x78, 0x5f, 0x6e, 0x61, 0x6e, 0x6f, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x0c, 0x74, 0x69, 0x6d, 0x65, 0x55, 0x6e, 0x69, 0x78, 0x4e, 0x61,
+	0x6e, 0x6f, 0x12, 0x1b, 0x0a, 0x09, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x08, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x49, 0x64, 0x12,
+	0x14, 0x0a, 0x05, 0x65, 0x70, 0x6f, 0x63, 0x68, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05,
+	0x65, 0x70, 0x6f, 0x63, 0x68, 0x12, 0x10, 0x0a, 0x03, 0x6d, 0x73, 0x65, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x01, 0x52, 0x03, 0x6d, 0x73, 0x65, 0x12, 0x25, 0x0a, 0x0e, 0x77, 0x6f, 0x72, 0x6b, 0x65,
+	0x72, 0x5f, 0x62, 0x61, 0x74, 0x63, 0x68, 0x65, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x0d, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x42, 0x61, 0x74, 0x63, 0x68, 0x65, 0x73, 0x12, 0x18,
+	0x0a, 0x07, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x07, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x73, 0x12, 0x24, 0x0a, 0x0e, 0x65, 0x70, 0x6f, 0x63,
+	0x68, 0x5f, 0x6d, 0x65, 0x61, 0x6e, 0x5f, 0x6d, 0x73, 0x65, 0x18, 0x08, 0x20, 0x01, 0x28, 0x01,
+	0x52, 0x0c, 0x65, 0x70, 0x6f, 0x63, 0x68, 0x4d, 0x65, 0x61, 0x6e, 0x4d, 0x73, 0x65, 0x12, 0x16,
+	0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
+	0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x22, 0x3c, 0x0a, 0x04, 0x4b, 0x69, 0x6e, 0x64, 0x12, 0x14,
+	0x0a, 0x10, 0x4b, 0x49, 0x4e, 0x44, 0x5f, 0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49, 0x46, 0x49,
+	0x45, 0x44, 0x10, 0x00, 0x12, 0x09, 0x0a, 0x05, 0x42, 0x41, 0x54, 0x43, 0x48, 0x10, 0x01, 0x12,
+	0x09, 0x0a, 0x05, 0x45, 0x50, 0x4f, 0x43, 0x48, 0x10, 0x02, 0x12, 0x08, 0x0a, 0x04, 0x44, 0x4f,
+	0x4e, 0x45, 0x10, 0x03, 0x32, 0xe5, 0x01, 0x0a, 0x07, 0x54, 0x72, 0x61, 0x69, 0x6e, 0x65, 0x72,
+	0x12, 0x31, 0x0a, 0x04, 0x4a, 0x6f, 0x69, 0x6e, 0x12, 0x14, 0x2e, 0x74, 0x72, 0x61, 0x69, 0x6e,
+	0x65, 0x72, 0x2e, 0x4a, 0x6f, 0x69, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x13,
+	0x2e, 0x74, 0x72, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x2e, 0x41, 0x73, 0x73, 0x69, 0x67, 0x6e, 0x6d,
+	0x65, 0x6e, 0x74, 0x12, 0x39, 0x0a, 0x0c, 0x50, 0x75, 0x73, 0x68, 0x47, 0x72, 0x61, 0x64, 0x69,
+	0x65, 0x6e, 0x74, 0x12, 0x11, 0x2e, 0x74, 0x72, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x2e, 0x47, 0x72,
+	0x61, 0x64, 0x69, 0x65, 0x6e, 0x74, 0x1a, 0x16, 0x2e, 0x74, 0x72, 0x61, 0x69, 0x6e, 0x65, 0x72,
+	0x2e, 0x4d, 0x6f, 0x64, 0x65, 0x6c, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x12, 0x39,
+	0x0a, 0x09, 0x50, 0x75, 0x6c, 0x6c, 0x4d, 0x6f, 0x64, 0x65, 0x6c, 0x12, 0x14, 0x2e, 0x74, 0x72,
+	0x61, 0x69, 0x6e, 0x65, 0x72, 0x2e, 0x50, 0x75, 0x6c, 0x6c, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x16, 0x2e, 0x74, 0x72, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x2e, 0x4d, 0x6f, 0x64, 0x65,
+	0x6c, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x12, 0x31, 0x0a, 0x0b, 0x52, 0x65, 0x70,
+	0x6f, 0x72, 0x74, 0x45, 0x70, 0x6f, 0x63, 0x68, 0x12, 0x14, 0x2e, 0x74, 0x72, 0x61, 0x69, 0x6e,
+	0x65, 0x72, 0x2e, 0x45, 0x70, 0x6f, 0x63, 0x68, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x1a, 0x0c,
+	0x2e, 0x74, 0x72, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x2e, 0x41, 0x63, 0x6b, 0x32, 0x51, 0x0a, 0x0f,
+	0x54, 0x72, 0x61, 0x69, 0x6e, 0x69, 0x6e, 0x67, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x73, 0x12,
+	0x3e, 0x0a, 0x09, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x12, 0x19, 0x2e, 0x74,
+	0x72, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x2e, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x14, 0x2e, 0x74, 0x72, 0x61, 0x69, 0x6e, 0x65,
+	0x72, 0x2e, 0x4d, 0x65, 0x74, 0x72, 0x69, 0x63, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x30, 0x01, 0x42,
+	0x35, 0x5a, 0x33, 0x67, 0x6f, 0x70, 0x68, 0x65, 0x72, 0x63, 0x6f, 0x6e, 0x41, 0x55, 0x2f, 0x62,
+	0x61, 0x73, 0x69, 0x63, 0x2d, 0x64, 0x69, 0x73, 0x74, 0x72, 0x69, 0x62, 0x75, 0x74, 0x65, 0x64,
+	0x2d, 0x6d, 0x6c, 0x2d, 0x70, 0x69, 0x70, 0x65, 0x6c, 0x69, 0x6e, 0x65, 0x2f, 0x74, 0x72, 0x61,
+	0x69, 0x6e, 0x65, 0x72, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_trainer_proto_rawDescOnce sync.Once
+	file_trainer_proto_rawDescData = file_trainer_proto_rawDesc
+)
+
+func file_trainer_proto_rawDescGZIP() []byte {
+	file_trainer_proto_rawDescOnce.Do(func() {
+		file_trainer_proto_rawDescData = protoimpl.X.CompressGZIP(file_trainer_proto_rawDescData)
+	})
+	return file_trainer_proto_rawDescData
+}
+
+var file_trainer_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_trainer_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_trainer_proto_goTypes = []any{
+	(MetricEvent_Kind)(0),    // 0: trainer.MetricEvent.Kind
+	(*DataPoint)(nil),        // 1: trainer.DataPoint
+	(*JoinRequest)(nil),      // 2: trainer.JoinRequest
+	(*Assignment)(nil),       // 3: trainer.Assignment
+	(*Gradient)(nil),         // 4: trainer.Gradient
+	(*PullRequest)(nil),      // 5: trainer.PullRequest
+	(*ModelSnapshot)(nil),    // 6: trainer.ModelSnapshot
+	(*EpochReport)(nil),      // 7: trainer.EpochReport
+	(*Ack)(nil),              // 8: trainer.Ack
+	(*SubscribeRequest)(nil), // 9: trainer.SubscribeRequest
+	(*MetricEvent)(nil),      // 10: trainer.MetricEvent
+}
+var file_trainer_proto_depIdxs = []int32{
+	1,  // 0: trainer.Assignment.shard:type_name -> trainer.DataPoint
+	6,  // 1: trainer.Assignment.model:type_name -> trainer.ModelSnapshot
+	0,  // 2: trainer.MetricEvent.kind:type_name -> trainer.MetricEvent.Kind
+	2,  // 3: trainer.Trainer.Join:input_type -> trainer.JoinRequest
+	4,  // 4: trainer.Trainer.PushGradient:input_type -> trainer.Gradient
+	5,  // 5: trainer.Trainer.PullModel:input_type -> trainer.PullRequest
+	7,  // 6: trainer.Trainer.ReportEpoch:input_type -> trainer.EpochReport
+	9,  // 7: trainer.TrainingMetrics.Subscribe:input_type -> trainer.SubscribeRequest
+	3,  // 8: trainer.Trainer.Join:output_type -> trainer.Assignment
+	6,  // 9: trainer.Trainer.PushGradient:output_type -> trainer.ModelSnapshot
+	6,  // 10: trainer.Trainer.PullModel:output_type -> trainer.ModelSnapshot
+	8,  // 11: trainer.Trainer.ReportEpoch:output_type -> trainer.Ack
+	10, // 12: trainer.TrainingMetrics.Subscribe:output_type -> trainer.MetricEvent
+	8,  // [8:13] is the sub-list for method output_type
+	3,  // [3:8] is the sub-list for method input_type
+	3,  // [3:3] is the sub-list for extension type_name
+	3,  // [3:3] is the sub-list for extension extendee
+	0,  // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_trainer_proto_init() }
+func file_trainer_proto_init() {
+	if File_trainer_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_trainer_proto_msgTypes[0].Exporter = func(v any, i int) any {
+			switch v := v.(*DataPoint); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_trainer_proto_msgTypes[1].Exporter = func(v any, i int) any {
+			switch v := v.(*JoinRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_trainer_proto_msgTypes[2].Exporter = func(v any, i int) any {
+			switch v := v.(*Assignment); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_trainer_proto_msgTypes[3].Exporter = func(v any, i int) any {
+			switch v := v.(*Gradient); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_trainer_proto_msgTypes[4].Exporter = func(v any, i int) any {
+			switch v := v.(*PullRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_trainer_proto_msgTypes[5].Exporter = func(v any, i int) any {
+			switch v := v.(*ModelSnapshot); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_trainer_proto_msgTypes[6].Exporter = func(v any, i int) any {
+			switch v := v.(*EpochReport); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_trainer_proto_msgTypes[7].Exporter = func(v any, i int) any {
+			switch v := v.(*Ack); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_trainer_proto_msgTypes[8].Exporter = func(v any, i int) any {
+			switch v := v.(*SubscribeRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_trainer_proto_msgTypes[9].Exporter = func(v any, i int) any {
+			switch v := v.(*MetricEvent); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_trainer_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   2,
+		},
+		GoTypes:           file_trainer_proto_goTypes,
+		DependencyIndexes: file_trainer_proto_depIdxs,
+		EnumInfos:         file_trainer_proto_enumTypes,
+		MessageInfos:      file_trainer_proto_msgTypes,
+	}.Build()
+	File_trainer_proto = out.File
+	file_trainer_proto_rawDesc = nil
+	file_trainer_proto_goTypes = nil
+	file_trainer_proto_depIdxs = nil
+}
@@ -0,0 +1,360 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: trainer.proto
+
+package trainerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	Trainer_Join_FullMethodName         = "/trainer.Trainer/Join"
+	Trainer_PushGradient_FullMethodName = "/trainer.Trainer/PushGradient"
+	Trainer_PullModel_FullMethodName    = "/trainer.Trainer/PullModel"
+	Trainer_ReportEpoch_FullMethodName  = "/trainer.Trainer/ReportEpoch"
+)
+
+// TrainerClient is the client API for Trainer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Trainer is served by the master. Workers join to receive a shard of the
+// training data, then repeatedly push the gradient of one batch and get back
+// the updated model.
+type TrainerClient interface {
+	Join(ctx context.Context, in *JoinRequest, opts ...grpc.CallOption) (*Assignment, error)
+	PushGradient(ctx context.Context, in *Gradient, opts ...grpc.CallOption) (*ModelSnapshot, error)
+	PullModel(ctx context.Context, in *PullRequest, opts ...grpc.CallOption) (*ModelSnapshot, error)
+	ReportEpoch(ctx context.Context, in *EpochReport, opts ...grpc.CallOption) (*Ack, error)
+}
+
+type trainerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTrainerClient(cc grpc.ClientConnInterface) TrainerClient {
+	return &trainerClient{cc}
+}
+
+func (c *trainerClient) Join(ctx context.Context, in *JoinRequest, opts ...grpc.CallOption) (*Assignment, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Assignment)
+	err := c.cc.Invoke(ctx, Trainer_Join_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trainerClient) PushGradient(ctx context.Context, in *Gradient, opts ...grpc.CallOption) (*ModelSnapshot, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ModelSnapshot)
+	err := c.cc.Invoke(ctx, Trainer_PushGradient_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trainerClient) PullModel(ctx context.Context, in *PullRequest, opts ...grpc.CallOption) (*ModelSnapshot, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ModelSnapshot)
+	err := c.cc.Invoke(ctx, Trainer_PullModel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *trainerClient) ReportEpoch(ctx context.Context, in *EpochReport, opts ...grpc.CallOption) (*Ack, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Ack)
+	err := c.cc.Invoke(ctx, Trainer_ReportEpoch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TrainerServer is the server API for Trainer service.
+// All implementations must embed UnimplementedTrainerServer
+// for forward compatibility
+//
+// Trainer is served by the master. Workers join to receive a shard of the
+// training data, then repeatedly push the gradient of one batch and get back
+// the updated model.
+type TrainerServer interface {
+	Join(context.Context, *JoinRequest) (*Assignment, error)
+	PushGradient(context.Context, *Gradient) (*ModelSnapshot, error)
+	PullModel(context.Context, *PullRequest) (*ModelSnapshot, error)
+	ReportEpoch(context.Context, *EpochReport) (*Ack, error)
+	mustEmbedUnimplementedTrainerServer()
+}
+
+// UnimplementedTrainerServer must be embedded to have forward compatible implementations.
+type UnimplementedTrainerServer struct {
+}
+
+func (UnimplementedTrainerServer) Join(context.Context, *JoinRequest) (*Assignment, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Join not implemented")
+}
+func (UnimplementedTrainerServer) PushGradient(context.Context, *Gradient) (*ModelSnapshot, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PushGradient not implemented")
+}
+func (UnimplementedTrainerServer) PullModel(context.Context, *PullRequest) (*ModelSnapshot, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PullModel not implemented")
+}
+func (UnimplementedTrainerServer) ReportEpoch(context.Context, *EpochReport) (*Ack, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReportEpoch not implemented")
+}
+func (UnimplementedTrainerServer) mustEmbedUnimplementedTrainerServer() {}
+
+// UnsafeTrainerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TrainerServer will
+// result in compilation errors.
+type UnsafeTrainerServer interface {
+	mustEmbedUnimplementedTrainerServer()
+}
+
+func RegisterTrainerServer(s grpc.ServiceRegistrar, srv TrainerServer) {
+	s.RegisterService(&Trainer_ServiceDesc, srv)
+}
+
+func _Trainer_Join_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JoinRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrainerServer).Join(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Trainer_Join_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrainerServer).Join(ctx, req.(*JoinRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Trainer_PushGradient_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Gradient)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrainerServer).PushGradient(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Trainer_PushGradient_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrainerServer).PushGradient(ctx, req.(*Gradient))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Trainer_PullModel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PullRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrainerServer).PullModel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Trainer_PullModel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrainerServer).PullModel(ctx, req.(*PullRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Trainer_ReportEpoch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EpochReport)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TrainerServer).ReportEpoch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Trainer_ReportEpoch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TrainerServer).ReportEpoch(ctx, req.(*EpochReport))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Trainer_ServiceDesc is the grpc.ServiceDesc for Trainer service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Trainer_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "trainer.Trainer",
+	HandlerType: (*TrainerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Join",
+			Handler:    _Trainer_Join_Handler,
+		},
+		{
+			MethodName: "PushGradient",
+			Handler:    _Trainer_PushGradient_Handler,
+		},
+		{
+			MethodName: "PullModel",
+			Handler:    _Trainer_PullModel_Handler,
+		},
+		{
+			MethodName: "ReportEpoch",
+			Handler:    _Trainer_ReportEpoch_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "trainer.proto",
+}
+
+const (
+	TrainingMetrics_Subscribe_FullMethodName = "/trainer.TrainingMetrics/Subscribe"
+)
+
+// TrainingMetricsClient is the client API for TrainingMetrics service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// TrainingMetrics is served by a training run, local or master, so that
+// dashboards on other machines can follow it live.
+type TrainingMetricsClient interface {
+	// Subscribe replays the epochs completed so far, then streams events as
+	// they happen. The stream ends after the DONE event.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (TrainingMetrics_SubscribeClient, error)
+}
+
+type trainingMetricsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTrainingMetricsClient(cc grpc.ClientConnInterface) TrainingMetricsClient {
+	return &trainingMetricsClient{cc}
+}
+
+func (c *trainingMetricsClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (TrainingMetrics_SubscribeClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TrainingMetrics_ServiceDesc.Streams[0], TrainingMetrics_Subscribe_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &trainingMetricsSubscribeClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type TrainingMetrics_SubscribeClient interface {
+	Recv() (*MetricEvent, error)
+	grpc.ClientStream
+}
+
+type trainingMetricsSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *trainingMetricsSubscribeClient) Recv() (*MetricEvent, error) {
+	m := new(MetricEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// TrainingMetricsServer is the server API for TrainingMetrics service.
+// All implementations must embed UnimplementedTrainingMetricsServer
+// for forward compatibility
+//
+// TrainingMetrics is served by a training run, local or master, so that
+// dashboards on other machines can follow it live.
+type TrainingMetricsServer interface {
+	// Subscribe replays the epochs completed so far, then streams events as
+	// they happen. The stream ends after the DONE event.
+	Subscribe(*SubscribeRequest, TrainingMetrics_SubscribeServer) error
+	mustEmbedUnimplementedTrainingMetricsServer()
+}
+
+// UnimplementedTrainingMetricsServer must be embedded to have forward compatible implementations.
+type UnimplementedTrainingMetricsServer struct {
+}
+
+func (UnimplementedTrainingMetricsServer) Subscribe(*SubscribeRequest, TrainingMetrics_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedTrainingMetricsServer) mustEmbedUnimplementedTrainingMetricsServer() {}
+
+// UnsafeTrainingMetricsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TrainingMetricsServer will
+// result in compilation errors.
+type UnsafeTrainingMetricsServer interface {
+	mustEmbedUnimplementedTrainingMetricsServer()
+}
+
+func RegisterTrainingMetricsServer(s grpc.ServiceRegistrar, srv TrainingMetricsServer) {
+	s.RegisterService(&TrainingMetrics_ServiceDesc, srv)
+}
+
+func _TrainingMetrics_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TrainingMetricsServer).Subscribe(m, &trainingMetricsSubscribeServer{ServerStream: stream})
+}
+
+type TrainingMetrics_SubscribeServer interface {
+	Send(*MetricEvent) error
+	grpc.ServerStream
+}
+
+type trainingMetricsSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *trainingMetricsSubscribeServer) Send(m *MetricEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// TrainingMetrics_ServiceDesc is the grpc.ServiceDesc for TrainingMetrics service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TrainingMetrics_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "trainer.TrainingMetrics",
+	HandlerType: (*TrainingMetricsServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _TrainingMetrics_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "trainer.proto",
+}
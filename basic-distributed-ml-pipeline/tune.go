@@ -0,0 +1,144 @@
+package distributed
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"time"
+
+	"gopherconAU/cli"
+	"gopherconAU/dataset"
+	"gopherconAU/logging"
+	"gopherconAU/metrics"
+	"gopherconAU/tuner"
+)
+
+// runTune implements the "tune" command: it searches learning rates, batch
+// sizes, epoch counts and worker counts, training several configurations at
+// once on the same split, and prints them ranked by a validation metric, the
+// MSE unless -metric names another registered one.
+func runTune(args []string) {
+	fs := flag.NewFlagSet("tune", flag.ExitOnError)
+	search := fs.String("search", "grid", "search strategy: grid (every combination) or random")
+	trials := fs.Int("trials", 10, "configurations sampled by the random search")
+	parallel := fs.Int("parallel", runtime.NumCPU(), "trials trained at the same time")
+	batchDelay := fs.Duration("batch-delay", 0, "simulated per-batch compute cost of every trial")
+	seed := fs.Int64("seed", 42, "seed for the train/validation split and the random search")
+	out := fs.String("out", "", "also write every trial's parameters and score to this JSON file")
+	metricName := fs.String("metric", "mse", "registered metric to rank trials by; scores for which higher is better are negated in the table")
+	dataPath := fs.String("data", "winequality-dataset.csv", "CSV or .xlsx file to train on")
+	space := tuner.Space{
+		LearningRates: []float64{0.001, 0.01, 0.1},
+		BatchSizes:    []int{16, 32, 64},
+		Epochs:        []int{5, 10},
+		Workers:       []int{1, 4},
+	}
+	space.RegisterFlags(fs)
+	mapping := defaultMapping()
+	mapping.RegisterFlags(fs)
+	var parseOptions dataset.Options
+	parseOptions.RegisterFlags(fs)
+	var noise dataset.Noise
+	noise.RegisterFlags(fs)
+	// The training logs of concurrent trials interleave, so only warnings
+	// are shown unless asked for.
+	logOptions := logging.Options{Level: "warn"}
+	logOptions.RegisterFlags(fs)
+	cli.Parse(fs, args)
+	configureLogging(logOptions)
+	defer logger.Close()
+
+	metric, err := metrics.Lookup(*metricName)
+	if err != nil {
+		logger.Error("Invalid -metric: %v", err)
+		return
+	}
+	// value turns a metric into the loss tuner.Search minimizes and back, by
+	// negating it if higher is better.
+	value := func(score float64) float64 {
+		if metric.HigherIsBetter {
+			return -score
+		}
+		return score
+	}
+
+	rng := rand.New(rand.NewSource(*seed))
+	var configs []tuner.Params
+	switch *search {
+	case "grid":
+		configs = space.Grid()
+	case "random":
+		if *trials < 1 {
+			logger.Error("-trials must be at least 1")
+			return
+		}
+		configs = space.Random(*trials, rng)
+	default:
+		logger.Error("Unknown search strategy %q", *search)
+		return
+	}
+
+	data, err := loadData(*dataPath, mapping, parseOptions)
+	if err != nil {
+		logger.Error("Failed to load data: %v", err)
+		return
+	}
+	data, _ = normalize(data)
+
+	// Every trial trains and is scored on the same split.
+	rng.Shuffle(len(data), func(i, j int) {
+		data[i], data[j] = data[j], data[i]
+	})
+	splitIndex := int(float64(len(data)) * 0.8)
+	trainData, validationData := data[:splitIndex], data[splitIndex:]
+
+	objective := func(p tuner.Params) (float64, error) {
+		model, _, err := train(context.Background(), TrainConfig{
+			Workers:      p.Workers,
+			BatchSize:    p.BatchSize,
+			Epochs:       p.Epochs,
+			LearningRate: p.LearningRate,
+			BatchDelay:   *batchDelay,
+			Consistency:  "async",
+			Noise:        noise,
+			Mode:         "shared",
+		}, trainData)
+		if err != nil {
+			return 0, err
+		}
+		if metric.Name == "mse" {
+			// The weighted MSE, as training minimizes.
+			return meanSquaredError(model.Weights, model.Bias, validationData), nil
+		}
+		return value(metricScore(metric, model.Weights, model.Bias, validationData)), nil
+	}
+
+	log := logger.With("search", *search)
+	log.Info("Tuning %d configurations, %d at a time", len(configs), *parallel)
+	start := time.Now()
+	results := tuner.Search(configs, *parallel, objective, func(r tuner.Result) {
+		if r.Err != nil {
+			log.Warn("Trial failed (%s): %v", r.Params, r.Err)
+			return
+		}
+		log.With("duration_ms", logging.Milliseconds(r.Duration)).Info("Trial done (%s): validation %s %.6f", r.Params, metric.Name, value(r.Score))
+	})
+	tuner.PrintTable(os.Stdout, results)
+
+	best := tuner.Ranked(results)[0]
+	if best.Err != nil {
+		logger.Error("Every trial failed")
+		return
+	}
+	log.With("duration_ms", logging.Milliseconds(time.Since(start))).Info("Tuning completed")
+	fmt.Printf("\nBest configuration: %s (validation %s %.6f)\n", best.Params, metric.Name, value(best.Score))
+	if *out != "" {
+		if err := writeJSON(*out, tuner.Ranked(results)); err != nil {
+			logger.Error("Failed to write %s: %v", *out, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package distributed
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"gopherconAU/blobstore"
+	"gopherconAU/cli"
+	"gopherconAU/convergence"
+	"gopherconAU/dataset"
+	"gopherconAU/logging"
+)
+
+// PartialFit continues training on new rows only, leaving what the model
+// learned from earlier data in place. It stops before passes once the loss
+// over data meets stopping, and returns why, or "" after every pass.
+func (m *Model) PartialFit(data []DataPoint, learningRate float64, batchSize, passes int, stopping convergence.Criteria) string {
+	monitor := stopping.Monitor()
+	for pass := 0; pass < passes; pass++ {
+		for i := 0; i < len(data); i += batchSize {
+			end := i + batchSize
+			if end > len(data) {
+				end = len(data)
+			}
+
+			m.mu.Lock()
+			weightGradients, biasGradient := computeGradients(m.Weights, m.Bias, data[i:end])
+			for j := range m.Weights {
+				m.Weights[j] -= learningRate * weightGradients[j]
+			}
+			m.Bias -= learningRate * biasGradient
+			m.Updates++
+			m.mu.Unlock()
+		}
+
+		if stopping.Enabled() {
+			m.mu.Lock()
+			weightGradients, biasGradient := computeGradients(m.Weights, m.Bias, data)
+			loss := meanSquaredError(m.Weights, m.Bias, data)
+			m.mu.Unlock()
+			if converged := monitor.Converged(loss, convergence.Norm(weightGradients, []float64{biasGradient})); converged != "" {
+				return fmt.Sprintf("%s after %d passes", converged, pass+1)
+			}
+		}
+	}
+	return ""
+}
+
+// csvTail follows a CSV file that is only ever appended to.
+type csvTail struct {
+	path    string
+	offset  int64
+	line    int // lines of the file before offset, for error reporting
+	options dataset.Options
+}
+
+// next returns the complete rows appended since the last call, with the line
+// of the file each starts on. A trailing partial line is left for the next
+// poll.
+func (t *csvTail) next() ([][]string, []int, error) {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.Size() < t.offset {
+		logger.Info("%s shrank from %d to %d bytes, following from the new end", t.path, t.offset, info.Size())
+		if t.line, err = countLines(t.path, info.Size()); err != nil {
+			return nil, nil, err
+		}
+		t.offset = info.Size()
+		return nil, nil, nil
+	}
+	if info.Size() == t.offset {
+		return nil, nil, nil
+	}
+
+	chunk := make([]byte, info.Size()-t.offset)
+	if _, err := file.ReadAt(chunk, t.offset); err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	complete := bytes.LastIndexByte(chunk, '\n') + 1
+	if complete == 0 {
+		return nil, nil, nil
+	}
+
+	reader := t.options.CSVReader(bytes.NewReader(chunk[:complete]))
+	reader.FieldsPerRecord = -1
+	var records [][]string
+	var lines []int
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("parsing appended rows: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, record)
+		lines = append(lines, t.line+line)
+	}
+	t.offset += int64(complete)
+	t.line += bytes.Count(chunk[:complete], []byte{'\n'})
+	return records, lines, nil
+}
+
+// countLines returns the number of lines in the first size bytes of the file
+// at path, which is where a tail starting at size picks up the numbering.
+func countLines(path string, size int64) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	lines := 0
+	buf := make([]byte, 64*1024)
+	reader := io.LimitReader(file, size)
+	for {
+		n, err := reader.Read(buf)
+		lines += bytes.Count(buf[:n], []byte{'\n'})
+		if err == io.EOF {
+			return lines, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// publishModel stores the artifact as the given version in the registry.
+func publishModel(ctx context.Context, registry blobstore.Store, version int, artifact ModelArtifact) (string, error) {
+	key := fmt.Sprintf("model-v%04d.json", version)
+	return key, putArtifact(ctx, registry, key, artifact)
+}
+
+// latestPublished returns the highest version publishModel has stored in the
+// registry, or 0 if there is none, so that a restarted watch numbers its
+// versions after those of earlier runs instead of overwriting them.
+func latestPublished(ctx context.Context, registry blobstore.Store) (int, error) {
+	keys, err := registry.List(ctx, "model-v")
+	if err != nil {
+		return 0, err
+	}
+	latest := 0
+	for _, key := range keys {
+		var version int
+		if _, err := fmt.Sscanf(key, "model-v%d.json", &version); err == nil && version > latest {
+			latest = version
+		}
+	}
+	return latest, nil
+}
+
+// runWatch implements the "watch" command: train once, then keep polling the
+// training CSV for appended rows (and optionally a directory for new CSV
+// files), apply each increment with PartialFit and publish a new model
+// version whenever validation MSE improves.
+func runWatch(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	dataPath := fs.String("data", "winequality-dataset.csv", "training CSV to follow for appended rows")
+	incomingDir := fs.String("dir", "", "directory to watch for new CSV files with the same columns")
+	interval := fs.Duration("interval", 5*time.Second, "polling interval")
+	modelDir := fs.String("model-dir", "models", "model registry receiving published versions: a directory, s3://bucket/prefix or gs://bucket/prefix")
+	learningRate := fs.Float64("lr", 0.01, "learning rate for incremental updates")
+	passes := fs.Int("passes", 3, "SGD passes over each increment")
+	seed := fs.Int64("seed", 1, "seed for the validation split")
+	var stopping convergence.Criteria
+	stopping.RegisterFlags(fs)
+	mapping := defaultMapping()
+	mapping.RegisterFlags(fs)
+	var parseOptions dataset.Options
+	parseOptions.RegisterFlags(fs)
+	var logOptions logging.Options
+	logOptions.RegisterFlags(fs)
+	cli.Parse(fs, args)
+	configureLogging(logOptions)
+	defer logger.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	registry, err := blobstore.Open(ctx, *modelDir)
+	if err != nil {
+		logger.Error("Failed to open model registry: %v", err)
+		return
+	}
+	defer registry.Close()
+
+	// Appended rows are selected and filtered like the rows loaded below,
+	// starting from the file's own header.
+	unselected := parseOptions
+	unselected.Columns, unselected.Filter = "", ""
+	header, err := dataset.ReadHeader(*dataPath, unselected)
+	if err != nil {
+		logger.Error("Failed to read header: %v", err)
+		return
+	}
+	selection, err := parseOptions.Select(header)
+	if err != nil {
+		logger.Error("%v", err)
+		return
+	}
+	cols, err := mapping.Resolve(selection.Header)
+	if err != nil {
+		logger.Error("%v", err)
+		return
+	}
+	info, err := os.Stat(*dataPath)
+	if err != nil {
+		logger.Error("Failed to stat dataset: %v", err)
+		return
+	}
+
+	data, err := loadData(*dataPath, mapping, parseOptions)
+	if err != nil {
+		logger.Error("Failed to load data: %v", err)
+		return
+	}
+	rowsSeen := len(data)
+
+	// The scaler and validation set are fixed at start-up so successive
+	// versions are compared on equal terms.
+	scaler := fitScaler(data)
+	data = scaler.transform(data)
+	rand.New(rand.NewSource(*seed)).Shuffle(len(data), func(i, j int) {
+		data[i], data[j] = data[j], data[i]
+	})
+	splitIndex := int(float64(len(data)) * 0.8)
+	trainData, validation := data[:splitIndex], data[splitIndex:]
+
+	model, _, err := train(ctx, TrainConfig{
+		Workers:      4,
+		BatchSize:    32,
+		Epochs:       10,
+		LearningRate: *learningRate,
+		Mode:         "shared",
+	}, trainData)
+	if err != nil {
+		logger.Error("Failed to train: %v", err)
+		return
+	}
+
+	version, err := latestPublished(ctx, registry)
+	if err != nil {
+		logger.Error("Failed to list published versions in %s: %v", registry, err)
+		return
+	}
+	bestMSE := meanSquaredError(model.Weights, model.Bias, validation)
+	publish := func() {
+		fingerprint, err := fingerprintDataset(*dataPath, rowsSeen, parseOptions)
+		if err != nil {
+			logger.Error("Failed to fingerprint dataset: %v", err)
+			return
+		}
+		key, err := publishModel(ctx, registry, version+1, ModelArtifact{
+			Kind:      linearKind,
+			Weights:   append([]float64(nil), model.Weights...),
+			Bias:      model.Bias,
+			Scaler:    &scaler,
+			Dataset:   fingerprint,
+			Features:  cols.FeatureNames,
+			TestMSE:   bestMSE,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			logger.Error("Failed to publish model version %d: %v", version+1, err)
+			return
+		}
+		version++
+		logger.Info("Published model version %d (validation MSE %.6f) as %s in %s", version, bestMSE, key, registry)
+	}
+	publish()
+
+	lines, err := countLines(*dataPath, info.Size())
+	if err != nil {
+		logger.Error("Failed to read dataset: %v", err)
+		return
+	}
+	tail := &csvTail{path: *dataPath, offset: info.Size(), line: lines, options: parseOptions}
+	seenFiles := make(map[string]bool)
+	if *incomingDir != "" {
+		existing, _ := filepath.Glob(filepath.Join(*incomingDir, "*.csv"))
+		for _, path := range existing {
+			seenFiles[path] = true
+		}
+	}
+
+	logger.Info("Watching %s for appended rows every %v", *dataPath, *interval)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Watch stopped at model version %d", version)
+			return
+		case <-ticker.C:
+		}
+
+		var increment []DataPoint
+		records, lines, err := tail.next()
+		if err != nil {
+			logger.Error("Failed to read appended rows: %v", err)
+		}
+		for i, record := range records {
+			row := selection.Row(lines[i], record, parseOptions)
+			if row == nil {
+				continue
+			}
+			dp, err := parseRecord(row, cols)
+			if err != nil {
+				logger.Error("Skipping appended row: %v", err)
+				continue
+			}
+			increment = append(increment, dp)
+		}
+
+		if *incomingDir != "" {
+			paths, _ := filepath.Glob(filepath.Join(*incomingDir, "*.csv"))
+			sort.Strings(paths)
+			for _, path := range paths {
+				if seenFiles[path] {
+					continue
+				}
+				seenFiles[path] = true
+				rows, err := loadData(path, mapping, parseOptions)
+				if err != nil {
+					logger.Error("Skipping %s: %v", path, err)
+					continue
+				}
+				increment = append(increment, rows...)
+			}
+		}
+
+		if len(increment) == 0 {
+			continue
+		}
+		rowsSeen += len(increment)
+
+		if converged := model.PartialFit(scaler.transform(increment), *learningRate, 32, *passes, stopping); converged != "" {
+			logger.Info("Increment converged: %s", converged)
+		}
+		mse := meanSquaredError(model.Weights, model.Bias, validation)
+		logger.Info("Applied %d new rows, validation MSE %.6f (best %.6f)", len(increment), mse, bestMSE)
+		if mse < bestMSE {
+			bestMSE = mse
+			publish()
+		}
+	}
+}
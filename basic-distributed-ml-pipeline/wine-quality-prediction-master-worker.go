@@ -1,19 +1,43 @@
-package main
+// Package distributed is the train-distributed command: it trains a linear
+// model of wine quality on workers sharing a parameter server, in process or
+// over gRPC, and has subcommands to report, tune, watch, schedule and serve
+// such runs.
+package distributed
 
 import (
-	"encoding/csv"
-	"log"
+	"context"
+	"flag"
+	"fmt"
 	"math"
 	"math/rand"
 	"os"
+	"os/signal"
+	"runtime/trace"
 	"strconv"
 	"sync"
+	"syscall"
 	"time"
+
+	"gopherconAU/baseline"
+	"gopherconAU/cli"
+	"gopherconAU/convergence"
+	"gopherconAU/dataset"
+	"gopherconAU/logging"
+	"gopherconAU/manifest"
+	"gopherconAU/metrics"
+	"gopherconAU/preprocess"
+	"gopherconAU/profiling"
+	"gopherconAU/regularization"
+
+	"gonum.org/v1/gonum/mat"
 )
 
 type DataPoint struct {
 	Features []float64
 	Label    float64
+	Weight   float64 // importance of the sample in loss, gradients and metrics
+	Group    string  // rows sharing a non-empty group are never split apart
+	ID       string  // id column value, or the row's position in the dataset
 }
 
 type Model struct {
@@ -24,6 +48,27 @@ type Model struct {
 	StartTime time.Time
 	Metrics   map[int]float64 // Epoch -> MSE mapping
 	MetricsMu sync.Mutex
+	// workerMetrics[worker][epoch] is the MSE every worker reported, NaN for
+	// epochs it has not reported; Metrics is merged from it.
+	workerMetrics [][]float64
+	// EvalTrajectory holds the test MSE measured during training when
+	// progressive evaluation is enabled.
+	EvalTrajectory []EvalPoint
+	// MeanStaleness and MaxStaleness count the updates applied between a
+	// worker pulling the weights and pushing its gradient.
+	MeanStaleness float64
+	MaxStaleness  int64
+	// Resources is the resource usage after every epoch completed by all
+	// workers.
+	Resources []ResourceUsage
+	// Scaler standardized the training data; it is saved with the model so
+	// new rows can be scored the same way.
+	Scaler *Scaler
+	// Dataset and Features identify the data the model was trained on and
+	// its feature columns in weight order; they are saved with the model so
+	// rows laid out differently are refused rather than scored.
+	Dataset  DatasetFingerprint
+	Features []string
 }
 
 // Utilising Master-Worker architecture, Worker here represents a distributed training worker
@@ -31,130 +76,326 @@ type Worker struct {
 	ID          int
 	Data        []DataPoint
 	BatchSize   int
+	BatchDelay  time.Duration
+	Server      ParameterServer
+	Controller  *batchController // nil unless batch size adaptation is enabled
+	Diagnostics *diagnostics
+	Budget      *budget
+	Best        *bestModel
+	Evaluator   *progressiveEvaluator // nil unless progressive evaluation is enabled
 	Model       *Model
 	GradientSum int
+	FirstEpoch  int // epochs already completed by a resumed run
+	Checkpoints *epochCheckpointer
+	Ordering    string // batch ordering, see ordering.go; empty is sequential
+	Seed        int64  // seed of the run, which random orderings mix in
+	Metrics     *trainingMetrics
+	CPUSets     [][]int // nil leaves the worker unpinned
+	Convergence convergence.Criteria
+	Penalty     regularization.Penalty // applied by the server; its loss at the weights pulled every epoch counts towards convergence
 }
 
-type Logger struct {
-	*log.Logger
-	mu sync.Mutex
-}
+// logger is configured by the -log-* flags of every command.
+var logger = logging.New()
 
-func NewLogger() *Logger {
-	return &Logger{
-		Logger: log.New(os.Stdout, "", log.Ldate|log.Ltime|log.Lmicroseconds),
+// configureLogging applies the -log-* flags, exiting on invalid values.
+func configureLogging(options logging.Options) {
+	if err := logger.Configure(options); err != nil {
+		logger.Fatal("Invalid logging flags: %v", err)
 	}
 }
 
-func (l *Logger) Info(format string, v ...interface{}) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.Printf("[INFO] "+format, v...)
+// defaultMapping matches the columns this program has always used: fixed
+// acidity is the label and every other column is a feature.
+func defaultMapping() dataset.Mapping {
+	return dataset.Mapping{Label: "fixed acidity"}
 }
 
-func (l *Logger) Debug(format string, v ...interface{}) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.Printf("[DEBUG] "+format, v...)
+// loadData reads and parses the wine dataset with logging, taking the label,
+// weight and feature columns from mapping. Without a weight column every
+// sample has weight 1. Rows that fail to parse abort the load unless options
+// allows skipping them, and so does a file left with no rows.
+func loadData(filepath string, mapping dataset.Mapping, options dataset.Options) ([]DataPoint, error) {
+	data, err := readData(filepath, mapping, options)
+	if err == nil && len(data) == 0 {
+		err = noRows(options)
+		logger.Error("Failed to load dataset: %v", err)
+	}
+	return data, err
 }
 
-func (l *Logger) Error(format string, v ...interface{}) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.Printf("[ERROR] "+format, v...)
+// noRows explains why a load kept no rows.
+func noRows(options dataset.Options) error {
+	switch {
+	case options.Filter != "":
+		return fmt.Errorf("no rows match the filter %q", options.Filter)
+	case options.Missing == dataset.MissingDrop:
+		return fmt.Errorf("no rows are left after dropping those with missing values")
+	}
+	return fmt.Errorf("no rows")
 }
 
-var logger = NewLogger()
-
-// loadData reads and parses the wine dataset with logging
-func loadData(filepath string) ([]DataPoint, error) {
+// readData is loadData without the check that rows were loaded.
+func readData(filepath string, mapping dataset.Mapping, options dataset.Options) ([]DataPoint, error) {
 	logger.Info("Starting data loading from %s", filepath)
 	startTime := time.Now()
 
-	file, err := os.Open(filepath)
+	loaded, err := dataset.CSVLoader{Path: filepath, Mapping: mapping, Options: options}.Load()
 	if err != nil {
-		logger.Error("Failed to open dataset: %v", err)
+		logger.Error("Failed to load dataset: %v", err)
 		return nil, err
 	}
-	defer file.Close()
+	if summary := loaded.Summary(); summary != "" {
+		logger.Info("%s: %s", filepath, summary)
+	}
+	if options.Filter != "" {
+		logger.Info("%s: filter %q kept %d rows and dropped %d", filepath, options.Filter, loaded.Len(), loaded.Filtered())
+	}
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		logger.Error("Failed to read CSV data: %v", err)
-		return nil, err
+	data := make([]DataPoint, loaded.Len())
+	for i, features := range loaded.X {
+		data[i] = DataPoint{Features: features, Label: loaded.Y[i], Weight: loaded.Weight(i)}
+		if loaded.Groups != nil {
+			data[i].Group = loaded.Groups[i]
+		}
+		if loaded.IDs != nil {
+			data[i].ID = loaded.IDs[i]
+		}
 	}
 
-	var dataset []DataPoint
-	for _, record := range records[1:] {
-		var features []float64
-		for i := 1; i < len(record); i++ {
-			val, err := strconv.ParseFloat(record[i], 64)
-			if err != nil {
-				logger.Error("Failed to parse feature value: %v", err)
-				return nil, err
-			}
-			features = append(features, val)
+	logger.Info("Data loading completed in %v. Total samples: %d", time.Since(startTime), len(data))
+	return data, nil
+}
+
+// loadFiles loads the files of a multi-file dataset concurrently and returns
+// their rows concatenated in file order, along with the row count of each
+// file. Rows without an id column are identified by their 0-based position
+// in that order. Files may be empty, but not all of them.
+func loadFiles(paths []string, mapping dataset.Mapping, options dataset.Options) ([]DataPoint, []int, error) {
+	parts := make([][]DataPoint, len(paths))
+	errs := make([]error, len(paths))
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			parts[i], errs[i] = readData(path, mapping, options)
+		}(i, path)
+	}
+	wg.Wait()
+
+	var data []DataPoint
+	sizes := make([]int, len(paths))
+	for i, part := range parts {
+		if errs[i] != nil {
+			return nil, nil, fmt.Errorf("%s: %v", paths[i], errs[i])
+		}
+		data = append(data, part...)
+		sizes[i] = len(part)
+	}
+	if len(data) == 0 {
+		return nil, nil, noRows(options)
+	}
+	for i := range data {
+		if data[i].ID == "" {
+			data[i].ID = strconv.Itoa(i)
 		}
+	}
+	if len(paths) > 1 {
+		logger.Info("Loaded %d samples from %d files", len(data), len(paths))
+	}
+	return data, sizes, nil
+}
 
-		label, err := strconv.ParseFloat(record[0], 64)
-		if err != nil {
-			logger.Error("Failed to parse label value: %v", err)
-			return nil, err
+// splitParts cuts data into consecutive slices of the given sizes.
+func splitParts(data []DataPoint, sizes []int) [][]DataPoint {
+	parts := make([][]DataPoint, len(sizes))
+	start := 0
+	for i, n := range sizes {
+		parts[i] = data[start : start+n]
+		start += n
+	}
+	return parts
+}
+
+// splitTrainTest shuffles data with rng and keeps trainRatio of it for
+// training. Rows that share a group all land on the same side.
+func splitTrainTest(data []DataPoint, trainRatio float64, rng *rand.Rand) (train, test []DataPoint) {
+	rng.Shuffle(len(data), func(i, j int) {
+		data[i], data[j] = data[j], data[i]
+	})
+	if !hasGroups(data) {
+		splitIndex := int(float64(len(data)) * trainRatio)
+		return data[:splitIndex], data[splitIndex:]
+	}
+
+	trainRows, testRows := dataset.GroupSplit(groupKeys(data), 1-trainRatio, rng)
+	for _, i := range trainRows {
+		train = append(train, data[i])
+	}
+	for _, i := range testRows {
+		test = append(test, data[i])
+	}
+	return train, test
+}
+
+func hasGroups(data []DataPoint) bool {
+	for _, dp := range data {
+		if dp.Group != "" {
+			return true
 		}
+	}
+	return false
+}
+
+// groupKeys returns every row's group, giving rows without one a group of
+// their own.
+func groupKeys(data []DataPoint) []string {
+	keys := make([]string, len(data))
+	for i, dp := range data {
+		keys[i] = dp.Group
+		if keys[i] == "" {
+			keys[i] = fmt.Sprintf("\x00row %d", i)
+		}
+	}
+	return keys
+}
 
-		dataset = append(dataset, DataPoint{
-			Features: features,
-			Label:    label,
-		})
+// parseRecord converts one CSV row using the resolved column mapping, for
+// rows read one at a time rather than through dataset.CSVLoader.
+func parseRecord(row *dataset.Row, cols dataset.Columns) (DataPoint, error) {
+	features := make([]float64, len(cols.Features))
+	for j, i := range cols.Features {
+		features[j] = row.Float(i)
 	}
 
-	logger.Info("Data loading completed in %v. Total samples: %d", time.Since(startTime), len(dataset))
-	return dataset, nil
+	weight := 1.0
+	if cols.Weight >= 0 {
+		weight = row.Float(cols.Weight)
+		row.Check(weight >= 0, cols.Weight, "negative sample weight")
+	}
+
+	var group, id string
+	if cols.Group >= 0 {
+		group = row.Fields[cols.Group]
+	}
+	if cols.ID >= 0 {
+		id = row.Fields[cols.ID]
+	}
+
+	label := row.Float(cols.Label)
+	if err := row.Err(); err != nil {
+		return DataPoint{}, err
+	}
+
+	return DataPoint{
+		Features: features,
+		Label:    label,
+		Weight:   weight,
+		Group:    group,
+		ID:       id,
+	}, nil
 }
 
-func normalize(data []DataPoint) []DataPoint {
-	logger.Info("Starting feature normalization")
-	startTime := time.Now()
+// Scaler holds the per-feature statistics used to standardize data, so rows
+// arriving later can be transformed exactly like the training set. It is a
+// preprocess.StandardScaler that transforms DataPoints.
+type Scaler struct {
+	preprocess.StandardScaler
+}
 
-	featureCount := len(data[0].Features)
-	means := make([]float64, featureCount)
-	stds := make([]float64, featureCount)
+func fitScaler(data []DataPoint) Scaler {
+	rows := make([][]float64, len(data))
+	for i, dp := range data {
+		rows[i] = dp.Features
+	}
+	var scaler Scaler
+	scaler.Fit(rows)
+	return scaler
+}
 
-	for i := 0; i < featureCount; i++ {
-		sum := 0.0
-		for _, dp := range data {
-			sum += dp.Features[i]
+// then returns the scaler that standardizes as s followed by next, which
+// was fitted on rows s had already standardized.
+func (s Scaler) then(next Scaler) Scaler {
+	var composed Scaler
+	for j := range s.Means {
+		std, nextStd := s.Stds[j], next.Stds[j]
+		if std == 0 {
+			std = 1
+		}
+		if nextStd == 0 {
+			nextStd = 1
 		}
-		means[i] = sum / float64(len(data))
+		composed.Means = append(composed.Means, s.Means[j]+std*next.Means[j])
+		composed.Stds = append(composed.Stds, std*nextStd)
 	}
+	return composed
+}
 
-	for i := 0; i < featureCount; i++ {
-		sumSquares := 0.0
-		for _, dp := range data {
-			sumSquares += math.Pow(dp.Features[i]-means[i], 2)
+// statsScaler builds the scaler from the column statistics saved next to
+// each dataset file, computing them on first use, so repeated runs over a
+// large file skip the fitting pass. Rows skipped as unparseable still count
+// towards the statistics.
+func statsScaler(paths []string, mapping dataset.Mapping, options dataset.Options) (Scaler, error) {
+	var parts []*dataset.Stats
+	for _, path := range paths {
+		stats, cached, err := dataset.LoadStats(path, options)
+		if stats == nil {
+			return Scaler{}, err
+		}
+		if err != nil {
+			logger.Error("%v", err)
+		}
+		if cached {
+			logger.Info("Using column statistics from %s", dataset.StatsPath(path))
+		} else {
+			logger.Info("Computed column statistics for %s over %d rows", path, stats.Rows)
+		}
+		parts = append(parts, stats)
+	}
+	stats, err := dataset.MergeStats(parts...)
+	if err != nil {
+		return Scaler{}, err
+	}
+
+	header := make([]string, len(stats.Columns))
+	for i, c := range stats.Columns {
+		header[i] = c.Name
+	}
+	cols, err := mapping.Resolve(header)
+	if err != nil {
+		return Scaler{}, err
+	}
+	var scaler Scaler
+	for _, i := range cols.Features {
+		c := stats.Columns[i]
+		if c.Missing > 0 {
+			return Scaler{}, fmt.Errorf("column %q has %d missing values", c.Name, c.Missing)
 		}
-		stds[i] = math.Sqrt(sumSquares / float64(len(data)))
+		scaler.Means = append(scaler.Means, c.Mean)
+		scaler.Stds = append(scaler.Stds, c.Std)
 	}
+	return scaler, nil
+}
 
+func (s Scaler) transform(data []DataPoint) []DataPoint {
 	normalizedData := make([]DataPoint, len(data))
 	for i, dp := range data {
-		normalizedFeatures := make([]float64, featureCount)
-		for j := 0; j < featureCount; j++ {
-			if stds[j] != 0 {
-				normalizedFeatures[j] = (dp.Features[j] - means[j]) / stds[j]
-			} else {
-				normalizedFeatures[j] = dp.Features[j] - means[j]
-			}
-		}
-		normalizedData[i] = DataPoint{
-			Features: normalizedFeatures,
-			Label:    dp.Label,
-		}
+		dp.Features = s.TransformRow(dp.Features)
+		normalizedData[i] = dp
 	}
+	return normalizedData
+}
+
+func normalize(data []DataPoint) ([]DataPoint, Scaler) {
+	logger.Info("Starting feature normalization")
+	startTime := time.Now()
+
+	scaler := fitScaler(data)
+	normalizedData := scaler.transform(data)
 
 	logger.Info("Feature normalization completed in %v", time.Since(startTime))
-	return normalizedData
+	return normalizedData, scaler
 }
 
 func (m *Model) predict(features []float64) float64 {
@@ -165,81 +406,278 @@ func (m *Model) predict(features []float64) float64 {
 	return sum
 }
 
-func (w *Worker) trainWorker(epochs int, learningRate float64, wg *sync.WaitGroup) {
+// PredictBatch predicts every row of X with a single matrix-vector multiply
+// against the current weights.
+func (m *Model) PredictBatch(X [][]float64) []float64 {
+	m.mu.Lock()
+	weights := mat.NewVecDense(len(m.Weights), append([]float64(nil), m.Weights...))
+	bias := m.Bias
+	m.mu.Unlock()
+
+	if len(X) == 0 {
+		return nil
+	}
+	rows := make([]float64, 0, len(X)*weights.Len())
+	for _, features := range X {
+		rows = append(rows, features...)
+	}
+	predictions := mat.NewVecDense(len(X), nil)
+	predictions.MulVec(mat.NewDense(len(X), weights.Len(), rows), weights)
+	for i := range X {
+		predictions.SetVec(i, predictions.AtVec(i)+bias)
+	}
+	return predictions.RawVector().Data
+}
+
+// recordEpoch stores the MSE a worker reported for an epoch in the worker's
+// own buffer and sets the epoch's entry in Metrics to the mean over the
+// workers that reported it, summed in worker order, so the merged value does
+// not depend on which worker finished the epoch last.
+func (m *Model) recordEpoch(worker, epoch int, mse float64) {
+	m.MetricsMu.Lock()
+	defer m.MetricsMu.Unlock()
+	for len(m.workerMetrics) <= worker {
+		m.workerMetrics = append(m.workerMetrics, nil)
+	}
+	for len(m.workerMetrics[worker]) <= epoch {
+		m.workerMetrics[worker] = append(m.workerMetrics[worker], math.NaN())
+	}
+	m.workerMetrics[worker][epoch] = mse
+
+	sum, reported := 0.0, 0
+	for _, epochs := range m.workerMetrics {
+		if epoch < len(epochs) && !math.IsNaN(epochs[epoch]) {
+			sum += epochs[epoch]
+			reported++
+		}
+	}
+	m.Metrics[epoch] = sum / float64(reported)
+}
+
+func (w *Worker) trainWorker(ctx context.Context, epochs int, learningRate float64, wg *sync.WaitGroup) {
 	defer wg.Done()
-	logger.Info("Worker %d starting training with %d samples", w.ID, len(w.Data))
+	defer func() {
+		if r := recover(); r != nil {
+			w.Diagnostics.recovered(fmt.Sprintf("worker %d", w.ID), r, nil)
+			w.Server.Leave(w.ID)
+		}
+	}()
+	pinWorker(w.ID, w.CPUSets)
+	// CPU profiles attribute the worker's samples to it, the epoch and
+	// whether it is training a batch or finishing the epoch; traces show it
+	// as a task with a region per batch.
+	ctx, task := trace.NewTask(ctx, "worker")
+	defer task.End()
+	ctx = profiling.Label(ctx, "worker", strconv.Itoa(w.ID))
+	log := logger.With("worker_id", w.ID)
+	log.Info("Worker %d starting training with %d samples", w.ID, len(w.Data))
+	startTime := time.Now()
+	monitor := w.Convergence.Monitor()
 
-	for epoch := 0; epoch < epochs; epoch++ {
+	for epoch := w.FirstEpoch; epoch < epochs; epoch++ {
 		epochStartTime := time.Now()
 		batchErrors := make([]float64, 0)
+		epochVariance := 0.0
 
-		for i := 0; i < len(w.Data); i += w.BatchSize {
+		epochCtx := profiling.Label(ctx, "epoch", strconv.Itoa(epoch+1), "phase", "batch")
+		trace.Logf(epochCtx, "epoch", "%d", epoch+1)
+		data := w.epochData(epoch)
+		w.Metrics.startEpoch(w.ID, (len(data)+w.BatchSize-1)/w.BatchSize)
+		for i := 0; i < len(data); i += w.BatchSize {
 			end := i + w.BatchSize
-			if end > len(w.Data) {
-				end = len(w.Data)
+			if end > len(data) {
+				end = len(data)
 			}
-			batch := w.Data[i:end]
-
-			time.Sleep(100 * time.Millisecond)
+			batch := data[i:end]
 
-			weightGradients := make([]float64, len(w.Model.Weights))
-			biasGradient := 0.0
-			batchError := 0.0
-
-			for _, dp := range batch {
-				prediction := w.Model.predict(dp.Features)
-				error := prediction - dp.Label
-				batchError += math.Pow(error, 2)
-
-				for j, feature := range dp.Features {
-					weightGradients[j] += error * feature
-				}
-				biasGradient += error
+			if ctx.Err() != nil {
+				log.With("epoch", epoch+1).Info("Worker %d stopping in epoch %d: interrupted", w.ID, epoch+1)
+				w.Server.Leave(w.ID)
+				return
 			}
-
-			batchErrors = append(batchErrors, batchError/float64(len(batch)))
-
-			w.Model.mu.Lock()
-			for j := range w.Model.Weights {
-				w.Model.Weights[j] -= learningRate * weightGradients[j] / float64(len(batch))
+			if w.Budget.exhausted() {
+				log.With("epoch", epoch+1).Info("Worker %d stopping in epoch %d: %s", w.ID, epoch+1, w.Budget.stopReason())
+				w.Server.Leave(w.ID)
+				return
 			}
-			w.Model.Bias -= learningRate * biasGradient / float64(len(batch))
-			w.Model.Updates++
-			w.Model.mu.Unlock()
 
+			region := trace.StartRegion(epochCtx, "batch")
+			batchError, variance, ok := w.safeStep(epoch, i, batch, learningRate)
+			region.End()
+			if !ok {
+				continue
+			}
+			updates := w.Budget.spend()
+			w.Metrics.batchDone(w.ID, batchError)
+			if w.Evaluator != nil {
+				w.Evaluator.observe(w.Model, updates)
+			}
+			batchErrors = append(batchErrors, batchError)
+			epochVariance += variance
 			w.GradientSum++
 		}
+		profiling.Label(epochCtx, "phase", "epoch-end")
+		if len(batchErrors) == 0 {
+			// Every batch was skipped or recovered from, which leaves no MSE
+			// to record, checkpoint, or judge convergence and the batch size
+			// by. The worker still passes the epoch barrier.
+			log.With("epoch", epoch+1).Warn("Worker %d epoch %d/%d had no successful batch; not recording it", w.ID, epoch+1, epochs)
+			w.Server.Advance(w.ID)
+			continue
+		}
 		averageError := 0.0
 		for _, err := range batchErrors {
 			averageError += err
 		}
 		averageError /= float64(len(batchErrors))
 
-		w.Model.MetricsMu.Lock()
-		w.Model.Metrics[epoch] = averageError
-		w.Model.MetricsMu.Unlock()
+		w.Model.recordEpoch(w.ID, epoch, averageError)
+		w.Best.offer(w.Model, epoch, averageError)
+		w.Metrics.epochDone(w.ID, epoch, averageError)
+
+		epochTime := time.Since(epochStartTime)
+		// With a penalty, training minimizes half the MSE plus the penalty,
+		// and that is the loss that has to settle for convergence.
+		loss := averageError
+		if w.Penalty.Enabled() {
+			loss = averageError/2 + w.Penalty.Loss(w.Server.Pull(w.ID).Weights)
+			log.With("epoch", epoch+1, "duration_ms", logging.Milliseconds(epochTime), "mse", averageError, "loss", loss).Info(
+				"Worker %d completed epoch %d/%d in %v - Avg MSE: %.6f, regularized loss: %.6f", w.ID, epoch+1, epochs, epochTime, averageError, loss)
+		} else {
+			log.With("epoch", epoch+1, "duration_ms", logging.Milliseconds(epochTime), "mse", averageError).Info(
+				"Worker %d completed epoch %d/%d in %v - Avg MSE: %.6f", w.ID, epoch+1, epochs, epochTime, averageError)
+		}
 
-		logger.Info("Worker %d completed epoch %d/%d in %v - Avg MSE: %.6f",
-			w.ID, epoch+1, epochs, time.Since(epochStartTime), averageError)
+		if w.Controller != nil {
+			epochVariance /= float64(len(batchErrors))
+			w.BatchSize = w.Controller.adjust(w.ID, epoch, w.BatchSize, epochVariance, averageError)
+		}
+
+		w.Checkpoints.epochDone(w.ID, w.Model)
+
+		gradientNorm := -1.0
+		if w.Convergence.GradientTolerance > 0 {
+			gradientNorm = shardGradientNorm(w.Server.Pull(w.ID), w.Data)
+		}
+		if converged := monitor.Converged(loss, gradientNorm); converged != "" {
+			log.With("epoch", epoch+1).Info("Worker %d converged after epoch %d: %s", w.ID, epoch+1, converged)
+			break
+		}
+		w.Server.Advance(w.ID)
+	}
+	w.Server.Leave(w.ID)
+
+	trainingTime := time.Since(startTime)
+	log.With("duration_ms", logging.Milliseconds(trainingTime), "updates", w.GradientSum).Info(
+		"Worker %d completed training. Total gradient updates: %d (%.1f updates/s)",
+		w.ID, w.GradientSum, float64(w.GradientSum)/trainingTime.Seconds())
+	if w.Controller != nil {
+		log.Info("Worker %d made %d batch size adaptations, final batch size %d",
+			w.ID, w.Controller.events, w.BatchSize)
+	}
+}
+
+// safeStep runs step, turning a panic into a diagnostics bundle for the batch
+// so one bad batch does not take down the whole run.
+func (w *Worker) safeStep(epoch, start int, batch []DataPoint, learningRate float64) (batchError, variance float64, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			w.Diagnostics.recovered(fmt.Sprintf("worker %d", w.ID), r, summarizeBatch(w.ID, epoch, start, batch))
+			ok = false
+		}
+	}()
+	return w.step(batch, learningRate)
+}
+
+// step pulls the weights, computes the weighted gradient of one batch against
+// them and pushes it back. The simulated compute cost falls between the two,
+// so other workers' updates make the gradient stale. It reports false for
+// batches whose weights sum to zero.
+func (w *Worker) step(batch []DataPoint, learningRate float64) (float64, float64, bool) {
+	pulled := w.Server.Pull(w.ID)
+	g := computeGradient(pulled, batch)
+	time.Sleep(w.BatchDelay)
+	if g.weight == 0 {
+		return 0, 0, false
 	}
+	w.Server.Push(w.ID, g, pulled.Updates, learningRate)
+	return g.error / g.weight, gradientVariance(g.weights, g.squared, g.bias, g.squaredBias, g.weight), true
+}
 
-	logger.Info("Worker %d completed training. Total gradient updates: %d",
-		w.ID, w.GradientSum)
+// batchGradient holds the sample-weighted sums of one batch's squared-error
+// gradient, and of its squares, from which its variance is estimated.
+type batchGradient struct {
+	weights     []float64
+	squared     []float64
+	bias        float64
+	squaredBias float64
+	error       float64 // weighted sum of squared errors
+	weight      float64 // total sample weight
+}
+
+func computeGradient(model *Model, batch []DataPoint) batchGradient {
+	g := batchGradient{
+		weights: make([]float64, len(model.Weights)),
+		squared: make([]float64, len(model.Weights)),
+	}
+	for _, dp := range batch {
+		prediction := model.predict(dp.Features)
+		error := prediction - dp.Label
+		g.error += dp.Weight * math.Pow(error, 2)
+		g.weight += dp.Weight
+
+		for j, feature := range dp.Features {
+			g.weights[j] += dp.Weight * error * feature
+			g.squared[j] += dp.Weight * math.Pow(error*feature, 2)
+		}
+		g.bias += dp.Weight * error
+		g.squaredBias += dp.Weight * error * error
+	}
+	return g
+}
+
+// shardGradientNorm is the norm of the mean loss gradient of model over
+// data, or -1 when the data weighs nothing.
+func shardGradientNorm(model *Model, data []DataPoint) float64 {
+	g := computeGradient(model, data)
+	if g.weight == 0 {
+		return -1
+	}
+	return convergence.Norm(g.weights, []float64{g.bias}) / g.weight
+}
+
+// applyGradient takes one SGD step with gradient sums over a batch of the
+// given total weight, then shrinks the weights by penalty. It returns the
+// number of updates made before it.
+func (m *Model) applyGradient(weights []float64, bias, batchWeight, learningRate float64, penalty regularization.Penalty) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for j := range m.Weights {
+		m.Weights[j] -= learningRate * weights[j] / batchWeight
+	}
+	penalty.Shrink(m.Weights, learningRate)
+	m.Bias -= learningRate * bias / batchWeight
+	m.Updates++
+	return m.Updates - 1
 }
 
 func evaluate(model *Model, testData []DataPoint) float64 {
 	logger.Info("Starting model evaluation on %d test samples", len(testData))
 	startTime := time.Now()
 
-	var totalError float64
-	predictions := make([]float64, len(testData))
+	features := make([][]float64, len(testData))
+	for i, dp := range testData {
+		features[i] = dp.Features
+	}
+	predictions := model.PredictBatch(features)
 
+	var totalError, totalWeight float64
 	for i, dp := range testData {
-		predictions[i] = model.predict(dp.Features)
-		totalError += math.Pow(predictions[i]-dp.Label, 2)
+		totalError += dp.Weight * math.Pow(predictions[i]-dp.Label, 2)
+		totalWeight += dp.Weight
 	}
 
-	mse := totalError / float64(len(testData))
+	mse := totalError / totalWeight
 	rmse := math.Sqrt(mse)
 
 	logger.Info("Evaluation completed in %v", time.Since(startTime))
@@ -250,99 +688,636 @@ func evaluate(model *Model, testData []DataPoint) float64 {
 	return mse
 }
 
-func main() {
+// meanBaseline returns the test MSE of predicting the mean training label
+// for every test point, the floor a trained model's MSE should be read
+// against, and that mean.
+func meanBaseline(trainData, testData []DataPoint) (mse, value float64) {
+	labels := make([]float64, len(trainData))
+	for i, dp := range trainData {
+		labels[i] = dp.Label
+	}
+	var mean baseline.Regressor
+	if err := mean.Fit(nil, labels); err != nil || len(testData) == 0 {
+		return math.NaN(), math.NaN()
+	}
+	return meanSquaredError(make([]float64, len(testData[0].Features)), mean.Value, testData), mean.Value
+}
+
+// Main runs the command with the arguments after its name: a subcommand
+// and its flags, or the flags of a training run.
+func Main(args []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case "report":
+			runReport(args[1:])
+			return
+		case "watch":
+			runWatch(args[1:])
+			return
+		case "schedule":
+			runSchedule(args[1:])
+			return
+		case "cache":
+			runCache(args[1:])
+			return
+		case "predict":
+			runPredict(args[1:])
+			return
+		case "tune":
+			runTune(args[1:])
+			return
+		case "diffmodel":
+			runDiffModel(args[1:])
+			return
+		case "follow":
+			runFollow(args[1:])
+			return
+		case "fetch-data":
+			runFetchData(args[1:])
+			return
+		case "serve":
+			runServe(args[1:])
+			return
+		}
+	}
+
+	workerCount := flag.Int("workers", 4, "number of in-process workers training the model")
+	batchSize := flag.Int("batch-size", 32, "rows in every worker's batch")
+	epochs := flag.Int("epochs", 10, "passes every worker makes over its shard")
+	learningRate := flag.Float64("learning-rate", 0.01, "step size of every gradient update")
+	role := flag.String("role", "local", "process role: local (in-process workers), master (serve training over gRPC) or worker (join a master)")
+	listenAddr := flag.String("listen", ":50051", "address the master serves gRPC training on")
+	masterAddr := flag.String("master", "localhost:50051", "address of the master a worker joins")
+	remoteWorkers := flag.Int("grpc-workers", 2, "number of worker processes the master waits for")
+	joinWindow := flag.Duration("join-timeout", 5*time.Minute, "how long the master waits for all -grpc-workers processes to join; the shards still unclaimed then are dropped, and the run fails if none joined. 0 waits forever")
+	workerTimeout := flag.Duration("worker-timeout", time.Minute, "how long a joined worker process may go without calling the master before it is dropped with its shard; 0 waits for it forever")
+	mode := flag.String("mode", "shared", "training mode: shared (one mutex-guarded model) or gossip (decentralized peer averaging)")
+	gossipInterval := flag.Duration("gossip-interval", 500*time.Millisecond, "how often each worker averages weights with its peers in gossip mode")
+	gossipFanout := flag.Int("gossip-fanout", 1, "number of random peers contacted per gossip round")
+	consistency := flag.String("consistency", "async", "parameter server consistency model: async, sync (barrier after every epoch) or ssp (bounded staleness)")
+	staleness := flag.Int("staleness", 2, "epochs a worker may run ahead of the slowest one with -consistency ssp")
+	syncEpochs := flag.Bool("sync", false, "shorthand for -consistency sync")
+	ordering := flag.String("ordering", OrderSequential, "order in which workers take their batches each epoch: sequential, random, easy-first (smallest residual first) or loss-weighted (resampled by squared residual)")
+	aggregation := flag.String("aggregation", "hogwild", "how gradients reach the model: hogwild (each applied as it arrives) or allreduce (one averaged update per round of worker batches)")
+	batchDelay := flag.Duration("batch-delay", 100*time.Millisecond, "simulated per-batch compute cost")
+	adaptiveBatch := flag.Bool("adaptive-batch", false, "adapt each worker's batch size from gradient variance and loss plateaus")
+	varianceThreshold := flag.Float64("variance-threshold", 1.0, "gradient variance below which the batch size is doubled")
+	plateauTolerance := flag.Float64("plateau-tolerance", 0.01, "relative epoch loss improvement below which the batch size is halved")
+	maxBatch := flag.Int("max-batch", 256, "upper bound for the adaptive batch size")
+	mapping := defaultMapping()
+	mapping.RegisterFlags(flag.CommandLine)
+	var parseOptions dataset.Options
+	parseOptions.RegisterFlags(flag.CommandLine)
+	var noise dataset.Noise
+	noise.RegisterFlags(flag.CommandLine)
+	var stopping convergence.Criteria
+	stopping.RegisterFlags(flag.CommandLine)
+	// -l1-ratio also sets the mix of the -reg-path elasticnet penalty.
+	penalty := regularization.Penalty{Kind: regularization.L2, L1Ratio: 0.5}
+	penalty.RegisterFlags(flag.CommandLine)
+	saveModel := flag.String("save-model", "", "write the trained model, tagged with the dataset hashes, to this JSON file")
+	metricsAddr := flag.String("metrics-addr", "", "serve Prometheus training metrics on this address at /metrics, e.g. :9091 (empty to disable)")
+	streamAddr := flag.String("stream-addr", "", "stream live training metrics over gRPC on this address for follow and dashboards, e.g. :50052 (empty to disable)")
+	dashboardAddr := flag.String("dashboard-addr", "", "serve a live dashboard of the training progress on this address, e.g. :8080 (empty to disable)")
+	runRecord := flag.String("run-record", "", "write an experiment record of this run to this JSON file")
+	olsFit := flag.Bool("ols", false, "fit the closed-form OLS model and print coefficient inference instead of training")
+	confidence := flag.Float64("confidence", 0.95, "confidence level for OLS coefficient intervals")
+	regPath := flag.String("reg-path", "", "compute a cross-validated lasso, ridge or elasticnet regularization path instead of training")
+	regPathOut := flag.String("reg-path-out", "regularization-path.html", "path of the generated regularization path chart")
+	regPathLambdas := flag.Int("lambdas", 40, "number of lambdas on the regularization path grid")
+	cvFolds := flag.Int("cv-folds", 5, "cross-validation folds used to select lambda")
+	foldSeed := flag.Int64("fold-seed", 1, "random seed of the cross-validation fold assignment")
+	foldsOut := flag.String("folds-out", "", "write the cross-validation fold of every row (id,fold CSV) to this file")
+	foldsIn := flag.String("folds-in", "", "read cross-validation folds from an id,fold CSV instead of assigning them")
+	simulateRun := flag.Bool("simulate", false, "run the deterministic cluster simulator instead of real training")
+	simWorkers := flag.Int("sim-workers", 4, "number of simulated workers")
+	simCompute := flag.String("sim-compute", "50ms,50ms,80ms,200ms", "comma-separated per-batch compute times, cycled over simulated workers")
+	simLatency := flag.String("sim-latency", "5ms,5ms,10ms,20ms", "comma-separated one-way network latencies, cycled over simulated workers")
+	simStaleness := flag.Int("sim-staleness", 2, "staleness bound for the simulated SSP strategy")
+	simTarget := flag.Float64("sim-target", 5.0, "test MSE that counts as reaching target accuracy")
+	simOut := flag.String("sim-out", "simulation.html", "path of the generated time-to-accuracy chart")
+	cacheDir := flag.String("cache-dir", defaultCacheDir(), "directory caching preprocessed datasets by content hash and transform")
+	noCache := flag.Bool("no-cache", false, "always load and preprocess the dataset from scratch")
+	dataPath := flag.String("data", "winequality-dataset.csv", "training data: a CSV or .xlsx file, a directory of them or a glob such as data/part-*.csv")
+	shardByFile := flag.Bool("shard-by-file", false, "give each worker whole files of a multi-file dataset instead of an equal share of the rows")
+	maxDuration := flag.Duration("max-duration", 0, "stop training gracefully after this long (0 for no limit)")
+	maxUpdates := flag.Int64("max-updates", 0, "stop training gracefully after this many model updates (0 for no limit)")
+	evalEvery := flag.Int64("eval-every", 0, "evaluate a weight snapshot on the test set every N updates while training (0 disables)")
+	evalMetric := flag.String("eval-metric", "", "registered metric, such as mae or r2, also scored on every -eval-every snapshot")
+	evalPatience := flag.Int("eval-patience", 0, "stop training once -eval-metric, or the test MSE, has not improved for N evaluations (0 disables)")
+	reportMetrics := flag.String("report-metrics", "", "comma-separated registered metrics, such as mae,r2, added to the test metrics of the summary")
+	checkpointPath := flag.String("checkpoint", "checkpoint.json", "where checkpoints are written, a file or a URL such as s3://bucket/prefix/checkpoint.json or gs://bucket/prefix/checkpoint.json: the model every -checkpoint-every epochs; the best model so far when a budget stops training goes beside it, to checkpoint.best.json for checkpoint.json")
+	checkpointEvery := flag.Int("checkpoint-every", 1, "checkpoint the model after every N epochs completed by all workers (0 disables)")
+	resumePath := flag.String("resume", "", "restore the model from this checkpoint, a file or an s3:// or gs:// URL, and continue training after its last completed epoch")
+	diagnosticsDir := flag.String("diagnostics-dir", "diagnostics", "directory receiving a bundle for every recovered worker panic")
+	cpuSetList := flag.String("cpu-sets", "", "pin workers to CPU sets: semicolon-separated cpulists such as \"0-7;8-15\", or numa for one set per NUMA node; worker i gets set i modulo their number (Linux only)")
+	var webhooks webhookList
+	flag.Var(&webhooks, "webhook", "URL notified when the run completes or fails (repeatable; Slack URLs get a chat message)")
+	var profiles profiling.Options
+	profiles.RegisterFlags(flag.CommandLine)
+	var repro manifest.Options
+	repro.RegisterFlags(flag.CommandLine)
+	var logOptions logging.Options
+	logOptions.RegisterFlags(flag.CommandLine)
+	cli.Parse(flag.CommandLine, args)
+	configureLogging(logOptions)
+	defer logger.Close()
+	run, err := repro.Start(flag.CommandLine, "fold-seed", "noise-seed")
+	if err != nil {
+		logger.Error("Invalid -seed: %v", err)
+		return
+	}
+	logger.Info("Seed: %d", repro.Seed)
+	stopProfiles, err := profiles.Start()
+	if err != nil {
+		logger.Error("Failed to start profiling: %v", err)
+		return
+	}
+	defer func() {
+		if err := stopProfiles(); err != nil {
+			logger.Error("Failed to write profiles: %v", err)
+		}
+	}()
+
+	// An interrupt stops training cleanly: workers finish their batch, the
+	// model so far is checkpointed and the run is reported as usual.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var cpuSets [][]int
+	if *cpuSetList != "" {
+		var err error
+		if cpuSets, err = parseCPUSets(*cpuSetList); err != nil {
+			logger.Error("Invalid -cpu-sets: %v", err)
+			return
+		}
+	}
+
+	switch *role {
+	case "local", "master":
+	case "worker":
+		if err := runRemoteWorker(ctx, *masterAddr, *batchDelay, cpuSets); err != nil {
+			logger.Error("Worker failed: %v", err)
+			os.Exit(1)
+		}
+		return
+	default:
+		logger.Error("Unknown role %q", *role)
+		return
+	}
+
+	if *mode != "shared" && *mode != "gossip" {
+		logger.Error("Unknown training mode %q", *mode)
+		return
+	}
+	if *syncEpochs {
+		*consistency = "sync"
+	}
+	if *consistency != "async" && *consistency != "sync" && *consistency != "ssp" {
+		logger.Error("Unknown consistency model %q", *consistency)
+		return
+	}
+	if !validOrdering(*ordering) {
+		logger.Error("Unknown batch ordering %q", *ordering)
+		return
+	}
+	if *aggregation != "hogwild" && *aggregation != "allreduce" {
+		logger.Error("Unknown aggregation %q", *aggregation)
+		return
+	}
+	if *aggregation == "allreduce" && *mode == "gossip" {
+		logger.Error("Allreduce aggregation needs -mode shared")
+		return
+	}
+	if *evalMetric != "" {
+		if _, err := metrics.Lookup(*evalMetric); err != nil {
+			logger.Error("Invalid -eval-metric: %v", err)
+			return
+		}
+	}
+	if *evalPatience > 0 && *evalEvery <= 0 {
+		logger.Error("-eval-patience needs -eval-every")
+		return
+	}
+	extraMetrics, err := metrics.LookupAll(dataset.SplitList(*reportMetrics))
+	if err != nil {
+		logger.Error("Invalid -report-metrics: %v", err)
+		return
+	}
+	if *staleness < 0 {
+		logger.Error("Staleness bound must not be negative, got %d", *staleness)
+		return
+	}
+	if err := stopping.Validate(); err != nil {
+		logger.Error("Invalid convergence criteria: %v", err)
+		return
+	}
+	if err := penalty.Validate(); err != nil {
+		logger.Error("Invalid penalty: %v", err)
+		return
+	}
+
 	mainStartTime := time.Now()
+	summary := RunSummary{Job: "train", StartedAt: mainStartTime}
+	fail := func(format string, v ...interface{}) {
+		logger.Error(format, v...)
+		summary.Status = "failed"
+		summary.Error = fmt.Sprintf(format, v...)
+		summary.Duration = time.Since(mainStartTime)
+		notifyWebhooks(webhooks, summary)
+	}
 	logger.Info("Starting distributed ML pipeline")
 	logger.Info("Implementation details:")
 	logger.Info("- Architecture: Data Parallel Training")
 	logger.Info("- Design Pattern: Observer Pattern for Metrics")
-	logger.Info("- Synchronization: Mutex-based Parameter Updates")
+	if *mode == "gossip" {
+		logger.Info("- Synchronization: Gossip Averaging (interval %v, fan-out %d)", *gossipInterval, *gossipFanout)
+	} else if *aggregation == "allreduce" {
+		logger.Info("- Synchronization: AllReduce (gradients averaged every round)")
+	} else {
+		logger.Info("- Synchronization: Parameter Server (%s consistency)", *consistency)
+	}
 
-	data, err := loadData("/workspaces/gopherConAU/winequality-dataset.csv")
+	dataPaths, err := dataset.Files(*dataPath)
+	if err != nil {
+		fail("Failed to find dataset: %v", err)
+		return
+	}
+	fingerprint, err := fingerprintFiles(*dataPath, dataPaths, 0, parseOptions)
 	if err != nil {
-		logger.Error("Failed to load data: %v", err)
+		fail("Failed to fingerprint dataset: %v", err)
 		return
 	}
+	summary.Dataset = &fingerprint
+	logger.Info("Dataset content hash: %s", fingerprint.ContentHash)
+	logger.Info("Dataset schema hash: %s", fingerprint.SchemaHash)
 
-	data = normalize(data)
+	header, err := dataset.ReadHeader(dataPaths[0], parseOptions)
+	if err != nil {
+		fail("Failed to read header: %v", err)
+		return
+	}
+	columns, err := mapping.Resolve(header)
+	if err != nil {
+		fail("Invalid column mapping: %v", err)
+		return
+	}
+	logger.Info("Label column %q, %d feature columns", mapping.Label, len(columns.Features))
 
+	var cache *preprocessCache
+	if !*noCache {
+		if cache, err = openPreprocessCache(*cacheDir); err != nil {
+			logger.Error("Preprocessing cache disabled: %v", err)
+		}
+	}
+	preprocess := PreprocessConfig{Transform: "standardize", Mapping: mapping, Parse: parseOptions}
+	data, fileRows, scaler, err := loadPreprocessed(cache, *dataPath, dataPaths, fingerprint.ContentHash, preprocess)
+	if err != nil {
+		fail("Failed to load data: %v", err)
+		return
+	}
+	fingerprint.Rows = len(data)
+
+	if *simulateRun {
+		runSimulation(data, *simWorkers, *simCompute, *simLatency, *simStaleness, *simTarget, *simOut)
+		return
+	}
+
+	// Folds are assigned over the whole dataset, in file order, so an
+	// exported assignment does not depend on the train/test split.
+	var folds map[string]int
+	switch {
+	case *foldsIn != "":
+		if folds, err = dataset.ReadFolds(*foldsIn); err != nil {
+			fail("Failed to read folds: %v", err)
+			return
+		}
+		logger.Info("Read fold assignments for %d rows from %s", len(folds), *foldsIn)
+	case *regPath != "" || *foldsOut != "":
+		if folds, err = makeFolds(data, *cvFolds, *foldSeed); err != nil {
+			fail("Failed to assign folds: %v", err)
+			return
+		}
+	}
+	if *foldsOut != "" {
+		if err := exportFolds(*foldsOut, data, folds); err != nil {
+			fail("Failed to write folds: %v", err)
+			return
+		}
+		logger.Info("Fold assignments written to %s", *foldsOut)
+	}
+
+	workers := *workerCount
+	if workers < 1 || *batchSize < 1 || *epochs < 1 || *learningRate <= 0 {
+		fail("-workers, -batch-size and -epochs must be at least 1 and -learning-rate positive")
+		return
+	}
 	trainRatio := 0.8
-	rand.Seed(time.Now().UnixNano())
-	rand.Shuffle(len(data), func(i, j int) {
-		data[i], data[j] = data[j], data[i]
-	})
+	rng := rand.New(rand.NewSource(repro.Seed))
 
-	splitIndex := int(float64(len(data)) * trainRatio)
-	trainData, testData := data[:splitIndex], data[splitIndex:]
+	var trainData, testData []DataPoint
+	var shards [][]DataPoint
+	if *shardByFile && len(fileRows) < workers {
+		logger.Info("Only %d files for %d workers, sharding by rows instead", len(fileRows), workers)
+	} else if *shardByFile {
+		// Every file is split into train and test on its own and whole files
+		// are dealt to the workers in turn.
+		shards = make([][]DataPoint, workers)
+		for i, part := range splitParts(data, fileRows) {
+			train, test := splitTrainTest(part, trainRatio, rng)
+			shards[i%workers] = append(shards[i%workers], train...)
+			trainData = append(trainData, train...)
+			testData = append(testData, test...)
+		}
+	}
+	if shards == nil {
+		trainData, testData = splitTrainTest(data, trainRatio, rng)
+	}
+	// The cached rows were standardized over the whole dataset. Standardizing
+	// them again over the training rows alone, and saving the two composed,
+	// keeps the test rows out of the scaler.
+	if len(trainData) > 0 {
+		refit := fitScaler(trainData)
+		trainData, testData = refit.transform(trainData), refit.transform(testData)
+		for i := range shards {
+			shards[i] = refit.transform(shards[i])
+		}
+		scaler = scaler.then(refit)
+		logger.Info("Refitted feature standardization on the %d training samples", len(trainData))
+	}
 	logger.Info("Dataset split: %d training samples, %d test samples",
 		len(trainData), len(testData))
-
-	featureCount := len(data[0].Features)
-	model := &Model{
-		Weights:   make([]float64, featureCount),
-		Bias:      0.0,
-		StartTime: time.Now(),
-		Metrics:   make(map[int]float64),
+	if len(trainData) == 0 {
+		fail("No training samples in the %d rows of the dataset", len(data))
+		return
 	}
 
-	numWorkers := 4
-	batchSize := 32
-	epochs := 10
-	learningRate := 0.01
-
-	logger.Info("Training configuration:")
-	logger.Info("- Number of workers: %d", numWorkers)
-	logger.Info("- Batch size: %d", batchSize)
-	logger.Info("- Epochs: %d", epochs)
-	logger.Info("- Learning rate: %f", learningRate)
+	if *regPath != "" {
+		result, err := computeRegularizationPath(trainData, *regPath, penalty.L1Ratio, *regPathLambdas, folds)
+		if err != nil {
+			logger.Error("Regularization path failed: %v", err)
+			return
+		}
+		if err := renderRegularizationPath(*regPathOut, result, columns.FeatureNames); err != nil {
+			logger.Error("Failed to render regularization path: %v", err)
+			return
+		}
 
-	workersData := make([][]DataPoint, numWorkers)
-	chunkSize := len(trainData) / numWorkers
-	for i := 0; i < numWorkers; i++ {
-		start := i * chunkSize
-		end := start + chunkSize
-		if i == numWorkers-1 {
-			end = len(trainData)
+		best := result.Points[result.Best]
+		nonZero := 0
+		for _, w := range best.Weights {
+			if w != 0 {
+				nonZero++
+			}
 		}
-		workersData[i] = trainData[start:end]
-		logger.Info("Worker %d assigned %d samples", i, len(workersData[i]))
+		logger.Info("Selected %s lambda %.6g: CV MSE %.6f (+/- %.6f), %d non-zero coefficients",
+			*regPath, best.Lambda, best.CVMSE, best.CVStd, nonZero)
+		logger.Info("Test MSE at selected lambda: %.6f", meanSquaredError(best.Weights, best.Bias, testData))
+		logger.Info("Regularization path chart written to %s", *regPathOut)
+		return
 	}
 
-	var wg sync.WaitGroup
-	workers := make([]*Worker, numWorkers)
+	if *olsFit {
+		result, err := fitOLS(trainData, columns.FeatureNames, *confidence)
+		if err != nil {
+			logger.Error("OLS fit failed: %v", err)
+			return
+		}
+		logger.Info("OLS coefficients on standardized features:")
+		printOLS(result, *confidence)
+
+		weights := make([]float64, len(result.Coefficients)-1)
+		for j := range weights {
+			weights[j] = result.Coefficients[j+1].Estimate
+		}
+		logger.Info("OLS test MSE: %.6f", meanSquaredError(weights, result.Coefficients[0].Estimate, testData))
+		return
+	}
 
-	logger.Info("Starting distributed training")
-	trainingStartTime := time.Now()
+	if *role == "master" && *ordering != OrderSequential {
+		fail("Remote workers only support -ordering %s", OrderSequential)
+		return
+	}
 
-	for i := 0; i < numWorkers; i++ {
-		workers[i] = &Worker{
-			ID:        i,
-			Data:      workersData[i],
-			BatchSize: batchSize,
-			Model:     model,
+	var resume *Checkpoint
+	if *resumePath != "" {
+		if *role == "master" {
+			fail("Resuming is not supported with -role master")
+			return
+		}
+		checkpoints, err := openCheckpoints(ctx, *resumePath)
+		if err != nil {
+			fail("Failed to open checkpoint store: %v", err)
+			return
+		}
+		resume, err = checkpoints.read(ctx)
+		checkpoints.Close()
+		if err != nil {
+			fail("Failed to read checkpoint: %v", err)
+			return
+		}
+		if len(resume.Weights) != len(trainData[0].Features) {
+			fail("Checkpoint %s has %d weights but the dataset has %d features", *resumePath, len(resume.Weights), len(trainData[0].Features))
+			return
 		}
-		wg.Add(1)
-		go workers[i].trainWorker(epochs, learningRate, &wg)
 	}
 
-	wg.Wait()
-	trainingDuration := time.Since(trainingStartTime)
+	config := TrainConfig{
+		Workers:      workers,
+		BatchSize:    *batchSize,
+		Epochs:       *epochs,
+		LearningRate: *learningRate,
+		BatchDelay:   *batchDelay,
+		Consistency:  *consistency,
+		Staleness:    *staleness,
+		Aggregation:  *aggregation,
+		Noise:        noise,
+		Ordering:     *ordering,
+		Seed:         repro.Seed,
+		CPUSets:      cpuSets,
+		Convergence:  stopping,
+		Penalty:      penalty,
+		Mode:         *mode,
+		Gossip: GossipConfig{
+			Interval: *gossipInterval,
+			Fanout:   *gossipFanout,
+			Seed:     repro.Seed,
+		},
+		MaxDuration:     *maxDuration,
+		MaxUpdates:      *maxUpdates,
+		CheckpointPath:  *checkpointPath,
+		CheckpointEvery: *checkpointEvery,
+		Resume:          resume,
+		DiagnosticsDir:  *diagnosticsDir,
+		EvalEvery:       *evalEvery,
+		EvalData:        testData,
+		EvalMetric:      *evalMetric,
+		EvalPatience:    *evalPatience,
+		ShardByFile:     shards != nil,
+		Shards:          shards,
+	}
+	if *checkpointPath != "" {
+		if config.Checkpoints, err = openCheckpoints(ctx, *checkpointPath); err != nil {
+			fail("Failed to open checkpoint store: %v", err)
+			return
+		}
+		defer config.Checkpoints.Close()
+	}
+	if *metricsAddr != "" || *streamAddr != "" || *dashboardAddr != "" {
+		config.Metrics = newTrainingMetrics()
+	}
+	if *dashboardAddr != "" {
+		server := serveTrainingDashboard(*dashboardAddr, config.Metrics, config.Epochs)
+		defer server.Close()
+	}
+	if *metricsAddr != "" {
+		server := serveTrainingMetrics(*metricsAddr, config.Metrics)
+		defer server.Close()
+	}
+	if *streamAddr != "" {
+		server, err := serveMetricsStream(*streamAddr, config.Metrics)
+		if err != nil {
+			fail("Failed to serve the metrics stream: %v", err)
+			return
+		}
+		defer server.GracefulStop()
+	}
+	if resume != nil && resume.Completed >= config.Epochs {
+		fail("Checkpoint %s already completed %d of %d epochs", *resumePath, resume.Completed, config.Epochs)
+		return
+	}
+	if *adaptiveBatch {
+		config.AdaptiveBatch = &AdaptiveBatchConfig{
+			MinBatch:          8,
+			MaxBatch:          *maxBatch,
+			VarianceThreshold: *varianceThreshold,
+			PlateauTolerance:  *plateauTolerance,
+		}
+	}
+	var model *Model
+	var trainingDuration time.Duration
+	if *role == "master" {
+		model, trainingDuration, err = serveTraining(ctx, config, trainData, *listenAddr, *remoteWorkers, *joinWindow, *workerTimeout)
+		if err != nil {
+			fail("Failed to serve training: %v", err)
+			return
+		}
+	} else {
+		model, trainingDuration, err = train(ctx, config, trainData)
+		if err != nil {
+			fail("Failed to train: %v", err)
+			return
+		}
+	}
 
-	logger.Info("Training completed in %v", trainingDuration)
+	logger.With("duration_ms", logging.Milliseconds(trainingDuration)).Info("Training completed in %v", trainingDuration)
 	logger.Info("Total model updates: %d", model.Updates)
+	if ctx.Err() != nil {
+		config.Metrics.finish("interrupted")
+	} else {
+		config.Metrics.finish("succeeded")
+	}
 
 	logger.Info("\nTraining Progress (MSE per epoch):")
-	for epoch := 0; epoch < epochs; epoch++ {
-		logger.Info("Epoch %d: %.6f", epoch+1, model.Metrics[epoch])
+	usage := make(map[int]ResourceUsage)
+	for _, u := range model.Resources {
+		usage[u.Epoch-1] = u
+	}
+	for epoch := 0; epoch < config.Epochs; epoch++ {
+		mse, ok := model.Metrics[epoch]
+		if !ok {
+			continue
+		}
+		if u, sampled := usage[epoch]; sampled {
+			logger.Info("Epoch %d: %.6f (RSS %.1f MiB, heap %.1f MiB, %d goroutines, %d GCs)",
+				epoch+1, mse, mebibytes(u.RSSBytes), mebibytes(u.HeapBytes), u.Goroutines, u.NumGC)
+			continue
+		}
+		logger.Info("Epoch %d: %.6f", epoch+1, mse)
+	}
+
+	if len(model.EvalTrajectory) > 0 {
+		logger.Info("\nTest MSE during training:")
+		for _, point := range model.EvalTrajectory {
+			if *evalMetric != "" {
+				logger.Info("After %d updates (%v): %.6f, %s %.6f", point.Updates, point.Elapsed.Round(time.Millisecond), point.TestMSE, *evalMetric, point.Metric)
+				continue
+			}
+			logger.Info("After %d updates (%v): %.6f", point.Updates, point.Elapsed.Round(time.Millisecond), point.TestMSE)
+		}
 	}
 
 	mse := evaluate(model, testData)
+	baselineMSE, baselineValue := meanBaseline(trainData, testData)
 
 	totalDuration := time.Since(mainStartTime)
 	logger.Info("\nPipeline Summary:")
 	logger.Info("- Total execution time: %v", totalDuration)
 	logger.Info("- Training time: %v", trainingDuration)
 	logger.Info("- Final Test MSE: %.6f", mse)
+	logger.Info("- Baseline Test MSE (always %.4f, the mean training label): %.6f", baselineValue, baselineMSE)
+	for _, m := range extraMetrics {
+		logger.Info("- Test %s: %.6f", m.Name, metricScore(m, model.Weights, model.Bias, testData))
+	}
 	logger.Info("- Updates per second: %.2f",
 		float64(model.Updates)/trainingDuration.Seconds())
+
+	if *saveModel != "" {
+		model.Scaler, model.Dataset, model.Features = &scaler, fingerprint, columns.FeatureNames
+		artifact := model.artifact()
+		artifact.TestMSE = mse
+		if err := writeJSON(*saveModel, artifact); err != nil {
+			logger.Error("Failed to save model: %v", err)
+		} else {
+			logger.Info("Model saved to %s", *saveModel)
+		}
+	}
+
+	if *runRecord != "" {
+		record := RunRecord{
+			StartedAt:      mainStartTime,
+			Dataset:        fingerprint,
+			Config:         config,
+			TestMSE:        mse,
+			TrainingTime:   trainingDuration,
+			Updates:        model.Updates,
+			MeanStaleness:  model.MeanStaleness,
+			MaxStaleness:   model.MaxStaleness,
+			EvalTrajectory: model.EvalTrajectory,
+			Resources:      model.Resources,
+		}
+		for epoch := 0; epoch < config.Epochs; epoch++ {
+			if mse, ok := model.Metrics[epoch]; ok {
+				record.EpochMSE = append(record.EpochMSE, mse)
+			}
+		}
+		if err := writeJSON(*runRecord, record); err != nil {
+			logger.Error("Failed to write run record: %v", err)
+		} else {
+			logger.Info("Run record written to %s", *runRecord)
+		}
+	}
+
+	run.Dataset = manifest.Dataset{Path: fingerprint.Path, SHA256: fingerprint.ContentHash, Rows: fingerprint.Rows}
+	run.Metric("test_mse", mse)
+	run.Metric("baseline_test_mse", baselineMSE)
+	for _, m := range extraMetrics {
+		run.Metric("test_"+m.Name, metricScore(m, model.Weights, model.Bias, testData))
+	}
+	run.Metric("updates", float64(model.Updates))
+	run.Metric("training_seconds", trainingDuration.Seconds())
+	if err := run.Write(); err != nil {
+		logger.Error("Failed to write manifest: %v", err)
+	} else if repro.Path != "" {
+		logger.Info("Manifest written to %s", repro.Path)
+	}
+
+	summary.Status = "succeeded"
+	if ctx.Err() != nil {
+		summary.Status = "interrupted"
+	}
+	summary.Duration = totalDuration
+	summary.TestMSE = mse
+	summary.Updates = model.Updates
+	notifyWebhooks(webhooks, summary)
 }
@@ -0,0 +1,76 @@
+// Package blobstore stores model artifacts and checkpoints behind one small
+// interface, so workers and servers on different machines can share them
+// through a local directory, Amazon S3 or Google Cloud Storage.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// ErrNotFound is returned by Get when no blob exists under the key.
+var ErrNotFound = errors.New("blobstore: not found")
+
+// Store is a flat namespace of blobs addressed by slash-separated keys.
+type Store interface {
+	// Put writes the blob under key, replacing any existing one.
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get opens the blob under key; the caller closes the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// List returns the keys that start with prefix, in lexical order.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Delete removes the blob under key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// String describes the location, for logs.
+	String() string
+	// Close releases the connections the store holds.
+	Close() error
+}
+
+// Open returns the store for location: s3://bucket/prefix,
+// gs://bucket/prefix, file:///path or a plain directory path.
+func Open(ctx context.Context, location string) (Store, error) {
+	if !strings.Contains(location, "://") {
+		return NewLocal(location)
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("blobstore: invalid location %q: %v", location, err)
+	}
+	prefix := strings.Trim(u.Path, "/")
+	switch u.Scheme {
+	case "file":
+		return NewLocal(u.Path)
+	case "s3":
+		return NewS3(ctx, u.Host, prefix)
+	case "gs":
+		return NewGCS(ctx, u.Host, prefix)
+	default:
+		return nil, fmt.Errorf("blobstore: unsupported scheme %q", u.Scheme)
+	}
+}
+
+// Copy copies the blob under src to dst within s. Together with Put, it
+// stands in for the rename stores lack: a blob put under a temporary key and
+// then copied into place is never seen partially written under its own key.
+func Copy(ctx context.Context, s Store, src, dst string) error {
+	r, err := s.Get(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return s.Put(ctx, dst, r)
+}
+
+// joinKey places key under prefix using forward slashes.
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "/" + key
+}
@@ -0,0 +1,89 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// GCS keeps blobs as objects under a prefix of a Cloud Storage bucket,
+// authenticating with Application Default Credentials.
+type GCS struct {
+	client *storage.Client
+	bucket *storage.BucketHandle
+	name   string
+	prefix string
+}
+
+func NewGCS(ctx context.Context, bucket, prefix string) (*GCS, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &GCS{client: client, bucket: client.Bucket(bucket), name: bucket, prefix: prefix}, nil
+}
+
+// Put uploads the blob, which replaces the object only once the writer is
+// closed. A failed copy cancels the upload instead, so no truncated object
+// is left under the key.
+func (g *GCS) Put(ctx context.Context, key string, r io.Reader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := g.bucket.Object(joinKey(g.prefix, key)).NewWriter(ctx)
+	if _, err := io.Copy(w, r); err != nil {
+		cancel()
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (g *GCS) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	r, err := g.bucket.Object(joinKey(g.prefix, key)).NewReader(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil, ErrNotFound
+	}
+	return r, err
+}
+
+func (g *GCS) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	it := g.bucket.Objects(ctx, &storage.Query{Prefix: joinKey(g.prefix, prefix)})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		key := attrs.Name
+		if g.prefix != "" {
+			key = strings.TrimPrefix(key, g.prefix+"/")
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (g *GCS) Delete(ctx context.Context, key string) error {
+	err := g.bucket.Object(joinKey(g.prefix, key)).Delete(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (g *GCS) String() string {
+	return "gs://" + joinKey(g.name, g.prefix)
+}
+
+func (g *GCS) Close() error {
+	return g.client.Close()
+}
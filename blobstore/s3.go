@@ -0,0 +1,101 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3 keeps blobs as objects under a prefix of an S3 bucket. Credentials and
+// region come from the standard AWS environment, shared config and
+// instance roles.
+type S3 struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func NewS3(ctx context.Context, bucket, prefix string) (*S3, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &S3{client: s3.NewFromConfig(cfg), bucket: bucket, prefix: prefix}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader) error {
+	// PutObject needs a seekable body to sign the payload, so buffer it.
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(joinKey(s.prefix, key)),
+		Body:   bytes.NewReader(data),
+	})
+	return err
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(joinKey(s.prefix, key)),
+	})
+	var missing *types.NoSuchKey
+	if errors.As(err, &missing) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(joinKey(s.prefix, prefix)),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			if s.prefix != "" {
+				key = strings.TrimPrefix(key, s.prefix+"/")
+			}
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(joinKey(s.prefix, key)),
+	})
+	return err
+}
+
+func (s *S3) String() string {
+	return "s3://" + joinKey(s.bucket, s.prefix)
+}
+
+// Close does nothing: the S3 client has no Close of its own.
+func (s *S3) Close() error {
+	return nil
+}
@@ -0,0 +1,154 @@
+// Package cli runs the programs of this repository as subcommands of one
+// binary, and lets their flags be set from a YAML config file as well as on
+// the command line. A config file sets flags by name, at the top level for
+// every command that has the flag and in a section for one command:
+//
+//	data: winequality-dataset.csv
+//	log-level: debug
+//	train-distributed:
+//	  workers: 8
+//	  batch-delay: 10ms
+//	tune:
+//	  trials: 20
+//
+// A section is named after the command's flag set: the subcommand for the
+// programs themselves, and the name of their own subcommands, such as tune,
+// for those. Lists are joined by commas. Flags given on the command line
+// take precedence over the file.
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Command is one subcommand of the binary. Main receives the arguments after
+// the subcommand's name, and parses its flags from flag.CommandLine, which
+// Run replaces with a flag set named after the subcommand.
+type Command struct {
+	Name    string
+	Summary string
+	Main    func(args []string)
+}
+
+// Run runs the command named by args[0] with the rest of args. It returns
+// the exit status for a missing or unknown command and 0 otherwise.
+func Run(program string, commands []Command, args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		usage(os.Stderr, program, commands)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	for _, command := range commands {
+		if command.Name == args[0] {
+			flag.CommandLine = flag.NewFlagSet(command.Name, flag.ExitOnError)
+			command.Main(args[1:])
+			return 0
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%s: unknown command %q\n\n", program, args[0])
+	usage(os.Stderr, program, commands)
+	return 2
+}
+
+func usage(w io.Writer, program string, commands []Command) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", program)
+	for _, command := range commands {
+		fmt.Fprintf(w, "  %-18s %s\n", command.Name, command.Summary)
+	}
+	fmt.Fprintf(w, "\nRun %s <command> -h for the flags of a command; every command also reads them from -config, a YAML file.\n", program)
+}
+
+// Parse adds -config to fs and parses args. If -config names a file, every
+// flag it sets that was not given in args is then set from it. Errors are
+// handled as fs.ErrorHandling says, as by fs.Parse.
+func Parse(fs *flag.FlagSet, args []string) error {
+	path := fs.String("config", "", "YAML file setting any of these flags, at the top level or under a \""+fs.Name()+"\" section; flags given here take precedence")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *path == "" {
+		return nil
+	}
+	err := Load(fs, *path)
+	if err == nil {
+		return nil
+	}
+	switch fs.ErrorHandling() {
+	case flag.ExitOnError:
+		fmt.Fprintf(fs.Output(), "invalid -config: %v\n", err)
+		os.Exit(2)
+	case flag.PanicOnError:
+		panic(err)
+	}
+	return err
+}
+
+// Load sets the flags of fs named in the config file at path, except those
+// already set. Keys of fs's section must name flags of fs; top-level keys
+// no flag of fs has are left for other commands.
+func Load(fs *flag.FlagSet, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var config map[string]any
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	values := make(map[string]any)
+	for key, value := range config {
+		if _, section := value.(map[string]any); !section && fs.Lookup(key) != nil {
+			values[key] = value
+		}
+	}
+	if section, ok := config[fs.Name()].(map[string]any); ok {
+		for key, value := range section {
+			if fs.Lookup(key) == nil {
+				return fmt.Errorf("%s: %s has no flag -%s", path, fs.Name(), key)
+			}
+			values[key] = value
+		}
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if given[key] || key == "config" {
+			continue
+		}
+		if err := fs.Set(key, format(values[key])); err != nil {
+			return fmt.Errorf("%s: -%s: %v", path, key, err)
+		}
+	}
+	return nil
+}
+
+// format turns a YAML value into the text of a flag.
+func format(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = format(item)
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value)
+}
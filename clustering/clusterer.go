@@ -0,0 +1,97 @@
+package clustering
+
+import (
+	"flag"
+	"fmt"
+
+	"gopherconAU/kmeans"
+)
+
+// Noise is the cluster of rows a Clusterer leaves out of every cluster.
+const Noise = -1
+
+// Clusterer assigns every row of X a cluster, numbered from 0, or Noise.
+type Clusterer interface {
+	Cluster(X [][]float64) ([]int, error)
+}
+
+// KMeans is k-means behind the Clusterer interface.
+type KMeans struct{ kmeans.Options }
+
+func (k KMeans) Cluster(X [][]float64) ([]int, error) {
+	result, err := kmeans.Fit(X, k.Options)
+	if err != nil {
+		return nil, err
+	}
+	return result.Assignments, nil
+}
+
+// Algorithms.
+const (
+	AlgorithmKMeans       = "kmeans"
+	AlgorithmDBSCAN       = "dbscan"
+	AlgorithmHierarchical = "hierarchical"
+)
+
+// Options configures every algorithm; -k sets the clusters of both k-means
+// and the hierarchical cut.
+type Options struct {
+	Algorithm    string
+	KMeans       kmeans.Options
+	DBSCAN       DBSCAN
+	Hierarchical Agglomerative
+}
+
+// DefaultOptions runs k-means with kmeans.DefaultOptions.
+func DefaultOptions() Options {
+	return Options{
+		Algorithm:    AlgorithmKMeans,
+		KMeans:       kmeans.DefaultOptions(),
+		DBSCAN:       DBSCAN{Eps: 0.5, MinPoints: 5},
+		Hierarchical: Agglomerative{Linkage: LinkageWard},
+	}
+}
+
+// RegisterFlags adds -algorithm, -eps, -min-points, -linkage, -cut-height
+// and the k-means flags to fs, with o's current values as defaults.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Algorithm, "algorithm", o.Algorithm, "clustering algorithm: kmeans, dbscan or hierarchical")
+	o.KMeans.RegisterFlags(fs)
+	fs.Float64Var(&o.DBSCAN.Eps, "eps", o.DBSCAN.Eps, "DBSCAN: distance within which rows are neighbors")
+	fs.IntVar(&o.DBSCAN.MinPoints, "min-points", o.DBSCAN.MinPoints, "DBSCAN: neighbors, the row itself included, that make a row a core row")
+	fs.StringVar(&o.Hierarchical.Linkage, "linkage", o.Hierarchical.Linkage, "hierarchical: single, complete, average or ward linkage between clusters")
+	fs.Float64Var(&o.Hierarchical.Height, "cut-height", o.Hierarchical.Height, "hierarchical: cut the dendrogram at this height instead of at -k clusters")
+}
+
+// New returns the Clusterer of the named algorithm.
+func (o Options) New(algorithm string) (Clusterer, error) {
+	switch algorithm {
+	case AlgorithmKMeans:
+		if err := o.KMeans.Validate(); err != nil {
+			return nil, err
+		}
+		return KMeans{o.KMeans}, nil
+	case AlgorithmDBSCAN:
+		return o.DBSCAN, nil
+	case AlgorithmHierarchical:
+		h := o.Hierarchical
+		h.K = o.KMeans.K
+		return h, nil
+	}
+	return nil, fmt.Errorf("unknown clustering algorithm %q, want kmeans, dbscan or hierarchical", algorithm)
+}
+
+// Sizes returns the rows in every cluster of labels and the Noise rows.
+func Sizes(labels []int) (sizes []int, noise int) {
+	for _, label := range labels {
+		if label == Noise {
+			noise++
+			continue
+		}
+		for len(sizes) <= label {
+			sizes = append(sizes, 0)
+		}
+		sizes[label]++
+	}
+	return sizes, noise
+}
@@ -0,0 +1,115 @@
+// Package clustering puts k-means, DBSCAN and agglomerative hierarchical
+// clustering behind one Clusterer interface, and helps choose the number of
+// clusters k for k-means. It clusters the data for every k in a range and
+// scores each clustering by its within-cluster sum of squares (WCSS), which
+// always falls as k grows but stops falling fast past a good k (the elbow),
+// and by its mean silhouette, which is highest for the k whose clusters are
+// tight and well apart.
+package clustering
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+
+	"gopherconAU/kmeans"
+)
+
+// Score is how well one k clusters the data.
+type Score struct {
+	K          int
+	WCSS       float64
+	Silhouette float64
+}
+
+// Elbow clusters X with k-means for every k from 2 to maxK and scores each;
+// options set everything but K. The WCSS of a k is the inertia of its best
+// restart.
+func Elbow(X [][]float64, maxK int, options kmeans.Options) ([]Score, error) {
+	if maxK < 2 || maxK >= len(X) {
+		return nil, fmt.Errorf("largest k %d must be at least 2 and below the %d rows", maxK, len(X))
+	}
+	var scores []Score
+	for k := 2; k <= maxK; k++ {
+		options.K = k
+		result, err := kmeans.Fit(X, options)
+		if err != nil {
+			return nil, fmt.Errorf("k %d: %v", k, err)
+		}
+		scores = append(scores, Score{K: k, WCSS: result.Inertia, Silhouette: Silhouette(X, result.Assignments)})
+	}
+	return scores, nil
+}
+
+// Silhouette returns the mean silhouette of the rows of X, between -1 and
+// 1: for each row, how much closer it is on average to the rows of its own
+// cluster than to those of the nearest other cluster. A row alone in its
+// cluster scores 0, and Noise rows count as one more cluster. It takes time
+// quadratic in the rows.
+func Silhouette(X [][]float64, guesses []int) float64 {
+	sizes := make(map[int]int)
+	for _, cluster := range guesses {
+		sizes[cluster]++
+	}
+	if len(sizes) < 2 {
+		return 0
+	}
+	total := 0.0
+	distances := make(map[int]float64, len(sizes))
+	for i, row := range X {
+		own := guesses[i]
+		if sizes[own] == 1 {
+			continue
+		}
+		clear(distances)
+		for j, other := range X {
+			if j != i {
+				distances[guesses[j]] += kmeans.Distance(row, other)
+			}
+		}
+		a := distances[own] / float64(sizes[own]-1)
+		b := math.Inf(1)
+		for cluster, sum := range distances {
+			if cluster != own {
+				b = math.Min(b, sum/float64(sizes[cluster]))
+			}
+		}
+		if m := math.Max(a, b); m > 0 {
+			total += (b - a) / m
+		}
+	}
+	return total / float64(len(X))
+}
+
+// Best returns the score with the highest silhouette, the lowest k on ties.
+func Best(scores []Score) Score {
+	best := scores[0]
+	for _, s := range scores[1:] {
+		if s.Silhouette > best.Silhouette {
+			best = s
+		}
+	}
+	return best
+}
+
+// Print writes a table of the scores, with the drop in WCSS from the k
+// before, marking the k with the best silhouette.
+func Print(w io.Writer, scores []Score) {
+	best := Best(scores)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "k\tWCSS\tdrop\tsilhouette\t\n")
+	for i, s := range scores {
+		drop := ""
+		if i > 0 {
+			drop = fmt.Sprintf("%.1f%%", (1-s.WCSS/scores[i-1].WCSS)*100)
+		}
+		mark := ""
+		if s.K == best.K {
+			mark = " *"
+		}
+		fmt.Fprintf(tw, "%d\t%.3f\t%s\t%.3f%s\t\n", s.K, s.WCSS, drop, s.Silhouette, mark)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "* best silhouette: k = %d\n", best.K)
+}
@@ -0,0 +1,71 @@
+package clustering
+
+import (
+	"fmt"
+
+	"gopherconAU/kmeans"
+)
+
+// DBSCAN clusters rows by density: a row with at least MinPoints rows
+// (itself included) within Eps of it is a core row, core rows within Eps of
+// each other share a cluster, and every other row within Eps of a core row
+// joins its cluster. The rest are Noise. Unlike k-means it finds the number
+// of clusters itself and clusters of any shape, but Eps has to suit the
+// scale of the features. It takes time quadratic in the rows.
+type DBSCAN struct {
+	Eps       float64 `json:"eps"`
+	MinPoints int     `json:"min_points"`
+}
+
+func (d DBSCAN) Cluster(X [][]float64) ([]int, error) {
+	if d.Eps <= 0 {
+		return nil, fmt.Errorf("DBSCAN eps %g must be positive", d.Eps)
+	}
+	if d.MinPoints < 1 {
+		return nil, fmt.Errorf("DBSCAN min points %d must be at least 1", d.MinPoints)
+	}
+	neighbors := func(i int) []int {
+		var within []int
+		for j, row := range X {
+			if kmeans.Distance(X[i], row) <= d.Eps {
+				within = append(within, j)
+			}
+		}
+		return within
+	}
+
+	const unvisited = -2
+	labels := make([]int, len(X))
+	for i := range labels {
+		labels[i] = unvisited
+	}
+	cluster := 0
+	for i := range X {
+		if labels[i] != unvisited {
+			continue
+		}
+		seeds := neighbors(i)
+		if len(seeds) < d.MinPoints {
+			labels[i] = Noise
+			continue
+		}
+		// Grow the cluster from the core row i, expanding through every
+		// core row reached.
+		labels[i] = cluster
+		for k := 0; k < len(seeds); k++ {
+			j := seeds[k]
+			if labels[j] == Noise {
+				labels[j] = cluster // a border row
+			}
+			if labels[j] != unvisited {
+				continue
+			}
+			labels[j] = cluster
+			if reached := neighbors(j); len(reached) >= d.MinPoints {
+				seeds = append(seeds, reached...)
+			}
+		}
+		cluster++
+	}
+	return labels, nil
+}
@@ -0,0 +1,141 @@
+package clustering
+
+import (
+	"fmt"
+	"math"
+
+	"gopherconAU/kmeans"
+)
+
+// Linkages: how far apart Agglomerative considers two clusters.
+const (
+	LinkageSingle   = "single"   // their closest rows
+	LinkageComplete = "complete" // their furthest rows
+	LinkageAverage  = "average"  // the mean distance between their rows
+	// LinkageWard is the rise in the within-cluster sum of squares merging
+	// them would cause, which like k-means favours compact clusters of
+	// similar size.
+	LinkageWard = "ward"
+)
+
+// Merge is one step of agglomerative clustering: clusters A and B, each
+// named by the lowest row in it, joined at Height.
+type Merge struct {
+	A, B   int
+	Height float64
+	Size   int // rows in the merged cluster
+}
+
+// Agglomerative clusters rows bottom up: every row starts as a cluster of
+// its own and the two closest clusters are merged until the dendrogram, the
+// tree of merges, is cut. It is cut where the next merge would rise above
+// Height, if Height is set, and otherwise at K clusters. It takes time
+// cubic in the rows.
+type Agglomerative struct {
+	K       int     `json:"k"`
+	Linkage string  `json:"linkage"`
+	Height  float64 `json:"height,omitempty"`
+}
+
+func (a Agglomerative) Cluster(X [][]float64) ([]int, error) {
+	labels, _, err := a.Dendrogram(X)
+	return labels, err
+}
+
+// Dendrogram clusters X and also returns the merges made, in order.
+func (a Agglomerative) Dendrogram(X [][]float64) ([]int, []Merge, error) {
+	switch a.Linkage {
+	case LinkageSingle, LinkageComplete, LinkageAverage, LinkageWard:
+	default:
+		return nil, nil, fmt.Errorf("unknown linkage %q, want single, complete, average or ward", a.Linkage)
+	}
+	if a.Height <= 0 && (a.K < 1 || a.K > len(X)) {
+		return nil, nil, fmt.Errorf("cannot cut %d rows into %d clusters", len(X), a.K)
+	}
+
+	// distances holds the linkage between live clusters; ward works on
+	// squared distances, as the Lance-Williams update below requires.
+	n := len(X)
+	distances := make([][]float64, n)
+	for i := range distances {
+		distances[i] = make([]float64, n)
+		for j := range i {
+			d := kmeans.Distance(X[i], X[j])
+			if a.Linkage == LinkageWard {
+				d *= d
+			}
+			distances[i][j], distances[j][i] = d, d
+		}
+	}
+	sizes := make([]int, n)
+	parent := make([]int, n) // the cluster every row was merged into
+	for i := range sizes {
+		sizes[i], parent[i] = 1, i
+	}
+	live := n
+	var merges []Merge
+	for live > 1 {
+		a1, b1, closest := -1, -1, math.Inf(1)
+		for i := range distances {
+			if sizes[i] == 0 {
+				continue
+			}
+			for j := i + 1; j < n; j++ {
+				if sizes[j] > 0 && distances[i][j] < closest {
+					a1, b1, closest = i, j, distances[i][j]
+				}
+			}
+		}
+		height := closest
+		if a.Linkage == LinkageWard {
+			height = math.Sqrt(closest)
+		}
+		if a.Height > 0 && height > a.Height || a.Height <= 0 && live == a.K {
+			break
+		}
+		for k := range distances {
+			if sizes[k] == 0 || k == a1 || k == b1 {
+				continue
+			}
+			d := a.update(distances[k][a1], distances[k][b1], closest, sizes[a1], sizes[b1], sizes[k])
+			distances[k][a1], distances[a1][k] = d, d
+		}
+		sizes[a1] += sizes[b1]
+		sizes[b1] = 0
+		parent[b1] = a1
+		live--
+		merges = append(merges, Merge{A: a1, B: b1, Height: height, Size: sizes[a1]})
+	}
+
+	// Number the clusters left in the order of their lowest row.
+	labels := make([]int, n)
+	number := make(map[int]int)
+	for i := range labels {
+		root := i
+		for parent[root] != root {
+			root = parent[root]
+		}
+		if _, ok := number[root]; !ok {
+			number[root] = len(number)
+		}
+		labels[i] = number[root]
+	}
+	return labels, merges, nil
+}
+
+// update returns the linkage between cluster k and the merge of clusters i
+// and j, by the Lance-Williams formula, from the linkages dki, dkj and dij
+// among them and their sizes.
+func (a Agglomerative) update(dki, dkj, dij float64, ni, nj, nk int) float64 {
+	switch a.Linkage {
+	case LinkageSingle:
+		return math.Min(dki, dkj)
+	case LinkageComplete:
+		return math.Max(dki, dkj)
+	case LinkageAverage:
+		return (float64(ni)*dki + float64(nj)*dkj) / float64(ni+nj)
+	default:
+		total := float64(ni + nj + nk)
+		return (float64(ni+nk)*dki + float64(nj+nk)*dkj - float64(nk)*dij) / total
+	}
+}
@@ -0,0 +1,103 @@
+// Package convergence holds the stopping criteria shared by the iterative
+// trainers in this repository. Besides running a fixed number of epochs, a
+// trainer can stop once its loss stops improving or its gradient vanishes.
+package convergence
+
+import (
+	"flag"
+	"fmt"
+	"math"
+)
+
+// Criteria stops training early. Zero tolerances are not checked, so the
+// zero Criteria always runs the full number of epochs.
+type Criteria struct {
+	// LossTolerance stops training once the loss changes by less than this
+	// fraction of the previous epoch's loss.
+	LossTolerance float64 `json:"loss_tolerance,omitempty"`
+	// GradientTolerance stops training once the L2 norm of the full
+	// gradient falls below it.
+	GradientTolerance float64 `json:"gradient_tolerance,omitempty"`
+}
+
+// RegisterFlags adds -loss-tol and -grad-tol to fs, with c's current values
+// as defaults.
+func (c *Criteria) RegisterFlags(fs *flag.FlagSet) {
+	fs.Float64Var(&c.LossTolerance, "loss-tol", c.LossTolerance, "stop once the epoch loss changes by less than this fraction of the previous one (0 runs every epoch)")
+	fs.Float64Var(&c.GradientTolerance, "grad-tol", c.GradientTolerance, "stop once the gradient norm falls below this (0 runs every epoch)")
+}
+
+// Enabled reports whether any criterion is checked.
+func (c Criteria) Enabled() bool {
+	return c.LossTolerance > 0 || c.GradientTolerance > 0
+}
+
+// Validate rejects negative tolerances.
+func (c Criteria) Validate() error {
+	if c.LossTolerance < 0 || c.GradientTolerance < 0 {
+		return fmt.Errorf("convergence tolerances must not be negative")
+	}
+	return nil
+}
+
+// String describes the criteria for logs.
+func (c Criteria) String() string {
+	switch {
+	case c.LossTolerance > 0 && c.GradientTolerance > 0:
+		return fmt.Sprintf("relative loss change < %g or gradient norm < %g", c.LossTolerance, c.GradientTolerance)
+	case c.LossTolerance > 0:
+		return fmt.Sprintf("relative loss change < %g", c.LossTolerance)
+	case c.GradientTolerance > 0:
+		return fmt.Sprintf("gradient norm < %g", c.GradientTolerance)
+	}
+	return "none"
+}
+
+// Monitor applies Criteria to the losses of one training run, epoch by
+// epoch.
+type Monitor struct {
+	criteria Criteria
+	previous float64
+	epochs   int
+}
+
+// Monitor returns a monitor for a new run.
+func (c Criteria) Monitor() *Monitor {
+	return &Monitor{criteria: c}
+}
+
+// Converged records the loss of another epoch, and the norm of the gradient
+// at its end, and returns why training should stop, or "" to go on. A
+// negative gradient norm means it was not measured. The loss criterion needs
+// two epochs; a non-finite loss never converges.
+func (m *Monitor) Converged(loss, gradientNorm float64) string {
+	previous := m.previous
+	m.previous = loss
+	m.epochs++
+	if math.IsNaN(loss) || math.IsInf(loss, 0) {
+		return ""
+	}
+
+	if tolerance := m.criteria.GradientTolerance; tolerance > 0 && gradientNorm >= 0 && gradientNorm < tolerance {
+		return fmt.Sprintf("gradient norm %.3g below %g", gradientNorm, tolerance)
+	}
+	if tolerance := m.criteria.LossTolerance; tolerance > 0 && m.epochs > 1 {
+		change := math.Abs(previous-loss) / math.Max(math.Abs(previous), math.SmallestNonzeroFloat64)
+		if change < tolerance {
+			return fmt.Sprintf("relative loss change %.3g below %g", change, tolerance)
+		}
+	}
+	return ""
+}
+
+// Norm returns the L2 norm of a gradient given in parts, such as the
+// weights and the bias.
+func Norm(parts ...[]float64) float64 {
+	var sum float64
+	for _, part := range parts {
+		for _, g := range part {
+			sum += g * g
+		}
+	}
+	return math.Sqrt(sum)
+}
@@ -0,0 +1,353 @@
+package dataset
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Dataset is a table of numeric features held in memory, one row per sample,
+// with the label, id, weight and group of every row when they were mapped.
+type Dataset struct {
+	FeatureNames []string
+	X            [][]float64
+	Y            []float64
+	// Classes names the labels of a categorical label column; Y then holds
+	// indices into it.
+	Classes []string
+	IDs     []string  // nil without an id column
+	Weights []float64 // nil without a weight column
+	Groups  []string  // nil without a group column
+	// Categories names the codes of every categorical feature loaded with
+	// CSVLoader.Codes, by feature.
+	Categories map[string][]string
+
+	skipped  []error
+	filtered int
+	missing  map[string]int     // empty feature fields by column
+	fills    map[string]float64 // what they were filled with, by column
+	dropped  int                // rows left out for them
+}
+
+// Len returns the number of rows.
+func (d *Dataset) Len() int { return len(d.X) }
+
+// Subset returns the given rows. The rows share their feature slices with d.
+func (d *Dataset) Subset(rows []int) *Dataset {
+	subset := &Dataset{FeatureNames: d.FeatureNames, Classes: d.Classes, Categories: d.Categories}
+	for _, i := range rows {
+		subset.X = append(subset.X, d.X[i])
+		subset.Y = append(subset.Y, d.Y[i])
+		if d.IDs != nil {
+			subset.IDs = append(subset.IDs, d.IDs[i])
+		}
+		if d.Weights != nil {
+			subset.Weights = append(subset.Weights, d.Weights[i])
+		}
+		if d.Groups != nil {
+			subset.Groups = append(subset.Groups, d.Groups[i])
+		}
+	}
+	return subset
+}
+
+// Shuffle puts the rows in random order.
+func (d *Dataset) Shuffle(rng *rand.Rand) {
+	rng.Shuffle(d.Len(), func(i, j int) {
+		d.X[i], d.X[j] = d.X[j], d.X[i]
+		d.Y[i], d.Y[j] = d.Y[j], d.Y[i]
+		if d.IDs != nil {
+			d.IDs[i], d.IDs[j] = d.IDs[j], d.IDs[i]
+		}
+		if d.Weights != nil {
+			d.Weights[i], d.Weights[j] = d.Weights[j], d.Weights[i]
+		}
+		if d.Groups != nil {
+			d.Groups[i], d.Groups[j] = d.Groups[j], d.Groups[i]
+		}
+	})
+}
+
+// Split returns the first trainFraction of the rows for training and the
+// rest for testing, in their current order; Shuffle first for a random split.
+// To keep every group on one side, pass the GroupSplit rows to Subset instead.
+func (d *Dataset) Split(trainFraction float64) (train, test *Dataset) {
+	cut := int(float64(d.Len()) * trainFraction)
+	return d.slice(0, cut), d.slice(cut, d.Len())
+}
+
+// Batches cuts the rows into consecutive batches of size rows, the last one
+// possibly smaller.
+func (d *Dataset) Batches(size int) []*Dataset {
+	var batches []*Dataset
+	for start := 0; start < d.Len(); start += size {
+		batches = append(batches, d.slice(start, min(start+size, d.Len())))
+	}
+	return batches
+}
+
+// slice returns rows [from, to), sharing d's storage.
+func (d *Dataset) slice(from, to int) *Dataset {
+	s := &Dataset{FeatureNames: d.FeatureNames, Classes: d.Classes, Categories: d.Categories, X: d.X[from:to], Y: d.Y[from:to]}
+	if d.IDs != nil {
+		s.IDs = d.IDs[from:to]
+	}
+	if d.Weights != nil {
+		s.Weights = d.Weights[from:to]
+	}
+	if d.Groups != nil {
+		s.Groups = d.Groups[from:to]
+	}
+	return s
+}
+
+// Weight returns the weight of row i, 1 without a weight column.
+func (d *Dataset) Weight(i int) float64 {
+	if d.Weights == nil {
+		return 1
+	}
+	return d.Weights[i]
+}
+
+// Filtered returns the number of rows passed over while loading because
+// they did not match Options.Filter.
+func (d *Dataset) Filtered() int { return d.filtered }
+
+// Summary describes the rows skipped while loading, as Reader.Summary does.
+func (d *Dataset) Summary() string {
+	summaries := []string{summarize(d.skipped), d.missingSummary()}
+	if summaries[0] == "" || summaries[1] == "" {
+		return summaries[0] + summaries[1]
+	}
+	return strings.Join(summaries, "; ")
+}
+
+// Loader loads a whole dataset into memory.
+type Loader interface {
+	Load() (*Dataset, error)
+}
+
+// CSVLoader loads a CSV or .xlsx file. Columns are assigned roles by Mapping
+// and parsed with Options, including whether the file has a header.
+// Categorical columns hold names rather than numbers: a categorical feature
+// becomes one 0/1 feature per distinct value, named "column=value", and a
+// categorical label becomes the index of its value in Dataset.Classes. Values
+// are taken in sorted order so that the encoding does not depend on row order.
+type CSVLoader struct {
+	Path        string
+	Mapping     Mapping
+	Options     Options
+	Categorical []string
+	// Codes leaves categorical features as the index of their value in
+	// Dataset.Categories rather than one-hot encoding them, for an encoder
+	// fitted on the training rows alone, such as preprocess.OneHotEncoder.
+	Codes bool
+	// Unlabeled loads rows to predict on: the label column may be missing,
+	// and every label is then 0.
+	Unlabeled bool
+}
+
+func (l CSVLoader) Load() (*Dataset, error) {
+	reader, err := Open(l.Path, l.Options)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	cols, err := l.Mapping.resolve(reader.Header, !l.Unlabeled)
+	if err != nil {
+		return nil, err
+	}
+	categorical := make(map[string]bool)
+	for _, name := range l.Categorical {
+		categorical[name] = true
+	}
+	var labelName string
+	if cols.Label >= 0 {
+		labelName = strings.TrimSpace(reader.Header[cols.Label])
+	}
+	labelCategorical := cols.Label >= 0 && categorical[labelName]
+	for _, name := range l.Categorical {
+		if name != labelName && !contains(cols.FeatureNames, name) {
+			return nil, fmt.Errorf("categorical column %q is neither the label nor a feature", name)
+		}
+	}
+
+	d := &Dataset{FeatureNames: cols.FeatureNames}
+	var values [][]string // categorical values per row: the label, if categorical, then features
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// A row with the wrong number of fields comes with its error set;
+		// its fields cannot be indexed by column.
+		if err := row.Err(); err != nil {
+			if err := reader.Skip(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		features := make([]float64, len(cols.Features))
+		var empty []string // features with empty fields
+		var names []string
+		if labelCategorical {
+			names = append(names, strings.TrimSpace(row.Fields[cols.Label]))
+		}
+		for j, i := range cols.Features {
+			if categorical[cols.FeatureNames[j]] {
+				names = append(names, strings.TrimSpace(row.Fields[i]))
+			} else if l.Options.isMissing(row.Fields[i]) {
+				features[j] = math.NaN()
+				empty = append(empty, cols.FeatureNames[j])
+			} else {
+				features[j] = row.Float(i)
+			}
+		}
+		var label float64
+		if !labelCategorical && cols.Label >= 0 {
+			label = row.Float(cols.Label)
+		}
+		weight := 1.0
+		if cols.Weight >= 0 {
+			weight = row.Float(cols.Weight)
+			row.Check(weight >= 0, cols.Weight, "negative sample weight")
+		}
+		if err := row.Err(); err != nil {
+			if err := reader.Skip(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, name := range empty {
+			if d.missing == nil {
+				d.missing = make(map[string]int)
+			}
+			d.missing[name]++
+		}
+		if len(empty) > 0 && l.Options.Missing == MissingDrop {
+			d.dropped++
+			continue
+		}
+
+		d.X = append(d.X, features)
+		d.Y = append(d.Y, label)
+		values = append(values, names)
+		if cols.Weight >= 0 {
+			d.Weights = append(d.Weights, weight)
+		}
+		if cols.ID >= 0 {
+			d.IDs = append(d.IDs, row.Fields[cols.ID])
+		}
+		if cols.Group >= 0 {
+			d.Groups = append(d.Groups, row.Fields[cols.Group])
+		}
+	}
+	d.skipped = reader.Skipped()
+	d.filtered = reader.Filtered()
+	if err := d.imputeMissing(l.Options); err != nil {
+		return nil, err
+	}
+
+	first := 0
+	if labelCategorical {
+		d.Classes = distinct(values, 0)
+		index := indexOf(d.Classes)
+		for i := range d.Y {
+			d.Y[i] = float64(index[values[i][0]])
+		}
+		first = 1
+	}
+	if len(l.Categorical) > first && l.Codes {
+		d.codeFeatures(categorical, values, first)
+	} else if len(l.Categorical) > first {
+		d.encodeFeatures(categorical, values, first)
+	}
+	return d, nil
+}
+
+// codeFeatures sets every categorical feature to the index of its value in
+// Categories. The values of the features are in values, from position first
+// on.
+func (d *Dataset) codeFeatures(categorical map[string]bool, values [][]string, first int) {
+	d.Categories = make(map[string][]string)
+	for j, name := range d.FeatureNames {
+		if !categorical[name] {
+			continue
+		}
+		categories := distinct(values, first)
+		index := indexOf(categories)
+		d.Categories[name] = categories
+		for i, row := range d.X {
+			row[j] = float64(index[values[i][first]])
+		}
+		first++
+	}
+}
+
+// encodeFeatures replaces every categorical feature with its one-hot columns.
+// The values of the features are in values, from position first on.
+func (d *Dataset) encodeFeatures(categorical map[string]bool, values [][]string, first int) {
+	names := d.FeatureNames
+	d.FeatureNames = nil
+	encoded := make([][]float64, d.Len())
+	for j, name := range names {
+		if !categorical[name] {
+			d.FeatureNames = append(d.FeatureNames, name)
+			for i := range encoded {
+				encoded[i] = append(encoded[i], d.X[i][j])
+			}
+			continue
+		}
+		categories := distinct(values, first)
+		index := indexOf(categories)
+		for _, category := range categories {
+			d.FeatureNames = append(d.FeatureNames, name+"="+category)
+		}
+		for i := range encoded {
+			oneHot := make([]float64, len(categories))
+			oneHot[index[values[i][first]]] = 1
+			encoded[i] = append(encoded[i], oneHot...)
+		}
+		first++
+	}
+	d.X = encoded
+}
+
+// distinct returns the sorted distinct values at position k of every row.
+func distinct(rows [][]string, k int) []string {
+	seen := make(map[string]bool)
+	var values []string
+	for _, row := range rows {
+		if !seen[row[k]] {
+			seen[row[k]] = true
+			values = append(values, row[k])
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func indexOf(values []string) map[string]int {
+	index := make(map[string]int, len(values))
+	for i, v := range values {
+		index[v] = i
+	}
+	return index
+}
@@ -0,0 +1,121 @@
+package dataset
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultBaseURL serves the demo datasets exactly as the examples in this
+// repository expect them.
+const DefaultBaseURL = "https://raw.githubusercontent.com/RN0311/gopherConAU/main/"
+
+// Demo is a dataset one of the examples runs on.
+type Demo struct {
+	Name        string
+	File        string // file name, relative to the base URL and the data directory
+	SHA256      string // hex digest of the file
+	Description string
+	UsedBy      string
+}
+
+// Demos lists the datasets the examples run on.
+var Demos = []Demo{
+	{
+		Name:        "wine",
+		File:        "winequality-dataset.csv",
+		SHA256:      "7e38cc28812d08f521ee19e29e9d3622cde03464ff5e9a8b14aa991ec74ae49e",
+		Description: "UCI wine quality, red wines with an Id column (1143 rows)",
+		UsedBy:      "basic-distributed-ml-pipeline, pipeline-design-pattern",
+	},
+	{
+		Name:        "iris",
+		File:        "iris.csv",
+		SHA256:      "cb2bd2048ef9fefb625e2a472742f76740e479227647a790782189d76e4fe0ae",
+		Description: "Fisher's iris flowers (150 rows)",
+		UsedBy:      "kmeans.go, k-means-visualization.go",
+	},
+	{
+		Name:        "housing",
+		File:        "housing.csv",
+		SHA256:      "8a3727f4cf54ac1a327f69b1d5b4db54c5834ea81c6e4efc0d163300022a685e",
+		Description: "California housing, 1990 census blocks (20640 rows)",
+		UsedBy:      "linear-regression.go",
+	},
+}
+
+// FindDemo returns the demo dataset with the given name.
+func FindDemo(name string) (Demo, error) {
+	names := make([]string, len(Demos))
+	for i, demo := range Demos {
+		if demo.Name == name {
+			return demo, nil
+		}
+		names[i] = demo.Name
+	}
+	return Demo{}, fmt.Errorf("unknown dataset %q (known: %s)", name, strings.Join(names, ", "))
+}
+
+// Verify reports whether path holds the demo's file, checked by its digest.
+func (d Demo) Verify(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return false, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)) == d.SHA256, nil
+}
+
+// Fetch downloads the demo's file from baseURL into dir and returns its path.
+// The download is checked against the digest before it replaces any file at
+// that path, so a failed or tampered download leaves nothing behind.
+func (d Demo) Fetch(ctx context.Context, client *http.Client, baseURL, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	url := strings.TrimSuffix(baseURL, "/") + "/" + d.File
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	path := filepath.Join(dir, d.File)
+	tmp, err := os.CreateTemp(dir, d.File+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("downloading %s: %v", url, err)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != d.SHA256 {
+		return "", fmt.Errorf("%s has SHA-256 %s, want %s", url, sum, d.SHA256)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,57 @@
+package dataset
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Files expands a dataset location into the files it names: a single file,
+// every .csv and .xlsx file in a directory, or the matches of a glob pattern such as
+// data/part-*.csv. Directories and globs are returned in lexical order, and
+// the column statistics kept next to dataset files are never included.
+func Files(location string) ([]string, error) {
+	if strings.ContainsAny(location, "*?[") {
+		matches, err := filepath.Glob(location)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %v", location, err)
+		}
+		var files []string
+		for _, match := range matches {
+			if strings.HasSuffix(match, StatsPath("")) {
+				continue
+			}
+			if info, err := os.Stat(match); err == nil && !info.IsDir() {
+				files = append(files, match)
+			}
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no files match %s", location)
+		}
+		sort.Strings(files)
+		return files, nil
+	}
+
+	info, err := os.Stat(location)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{location}, nil
+	}
+	var files []string
+	for _, pattern := range []string{"*.csv", "*.xlsx"} {
+		matches, err := filepath.Glob(filepath.Join(location, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .csv or .xlsx files in %s", location)
+	}
+	sort.Strings(files)
+	return files, nil
+}
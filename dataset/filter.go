@@ -0,0 +1,386 @@
+package dataset
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Filter is a row filter expression such as
+//
+//	quality >= 5 && alcohol < 12
+//
+// It compares columns with numbers, strings or other columns using ==, !=,
+// <, <=, > and >=, and combines comparisons with &&, || and !, grouped by
+// parentheses. A column whose name is not a plain identifier is written in
+// backquotes, as in `fixed acidity` > 7.5. Comparing with a number, or two
+// columns, parses the fields as numbers, and a row where that fails is a
+// bad row; comparing with a quoted string compares the trimmed field as
+// text.
+type Filter struct {
+	source string
+	root   node
+}
+
+// ParseFilter parses a filter expression.
+func ParseFilter(source string) (*Filter, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %v", source, err)
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.or()
+	if err == nil && p.peek().kind != tokenEOF {
+		err = p.unexpected()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %v", source, err)
+	}
+	return &Filter{source: source, root: root}, nil
+}
+
+func (f *Filter) String() string { return f.source }
+
+// Columns returns the columns the filter refers to, in order of first use.
+func (f *Filter) Columns() []string {
+	var columns []string
+	f.root.walk(func(c comparison) {
+		for _, side := range []operand{c.left, c.right} {
+			if side.kind == operandColumn && !contains(columns, side.text) {
+				columns = append(columns, side.text)
+			}
+		}
+	})
+	return columns
+}
+
+// bind resolves the filter's columns against header and returns a
+// predicate over rows with that header. A predicate that fails to parse a
+// field sets the row's Err and returns false.
+func (f *Filter) bind(header []string) (predicate, error) {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+	for _, name := range f.Columns() {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("filter %q: column %q not in header (columns: %s)", f.source, name, strings.Join(header, ", "))
+		}
+	}
+	return f.root.bind(index), nil
+}
+
+type predicate func(row *Row) bool
+
+// node is a boolean expression of the filter syntax tree.
+type node interface {
+	bind(index map[string]int) predicate
+	walk(visit func(comparison))
+}
+
+type logical struct {
+	and         bool // && rather than ||
+	left, right node
+}
+
+func (l logical) bind(index map[string]int) predicate {
+	left, right := l.left.bind(index), l.right.bind(index)
+	if l.and {
+		return func(row *Row) bool { return left(row) && right(row) }
+	}
+	return func(row *Row) bool { return left(row) || right(row) }
+}
+
+func (l logical) walk(visit func(comparison)) {
+	l.left.walk(visit)
+	l.right.walk(visit)
+}
+
+type negation struct{ operand node }
+
+func (n negation) bind(index map[string]int) predicate {
+	operand := n.operand.bind(index)
+	return func(row *Row) bool { return !operand(row) && row.err == nil }
+}
+
+func (n negation) walk(visit func(comparison)) { n.operand.walk(visit) }
+
+type operandKind int
+
+const (
+	operandColumn operandKind = iota
+	operandNumber
+	operandString
+)
+
+type operand struct {
+	kind   operandKind
+	text   string // the column name or the string
+	number float64
+}
+
+type comparison struct {
+	op          string
+	left, right operand
+}
+
+func (c comparison) walk(visit func(comparison)) { visit(c) }
+
+func (c comparison) bind(index map[string]int) predicate {
+	if c.left.kind == operandString || c.right.kind == operandString {
+		left, right := c.text(c.left, index), c.text(c.right, index)
+		return func(row *Row) bool {
+			return compare(c.op, strings.Compare(left(row), right(row)))
+		}
+	}
+	left, right := c.number(c.left, index), c.number(c.right, index)
+	return func(row *Row) bool {
+		a, b := left(row), right(row)
+		if row.err != nil {
+			return false
+		}
+		switch {
+		case a < b:
+			return compare(c.op, -1)
+		case a > b:
+			return compare(c.op, 1)
+		case a == b:
+			return compare(c.op, 0)
+		}
+		return c.op == "!=" // NaN
+	}
+}
+
+func (comparison) text(side operand, index map[string]int) func(*Row) string {
+	if side.kind == operandColumn {
+		i := index[side.text]
+		return func(row *Row) string { return strings.TrimSpace(row.Fields[i]) }
+	}
+	return func(*Row) string { return side.text }
+}
+
+func (comparison) number(side operand, index map[string]int) func(*Row) float64 {
+	if side.kind == operandColumn {
+		i := index[side.text]
+		return func(row *Row) float64 { return row.Float(i) }
+	}
+	return func(*Row) float64 { return side.number }
+}
+
+// compare reports whether op holds between two values whose order is
+// given by sign, as returned by strings.Compare.
+func compare(op string, sign int) bool {
+	switch op {
+	case "==":
+		return sign == 0
+	case "!=":
+		return sign != 0
+	case "<":
+		return sign < 0
+	case "<=":
+		return sign <= 0
+	case ">":
+		return sign > 0
+	default: // ">="
+		return sign >= 0
+	}
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenColumn
+	tokenNumber
+	tokenString
+	tokenOp // a comparison
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // byte offset in the source
+}
+
+// lex splits a filter expression into tokens.
+func lex(source string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(source); {
+		c := source[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case strings.HasPrefix(source[i:], "&&"):
+			tokens = append(tokens, token{tokenAnd, "&&", start})
+			i += 2
+		case strings.HasPrefix(source[i:], "||"):
+			tokens = append(tokens, token{tokenOr, "||", start})
+			i += 2
+		case strings.HasPrefix(source[i:], "=="), strings.HasPrefix(source[i:], "!="),
+			strings.HasPrefix(source[i:], "<="), strings.HasPrefix(source[i:], ">="):
+			tokens = append(tokens, token{tokenOp, source[i : i+2], start})
+			i += 2
+		case c == '<' || c == '>':
+			tokens = append(tokens, token{tokenOp, source[i : i+1], start})
+			i++
+		case c == '!':
+			tokens = append(tokens, token{tokenNot, "!", start})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenOpen, "(", start})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenClose, ")", start})
+			i++
+		case c == '`' || c == '"' || c == '\'':
+			end := strings.IndexByte(source[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated %c at offset %d", c, start)
+			}
+			kind := tokenString
+			if c == '`' {
+				kind = tokenColumn
+			}
+			tokens = append(tokens, token{kind, source[i+1 : i+1+end], start})
+			i += end + 2
+		case c >= '0' && c <= '9' || c == '.' || c == '-' || c == '+':
+			i++
+			for i < len(source) && (isDigit(source[i]) || source[i] == '.' || source[i] == 'e' || source[i] == 'E' ||
+				(source[i] == '-' || source[i] == '+') && (source[i-1] == 'e' || source[i-1] == 'E')) {
+				i++
+			}
+			if _, err := strconv.ParseFloat(source[start:i], 64); err != nil {
+				return nil, fmt.Errorf("bad number %q at offset %d", source[start:i], start)
+			}
+			tokens = append(tokens, token{tokenNumber, source[start:i], start})
+		case isIdentifier(rune(c), true):
+			for i < len(source) && isIdentifier(rune(source[i]), false) {
+				i++
+			}
+			tokens = append(tokens, token{tokenColumn, source[start:i], start})
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d", c, start)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(source)}), nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isIdentifier(r rune, first bool) bool {
+	return r == '_' || r < 0x80 && unicode.IsLetter(r) || !first && (r == '.' || r < 0x80 && unicode.IsDigit(r))
+}
+
+// parser builds the syntax tree by recursive descent, with && binding
+// tighter than ||.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	if t.kind == tokenEOF {
+		return fmt.Errorf("unexpected end of expression")
+	}
+	return fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	for err == nil && p.peek().kind == tokenOr {
+		p.next()
+		var right node
+		if right, err = p.and(); err == nil {
+			left = logical{left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.unary()
+	for err == nil && p.peek().kind == tokenAnd {
+		p.next()
+		var right node
+		if right, err = p.unary(); err == nil {
+			left = logical{and: true, left: left, right: right}
+		}
+	}
+	return left, err
+}
+
+func (p *parser) unary() (node, error) {
+	switch p.peek().kind {
+	case tokenNot:
+		p.next()
+		operand, err := p.unary()
+		return negation{operand}, err
+	case tokenOpen:
+		p.next()
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokenClose {
+			return nil, p.unexpected()
+		}
+		p.next()
+		return inner, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (node, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenOp {
+		return nil, p.unexpected()
+	}
+	op := p.next()
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	if left.kind != operandColumn && right.kind != operandColumn {
+		return nil, fmt.Errorf("comparison at offset %d has no column", op.pos)
+	}
+	return comparison{op: op.text, left: left, right: right}, nil
+}
+
+func (p *parser) operand() (operand, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenColumn:
+		p.next()
+		return operand{kind: operandColumn, text: t.text}, nil
+	case tokenString:
+		p.next()
+		return operand{kind: operandString, text: t.text}, nil
+	case tokenNumber:
+		p.next()
+		number, _ := strconv.ParseFloat(t.text, 64)
+		return operand{kind: operandNumber, number: number}, nil
+	}
+	return operand{}, p.unexpected()
+}
@@ -0,0 +1,96 @@
+package dataset
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+)
+
+// StratifiedKFold assigns every row a fold in [0, k) so that each stratum is
+// spread as evenly as possible over the folds. The rows of a stratum are
+// shuffled with rng and dealt out in turn, each stratum starting where the
+// previous one stopped, so the same seed always gives the same folds.
+func StratifiedKFold(strata []string, k int, rng *rand.Rand) ([]int, error) {
+	if k < 2 || k > len(strata) {
+		return nil, fmt.Errorf("cannot make %d folds from %d rows", k, len(strata))
+	}
+	folds := make([]int, len(strata))
+	next := 0
+	for _, rows := range groupRows(strata) {
+		rng.Shuffle(len(rows), func(i, j int) {
+			rows[i], rows[j] = rows[j], rows[i]
+		})
+		for _, i := range rows {
+			folds[i] = next
+			next = (next + 1) % k
+		}
+	}
+	return folds, nil
+}
+
+// WriteFolds writes fold assignments as a CSV file with an "id" and a "fold"
+// column, one row per id, which pandas and other tools read directly.
+func WriteFolds(path string, ids []string, folds []int) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(file)
+	w.Write([]string{"id", "fold"})
+	for i, id := range ids {
+		w.Write([]string{id, strconv.Itoa(folds[i])})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ReadFolds reads fold assignments from a CSV file with "id" and "fold"
+// columns, in any order and among other columns.
+func ReadFolds(path string) (map[string]int, error) {
+	reader, err := Open(path, Options{})
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	idColumn, foldColumn := -1, -1
+	for i, name := range reader.Header {
+		switch name {
+		case "id":
+			idColumn = i
+		case "fold":
+			foldColumn = i
+		}
+	}
+	if idColumn < 0 || foldColumn < 0 {
+		return nil, fmt.Errorf("%s: need an id and a fold column", path)
+	}
+
+	folds := make(map[string]int)
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			return folds, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		fold := row.Int(foldColumn)
+		row.Check(fold >= 0, foldColumn, "negative fold")
+		if err := row.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		id := row.Fields[idColumn]
+		if _, dup := folds[id]; dup {
+			return nil, fmt.Errorf("%s: line %d: id %q assigned twice", path, row.Line, id)
+		}
+		folds[id] = fold
+	}
+}
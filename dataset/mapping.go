@@ -0,0 +1,137 @@
+// Package dataset holds the CSV handling shared by the programs in this
+// repository: which columns are labels, ids, weights and features.
+package dataset
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// Mapping names the CSV columns that hold the label, an optional row id, an
+// optional per-sample weight, an optional group key and the features. With
+// no Features listed, every other column is a feature, in header order.
+type Mapping struct {
+	Label    string   `json:"label"`
+	ID       string   `json:"id,omitempty"`
+	Weight   string   `json:"weight,omitempty"`
+	Group    string   `json:"group,omitempty"`
+	Features []string `json:"features,omitempty"`
+}
+
+// Columns is a Mapping resolved against a header to column indices.
+type Columns struct {
+	Label        int // -1 when an unlabeled load found no label column
+	ID           int // -1 when there is no id column
+	Weight       int // -1 when there is no weight column
+	Group        int // -1 when there is no group column
+	Features     []int
+	FeatureNames []string
+}
+
+// Resolve checks every mapped column against the header and returns their
+// indices. A column may play only one role.
+func (m Mapping) Resolve(header []string) (Columns, error) {
+	return m.resolve(header, true)
+}
+
+// resolve is Resolve, with the label column optional unless labeled is set.
+func (m Mapping) resolve(header []string, labeled bool) (Columns, error) {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+	lookup := func(role, name string) (int, error) {
+		i, ok := index[name]
+		if !ok {
+			return -1, fmt.Errorf("%s column %q not in header (columns: %s)", role, name, strings.Join(header, ", "))
+		}
+		return i, nil
+	}
+
+	cols := Columns{Label: -1, ID: -1, Weight: -1, Group: -1}
+	roles := make(map[int]string)
+	if _, found := index[m.Label]; labeled || found {
+		if m.Label == "" {
+			return cols, fmt.Errorf("no label column configured")
+		}
+		var err error
+		if cols.Label, err = lookup("label", m.Label); err != nil {
+			return cols, err
+		}
+		roles[cols.Label] = "label"
+	}
+
+	for _, optional := range []struct {
+		role, name string
+		dst        *int
+	}{
+		{"id", m.ID, &cols.ID},
+		{"weight", m.Weight, &cols.Weight},
+		{"group", m.Group, &cols.Group},
+	} {
+		if optional.name == "" {
+			continue
+		}
+		i, err := lookup(optional.role, optional.name)
+		if err != nil {
+			return cols, err
+		}
+		if other, taken := roles[i]; taken {
+			return cols, fmt.Errorf("column %q cannot be both %s and %s", optional.name, other, optional.role)
+		}
+		roles[i] = optional.role
+		*optional.dst = i
+	}
+
+	if len(m.Features) == 0 {
+		for i, name := range header {
+			if _, taken := roles[i]; !taken {
+				cols.Features = append(cols.Features, i)
+				cols.FeatureNames = append(cols.FeatureNames, strings.TrimSpace(name))
+			}
+		}
+	} else {
+		for _, name := range m.Features {
+			i, err := lookup("feature", name)
+			if err != nil {
+				return cols, err
+			}
+			if other, taken := roles[i]; taken {
+				return cols, fmt.Errorf("column %q cannot be both %s and feature", name, other)
+			}
+			roles[i] = "feature"
+			cols.Features = append(cols.Features, i)
+			cols.FeatureNames = append(cols.FeatureNames, name)
+		}
+	}
+	if len(cols.Features) == 0 {
+		return cols, fmt.Errorf("no feature columns left after mapping")
+	}
+	return cols, nil
+}
+
+// SplitList parses a comma-separated flag value, trimming spaces and
+// dropping empty entries.
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// RegisterFlags binds -label-column, -id-column, -weight-column,
+// -group-column and -feature-columns on fs to m, using m's current values as defaults.
+func (m *Mapping) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&m.Label, "label-column", m.Label, "CSV column holding the label")
+	fs.StringVar(&m.ID, "id-column", m.ID, "CSV column holding the row id (excluded from the features)")
+	fs.StringVar(&m.Weight, "weight-column", m.Weight, "CSV column holding per-sample weights (excluded from the features)")
+	fs.StringVar(&m.Group, "group-column", m.Group, "CSV column whose rows must stay on the same side of every split (excluded from the features)")
+	fs.Func("feature-columns", "comma-separated CSV columns used as features (default: every other column)", func(value string) error {
+		m.Features = SplitList(value)
+		return nil
+	})
+}
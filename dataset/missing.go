@@ -0,0 +1,102 @@
+package dataset
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"gopherconAU/preprocess"
+)
+
+// Strategies for an empty feature field, set by Options.Missing.
+const (
+	// MissingSkip skips the row as bad, counting it against MaxBadRows.
+	MissingSkip = "skip"
+	// MissingDrop leaves the row out without counting it as bad.
+	MissingDrop = "drop"
+	// MissingNaN loads the field as NaN, for an imputer fitted on the
+	// training rows alone, such as preprocess.Imputer, to fill.
+	MissingNaN = "nan"
+	// MissingMean, MissingMedian and MissingConstant fill the field with the
+	// mean or median of the column over every row loaded, or with
+	// Options.MissingValue.
+	MissingMean     = preprocess.Mean
+	MissingMedian   = preprocess.Median
+	MissingConstant = preprocess.Constant
+)
+
+// validMissing checks a strategy for empty feature fields.
+func validMissing(strategy string) error {
+	switch strategy {
+	case "", MissingSkip, MissingDrop, MissingNaN, MissingMean, MissingMedian, MissingConstant:
+		return nil
+	}
+	return fmt.Errorf("unknown missing-value strategy %q, want skip, drop, nan, mean, median or constant", strategy)
+}
+
+// isMissing reports whether field is an empty feature field under the
+// strategy, which leaves it to fail to parse when it is MissingSkip.
+func (o Options) isMissing(field string) bool {
+	return o.Missing != "" && o.Missing != MissingSkip && strings.TrimSpace(field) == ""
+}
+
+// imputeMissing fills the NaN features of d as Options.Missing says,
+// fitting the fill values on every row of d.
+func (d *Dataset) imputeMissing(o Options) error {
+	if o.Missing != MissingMean && o.Missing != MissingMedian && o.Missing != MissingConstant {
+		return nil
+	}
+	if len(d.missing) == 0 {
+		return nil
+	}
+	imputer := &preprocess.Imputer{Strategy: o.Missing, Fill: o.MissingValue}
+	if err := imputer.Fit(d.X); err != nil {
+		return err
+	}
+	d.X = imputer.Transform(d.X)
+	d.fills = make(map[string]float64)
+	for j, name := range d.FeatureNames {
+		if d.missing[name] > 0 {
+			d.fills[name] = imputer.Values[j]
+		}
+	}
+	return nil
+}
+
+// Missing returns the number of empty feature fields of every column that
+// had any, in the rows loaded or, with MissingDrop, in the rows dropped.
+func (d *Dataset) Missing() map[string]int { return d.missing }
+
+// missingSummary describes how empty feature fields were handled, or
+// returns "" when there were none.
+func (d *Dataset) missingSummary() string {
+	if len(d.missing) == 0 {
+		return ""
+	}
+	var names []string
+	total := 0
+	for name, count := range d.missing {
+		names = append(names, name)
+		total += count
+	}
+	sort.Strings(names)
+	var columns []string
+	for _, name := range names {
+		column := fmt.Sprintf("%s %d", name, d.missing[name])
+		if fill, ok := d.fills[name]; ok && !math.IsNaN(fill) {
+			column += fmt.Sprintf(" (filled with %g)", fill)
+		}
+		columns = append(columns, column)
+	}
+	summary := fmt.Sprintf("%d missing cells", total)
+	switch {
+	case d.dropped > 0:
+		summary = fmt.Sprintf("dropped %d rows with %s", d.dropped, summary)
+	case d.fills != nil:
+		summary = "imputed " + summary
+	default:
+		summary = "loaded " + summary + " as NaN"
+	}
+	return summary + ": " + strings.Join(columns, ", ")
+}
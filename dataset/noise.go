@@ -0,0 +1,99 @@
+package dataset
+
+import (
+	"flag"
+	"math"
+	"math/rand"
+)
+
+// Noise describes corruption applied to training data, for studying how a
+// model degrades as its data gets worse.
+type Noise struct {
+	// Features is the standard deviation of the Gaussian noise added to
+	// every feature, in units of that feature's own standard deviation.
+	Features float64 `json:"feature_noise"`
+	// Labels is the fraction of rows whose label is replaced by the label of
+	// another row that has a different one.
+	Labels float64 `json:"label_noise"`
+	Seed   int64   `json:"noise_seed"`
+}
+
+// RegisterFlags adds -feature-noise, -label-noise and -noise-seed to fs,
+// with n's current values as defaults.
+func (n *Noise) RegisterFlags(fs *flag.FlagSet) {
+	fs.Float64Var(&n.Features, "feature-noise", n.Features, "add Gaussian noise with this many standard deviations to every training feature")
+	fs.Float64Var(&n.Labels, "label-noise", n.Labels, "fraction of training labels to replace with another row's label")
+	fs.Int64Var(&n.Seed, "noise-seed", n.Seed, "random seed of the injected noise")
+}
+
+// Enabled reports whether n changes anything.
+func (n Noise) Enabled() bool {
+	return n.Features > 0 || n.Labels > 0
+}
+
+// Apply returns a corrupted copy of d and the number of labels it changed;
+// d itself is left untouched. Taking replacement labels from other rows
+// works for class indices and numeric targets alike, and keeps them within
+// the values the data already has.
+func (n Noise) Apply(d *Dataset) (*Dataset, int) {
+	noisy := d.Subset(seq(d.Len()))
+	if !n.Enabled() || d.Len() == 0 {
+		return noisy, 0
+	}
+	rng := rand.New(rand.NewSource(n.Seed))
+
+	if n.Features > 0 {
+		stds := featureStds(d.X)
+		for i, row := range noisy.X {
+			row = append([]float64(nil), row...)
+			for j := range row {
+				row[j] += n.Features * stds[j] * rng.NormFloat64()
+			}
+			noisy.X[i] = row
+		}
+	}
+
+	corrupted := 0
+	if n.Labels > 0 {
+		count := int(math.Round(n.Labels * float64(d.Len())))
+		for _, i := range rng.Perm(d.Len())[:min(count, d.Len())] {
+			// A few draws find a differing label unless nearly all agree.
+			for attempt := 0; attempt < 100; attempt++ {
+				if label := d.Y[rng.Intn(d.Len())]; label != d.Y[i] {
+					noisy.Y[i] = label
+					corrupted++
+					break
+				}
+			}
+		}
+	}
+	return noisy, corrupted
+}
+
+// featureStds returns the population standard deviation of every column.
+func featureStds(rows [][]float64) []float64 {
+	means := make([]float64, len(rows[0]))
+	for _, row := range rows {
+		for j, v := range row {
+			means[j] += v / float64(len(rows))
+		}
+	}
+	stds := make([]float64, len(means))
+	for _, row := range rows {
+		for j, v := range row {
+			stds[j] += (v - means[j]) * (v - means[j]) / float64(len(rows))
+		}
+	}
+	for j := range stds {
+		stds[j] = math.Sqrt(stds[j])
+	}
+	return stds
+}
+
+func seq(n int) []int {
+	rows := make([]int, n)
+	for i := range rows {
+		rows[i] = i
+	}
+	return rows
+}
@@ -0,0 +1,487 @@
+package dataset
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseError reports a field that could not be parsed, with the 1-based line
+// of the file it is on and the name of its column.
+type ParseError struct {
+	Line   int
+	Column string
+	Value  string
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d, column %q: cannot parse %q: %v", e.Line, e.Column, e.Value, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// Options controls how rows are parsed. The zero value reads plain
+// comma-separated files with '.' as the decimal point.
+type Options struct {
+	// MaxBadRows is how many rows that fail to parse may be skipped before
+	// the load is aborted. Zero aborts on the first bad row.
+	MaxBadRows int `json:"max_bad_rows,omitempty"`
+
+	// NoHeader reads the first row as data. Columns are then named
+	// column1, column2 and so on.
+	NoHeader bool `json:"no_header,omitempty"`
+
+	// Delimiter separates fields, "," when empty. Files that write decimals
+	// with a comma usually use ";".
+	Delimiter string `json:"delimiter,omitempty"`
+	// Decimal is the decimal separator in numbers, "." when empty.
+	Decimal string `json:"decimal,omitempty"`
+	// Thousands is a digit-grouping separator stripped from numbers, such
+	// as "." in "1.234,5" or "'" in "1'234.5".
+	Thousands string `json:"thousands,omitempty"`
+
+	// Sheet selects the worksheet of an .xlsx file, the first one when
+	// empty. Range restricts it to a block of cells such as "B3:H200" whose
+	// first row is the header; the whole used area is read when empty.
+	// Spreadsheet numbers are read unformatted, so the separators above do
+	// not apply to them.
+	Sheet string `json:"sheet,omitempty"`
+	Range string `json:"range,omitempty"`
+
+	// Columns is a comma-separated list of the columns to keep, in the order
+	// given; the others are dropped as rows are read, as if the file never
+	// had them. Every column is kept when empty.
+	Columns string `json:"columns,omitempty"`
+	// Filter is an expression, described at Filter, that rows must satisfy
+	// to be read at all. It may refer to columns that Columns drops.
+	Filter string `json:"filter,omitempty"`
+
+	// Missing is what loading a Dataset does with an empty feature field:
+	// MissingSkip, the default, MissingDrop, MissingNaN, MissingMean,
+	// MissingMedian or MissingConstant, which fills in MissingValue.
+	Missing      string  `json:"missing,omitempty"`
+	MissingValue float64 `json:"missing_value,omitempty"`
+}
+
+// RegisterFlags binds -max-bad-rows, -no-header, -csv-delimiter,
+// -decimal-separator, -thousands-separator, -sheet, -range, -columns,
+// -filter, -missing and -missing-value on fs to o.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.IntVar(&o.MaxBadRows, "max-bad-rows", o.MaxBadRows, "skip up to this many unparseable rows instead of aborting the load")
+	fs.BoolVar(&o.NoHeader, "no-header", o.NoHeader, "the file has no header row; columns are named column1, column2, ...")
+	fs.StringVar(&o.Delimiter, "csv-delimiter", o.Delimiter, "CSV field delimiter (default \",\")")
+	fs.StringVar(&o.Decimal, "decimal-separator", o.Decimal, "decimal separator in numbers (default \".\")")
+	fs.StringVar(&o.Thousands, "thousands-separator", o.Thousands, "thousands separator stripped from numbers")
+	fs.StringVar(&o.Sheet, "sheet", o.Sheet, "worksheet to read from .xlsx files (default: the first)")
+	fs.StringVar(&o.Range, "range", o.Range, "cell range to read from .xlsx files, such as B3:H200, with the header in its first row")
+	fs.StringVar(&o.Columns, "columns", o.Columns, "comma-separated columns to read, dropping the others (default: every column)")
+	fs.StringVar(&o.Filter, "filter", o.Filter, "read only the rows matching this expression, such as 'quality >= 5 && alcohol < 12'; quote other column names in backquotes")
+	fs.StringVar(&o.Missing, "missing", o.Missing, "what to do with empty feature cells: skip (the row is bad), drop (the row is left out), nan, or fill with the column's mean, median or a constant")
+	fs.Float64Var(&o.MissingValue, "missing-value", o.MissingValue, "value filled into empty feature cells with -missing constant")
+}
+
+// Validate checks that the separators are single characters that cannot be
+// confused with each other, that the filter parses and that the
+// missing-value strategy is known.
+func (o Options) Validate() error {
+	for _, sep := range []struct{ name, value string }{
+		{"delimiter", o.Delimiter},
+		{"decimal separator", o.Decimal},
+		{"thousands separator", o.Thousands},
+	} {
+		if sep.value != "" && utf8.RuneCountInString(sep.value) != 1 {
+			return fmt.Errorf("%s %q must be a single character", sep.name, sep.value)
+		}
+	}
+	if o.decimal() == o.Thousands {
+		return fmt.Errorf("decimal and thousands separators are both %q", o.Thousands)
+	}
+	if o.delimiter() == o.Decimal || o.delimiter() == o.Thousands {
+		return fmt.Errorf("delimiter %q is also used inside numbers; use -csv-delimiter to pick another", o.delimiter())
+	}
+	if o.Filter != "" {
+		if _, err := ParseFilter(o.Filter); err != nil {
+			return err
+		}
+	}
+	if err := validMissing(o.Missing); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (o Options) delimiter() string {
+	if o.Delimiter == "" {
+		return ","
+	}
+	return o.Delimiter
+}
+
+func (o Options) decimal() string {
+	if o.Decimal == "" {
+		return "."
+	}
+	return o.Decimal
+}
+
+// ParseFloat parses a number written with the configured separators.
+func (o Options) ParseFloat(s string) (float64, error) {
+	return strconv.ParseFloat(o.canonical(s), 64)
+}
+
+// ParseInt parses an integer written with the configured thousands
+// separator.
+func (o Options) ParseInt(s string) (int, error) {
+	return strconv.Atoi(o.canonical(s))
+}
+
+// canonical rewrites s into the form strconv expects.
+func (o Options) canonical(s string) string {
+	s = strings.TrimSpace(s)
+	if o.Thousands != "" {
+		s = strings.ReplaceAll(s, o.Thousands, "")
+	}
+	if o.Decimal != "" && o.Decimal != "." {
+		s = strings.Replace(s, o.Decimal, ".", 1)
+	}
+	return s
+}
+
+// CSVReader returns a csv.Reader for r using the configured delimiter.
+func (o Options) CSVReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma, _ = utf8.DecodeRuneInString(o.delimiter())
+	return reader
+}
+
+// ReadHeader returns the column names of the CSV or .xlsx file at path.
+func ReadHeader(path string, options Options) ([]string, error) {
+	reader, err := Open(path, options)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return reader.Header, nil
+}
+
+// Row is one CSV record and the line it starts on.
+type Row struct {
+	Line   int
+	Fields []string
+
+	header  []string
+	options Options
+	err     error
+}
+
+// NewRow wraps a record read elsewhere so its fields can be parsed with the
+// same error reporting as rows returned by a Reader. A record whose field
+// count differs from the header's comes back with Err already set.
+func NewRow(line int, header, fields []string, options Options) *Row {
+	row := &Row{Line: line, Fields: fields, header: header, options: options}
+	if len(fields) != len(header) {
+		row.err = &ParseError{Line: line, Err: fmt.Errorf("%d fields, header has %d", len(fields), len(header))}
+	}
+	return row
+}
+
+// Float parses the field in column i. After the first failure on a row,
+// Float and Int return zero and Err reports that failure.
+func (r *Row) Float(i int) float64 {
+	if r.err != nil {
+		return 0
+	}
+	value, err := r.options.ParseFloat(r.Fields[i])
+	if err != nil {
+		r.fail(i, err)
+		return 0
+	}
+	return value
+}
+
+// Int parses the field in column i as an integer.
+func (r *Row) Int(i int) int {
+	if r.err != nil {
+		return 0
+	}
+	value, err := r.options.ParseInt(r.Fields[i])
+	if err != nil {
+		r.fail(i, err)
+		return 0
+	}
+	return value
+}
+
+// Check fails the row with msg when ok is false, attributing the failure to
+// column i. It is used for values that parse but are out of range.
+func (r *Row) Check(ok bool, i int, msg string) {
+	if !ok && r.err == nil {
+		r.fail(i, errors.New(msg))
+	}
+}
+
+// Err returns the first parse failure on the row, as a *ParseError.
+func (r *Row) Err() error { return r.err }
+
+func (r *Row) fail(i int, err error) {
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) {
+		err = numErr.Err
+	}
+	column := fmt.Sprintf("#%d", i+1)
+	if i < len(r.header) {
+		column = r.header[i]
+	}
+	r.err = &ParseError{Line: r.Line, Column: column, Value: r.Fields[i], Err: err}
+}
+
+// Reader reads the records of a CSV file or worksheet after its header,
+// keeping line numbers for error reporting and tolerating up to
+// Options.MaxBadRows bad rows. In a worksheet the line is the row number.
+// Header and the rows returned by Next hold only the columns selected by
+// Options.Columns, and rows not matching Options.Filter are passed over.
+type Reader struct {
+	Header []string
+
+	options   Options
+	records   recordSource
+	selection *Selection
+	closer    io.Closer
+	skipped   []error
+}
+
+// newReader returns a Reader for the records of a file with the given
+// header.
+func newReader(header []string, options Options, records recordSource) (*Reader, error) {
+	selection, err := options.Select(header)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{Header: selection.Header, options: options, records: records, selection: selection}, nil
+}
+
+// Selection applies Options.Columns and Options.Filter to the records of a
+// file. A Reader uses one internally; it is exported for records read some
+// other way, such as lines appended to a file being watched.
+type Selection struct {
+	// Header names the selected columns.
+	Header []string
+
+	fileHeader []string
+	columns    []int // indices into fileHeader, nil to keep every column
+	filter     predicate
+	filtered   int
+}
+
+// Select resolves Columns and Filter against the header of a file, which
+// must name every column of it.
+func (o Options) Select(header []string) (*Selection, error) {
+	s := &Selection{Header: header, fileHeader: header}
+	if o.Filter != "" {
+		filter, err := ParseFilter(o.Filter)
+		if err != nil {
+			return nil, err
+		}
+		if s.filter, err = filter.bind(header); err != nil {
+			return nil, err
+		}
+	}
+	if o.Columns == "" {
+		return s, nil
+	}
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.TrimSpace(name)] = i
+	}
+	s.Header = nil
+	for _, name := range SplitList(o.Columns) {
+		i, ok := index[name]
+		if !ok {
+			return nil, fmt.Errorf("selected column %q not in header (columns: %s)", name, strings.Join(header, ", "))
+		}
+		if contains(s.Header, name) {
+			return nil, fmt.Errorf("column %q selected twice", name)
+		}
+		s.columns = append(s.columns, i)
+		s.Header = append(s.Header, name)
+	}
+	return s, nil
+}
+
+// Row returns the selected fields of a record as a row, or nil when the
+// record does not match the filter. A record that cannot be filtered, such
+// as one whose filtered fields are not numbers, comes back with Err set.
+func (s *Selection) Row(line int, fields []string, options Options) *Row {
+	row := NewRow(line, s.fileHeader, fields, options)
+	if s.filter != nil && row.err == nil && !s.filter(row) && row.err == nil {
+		s.filtered++
+		return nil
+	}
+	if s.columns == nil {
+		return row
+	}
+	selected := make([]string, len(s.columns))
+	for j, i := range s.columns {
+		if i < len(fields) {
+			selected[j] = fields[i]
+		}
+	}
+	projected := NewRow(line, s.Header, selected, options)
+	projected.err = row.err
+	return projected
+}
+
+// Filtered returns the number of records that did not match the filter.
+func (s *Selection) Filtered() int { return s.filtered }
+
+// recordSource yields records with the line they start on.
+type recordSource interface {
+	next() ([]string, int, error)
+}
+
+type csvSource struct {
+	reader *csv.Reader
+	first  []string // a record read ahead of the others, returned first
+}
+
+func (s *csvSource) next() ([]string, int, error) {
+	if s.first != nil {
+		fields := s.first
+		s.first = nil
+		line, _ := s.reader.FieldPos(0)
+		return fields, line, nil
+	}
+	fields, err := s.reader.Read()
+	if err != nil {
+		return nil, 0, err
+	}
+	line, _ := s.reader.FieldPos(0)
+	return fields, line, nil
+}
+
+// Open returns a Reader for the file at path: a worksheet for .xlsx files
+// and CSV otherwise. The caller must Close it.
+func Open(path string, options Options) (*Reader, error) {
+	if isSpreadsheet(path) {
+		return openSheet(path, options)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := NewReader(file, options)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	reader.closer = file
+	return reader, nil
+}
+
+// numberedHeader names n columns of a file without a header.
+func numberedHeader(n int) []string {
+	header := make([]string, n)
+	for i := range header {
+		header[i] = fmt.Sprintf("column%d", i+1)
+	}
+	return header
+}
+
+// Close releases the file opened by Open.
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// NewReader reads the header from r and returns a Reader for the remaining
+// records. Without a header, the first record is returned by Next.
+func NewReader(r io.Reader, options Options) (*Reader, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	reader := options.CSVReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.New("empty CSV file")
+		}
+		return nil, err
+	}
+	// Rows with the wrong field count are reported by Next like any other
+	// bad row rather than as a read error.
+	reader.FieldsPerRecord = -1
+	source := &csvSource{reader: reader}
+	if options.NoHeader {
+		source.first, header = header, numberedHeader(len(header))
+	}
+	return newReader(header, options, source)
+}
+
+// Next returns the next record that matches the filter, or io.EOF after the
+// last one. A record with the wrong number of fields comes back with its Err
+// already set.
+func (r *Reader) Next() (*Row, error) {
+	for {
+		fields, line, err := r.records.next()
+		if err != nil {
+			return nil, err
+		}
+		if row := r.selection.Row(line, fields, r.options); row != nil {
+			return row, nil
+		}
+	}
+}
+
+// Filtered returns the number of records passed over so far because they
+// did not match Options.Filter.
+func (r *Reader) Filtered() int { return r.selection.Filtered() }
+
+// Skip records a bad row. It returns the row's error, wrapped with a count of
+// skipped rows, once more than MaxBadRows rows have been skipped.
+func (r *Reader) Skip(err error) error {
+	r.skipped = append(r.skipped, err)
+	if len(r.skipped) > r.options.MaxBadRows {
+		if r.options.MaxBadRows == 0 {
+			return err
+		}
+		return fmt.Errorf("more than %d bad rows, last: %w", r.options.MaxBadRows, err)
+	}
+	return nil
+}
+
+// Skipped returns the errors of the rows skipped so far.
+func (r *Reader) Skipped() []error { return r.skipped }
+
+// Summary describes the skipped rows in one line, showing at most the first
+// few errors, or returns "" when nothing was skipped.
+func (r *Reader) Summary() string {
+	return summarize(r.skipped)
+}
+
+func summarize(skipped []error) string {
+	if len(skipped) == 0 {
+		return ""
+	}
+	const shown = 3
+	summary := fmt.Sprintf("skipped %d bad rows", len(skipped))
+	for i, err := range skipped {
+		if i == shown {
+			summary += fmt.Sprintf("; and %d more", len(skipped)-shown)
+			break
+		}
+		summary += "; " + err.Error()
+	}
+	return summary
+}
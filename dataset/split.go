@@ -0,0 +1,76 @@
+package dataset
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// groupRows lists the rows of every distinct group, in order of first
+// appearance.
+func groupRows(groups []string) [][]int {
+	index := make(map[string]int)
+	var rows [][]int
+	for i, g := range groups {
+		k, ok := index[g]
+		if !ok {
+			k = len(rows)
+			index[g] = k
+			rows = append(rows, nil)
+		}
+		rows[k] = append(rows[k], i)
+	}
+	return rows
+}
+
+// GroupSplit holds out about testFraction of the rows for testing without
+// splitting any group: groups are taken in random order until the test side
+// has its share. It returns the row indices of both sides.
+func GroupSplit(groups []string, testFraction float64, rng *rand.Rand) (train, test []int) {
+	members := groupRows(groups)
+	rng.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+
+	want := int(testFraction*float64(len(groups)) + 0.5)
+	for _, rows := range members {
+		if len(test) < want {
+			test = append(test, rows...)
+		} else {
+			train = append(train, rows...)
+		}
+	}
+	return train, test
+}
+
+// GroupKFold assigns every row a fold in [0, k) so that rows sharing a group
+// share a fold. Groups go largest first to the fold with the fewest rows,
+// which keeps folds close in size; rng breaks ties between equal groups.
+func GroupKFold(groups []string, k int, rng *rand.Rand) ([]int, error) {
+	members := groupRows(groups)
+	if k < 2 || k > len(members) {
+		return nil, fmt.Errorf("cannot make %d folds from %d groups", k, len(members))
+	}
+	rng.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	sort.SliceStable(members, func(i, j int) bool {
+		return len(members[i]) > len(members[j])
+	})
+
+	folds := make([]int, len(groups))
+	sizes := make([]int, k)
+	for _, rows := range members {
+		smallest := 0
+		for f := range sizes {
+			if sizes[f] < sizes[smallest] {
+				smallest = f
+			}
+		}
+		for _, i := range rows {
+			folds[i] = smallest
+		}
+		sizes[smallest] += len(rows)
+	}
+	return folds, nil
+}
@@ -0,0 +1,218 @@
+package dataset
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// ColumnStats summarizes the numeric values of one column. Empty, "NA" and
+// "NaN" fields and fields that do not parse as numbers count as missing.
+type ColumnStats struct {
+	Name    string  `json:"name"`
+	Count   int     `json:"count"`
+	Missing int     `json:"missing"`
+	Mean    float64 `json:"mean"`
+	Std     float64 `json:"std"` // population standard deviation
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+}
+
+// Stats holds per-column statistics of a CSV file together with the size
+// and modification time the file had when they were computed.
+type Stats struct {
+	Size    int64         `json:"size"`
+	ModTime time.Time     `json:"mod_time"`
+	Format  Options       `json:"format"`
+	Rows    int           `json:"rows"`
+	Columns []ColumnStats `json:"columns"`
+}
+
+// ErrStaleStats is returned by ReadStats when the sidecar file no longer
+// matches the dataset.
+var ErrStaleStats = errors.New("column statistics are out of date")
+
+// StatsPath is where the statistics of the dataset at path are kept.
+func StatsPath(path string) string {
+	return path + ".stats.json"
+}
+
+// format is the part of the options that affects parsed values.
+func (o Options) format() Options {
+	o.MaxBadRows = 0
+	return o
+}
+
+// Column returns the statistics of the named column.
+func (s *Stats) Column(name string) (ColumnStats, bool) {
+	for _, c := range s.Columns {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return ColumnStats{}, false
+}
+
+// ComputeStats makes one pass over the CSV or .xlsx file at path. Rows with the wrong
+// number of fields are skipped.
+func ComputeStats(path string, options Options) (*Stats, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := Open(path, options)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	stats := &Stats{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Format:  options.format(),
+		Columns: make([]ColumnStats, len(reader.Header)),
+	}
+	// Welford's running mean and sum of squared deviations.
+	m2 := make([]float64, len(reader.Header))
+	for i, name := range reader.Header {
+		stats.Columns[i] = ColumnStats{Name: strings.TrimSpace(name), Min: math.Inf(1), Max: math.Inf(-1)}
+	}
+
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if row.Err() != nil {
+			continue
+		}
+		stats.Rows++
+		for i, field := range row.Fields {
+			c := &stats.Columns[i]
+			value, err := options.ParseFloat(field)
+			if err != nil || math.IsNaN(value) {
+				c.Missing++
+				continue
+			}
+			c.Count++
+			delta := value - c.Mean
+			c.Mean += delta / float64(c.Count)
+			m2[i] += delta * (value - c.Mean)
+			c.Min = math.Min(c.Min, value)
+			c.Max = math.Max(c.Max, value)
+		}
+	}
+
+	for i := range stats.Columns {
+		c := &stats.Columns[i]
+		if c.Count == 0 {
+			c.Min, c.Max = 0, 0
+			continue
+		}
+		c.Std = math.Sqrt(m2[i] / float64(c.Count))
+	}
+	return stats, nil
+}
+
+// MergeStats combines the statistics of files with the same columns into
+// the statistics of their concatenation. Size and ModTime are left zero.
+func MergeStats(parts ...*Stats) (*Stats, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("no statistics to merge")
+	}
+	merged := &Stats{Format: parts[0].Format, Columns: append([]ColumnStats(nil), parts[0].Columns...)}
+	merged.Rows = parts[0].Rows
+	for _, part := range parts[1:] {
+		if len(part.Columns) != len(merged.Columns) {
+			return nil, fmt.Errorf("cannot merge statistics of %d and %d columns", len(merged.Columns), len(part.Columns))
+		}
+		merged.Rows += part.Rows
+		for i, c := range part.Columns {
+			m := &merged.Columns[i]
+			if c.Name != m.Name {
+				return nil, fmt.Errorf("column %d is %q in one file and %q in another", i+1, m.Name, c.Name)
+			}
+			m.Missing += c.Missing
+			if c.Count == 0 {
+				continue
+			}
+			if m.Count == 0 {
+				m.Count, m.Mean, m.Std, m.Min, m.Max = c.Count, c.Mean, c.Std, c.Min, c.Max
+				continue
+			}
+			// Chan et al.'s pairwise combination of means and variances.
+			n := float64(m.Count + c.Count)
+			delta := c.Mean - m.Mean
+			m2 := m.Std*m.Std*float64(m.Count) + c.Std*c.Std*float64(c.Count) +
+				delta*delta*float64(m.Count)*float64(c.Count)/n
+			m.Mean += delta * float64(c.Count) / n
+			m.Std = math.Sqrt(m2 / n)
+			m.Count += c.Count
+			m.Min = math.Min(m.Min, c.Min)
+			m.Max = math.Max(m.Max, c.Max)
+		}
+	}
+	return merged, nil
+}
+
+// Save writes the statistics next to the dataset at path.
+func (s *Stats) Save(path string) error {
+	encoded, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := StatsPath(path) + ".tmp"
+	if err := os.WriteFile(tmp, encoded, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, StatsPath(path))
+}
+
+// ReadStats returns the saved statistics of the dataset at path. It returns
+// an error wrapping os.ErrNotExist when there are none and ErrStaleStats when
+// the file has changed size or modification time since, or was parsed with
+// different separators.
+func ReadStats(path string, options Options) (*Stats, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := os.ReadFile(StatsPath(path))
+	if err != nil {
+		return nil, err
+	}
+	var stats Stats
+	if err := json.Unmarshal(encoded, &stats); err != nil {
+		return nil, fmt.Errorf("%s: %v", StatsPath(path), err)
+	}
+	if stats.Size != info.Size() || !stats.ModTime.Equal(info.ModTime()) || stats.Format != options.format() {
+		return nil, ErrStaleStats
+	}
+	return &stats, nil
+}
+
+// LoadStats returns the saved statistics of the dataset at path, computing
+// and saving them first when they are missing or stale. A failure to save is
+// returned together with the computed statistics.
+func LoadStats(path string, options Options) (stats *Stats, cached bool, err error) {
+	stats, err = ReadStats(path, options)
+	if err == nil {
+		return stats, true, nil
+	}
+	stats, err = ComputeStats(path, options)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := stats.Save(path); err != nil {
+		return stats, false, fmt.Errorf("saving column statistics: %v", err)
+	}
+	return stats, false, nil
+}
@@ -0,0 +1,111 @@
+package dataset
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func isSpreadsheet(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".xlsx")
+}
+
+// sheetSource yields the rows of a worksheet that were read up front.
+type sheetSource struct {
+	rows  [][]string
+	lines []int // worksheet row number of each row
+	index int
+}
+
+func (s *sheetSource) next() ([]string, int, error) {
+	if s.index == len(s.rows) {
+		return nil, 0, io.EOF
+	}
+	s.index++
+	return s.rows[s.index-1], s.lines[s.index-1], nil
+}
+
+// openSheet reads the selected worksheet and range of an .xlsx file. Cell
+// values are taken unformatted, so numbers keep full precision whatever the
+// display format, and entirely blank rows are left out.
+func openSheet(path string, options Options) (*Reader, error) {
+	file, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sheets := file.GetSheetList()
+	sheet := options.Sheet
+	if sheet == "" && len(sheets) > 0 {
+		sheet = sheets[0]
+	}
+	if index, err := file.GetSheetIndex(sheet); err != nil || index < 0 {
+		return nil, fmt.Errorf("%s has no sheet %q (sheets: %s)", path, sheet, strings.Join(sheets, ", "))
+	}
+	rows, err := file.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, err
+	}
+
+	// Bounds are 1-based and inclusive, as in the spreadsheet.
+	firstCol, firstRow, lastCol, lastRow := 1, 1, 0, len(rows)
+	for _, row := range rows {
+		lastCol = max(lastCol, len(row))
+	}
+	if options.Range != "" {
+		if firstCol, firstRow, lastCol, lastRow, err = parseRange(options.Range); err != nil {
+			return nil, err
+		}
+	}
+
+	source := &sheetSource{}
+	var header []string
+	for r := firstRow; r <= lastRow && r <= len(rows); r++ {
+		fields := make([]string, lastCol-firstCol+1)
+		blank := true
+		for c := firstCol; c <= lastCol && c <= len(rows[r-1]); c++ {
+			fields[c-firstCol] = strings.TrimSpace(rows[r-1][c-1])
+			blank = blank && fields[c-firstCol] == ""
+		}
+		switch {
+		case blank:
+		case header == nil && !options.NoHeader:
+			header = fields
+		default:
+			source.rows = append(source.rows, fields)
+			source.lines = append(source.lines, r)
+		}
+	}
+	if options.NoHeader {
+		header = numberedHeader(lastCol - firstCol + 1)
+	}
+	if header == nil {
+		return nil, fmt.Errorf("sheet %q of %s has no header row", sheet, path)
+	}
+
+	// Only the row limit and the selection apply to spreadsheet values.
+	options = Options{MaxBadRows: options.MaxBadRows, Columns: options.Columns, Filter: options.Filter}
+	return newReader(header, options, source)
+}
+
+// parseRange turns a range such as "B3:H200" into its bounds.
+func parseRange(cellRange string) (firstCol, firstRow, lastCol, lastRow int, err error) {
+	from, to, ok := strings.Cut(strings.ToUpper(cellRange), ":")
+	if !ok {
+		return 0, 0, 0, 0, fmt.Errorf("range %q must look like B3:H200", cellRange)
+	}
+	if firstCol, firstRow, err = excelize.CellNameToCoordinates(from); err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("range %q: %v", cellRange, err)
+	}
+	if lastCol, lastRow, err = excelize.CellNameToCoordinates(to); err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("range %q: %v", cellRange, err)
+	}
+	if lastCol < firstCol || lastRow < firstRow {
+		return 0, 0, 0, 0, fmt.Errorf("range %q ends before it starts", cellRange)
+	}
+	return firstCol, firstRow, lastCol, lastRow, nil
+}
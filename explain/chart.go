@@ -0,0 +1,56 @@
+package explain
+
+import (
+	"os"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/components"
+	"github.com/go-echarts/go-echarts/v2/opts"
+)
+
+// RenderDependence writes an HTML page with one chart per feature: at most
+// maxCurves ICE curves in grey under the partial dependence curve.
+func RenderDependence(path, prediction string, dependences []Dependence, maxCurves int) error {
+	show, hide := true, false
+	page := components.NewPage()
+	page.PageTitle = "Partial dependence"
+	for _, d := range dependences {
+		chart := charts.NewLine()
+		chart.SetGlobalOptions(
+			charts.WithTitleOpts(opts.Title{Title: d.Feature, Subtitle: "partial dependence and ICE curves"}),
+			charts.WithXAxisOpts(opts.XAxis{Name: d.Feature, Type: "value", Scale: &show}),
+			charts.WithYAxisOpts(opts.YAxis{Name: prediction, Scale: &show}),
+			charts.WithTooltipOpts(opts.Tooltip{Show: &show}),
+			charts.WithLegendOpts(opts.Legend{Show: &show}),
+		)
+
+		for i, curve := range d.Individual {
+			if i == maxCurves {
+				break
+			}
+			chart.AddSeries("ICE", curvePoints(d.Grid, curve),
+				charts.WithLineChartOpts(opts.LineChart{ShowSymbol: &hide}),
+				charts.WithLineStyleOpts(opts.LineStyle{Color: "#b0b0b0", Width: 1, Opacity: 0.5}),
+				charts.WithItemStyleOpts(opts.ItemStyle{Color: "#b0b0b0"}))
+		}
+		chart.AddSeries("partial dependence", curvePoints(d.Grid, d.Average),
+			charts.WithLineStyleOpts(opts.LineStyle{Color: "#c23531", Width: 3}),
+			charts.WithItemStyleOpts(opts.ItemStyle{Color: "#c23531"}))
+		page.AddCharts(chart)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return page.Render(f)
+}
+
+func curvePoints(grid, curve []float64) []opts.LineData {
+	points := make([]opts.LineData, len(grid))
+	for i, x := range grid {
+		points[i] = opts.LineData{Value: []interface{}{x, curve[i]}}
+	}
+	return points
+}
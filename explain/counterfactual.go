@@ -0,0 +1,185 @@
+package explain
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Classifier is a fitted model that predicts a class from a feature vector.
+type Classifier interface {
+	Classify(features []float64) int
+}
+
+// ClassifierFunc adapts a classification function to a Classifier.
+type ClassifierFunc func(features []float64) int
+
+func (f ClassifierFunc) Classify(features []float64) int {
+	return f(features)
+}
+
+// Range bounds the values a feature may take in a counterfactual.
+type Range struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// Ranges returns the observed range of every feature over rows.
+func Ranges(rows [][]float64) []Range {
+	ranges := make([]Range, len(rows[0]))
+	for j := range ranges {
+		ranges[j] = Range{Min: math.Inf(1), Max: math.Inf(-1)}
+	}
+	for _, row := range rows {
+		for j, value := range row {
+			ranges[j].Min = math.Min(ranges[j].Min, value)
+			ranges[j].Max = math.Max(ranges[j].Max, value)
+		}
+	}
+	return ranges
+}
+
+// CounterfactualOptions tunes the counterfactual search. Distances are L1
+// over the features, so features should be on comparable scales, such as
+// standardized.
+type CounterfactualOptions struct {
+	Ranges    []Range // bounds per feature; the counterfactual stays inside them
+	Immutable []int   // features that must keep their value
+	Samples   int     // candidates drawn per search radius
+	Step      float64 // growth of the search radius
+	MaxRadius float64
+	Rand      *rand.Rand // nil uses a fixed seed
+}
+
+// Counterfactual is a changed version of a sample that the model assigns a
+// wanted class.
+type Counterfactual struct {
+	Features []float64 `json:"features"`
+	Class    int       `json:"class"`
+	Distance float64   `json:"distance"` // L1 distance from the original sample
+	Changed  []int     `json:"changed"`  // features that differ from it
+}
+
+// FindCounterfactual searches for a small change to x, within the feature
+// ranges, that makes model predict a class accepted by wanted. Candidates are
+// drawn in growing spheres around x until some are accepted. The closest one
+// is then made sparse by restoring features to their original values one at
+// a time, and pulled towards x as long as its class stays wanted.
+func FindCounterfactual(model Classifier, x []float64, wanted func(class int) bool, options CounterfactualOptions) (*Counterfactual, error) {
+	if len(options.Ranges) != len(x) {
+		return nil, fmt.Errorf("have ranges for %d features, sample has %d", len(options.Ranges), len(x))
+	}
+	if options.Samples < 1 || options.Step <= 0 || options.MaxRadius < options.Step {
+		return nil, fmt.Errorf("need positive samples, step and a max radius of at least one step")
+	}
+	if options.Rand == nil {
+		options.Rand = rand.New(rand.NewSource(1))
+	}
+	if wanted(model.Classify(x)) {
+		return nil, fmt.Errorf("the sample already has a wanted class")
+	}
+	immutable := make([]bool, len(x))
+	for _, j := range options.Immutable {
+		immutable[j] = true
+	}
+	var mutable []int
+	for j := range x {
+		if !immutable[j] {
+			mutable = append(mutable, j)
+		}
+	}
+	if len(mutable) == 0 {
+		return nil, fmt.Errorf("every feature is immutable")
+	}
+
+	var best []float64
+	bestDistance := math.Inf(1)
+	for radius := options.Step; radius <= options.MaxRadius && best == nil; radius += options.Step {
+		for s := 0; s < options.Samples; s++ {
+			candidate := options.sample(x, mutable, radius-options.Step, radius)
+			if d := l1(x, candidate); d < bestDistance && wanted(model.Classify(candidate)) {
+				best, bestDistance = candidate, d
+			}
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no counterfactual within distance %g", options.MaxRadius)
+	}
+
+	// Restore the least changed features first, keeping each restore that
+	// leaves the class wanted.
+	order := append([]int(nil), mutable...)
+	sort.Slice(order, func(a, b int) bool {
+		return math.Abs(best[order[a]]-x[order[a]]) < math.Abs(best[order[b]]-x[order[b]])
+	})
+	for _, j := range order {
+		changed := best[j]
+		best[j] = x[j]
+		if !wanted(model.Classify(best)) {
+			best[j] = changed
+		}
+	}
+
+	// Bisect for the point closest to x on the segment towards best that
+	// still has a wanted class.
+	low, high := 0.0, 1.0
+	for i := 0; i < 20; i++ {
+		mid := (low + high) / 2
+		if wanted(model.Classify(interpolate(x, best, mid))) {
+			high = mid
+		} else {
+			low = mid
+		}
+	}
+	best = interpolate(x, best, high)
+
+	counterfactual := &Counterfactual{Features: best, Class: model.Classify(best), Distance: l1(x, best)}
+	for j := range x {
+		if best[j] != x[j] {
+			counterfactual.Changed = append(counterfactual.Changed, j)
+		}
+	}
+	return counterfactual, nil
+}
+
+// sample draws a point whose L1 distance from x lies in (inner, outer],
+// changing a random subset of the mutable features and clamping them to
+// their ranges.
+func (o CounterfactualOptions) sample(x []float64, mutable []int, inner, outer float64) []float64 {
+	candidate := append([]float64(nil), x...)
+	features := append([]int(nil), mutable...)
+	o.Rand.Shuffle(len(features), func(i, j int) {
+		features[i], features[j] = features[j], features[i]
+	})
+	features = features[:1+o.Rand.Intn(len(features))]
+
+	direction := make([]float64, len(features))
+	norm := 0.0
+	for i := range direction {
+		direction[i] = o.Rand.NormFloat64()
+		norm += math.Abs(direction[i])
+	}
+	radius := inner + (outer-inner)*o.Rand.Float64()
+	for i, j := range features {
+		value := x[j] + radius*direction[i]/norm
+		candidate[j] = math.Max(o.Ranges[j].Min, math.Min(o.Ranges[j].Max, value))
+	}
+	return candidate
+}
+
+func interpolate(from, to []float64, t float64) []float64 {
+	point := make([]float64, len(from))
+	for j := range from {
+		point[j] = from[j] + t*(to[j]-from[j])
+	}
+	return point
+}
+
+func l1(a, b []float64) float64 {
+	d := 0.0
+	for j := range a {
+		d += math.Abs(a[j] - b[j])
+	}
+	return d
+}
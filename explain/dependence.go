@@ -0,0 +1,111 @@
+// Package explain computes model-agnostic explanations shared by the programs
+// in this repository: how a fitted model's prediction responds to one feature
+// when everything else about a sample is held fixed, what change would alter
+// it, and how far accuracy falls when the features are perturbed.
+package explain
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Estimator is a fitted model that makes a numeric prediction from a feature
+// vector. Explanations call Predict from several goroutines at once and never
+// modify the features they pass.
+type Estimator interface {
+	Predict(features []float64) float64
+}
+
+// EstimatorFunc adapts a prediction function to an Estimator.
+type EstimatorFunc func(features []float64) float64
+
+func (f EstimatorFunc) Predict(features []float64) float64 {
+	return f(features)
+}
+
+// Dependence holds the individual conditional expectation (ICE) curves of one
+// feature, the prediction of every sample as that feature sweeps Grid, and
+// their mean, the partial dependence.
+type Dependence struct {
+	Feature    string      `json:"feature"`
+	Grid       []float64   `json:"grid"`
+	Average    []float64   `json:"partial_dependence"`
+	Individual [][]float64 `json:"ice"`
+}
+
+// Grid returns up to points evenly spaced values of the feature, from its
+// 5th to its 95th percentile over rows, so outliers do not stretch the curve
+// into regions with no data.
+func Grid(rows [][]float64, feature, points int) ([]float64, error) {
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no rows to take the grid from")
+	}
+	if points < 2 {
+		return nil, fmt.Errorf("a grid needs at least 2 points, got %d", points)
+	}
+	values := make([]float64, 0, len(rows))
+	for _, row := range rows {
+		if !math.IsNaN(row[feature]) {
+			values = append(values, row[feature])
+		}
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("feature %d has no values", feature)
+	}
+	sort.Float64s(values)
+	low := values[int(0.05*float64(len(values)-1))]
+	high := values[int(0.95*float64(len(values)-1))]
+	if low == high {
+		return []float64{low}, nil
+	}
+
+	grid := make([]float64, points)
+	for i := range grid {
+		grid[i] = low + (high-low)*float64(i)/float64(points-1)
+	}
+	return grid, nil
+}
+
+// PartialDependence predicts every row with the feature set to each grid
+// value in turn. Rows are spread over all CPUs.
+func PartialDependence(model Estimator, rows [][]float64, feature int, name string, grid []float64) Dependence {
+	dependence := Dependence{
+		Feature:    name,
+		Grid:       grid,
+		Average:    make([]float64, len(grid)),
+		Individual: make([][]float64, len(rows)),
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				features := append([]float64(nil), rows[i]...)
+				curve := make([]float64, len(grid))
+				for g, value := range grid {
+					features[feature] = value
+					curve[g] = model.Predict(features)
+				}
+				dependence.Individual[i] = curve
+			}
+		}()
+	}
+	for i := range rows {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for _, curve := range dependence.Individual {
+		for g, prediction := range curve {
+			dependence.Average[g] += prediction / float64(len(rows))
+		}
+	}
+	return dependence
+}
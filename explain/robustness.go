@@ -0,0 +1,203 @@
+package explain
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+// Attacks accepted by RobustnessOptions.Attack.
+const (
+	AttackRandom   = "random"
+	AttackGradient = "gradient"
+)
+
+// Loss scores how badly a model does on features whose true class is label;
+// higher is worse. The gradient attack moves features up its gradient.
+type Loss func(features []float64, label int) float64
+
+// RobustnessOptions configures a robustness check. Perturbations are bounded
+// per feature: feature j moves by at most epsilon*Scale[j], and stays inside
+// Ranges[j] when ranges are given.
+type RobustnessOptions struct {
+	Attack string    // AttackRandom or AttackGradient
+	Scale  []float64 // nil scales every feature by 1, as for standardized features
+	Ranges []Range   // nil leaves perturbed features unbounded
+	// Trials is the number of random perturbations drawn per sample; a sample
+	// counts as correct only if all of them are classified correctly.
+	Trials int
+	// Loss and Gradient drive the gradient attack. Gradient returns the
+	// gradient of the loss with respect to the features; without it the
+	// gradient is estimated by central differences of Loss with a step of
+	// epsilon, which also works for models whose loss is piecewise constant.
+	Loss     Loss
+	Gradient func(features []float64, label int) []float64
+	Seed     int64
+}
+
+// RobustnessPoint is the accuracy under perturbations of one size.
+type RobustnessPoint struct {
+	Epsilon     float64 `json:"epsilon"`
+	Accuracy    float64 `json:"accuracy"`
+	Degradation float64 `json:"degradation"` // clean accuracy minus Accuracy
+	Flipped     int     `json:"flipped"`     // correctly classified samples the perturbation broke
+}
+
+// RobustnessReport is the outcome of Robustness.
+type RobustnessReport struct {
+	Attack  string            `json:"attack"`
+	Samples int               `json:"samples"`
+	Clean   float64           `json:"clean_accuracy"`
+	Points  []RobustnessPoint `json:"points"`
+}
+
+// Robustness measures how the accuracy of model on rows degrades when their
+// features are perturbed by each of epsilons. The random attack draws
+// perturbations uniformly from the bounded box; the gradient attack takes one
+// full step of size epsilon along the sign of the loss gradient (FGSM).
+// Rows are spread over all CPUs.
+func Robustness(model Classifier, rows [][]float64, labels []int, epsilons []float64, options RobustnessOptions) (*RobustnessReport, error) {
+	if len(rows) == 0 || len(rows) != len(labels) {
+		return nil, fmt.Errorf("need one label per row, have %d rows and %d labels", len(rows), len(labels))
+	}
+	switch options.Attack {
+	case AttackRandom:
+		if options.Trials < 1 {
+			return nil, fmt.Errorf("the random attack needs at least one trial")
+		}
+	case AttackGradient:
+		if options.Loss == nil && options.Gradient == nil {
+			return nil, fmt.Errorf("the gradient attack needs a loss or its gradient")
+		}
+	default:
+		return nil, fmt.Errorf("unknown attack %q (want %s or %s)", options.Attack, AttackRandom, AttackGradient)
+	}
+	if options.Scale != nil && len(options.Scale) != len(rows[0]) {
+		return nil, fmt.Errorf("have scales for %d features, rows have %d", len(options.Scale), len(rows[0]))
+	}
+	if options.Ranges != nil && len(options.Ranges) != len(rows[0]) {
+		return nil, fmt.Errorf("have ranges for %d features, rows have %d", len(options.Ranges), len(rows[0]))
+	}
+
+	clean := make([]bool, len(rows))
+	// robust[e][i] is whether row i stays correct at epsilons[e].
+	robust := make([][]bool, len(epsilons))
+	for e := range robust {
+		robust[e] = make([]bool, len(rows))
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				clean[i] = model.Classify(rows[i]) == labels[i]
+				// Seeding per row keeps the draws independent of scheduling.
+				rng := rand.New(rand.NewSource(options.Seed + int64(i)))
+				for e, epsilon := range epsilons {
+					robust[e][i] = options.survives(model, rows[i], labels[i], epsilon, rng)
+				}
+			}
+		}()
+	}
+	for i := range rows {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	report := &RobustnessReport{Attack: options.Attack, Samples: len(rows), Clean: fraction(clean)}
+	for e, epsilon := range epsilons {
+		point := RobustnessPoint{Epsilon: epsilon, Accuracy: fraction(robust[e])}
+		point.Degradation = report.Clean - point.Accuracy
+		for i := range rows {
+			if clean[i] && !robust[e][i] {
+				point.Flipped++
+			}
+		}
+		report.Points = append(report.Points, point)
+	}
+	return report, nil
+}
+
+// survives reports whether model still classifies x correctly under the
+// attack at epsilon.
+func (o RobustnessOptions) survives(model Classifier, x []float64, label int, epsilon float64, rng *rand.Rand) bool {
+	if o.Attack == AttackGradient {
+		gradient := o.gradient(x, label, epsilon)
+		perturbed := make([]float64, len(x))
+		for j := range x {
+			perturbed[j] = o.clamp(j, x[j]+epsilon*o.scale(j)*sign(gradient[j]))
+		}
+		return model.Classify(perturbed) == label
+	}
+
+	perturbed := make([]float64, len(x))
+	for t := 0; t < o.Trials; t++ {
+		for j := range x {
+			perturbed[j] = o.clamp(j, x[j]+epsilon*o.scale(j)*(2*rng.Float64()-1))
+		}
+		if model.Classify(perturbed) != label {
+			return false
+		}
+	}
+	return true
+}
+
+// gradient returns the loss gradient at x, estimated numerically when no
+// Gradient is given.
+func (o RobustnessOptions) gradient(x []float64, label int, epsilon float64) []float64 {
+	if o.Gradient != nil {
+		return o.Gradient(x, label)
+	}
+	gradient := make([]float64, len(x))
+	point := append([]float64(nil), x...)
+	for j := range x {
+		h := epsilon * o.scale(j)
+		point[j] = x[j] + h
+		up := o.Loss(point, label)
+		point[j] = x[j] - h
+		down := o.Loss(point, label)
+		point[j] = x[j]
+		gradient[j] = (up - down) / (2 * h)
+	}
+	return gradient
+}
+
+func (o RobustnessOptions) scale(j int) float64 {
+	if o.Scale == nil {
+		return 1
+	}
+	return o.Scale[j]
+}
+
+func (o RobustnessOptions) clamp(j int, value float64) float64 {
+	if o.Ranges == nil {
+		return value
+	}
+	return math.Max(o.Ranges[j].Min, math.Min(o.Ranges[j].Max, value))
+}
+
+func sign(x float64) float64 {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
+
+func fraction(values []bool) float64 {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return float64(n) / float64(len(values))
+}
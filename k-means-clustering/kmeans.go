@@ -0,0 +1,118 @@
+// Package cluster is the cluster command: it clusters a dataset with
+// k-means, DBSCAN or agglomerative clustering, or helps choose k.
+package cluster
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"gopherconAU/cli"
+	"gopherconAU/clustering"
+	"gopherconAU/dataset"
+	"gopherconAU/kmeans"
+	"gopherconAU/logging"
+	"gopherconAU/manifest"
+)
+
+var logger = logging.New().With("program", "kmeans")
+
+// Main runs the command with the arguments after its name.
+func Main(args []string) {
+	dataPath := flag.String("data", "iris.csv", "CSV or .xlsx file to cluster")
+	clusterOptions := clustering.DefaultOptions()
+	clusterOptions.RegisterFlags(flag.CommandLine)
+	kmeansOptions := &clusterOptions.KMeans
+	elbow := flag.Int("elbow", 0, "instead of clustering, score every k from 2 to this by WCSS and silhouette to help choose -k")
+	saveModel := flag.String("save-model", "", "write the k-means centroids, with the feature names, to this JSON file, which the serve command of train-distributed can serve")
+	mapping := dataset.Mapping{Label: "species"}
+	mapping.RegisterFlags(flag.CommandLine)
+	var options dataset.Options
+	options.RegisterFlags(flag.CommandLine)
+	// k-means has a -seed of its own, which the manifest records.
+	var repro manifest.Options
+	repro.RegisterManifestFlag(flag.CommandLine)
+	var logOptions logging.Options
+	logOptions.RegisterFlags(flag.CommandLine)
+	cli.Parse(flag.CommandLine, args)
+	if err := logger.Configure(logOptions); err != nil {
+		logger.Fatal("invalid logging flags: %v", err)
+	}
+	defer logger.Close()
+	run, err := repro.Start(flag.CommandLine)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+	run.Seed = kmeansOptions.Seed
+	if err := kmeansOptions.Validate(); err != nil {
+		logger.Fatal("invalid k-means flags: %v", err)
+	}
+	if *saveModel != "" && clusterOptions.Algorithm != clustering.AlgorithmKMeans {
+		logger.Fatal("-save-model needs -algorithm %s: only k-means clusters new rows", clustering.AlgorithmKMeans)
+	}
+
+	// The label only names the species; clustering uses the features alone.
+	data, err := dataset.CSVLoader{Path: *dataPath, Mapping: mapping, Options: options, Categorical: []string{mapping.Label}}.Load()
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+
+	if *elbow > 0 {
+		scores, err := clustering.Elbow(data.X, *elbow, *kmeansOptions)
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		clustering.Print(os.Stdout, scores)
+		return
+	}
+
+	var labels []int
+	if clusterOptions.Algorithm == clustering.AlgorithmKMeans {
+		c, err := kmeans.Fit(data.X, *kmeansOptions)
+		if err != nil {
+			logger.Fatal("failed to learn clusters: %v", err)
+		}
+		logger.Info("k-means took %d iterations (converged: %t), inertia %.3f", c.Iterations, c.Converged, c.Inertia)
+		labels = c.Assignments
+		run.Metric("inertia", c.Inertia)
+		run.Metric("iterations", float64(c.Iterations))
+		if *saveModel != "" {
+			if err := c.Save(*saveModel, data.FeatureNames); err != nil {
+				logger.Error("failed to save the model: %v", err)
+			} else {
+				logger.Info("model saved to %s", *saveModel)
+			}
+		}
+	} else {
+		clusterer, err := clusterOptions.New(clusterOptions.Algorithm)
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		if labels, err = clusterer.Cluster(data.X); err != nil {
+			logger.Fatal("failed to learn clusters: %v", err)
+		}
+	}
+
+	sizes, noise := clustering.Sizes(labels)
+	fmt.Printf("Clustered data set into %d clusters, %d noise points\n", sizes, noise)
+	if repro.Path != "" {
+		if err := run.SetDataset(*dataPath, len(data.X)); err != nil {
+			logger.Error("failed to checksum the dataset: %v", err)
+		}
+		run.Metric("clusters", float64(len(sizes)))
+		run.Metric("noise_points", float64(noise))
+		run.Metric("silhouette", clustering.Silhouette(data.X, labels))
+		if err := run.Write(); err != nil {
+			logger.Error("failed to write the manifest: %v", err)
+		}
+	}
+	for i, label := range labels {
+		if label == clustering.Noise {
+			fmt.Printf("Data Point %d: noise\n", i+1)
+		} else {
+			fmt.Printf("Data Point %d: Cluster %d\n", i+1, label+1)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
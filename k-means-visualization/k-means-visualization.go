@@ -0,0 +1,340 @@
+// Package visualize is the visualize command: it clusters a dataset and
+// serves charts of the clusters, and pages following a live k-means run.
+package visualize
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+
+	"os"
+	"sync"
+	"time"
+
+	"gopherconAU/cli"
+	"gopherconAU/clustering"
+	"gopherconAU/dataset"
+	"gopherconAU/kmeans"
+	"gopherconAU/logging"
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/components"
+	"github.com/go-echarts/go-echarts/v2/opts"
+)
+
+var logger = logging.New().With("program", "k-means-visualization")
+
+// Main runs the command with the arguments after its name.
+func Main(args []string) {
+	dataPath := flag.String("data", "iris.csv", "CSV or .xlsx file to cluster")
+	clusterOptions := clustering.DefaultOptions()
+	clusterOptions.RegisterFlags(flag.CommandLine)
+	kmeansOptions := &clusterOptions.KMeans
+	compare := flag.String("compare", "", "comma-separated algorithms to cluster with and chart side by side, e.g. kmeans,dbscan,hierarchical (default: -algorithm)")
+	elbow := flag.Int("elbow", 0, "also score every k from 2 to this by WCSS and silhouette, and chart them above the clusters to help choose -k")
+	stepDelay := flag.Duration("step-delay", 300*time.Millisecond, "pause between the iterations of the live k-means run on the dashboard pages")
+	mapping := dataset.Mapping{Label: "species"}
+	mapping.RegisterFlags(flag.CommandLine)
+	var options dataset.Options
+	options.RegisterFlags(flag.CommandLine)
+	var logOptions logging.Options
+	logOptions.RegisterFlags(flag.CommandLine)
+	cli.Parse(flag.CommandLine, args)
+	if err := logger.Configure(logOptions); err != nil {
+		logger.Fatal("invalid logging flags: %v", err)
+	}
+	defer logger.Close()
+	if err := kmeansOptions.Validate(); err != nil {
+		logger.Fatal("invalid k-means flags: %v", err)
+	}
+
+	// The label only names the species; clustering uses the features alone.
+	data, err := dataset.CSVLoader{Path: *dataPath, Mapping: mapping, Options: options, Categorical: []string{mapping.Label}}.Load()
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+
+	var scores []clustering.Score
+	if *elbow > 0 {
+		scores, err = clustering.Elbow(data.X, *elbow, *kmeansOptions)
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		clustering.Print(os.Stdout, scores)
+	}
+
+	algorithms := dataset.SplitList(*compare)
+	if len(algorithms) == 0 {
+		algorithms = []string{clusterOptions.Algorithm}
+	}
+	var results []clusterResult
+	for _, algorithm := range algorithms {
+		clusterer, err := clusterOptions.New(algorithm)
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		labels, err := clusterer.Cluster(data.X)
+		if err != nil {
+			logger.Fatal("%s failed to learn clusters: %v", algorithm, err)
+		}
+		sizes, noise := clustering.Sizes(labels)
+		fmt.Printf("%s clustered data set into %d clusters, %d noise points\n", algorithm, sizes, noise)
+		results = append(results, clusterResult{algorithm: algorithm, labels: labels, silhouette: clustering.Silhouette(data.X, labels)})
+	}
+
+	live := newDashboard(data, *kmeansOptions, *stepDelay)
+	live.register()
+	go live.run()
+	err = visualizeClusters(data.X, results, scores)
+	if err != nil {
+		logger.Fatal("failed to visualize clusters: %v", err)
+	}
+}
+
+// elbowChart charts the WCSS and the silhouette of every k, on axes of their
+// own: the k to choose is where the WCSS stops falling steeply, or where the
+// silhouette peaks.
+func elbowChart(scores []clustering.Score) *charts.Line {
+	line := charts.NewLine()
+	line.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{Title: "Choosing k", Subtitle: "within-cluster sum of squares (elbow) and mean silhouette"}),
+		charts.WithXAxisOpts(opts.XAxis{Name: "k"}),
+		charts.WithYAxisOpts(opts.YAxis{Name: "WCSS"}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: pointer(true), Trigger: "axis"}),
+	)
+	line.ExtendYAxis(opts.YAxis{Name: "silhouette", Min: -1, Max: 1})
+
+	ks := make([]int, len(scores))
+	wcss := make([]opts.LineData, len(scores))
+	silhouettes := make([]opts.LineData, len(scores))
+	for i, s := range scores {
+		ks[i] = s.K
+		wcss[i] = opts.LineData{Value: s.WCSS}
+		silhouettes[i] = opts.LineData{Value: s.Silhouette, YAxisIndex: 1}
+	}
+	line.SetXAxis(ks).
+		AddSeries("WCSS", wcss).
+		AddSeries("silhouette", silhouettes, charts.WithLineChartOpts(opts.LineChart{YAxisIndex: 1}))
+	return line
+}
+
+// visualizeClusters serves a scatter chart of the clusters, below the elbow
+// chart of scores when there are any, one chart per result side by side.
+func visualizeClusters(data [][]float64, results []clusterResult, scores []clustering.Score) error {
+	page := components.NewPage()
+	if len(results) > 1 {
+		page.SetLayout(components.PageFlexLayout)
+	}
+	if len(scores) > 0 {
+		page.AddCharts(elbowChart(scores))
+	}
+	for _, result := range results {
+		page.AddCharts(clusterScatter(data, result))
+	}
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if err := page.Render(w); err != nil {
+			logger.Error("%v", err)
+		}
+	})
+	logger.Info("Open http://localhost:8080 to see the visualization, and /clusters, /centroids, /sizes or /inertia to follow a live k-means run.")
+	return http.ListenAndServe(":8080", nil)
+}
+
+
+// clusterResult is the clustering of the data by one algorithm.
+type clusterResult struct {
+	algorithm  string
+	labels     []int
+	silhouette float64
+}
+
+// clusterScatter charts the first two features of the rows, one series per
+// cluster and one for the noise rows.
+func clusterScatter(data [][]float64, result clusterResult) *charts.Scatter {
+	scatter := charts.NewScatter()
+	scatter.SetGlobalOptions(charts.WithTitleOpts(opts.Title{
+		Title:    fmt.Sprintf("%s clustering of Iris Dataset", result.algorithm),
+		Subtitle: fmt.Sprintf("mean silhouette %.3f", result.silhouette),
+	}))
+
+	sizes, _ := clustering.Sizes(result.labels)
+	clusterData := make([][]opts.ScatterData, len(sizes))
+	var noise []opts.ScatterData
+	for i, point := range data {
+		scatterData := opts.ScatterData{Value: []interface{}{point[0], point[1]}}
+		if result.labels[i] == clustering.Noise {
+			noise = append(noise, scatterData)
+		} else {
+			clusterData[result.labels[i]] = append(clusterData[result.labels[i]], scatterData)
+		}
+	}
+
+	labelOpts := charts.WithLabelOpts(opts.Label{Show: pointer(false), Position: "top"})
+	for clusterID, points := range clusterData {
+		scatter.AddSeries(fmt.Sprintf("Cluster %d", clusterID+1), points).SetSeriesOptions(labelOpts)
+	}
+	if len(noise) > 0 {
+		scatter.AddSeries("Noise", noise).SetSeriesOptions(labelOpts)
+	}
+	return scatter
+}
+
+func pointer(b bool) *bool {
+	return &b
+}
+// dashboard serves pages that follow a k-means run as it happens: the
+// clusters with their centroids, the centroid of every cluster across all
+// features, the cluster sizes and the inertia after every iteration of
+// every restart. The pages poll /data.json and redraw until the run ends.
+type dashboard struct {
+	data    *dataset.Dataset
+	options kmeans.Options
+	delay   time.Duration // between iterations, to watch them
+
+	mu    sync.Mutex
+	state dashboardState
+}
+
+// dashboardState is the body of /data.json.
+type dashboardState struct {
+	Running   bool        `json:"running"`
+	Restart   int         `json:"restart"`
+	Iteration int         `json:"iteration"`
+	Features  []string    `json:"features"`
+	Points    [][]float64 `json:"points"` // the first two features of every row
+	Labels    []int       `json:"labels"`
+	Centroids [][]float64 `json:"centroids"`
+	Sizes     []int       `json:"sizes"`
+	Inertia   [][]float64 `json:"inertia"` // by restart, then iteration
+	Final     float64     `json:"final"`   // inertia of the restart kept, once done
+}
+
+func newDashboard(data *dataset.Dataset, options kmeans.Options, delay time.Duration) *dashboard {
+	d := &dashboard{data: data, options: options, delay: delay}
+	d.state.Running, d.state.Features = true, data.FeatureNames
+	for _, row := range data.X {
+		d.state.Points = append(d.state.Points, row[:2])
+	}
+	return d
+}
+
+// run clusters the data, publishing every iteration.
+func (d *dashboard) run() {
+	options := d.options
+	options.Progress = func(p kmeans.Progress) {
+		d.mu.Lock()
+		s := &d.state
+		s.Restart, s.Iteration = p.Restart, p.Iteration
+		s.Labels = append(s.Labels[:0], p.Assignments...)
+		s.Centroids = make([][]float64, len(p.Centroids))
+		for c, centroid := range p.Centroids {
+			s.Centroids[c] = append([]float64(nil), centroid...)
+		}
+		s.Sizes, _ = clustering.Sizes(s.Labels)
+		for len(s.Inertia) <= p.Restart {
+			s.Inertia = append(s.Inertia, nil)
+		}
+		s.Inertia[p.Restart] = append(s.Inertia[p.Restart], p.Inertia)
+		d.mu.Unlock()
+		time.Sleep(d.delay)
+	}
+	result, err := kmeans.Fit(d.data.X, options)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.state.Running = false
+	if err != nil {
+		logger.Error("live k-means failed: %v", err)
+		return
+	}
+	// The last restart published may not be the one kept.
+	d.state.Labels, d.state.Centroids, d.state.Final = result.Assignments, result.Centroids, result.Inertia
+	d.state.Sizes = result.Sizes()
+	logger.Info("Live k-means finished: inertia %.3f after %d restarts", result.Inertia, len(d.state.Inertia))
+}
+
+func (d *dashboard) serveData(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(d.state); err != nil {
+		logger.Error("%v", err)
+	}
+}
+
+// register adds /data.json and the dashboard pages to http.DefaultServeMux.
+func (d *dashboard) register() {
+	http.HandleFunc("/data.json", d.serveData)
+	pages := []struct {
+		path  string
+		chart interface{ AddJSFuncs(...string) }
+		js    string
+	}{
+		{"/clusters", charts.NewScatter(), liveScatter},
+		{"/centroids", charts.NewLine(), liveCentroids},
+		{"/sizes", charts.NewBar(), liveSizes},
+		{"/inertia", charts.NewLine(), liveInertia},
+	}
+	for _, p := range pages {
+		p.chart.AddJSFuncs(livePoll(p.js))
+		page := components.NewPage()
+		page.SetPageTitle("k-means " + p.path[1:])
+		page.AddCharts(p.chart.(components.Charter))
+		http.HandleFunc(p.path, func(w http.ResponseWriter, r *http.Request) {
+			if err := page.Render(w); err != nil {
+				logger.Error("%v", err)
+			}
+		})
+	}
+}
+
+// livePoll wraps draw, JavaScript that redraws the chart %MY_ECHARTS% from
+// the state d of /data.json, in a loop that fetches the state every half
+// second while the run lasts. go-echarts strips newlines from it, so every
+// statement ends in a semicolon.
+func livePoll(draw string) string {
+	return `(function () {
+		function poll() {
+			fetch('/data.json').then(function (r) { return r.json(); }).then(function (d) {
+				var status = d.running ? 'restart ' + (d.restart + 1) + ', iteration ' + d.iteration : 'done, inertia ' + d.final.toFixed(3);
+				` + draw + `;
+				if (d.running) { setTimeout(poll, 500); }
+			});
+		}
+		poll();
+	})();`
+}
+
+const (
+	liveScatter = `var series = (d.centroids || []).map(function (c, k) {
+			return {name: 'Cluster ' + (k + 1), type: 'scatter', data: d.points.filter(function (p, i) { return d.labels[i] === k; })};
+		});
+		series.push({name: 'Centroids', type: 'scatter', symbol: 'diamond', symbolSize: 18, data: (d.centroids || []).map(function (c) { return [c[0], c[1]]; })});
+		%MY_ECHARTS%.setOption({
+			title: {text: 'k-means clusters', subtext: status},
+			legend: {data: series.map(function (s) { return s.name; })},
+			xAxis: {name: d.features[0], scale: true}, yAxis: {name: d.features[1], scale: true},
+			series: series
+		}, {replaceMerge: ['series']})`
+	liveCentroids = `%MY_ECHARTS%.setOption({
+			title: {text: 'Centroid positions', subtext: status},
+			legend: {data: (d.centroids || []).map(function (c, k) { return 'Cluster ' + (k + 1); })},
+			tooltip: {trigger: 'axis'},
+			xAxis: {type: 'category', data: d.features}, yAxis: {type: 'value'},
+			series: (d.centroids || []).map(function (c, k) { return {name: 'Cluster ' + (k + 1), type: 'line', data: c}; })
+		}, {replaceMerge: ['series']})`
+	liveSizes = `%MY_ECHARTS%.setOption({
+			title: {text: 'Cluster sizes', subtext: status},
+			tooltip: {},
+			xAxis: {type: 'category', data: (d.sizes || []).map(function (s, k) { return 'Cluster ' + (k + 1); })}, yAxis: {type: 'value', name: 'rows'},
+			series: [{name: 'rows', type: 'bar', data: d.sizes || []}]
+		}, {replaceMerge: ['series']})`
+	liveInertia = `var longest = Math.max.apply(null, (d.inertia || [[]]).map(function (run) { return run.length; }));
+		%MY_ECHARTS%.setOption({
+			title: {text: 'Inertia by iteration', subtext: status},
+			legend: {data: (d.inertia || []).map(function (run, r) { return 'Restart ' + (r + 1); })},
+			tooltip: {trigger: 'axis'},
+			xAxis: {type: 'category', name: 'iteration', data: Array.from({length: longest}, function (v, i) { return i + 1; })},
+			yAxis: {type: 'value', name: 'inertia', scale: true},
+			series: (d.inertia || []).map(function (run, r) { return {name: 'Restart ' + (r + 1), type: 'line', data: run}; })
+		}, {replaceMerge: ['series']})`
+)
@@ -0,0 +1,227 @@
+// Package kdtree indexes points for nearest-neighbor queries. The tree is
+// built once, in O(n log² n), after which a query for the k nearest points
+// visits only the cells that could hold one of them rather than every
+// point. Distances are Euclidean, or Minkowski distances of any order p >= 1.
+package kdtree
+
+import (
+	"math"
+	"sort"
+)
+
+// Neighbor is a point found by a query.
+type Neighbor struct {
+	Index    int     // position of the point in the slice the tree was built from
+	Distance float64 // distance to the query in the tree's metric
+}
+
+// Tree is a k-d tree over a fixed set of points, all of the same dimension.
+// It is safe for concurrent queries.
+type Tree struct {
+	points [][]float64
+	p      float64 // order of the Minkowski distance
+	nodes  []node
+	root   int
+}
+
+// node splits its cell at its point's coordinate on axis; left and right
+// index the children in Tree.nodes, -1 for none.
+type node struct {
+	point       int
+	axis        int
+	left, right int
+}
+
+// New builds a tree over points whose queries measure Euclidean distances.
+// The points are not copied and must not be modified while the tree is in
+// use.
+func New(points [][]float64) *Tree {
+	return NewMinkowski(points, 2)
+}
+
+// NewMinkowski builds a tree over points whose queries measure Minkowski
+// distances of order p: 1 is the Manhattan distance, 2 the Euclidean
+// distance and math.Inf(1) the Chebyshev distance. It panics if p < 1,
+// which does not give a metric.
+func NewMinkowski(points [][]float64, p float64) *Tree {
+	if !(p >= 1) {
+		panic("kdtree: Minkowski order below 1")
+	}
+	t := &Tree{points: points, p: p, nodes: make([]node, 0, len(points)), root: -1}
+	indices := make([]int, len(points))
+	for i := range indices {
+		indices[i] = i
+	}
+	t.root = t.build(indices)
+	return t
+}
+
+// Len returns the number of points in the tree.
+func (t *Tree) Len() int { return len(t.points) }
+
+// build splits indices at the median of the axis along which they spread
+// widest, and returns the node of the median point.
+func (t *Tree) build(indices []int) int {
+	if len(indices) == 0 {
+		return -1
+	}
+	axis := t.widestAxis(indices)
+	sort.Slice(indices, func(a, b int) bool {
+		pa, pb := t.points[indices[a]][axis], t.points[indices[b]][axis]
+		if pa != pb {
+			return pa < pb
+		}
+		return indices[a] < indices[b]
+	})
+	median := len(indices) / 2
+
+	n := len(t.nodes)
+	t.nodes = append(t.nodes, node{point: indices[median], axis: axis})
+	left := t.build(indices[:median])
+	right := t.build(indices[median+1:])
+	t.nodes[n].left, t.nodes[n].right = left, right
+	return n
+}
+
+func (t *Tree) widestAxis(indices []int) int {
+	best, widest := 0, -1.0
+	for axis := range t.points[indices[0]] {
+		low, high := math.Inf(1), math.Inf(-1)
+		for _, i := range indices {
+			low, high = math.Min(low, t.points[i][axis]), math.Max(high, t.points[i][axis])
+		}
+		if high-low > widest {
+			best, widest = axis, high-low
+		}
+	}
+	return best
+}
+
+// NearestK returns the k points nearest to query, nearest first. Points at
+// equal distances come in the order they were given to New, and the result
+// is the same as Scan's.
+func (t *Tree) NearestK(query []float64, k int) []Neighbor {
+	if k <= 0 || t.root < 0 {
+		return nil
+	}
+	s := search{tree: t, query: query, k: min(k, len(t.points))}
+	s.visit(t.root)
+	for i := range s.best {
+		s.best[i].Distance = root(s.best[i].Distance, t.p)
+	}
+	return s.best
+}
+
+// Scan returns the k of points nearest to query in the Minkowski distance of
+// order p, nearest first, by measuring the distance to every point. It finds
+// the same neighbors as a tree built over points with that order, without
+// building one.
+func Scan(points [][]float64, query []float64, k int, p float64) []Neighbor {
+	if k <= 0 || len(points) == 0 {
+		return nil
+	}
+	s := search{tree: &Tree{points: points, p: p}, query: query, k: min(k, len(points))}
+	for i, point := range points {
+		s.offer(i, power(query, point, p))
+	}
+	for i := range s.best {
+		s.best[i].Distance = root(s.best[i].Distance, p)
+	}
+	return s.best
+}
+
+// Minkowski returns the Minkowski distance of order p between a and b,
+// exactly as a tree built with that order measures it.
+func Minkowski(a, b []float64, p float64) float64 {
+	return root(power(a, b, p), p)
+}
+
+// power returns the Minkowski distance of order p raised to the power p,
+// which orders points the same as the distance itself and takes no root;
+// for p = +Inf it is the distance.
+func power(a, b []float64, p float64) float64 {
+	sum := 0.0
+	for i := range a {
+		sum = accumulate(sum, a[i]-b[i], p)
+	}
+	return sum
+}
+
+// accumulate adds the difference d along one axis to a power distance.
+func accumulate(sum, d, p float64) float64 {
+	switch {
+	case p == 1:
+		return sum + math.Abs(d)
+	case p == 2:
+		return sum + d*d
+	case math.IsInf(p, 1):
+		return math.Max(sum, math.Abs(d))
+	default:
+		return sum + math.Pow(math.Abs(d), p)
+	}
+}
+
+// root turns a power distance back into the distance.
+func root(sum, p float64) float64 {
+	switch {
+	case p == 1 || math.IsInf(p, 1):
+		return sum
+	case p == 2:
+		return math.Sqrt(sum)
+	default:
+		return math.Pow(sum, 1/p)
+	}
+}
+
+// search holds the k best points found so far, nearest first, with power
+// distances until the search is done.
+type search struct {
+	tree  *Tree
+	query []float64
+	k     int
+	best  []Neighbor
+}
+
+func (s *search) visit(n int) {
+	if n < 0 {
+		return
+	}
+	nd := s.tree.nodes[n]
+	point := s.tree.points[nd.point]
+	s.offer(nd.point, power(s.query, point, s.tree.p))
+
+	diff := s.query[nd.axis] - point[nd.axis]
+	near, far := nd.left, nd.right
+	if diff > 0 {
+		near, far = far, near
+	}
+	s.visit(near)
+	// The far cell can only hold a better point if the splitting plane is
+	// no farther than the worst point kept; a tie may still win on index.
+	if len(s.best) < s.k || accumulate(0, diff, s.tree.p) <= s.best[len(s.best)-1].Distance {
+		s.visit(far)
+	}
+}
+
+// offer keeps point i if it is among the k best so far.
+func (s *search) offer(i int, distance float64) {
+	if len(s.best) == s.k && !closer(Neighbor{i, distance}, s.best[s.k-1]) {
+		return
+	}
+	at := sort.Search(len(s.best), func(j int) bool {
+		return closer(Neighbor{i, distance}, s.best[j])
+	})
+	if len(s.best) < s.k {
+		s.best = append(s.best, Neighbor{})
+	}
+	copy(s.best[at+1:], s.best[at:len(s.best)-1])
+	s.best[at] = Neighbor{i, distance}
+}
+
+// closer orders neighbors by distance, then by index.
+func closer(a, b Neighbor) bool {
+	if a.Distance != b.Distance {
+		return a.Distance < b.Distance
+	}
+	return a.Index < b.Index
+}
@@ -0,0 +1,325 @@
+// Package kmeans clusters rows of features with Lloyd's k-means algorithm,
+// seeded by k-means++: the first centroid is a random row and each next one
+// a row drawn with probability proportional to its squared distance from
+// the nearest centroid so far, which spreads the seeds out and makes a poor
+// local optimum much less likely than uniform seeding. Fit runs several
+// restarts and keeps the one with the least inertia.
+//
+// The assignment step, which measures the distance of every row to every
+// centroid and so dominates on large data, runs on a pool of workers that
+// each take a contiguous block of rows and sum them by cluster; the partial
+// sums are added up in block order for the update step.
+package kmeans
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+)
+
+// minBlock is the fewest rows worth handing to a worker of its own.
+const minBlock = 4096
+
+// Options configures Fit.
+type Options struct {
+	K int `json:"k"`
+	// MaxIterations bounds the assignment and update steps of each restart.
+	MaxIterations int `json:"max_iterations"`
+	// Tolerance stops a restart once no centroid moves further than this.
+	// Zero runs until no row changes cluster or MaxIterations.
+	Tolerance float64 `json:"tolerance,omitempty"`
+	// Restarts is how many times to cluster from new seeds, keeping the
+	// result with the least inertia; 0 counts as 1.
+	Restarts int   `json:"restarts,omitempty"`
+	Seed     int64 `json:"seed"`
+	// Workers is how many goroutines share the assignment step; 0 uses
+	// GOMAXPROCS. Fewer run when there are too few rows to split.
+	Workers int `json:"workers,omitempty"`
+	// Progress, if set, is called after every assignment step, from the
+	// goroutine running Fit. It must not keep the slices it is passed.
+	Progress func(Progress) `json:"-"`
+}
+
+// Progress is the state of a restart after an assignment step: every row
+// assigned to its nearest centroid, which has not moved yet.
+type Progress struct {
+	Restart     int // from 0
+	Iteration   int // from 1
+	Centroids   [][]float64
+	Assignments []int
+	Inertia     float64
+}
+
+// DefaultOptions clusters into 3 clusters with up to 300 iterations and 10
+// restarts.
+func DefaultOptions() Options {
+	return Options{K: 3, MaxIterations: 300, Tolerance: 1e-6, Restarts: 10, Seed: 1}
+}
+
+// RegisterFlags adds -k, -max-iterations, -tolerance, -restarts, -seed and
+// -workers to fs, with o's current values as defaults.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.IntVar(&o.K, "k", o.K, "number of clusters")
+	fs.IntVar(&o.MaxIterations, "max-iterations", o.MaxIterations, "most k-means iterations of each restart")
+	fs.Float64Var(&o.Tolerance, "tolerance", o.Tolerance, "stop once no centroid moves further than this")
+	fs.IntVar(&o.Restarts, "restarts", o.Restarts, "cluster this many times from new k-means++ seeds and keep the tightest clustering")
+	fs.Int64Var(&o.Seed, "seed", o.Seed, "random seed of the k-means++ seeding")
+	fs.IntVar(&o.Workers, "workers", o.Workers, "goroutines sharing the k-means assignment step (0 = GOMAXPROCS)")
+}
+
+// Validate rejects options Fit cannot run with.
+func (o Options) Validate() error {
+	switch {
+	case o.K < 1:
+		return fmt.Errorf("k %d must be at least 1", o.K)
+	case o.MaxIterations < 1:
+		return fmt.Errorf("max iterations %d must be at least 1", o.MaxIterations)
+	case o.Tolerance < 0:
+		return fmt.Errorf("tolerance %g must not be negative", o.Tolerance)
+	case o.Restarts < 0:
+		return fmt.Errorf("restarts %d must not be negative", o.Restarts)
+	case o.Workers < 0:
+		return fmt.Errorf("workers %d must not be negative", o.Workers)
+	}
+	return nil
+}
+
+// Result is a clustering.
+type Result struct {
+	Centroids   [][]float64
+	Assignments []int // the cluster of every row, an index into Centroids
+	// Inertia is the sum of the squared distances of the rows to their
+	// centroids, the within-cluster sum of squares.
+	Inertia    float64
+	Iterations int  // of the restart kept
+	Converged  bool // whether that restart stopped before MaxIterations
+}
+
+// Fit clusters the rows of X.
+func Fit(X [][]float64, o Options) (*Result, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	if len(X) < o.K {
+		return nil, fmt.Errorf("%d rows cannot make %d clusters", len(X), o.K)
+	}
+	for i, row := range X {
+		if len(row) != len(X[0]) {
+			return nil, fmt.Errorf("row %d has %d features, row 1 has %d", i+1, len(row), len(X[0]))
+		}
+	}
+	rng := rand.New(rand.NewSource(o.Seed))
+	var best *Result
+	for restart := 0; restart < max(o.Restarts, 1); restart++ {
+		r := lloyd(X, seed(X, o.K, rng), o, restart)
+		if best == nil || r.Inertia < best.Inertia {
+			best = r
+		}
+	}
+	return best, nil
+}
+
+// seed picks k centroids among the rows by k-means++.
+func seed(X [][]float64, k int, rng *rand.Rand) [][]float64 {
+	centroids := [][]float64{clone(X[rng.Intn(len(X))])}
+	distances := make([]float64, len(X))
+	for i, row := range X {
+		distances[i] = squaredDistance(row, centroids[0])
+	}
+	for len(centroids) < k {
+		total := 0.0
+		for _, d := range distances {
+			total += d
+		}
+		next := rng.Intn(len(X)) // every row is on a centroid already
+		if total > 0 {
+			target := rng.Float64() * total
+			for i, d := range distances {
+				if target -= d; target < 0 {
+					next = i
+					break
+				}
+			}
+		}
+		centroids = append(centroids, clone(X[next]))
+		for i, row := range X {
+			distances[i] = math.Min(distances[i], squaredDistance(row, X[next]))
+		}
+	}
+	return centroids
+}
+
+// lloyd alternates assigning every row to its nearest centroid and moving
+// every centroid to the mean of its rows.
+func lloyd(X [][]float64, centroids [][]float64, o Options, restart int) *Result {
+	r := &Result{Centroids: centroids, Assignments: make([]int, len(X))}
+	for i := range r.Assignments {
+		r.Assignments[i] = -1
+	}
+	workers := o.Workers
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = max(1, min(workers, len(X)/minBlock))
+	for r.Iterations < o.MaxIterations {
+		r.Iterations++
+		p := r.assign(X, workers)
+		if o.Progress != nil {
+			o.Progress(Progress{
+				Restart:     restart,
+				Iteration:   r.Iterations,
+				Centroids:   r.Centroids,
+				Assignments: r.Assignments,
+				Inertia:     Inertia(X, r.Centroids, r.Assignments),
+			})
+		}
+		if !p.changed {
+			r.Converged = true
+			break
+		}
+		if shift := r.update(X, p); shift <= o.Tolerance {
+			r.Converged = true
+			break
+		}
+	}
+	r.Inertia = Inertia(X, r.Centroids, r.Assignments)
+	return r
+}
+
+// partial is the assignment step over a block of rows: the sum and count of
+// the rows of every cluster, and whether any row changed cluster.
+type partial struct {
+	sums    [][]float64
+	counts  []int
+	changed bool
+}
+
+func newPartial(k, n int) *partial {
+	p := &partial{sums: make([][]float64, k), counts: make([]int, k)}
+	for c := range p.sums {
+		p.sums[c] = make([]float64, n)
+	}
+	return p
+}
+
+// add adds the rows of other to p.
+func (p *partial) add(other *partial) {
+	for c, sum := range other.sums {
+		p.counts[c] += other.counts[c]
+		for j, value := range sum {
+			p.sums[c][j] += value
+		}
+	}
+	p.changed = p.changed || other.changed
+}
+
+// assign moves every row to the cluster of its nearest centroid, splitting
+// the rows into one block per worker, and returns the sums of the clusters.
+func (r *Result) assign(X [][]float64, workers int) *partial {
+	k, n := len(r.Centroids), len(X[0])
+	block := (len(X) + workers - 1) / workers
+	partials := make([]*partial, workers)
+	var wg sync.WaitGroup
+	for w := range partials {
+		partials[w] = newPartial(k, n)
+		from, to := w*block, min((w+1)*block, len(X))
+		wg.Add(1)
+		go func(p *partial) {
+			defer wg.Done()
+			for i := from; i < to; i++ {
+				c := r.Predict(X[i])
+				if c != r.Assignments[i] {
+					r.Assignments[i], p.changed = c, true
+				}
+				p.counts[c]++
+				for j, value := range X[i] {
+					p.sums[c][j] += value
+				}
+			}
+		}(partials[w])
+	}
+	wg.Wait()
+	for _, p := range partials[1:] {
+		partials[0].add(p)
+	}
+	return partials[0]
+}
+
+// update moves every centroid to the mean of its rows, summed in p, and
+// returns the furthest any moved. A centroid left without rows moves to the
+// row furthest from its own centroid, so no cluster stays empty.
+func (r *Result) update(X [][]float64, p *partial) float64 {
+	shift := 0.0
+	for c := range r.Centroids {
+		var moved []float64
+		if p.counts[c] == 0 {
+			moved = clone(X[r.furthest(X)])
+		} else {
+			moved = p.sums[c]
+			for j := range moved {
+				moved[j] /= float64(p.counts[c])
+			}
+		}
+		shift = math.Max(shift, math.Sqrt(squaredDistance(moved, r.Centroids[c])))
+		r.Centroids[c] = moved
+	}
+	return shift
+}
+
+// furthest returns the row furthest from its centroid.
+func (r *Result) furthest(X [][]float64) int {
+	best, bestDistance := 0, -1.0
+	for i, row := range X {
+		if d := squaredDistance(row, r.Centroids[r.Assignments[i]]); d > bestDistance {
+			best, bestDistance = i, d
+		}
+	}
+	return best
+}
+
+// Predict returns the cluster whose centroid is nearest to x.
+func (r *Result) Predict(x []float64) int {
+	best, bestDistance := 0, math.Inf(1)
+	for c, centroid := range r.Centroids {
+		if d := squaredDistance(x, centroid); d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	return best
+}
+
+// Sizes returns the number of rows in every cluster.
+func (r *Result) Sizes() []int {
+	sizes := make([]int, len(r.Centroids))
+	for _, c := range r.Assignments {
+		sizes[c]++
+	}
+	return sizes
+}
+
+// Inertia returns the sum of the squared distances of the rows of X to the
+// centroids of their clusters.
+func Inertia(X, centroids [][]float64, assignments []int) float64 {
+	total := 0.0
+	for i, row := range X {
+		total += squaredDistance(row, centroids[assignments[i]])
+	}
+	return total
+}
+
+// Distance returns the Euclidean distance between a and b.
+func Distance(a, b []float64) float64 { return math.Sqrt(squaredDistance(a, b)) }
+
+func squaredDistance(a, b []float64) float64 {
+	total := 0.0
+	for j := range a {
+		d := a[j] - b[j]
+		total += d * d
+	}
+	return total
+}
+
+func clone(row []float64) []float64 { return append([]float64(nil), row...) }
@@ -0,0 +1,83 @@
+package kmeans
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+// blobs returns points points drawn around k random centers in dimensions
+// dimensions, and k-means++ seeds for them.
+func blobs(points, k, dimensions int) ([][]float64, [][]float64) {
+	rng := rand.New(rand.NewSource(1))
+	centers := make([][]float64, k)
+	for c := range centers {
+		centers[c] = make([]float64, dimensions)
+		for j := range centers[c] {
+			centers[c][j] = rng.Float64() * 5
+		}
+	}
+	X := make([][]float64, points)
+	for i := range X {
+		center := centers[rng.Intn(len(centers))]
+		X[i] = make([]float64, dimensions)
+		for j := range X[i] {
+			X[i][j] = center[j] + rng.NormFloat64()
+		}
+	}
+	return X, seed(X, k, rng)
+}
+
+// workerCounts returns 1, 2, 4, ... up to GOMAXPROCS.
+func workerCounts() []int {
+	var counts []int
+	for workers := 1; ; workers *= 2 {
+		workers = min(workers, runtime.GOMAXPROCS(0))
+		counts = append(counts, workers)
+		if workers == runtime.GOMAXPROCS(0) {
+			return counts
+		}
+	}
+}
+
+func unassigned(centroids [][]float64, rows int) *Result {
+	r := &Result{Centroids: centroids, Assignments: make([]int, rows)}
+	for i := range r.Assignments {
+		r.Assignments[i] = -1
+	}
+	return r
+}
+
+func TestAssignWorkers(t *testing.T) {
+	X, centroids := blobs(10000, 8, 8)
+	want := unassigned(centroids, len(X)).assign(X, 1)
+	for _, workers := range []int{2, 3, 7} {
+		got := unassigned(centroids, len(X)).assign(X, workers)
+		for c := range want.sums {
+			if got.counts[c] != want.counts[c] {
+				t.Errorf("%d workers: cluster %d has %d rows, want %d", workers, c, got.counts[c], want.counts[c])
+			}
+			for j := range want.sums[c] {
+				if math.Abs(got.sums[c][j]-want.sums[c][j]) > 1e-6 {
+					t.Errorf("%d workers: cluster %d sums to %g in feature %d, want %g", workers, c, got.sums[c][j], j, want.sums[c][j])
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkAssign times the assignment step of 100000 points into 8
+// clusters with 1, 2, 4, ... workers up to GOMAXPROCS.
+func BenchmarkAssign(b *testing.B) {
+	X, centroids := blobs(100000, 8, 8)
+	for _, workers := range workerCounts() {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			r := unassigned(centroids, len(X))
+			for i := 0; i < b.N; i++ {
+				r.assign(X, workers)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package kmeans
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Kind names k-means models in the files Save writes, so that a server
+// loading several kinds of model can tell them apart.
+const Kind = "kmeans"
+
+// savedModel is a clustering as written by Save.
+type savedModel struct {
+	Kind      string      `json:"kind"`
+	Features  []string    `json:"features"`
+	Centroids [][]float64 `json:"centroids"`
+	Inertia   float64     `json:"inertia"`
+}
+
+// Save writes the centroids, with the names of the feature columns they
+// span, to path as JSON, so that new rows can be assigned to the clusters.
+func (r *Result) Save(path string, features []string) error {
+	data, err := json.MarshalIndent(savedModel{
+		Kind:      Kind,
+		Features:  features,
+		Centroids: r.Centroids,
+		Inertia:   r.Inertia,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Decode returns the clustering Save wrote as data, and the names of its
+// feature columns. Only its centroids and inertia are restored, which is
+// all Predict needs.
+func Decode(data []byte) (*Result, []string, error) {
+	var saved savedModel
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, nil, err
+	}
+	if len(saved.Centroids) == 0 {
+		return nil, nil, fmt.Errorf("no centroids")
+	}
+	for c, centroid := range saved.Centroids {
+		if len(centroid) != len(saved.Features) {
+			return nil, nil, fmt.Errorf("centroid %d has %d coordinates for %d features", c, len(centroid), len(saved.Features))
+		}
+	}
+	return &Result{Centroids: saved.Centroids, Inertia: saved.Inertia}, saved.Features, nil
+}
@@ -0,0 +1,1413 @@
+// Package logreg is the train-logreg command: it trains a logistic
+// regression of housing price classes, and has subcommands to score new rows
+// with a saved model and to train multi-label heads.
+package logreg
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sort"
+	"strings"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/opts"
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/optimize"
+
+	"gopherconAU/baseline"
+	"gopherconAU/cli"
+	"gopherconAU/convergence"
+	"gopherconAU/crossval"
+	"gopherconAU/dataset"
+	"gopherconAU/explain"
+	"gopherconAU/logging"
+	"gopherconAU/manifest"
+	"gopherconAU/metrics"
+	"gopherconAU/preprocess"
+	"gopherconAU/regularization"
+)
+
+var logger = logging.New().With("program", "linear-regression")
+
+// loadHousing loads the housing data, with the categorical columns as codes
+// for preprocessing to one-hot encode, and turns the label into a price
+// class. Empty fields are handled as options.Missing says.
+func loadHousing(path string, mapping dataset.Mapping, options dataset.Options, categorical []string) (*dataset.Dataset, error) {
+	data, err := dataset.CSVLoader{Path: path, Mapping: mapping, Options: options, Categorical: categorical, Codes: true}.Load()
+	if err != nil {
+		return nil, err
+	}
+	if summary := data.Summary(); summary != "" {
+		logger.Warn("%s", summary)
+	}
+	if options.Filter != "" {
+		logger.Info("Filter %q kept %d rows and dropped %d", options.Filter, data.Len(), data.Filtered())
+	}
+	for i, value := range data.Y {
+		data.Y[i] = classifyHouseValue(value)
+	}
+	return data, nil
+}
+
+// preprocessing returns the unfitted transformers applied to the features
+// before the model: the imputer, if impute names a strategy, polynomial
+// terms of the numeric features up to degree, and the one-hot encoding of
+// the categorical ones. Fitted on the training rows alone, they learn
+// nothing from the test rows.
+func preprocessing(data *dataset.Dataset, impute string, degree int, cross *preprocess.FeatureCross) preprocess.Chain {
+	var chain preprocess.Chain
+	if impute != "" {
+		chain = append(chain, &preprocess.Imputer{Strategy: impute})
+	}
+	var numeric []int
+	encoder := &preprocess.OneHotEncoder{}
+	for j, name := range data.FeatureNames {
+		if categories, ok := data.Categories[name]; ok {
+			encoder.Columns = append(encoder.Columns, j)
+			encoder.Categories = append(encoder.Categories, categories)
+		} else {
+			numeric = append(numeric, j)
+		}
+	}
+	if degree > 1 {
+		chain = append(chain, &preprocess.PolynomialFeatures{Degree: degree, Columns: numeric})
+	}
+	if cross != nil {
+		// Every chain fits a cross of its own.
+		fresh := *cross
+		chain = append(chain, &fresh)
+	}
+	return append(chain, encoder)
+}
+
+// featureCross returns a FeatureCross of the crosses in spec, comma-separated
+// crosses of feature names joined by '&', or nil for an empty spec.
+// Categorical features are crossed by category, numeric ones by which of
+// buckets quantile buckets they fall in, hashed into size features a cross.
+func featureCross(data *dataset.Dataset, spec string, buckets, size int) (*preprocess.FeatureCross, error) {
+	crosses := dataset.SplitList(spec)
+	if len(crosses) == 0 {
+		return nil, nil
+	}
+	f := &preprocess.FeatureCross{Categories: make(map[int][]string), Buckets: buckets, Size: size}
+	for _, cross := range crosses {
+		var columns []int
+		for _, name := range strings.Split(cross, "&") {
+			name = strings.TrimSpace(name)
+			j := -1
+			for k, feature := range data.FeatureNames {
+				if feature == name {
+					j = k
+				}
+			}
+			if j < 0 {
+				return nil, fmt.Errorf("feature cross %q: no feature %q", cross, name)
+			}
+			if categories, ok := data.Categories[name]; ok {
+				f.Categories[j] = categories
+			}
+			columns = append(columns, j)
+		}
+		if len(columns) < 2 {
+			return nil, fmt.Errorf("feature cross %q must join at least 2 features with '&'", cross)
+		}
+		f.Crosses = append(f.Crosses, columns)
+	}
+	return f, nil
+}
+
+// transformed returns data with its features transformed by t and named
+// names.
+func transformed(data *dataset.Dataset, t preprocess.Transformer, names []string) *dataset.Dataset {
+	out := *data
+	out.X, out.FeatureNames = t.Transform(data.X), names
+	return &out
+}
+
+// featureGroups returns one key per row made from the values of the given
+// feature columns, so that rows describing the same block group can be kept
+// on one side of a split.
+func featureGroups(data *dataset.Dataset, columns []string) ([]string, error) {
+	var positions []int
+	for _, name := range columns {
+		position := -1
+		for j, feature := range data.FeatureNames {
+			if feature == name {
+				position = j
+			}
+		}
+		if position < 0 {
+			return nil, fmt.Errorf("group column %q is not a feature (features: %s)", name, strings.Join(data.FeatureNames, ", "))
+		}
+		positions = append(positions, position)
+	}
+
+	keys := make([]string, data.Len())
+	for i, row := range data.X {
+		values := make([]string, len(positions))
+		for k, j := range positions {
+			values[k] = strconv.FormatFloat(row[j], 'g', -1, 64)
+		}
+		keys[i] = strings.Join(values, "\x1f")
+	}
+	return keys, nil
+}
+
+// matrices returns the features and labels of data as gonum matrices.
+func matrices(data *dataset.Dataset) (*mat.Dense, *mat.VecDense) {
+	X := mat.NewDense(data.Len(), len(data.FeatureNames), nil)
+	for i, row := range data.X {
+		X.SetRow(i, row)
+	}
+	return X, mat.NewVecDense(data.Len(), append([]float64(nil), data.Y...))
+}
+
+func classifyHouseValue(value float64) float64 {
+	switch {
+	case value < 150000:
+		return 0 // Low
+	case value < 300000:
+		return 1 // Medium
+	default:
+		return 2 // High
+	}
+}
+
+type LogisticRegression struct {
+	Weights *mat.VecDense
+	LR      float64
+	Epochs  int
+	// LineSearch picks each epoch's step size by backtracking from 1 instead
+	// of using the fixed LR.
+	LineSearch bool
+	// Solver selects the optimizer: SolverGD (the default) or SolverLBFGS,
+	// which treats Epochs as its iteration limit.
+	Solver string
+	// SampleWeights scales each row's contribution to the loss and gradient;
+	// nil weights every row equally.
+	SampleWeights *mat.VecDense
+	// Means and Stds standardize every row before the weights are applied;
+	// nil leaves the features as they are. Standardize fits them.
+	Means, Stds []float64
+	// Features names the feature columns in weight order, so that a saved
+	// model finds them again in a new file.
+	Features []string
+	// Convergence stops training before Epochs once the loss or the
+	// gradient settles.
+	Convergence convergence.Criteria
+	// Penalty is added to the loss every solver minimizes.
+	Penalty regularization.Penalty
+	// Degree and Inputs describe the polynomial terms among Features: the
+	// products of up to Degree of the Inputs, as named by
+	// preprocess.PolynomialFeatures, for a saved model to compute them
+	// again. A Degree of 0 or 1 means there are none.
+	Degree int
+	Inputs []string
+	// Cross is the fitted feature cross among Features, if any, over the
+	// columns named by CrossInputs.
+	Cross       *preprocess.FeatureCross
+	CrossInputs []string
+}
+
+const (
+	SolverGD    = "gd"
+	SolverLBFGS = "lbfgs"
+)
+
+func NewLogisticRegression(nFeatures int, lr float64, epochs int) *LogisticRegression {
+	return &LogisticRegression{
+		Weights: mat.NewVecDense(nFeatures, nil),
+		LR:      lr,
+		Epochs:  epochs,
+	}
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+func (lr *LogisticRegression) Train(X *mat.Dense, y *mat.VecDense) {
+	X = lr.scale(X)
+	if lr.Solver == SolverLBFGS {
+		lr.trainLBFGS(X, y)
+		return
+	}
+
+	monitor := lr.Convergence.Monitor()
+	gradient := lr.gradient(X, y, lr.Weights)
+	for epoch := 0; epoch < lr.Epochs; epoch++ {
+		step := lr.LR
+		if lr.LineSearch {
+			step = lr.backtrack(X, y, gradient)
+		}
+		lr.Weights.AddScaledVec(lr.Weights, -step, gradient)
+		gradient = lr.gradient(X, y, lr.Weights)
+
+		if lr.LineSearch || lr.Convergence.Enabled() || lr.Penalty.Enabled() {
+			loss := lr.objective(X, y, lr.Weights)
+			if lr.Penalty.Enabled() {
+				logger.With("epoch", epoch+1, "step", step, "loss", loss).Info("Running epoch %d/%d (step %.3g, regularized loss %.6f)", epoch+1, lr.Epochs, step, loss)
+			} else {
+				logger.With("epoch", epoch+1, "step", step, "loss", loss).Info("Running epoch %d/%d (step %.3g, loss %.6f)", epoch+1, lr.Epochs, step, loss)
+			}
+			if converged := monitor.Converged(loss, mat.Norm(gradient, 2)); converged != "" {
+				logger.With("epoch", epoch+1).Info("Converged after epoch %d: %s", epoch+1, converged)
+				return
+			}
+		} else {
+			logger.With("epoch", epoch+1).Info("Running epoch %d/%d", epoch+1, lr.Epochs)
+		}
+	}
+}
+
+// objective is the loss whose gradient Train descends: half the mean squared
+// difference between the linear scores and the labels, plus the penalty on
+// the weights.
+func (lr *LogisticRegression) objective(X *mat.Dense, y *mat.VecDense, weights *mat.VecDense) float64 {
+	r, _ := X.Dims()
+	residuals := lr.residuals(X, y, weights)
+	weighted := residuals
+	if lr.SampleWeights != nil {
+		weighted = mat.NewVecDense(r, nil)
+		weighted.MulElemVec(lr.SampleWeights, residuals)
+	}
+	return mat.Dot(weighted, residuals)/(2*lr.totalWeight(r)) + lr.Penalty.Loss(weights.RawVector().Data)
+}
+
+// residuals returns the linear scores of the rows of X under weights minus
+// the labels.
+func (lr *LogisticRegression) residuals(X *mat.Dense, y *mat.VecDense, weights *mat.VecDense) *mat.VecDense {
+	r, _ := X.Dims()
+	residuals := mat.NewVecDense(r, nil)
+	residuals.MulVec(X, weights)
+	residuals.SubVec(residuals, y)
+	return residuals
+}
+
+func (lr *LogisticRegression) sampleWeight(i int) float64 {
+	if lr.SampleWeights == nil {
+		return 1
+	}
+	return lr.SampleWeights.AtVec(i)
+}
+
+func (lr *LogisticRegression) totalWeight(rows int) float64 {
+	if lr.SampleWeights == nil {
+		return float64(rows)
+	}
+	return mat.Sum(lr.SampleWeights)
+}
+
+// gradient returns the gradient of the objective at weights,
+// X^T W (Xw - y) / sum(W) for the sample weights W, plus the penalty's.
+func (lr *LogisticRegression) gradient(X *mat.Dense, y *mat.VecDense, weights *mat.VecDense) *mat.VecDense {
+	r, c := X.Dims()
+	residuals := lr.residuals(X, y, weights)
+	if lr.SampleWeights != nil {
+		residuals.MulElemVec(lr.SampleWeights, residuals)
+	}
+	gradients := mat.NewVecDense(c, nil)
+	gradients.MulVec(X.T(), residuals)
+	gradients.ScaleVec(1/lr.totalWeight(r), gradients)
+	lr.Penalty.AddGradient(gradients.RawVector().Data, weights.RawVector().Data)
+	return gradients
+}
+
+// trainLBFGS minimizes the same objective as gradient descent with the
+// quasi-Newton L-BFGS method, which needs only a handful of iterations and
+// no learning rate.
+func (lr *LogisticRegression) trainLBFGS(X *mat.Dense, y *mat.VecDense) {
+	problem := optimize.Problem{
+		Func: func(w []float64) float64 {
+			return lr.objective(X, y, mat.NewVecDense(len(w), w))
+		},
+		Grad: func(grad, w []float64) {
+			copy(grad, lr.gradient(X, y, mat.NewVecDense(len(w), w)).RawVector().Data)
+		},
+	}
+	settings := &optimize.Settings{
+		MajorIterations:   lr.Epochs,
+		GradientThreshold: 1e-8,
+	}
+	if lr.Convergence.GradientTolerance > 0 {
+		settings.GradientThreshold = lr.Convergence.GradientTolerance
+	}
+	if lr.Convergence.LossTolerance > 0 {
+		settings.Converger = &optimize.FunctionConverge{Relative: lr.Convergence.LossTolerance, Iterations: 1}
+	}
+
+	result, err := optimize.Minimize(problem, mat.Col(nil, 0, lr.Weights), settings, &optimize.LBFGS{})
+	if err != nil {
+		logger.Warn("L-BFGS stopped early: %v", err)
+	}
+	if result == nil {
+		return
+	}
+	lr.Weights = mat.NewVecDense(len(result.X), result.X)
+	logger.With("iterations", result.MajorIterations, "loss", result.F).Info("L-BFGS finished after %d iterations (%v), loss %.6f",
+		result.MajorIterations, result.Status, result.F)
+}
+
+// backtrack halves the step size, starting from 1, until the Armijo
+// sufficient-decrease condition holds along the negative gradient.
+func (lr *LogisticRegression) backtrack(X *mat.Dense, y *mat.VecDense, gradient *mat.VecDense) float64 {
+	const (
+		armijo   = 1e-4
+		shrink   = 0.5
+		maxSteps = 60
+	)
+
+	loss := lr.objective(X, y, lr.Weights)
+	slope := mat.Dot(gradient, gradient)
+	candidate := mat.NewVecDense(gradient.Len(), nil)
+
+	step := 1.0
+	for i := 0; i < maxSteps; i++ {
+		candidate.AddScaledVec(lr.Weights, -step, gradient)
+		if lr.objective(X, y, candidate) <= loss-armijo*step*slope {
+			break
+		}
+		step *= shrink
+	}
+	return step
+}
+
+
+// decisionThreshold is the probability above which Predict and Classify
+// predict class 1.
+const decisionThreshold = 0.7
+
+func (lr *LogisticRegression) Predict(X *mat.Dense) *mat.VecDense {
+	predictions := lr.PredictProba(X)
+	for i := 0; i < predictions.Len(); i++ {
+		if predictions.AtVec(i) > decisionThreshold {
+			predictions.SetVec(i, 1)
+		} else {
+			predictions.SetVec(i, 0)
+		}
+	}
+
+	return predictions
+}
+
+// PredictProba returns the model's estimate, for every row of X, that the
+// row is of class 1: the sigmoid of its score, before any threshold.
+func (lr *LogisticRegression) PredictProba(X *mat.Dense) *mat.VecDense {
+	r, _ := X.Dims()
+	probabilities := mat.NewVecDense(r, nil)
+	probabilities.MulVec(lr.scale(X), lr.Weights)
+	for i := 0; i < r; i++ {
+		probabilities.SetVec(i, sigmoid(probabilities.AtVec(i)))
+	}
+	return probabilities
+}
+
+// PredictBatch classifies every row of X, as Predict does, with a single
+// matrix-vector multiply.
+func (lr *LogisticRegression) PredictBatch(X [][]float64) []float64 {
+	if len(X) == 0 {
+		return nil
+	}
+	rows := mat.NewDense(len(X), lr.Weights.Len(), nil)
+	for i, features := range X {
+		rows.SetRow(i, features)
+	}
+	return lr.Predict(rows).RawVector().Data
+}
+
+// Classify predicts the class of one row of features, as Predict does.
+func (lr *LogisticRegression) Classify(features []float64) int {
+	if lr.Probability(features) > decisionThreshold {
+		return 1
+	}
+	return 0
+}
+
+// Probability is the model's estimate that a row of features is of class 1.
+func (lr *LogisticRegression) Probability(features []float64) float64 {
+	features = lr.scaleRow(features)
+	return sigmoid(mat.Dot(lr.Weights, mat.NewVecDense(len(features), features)))
+}
+
+// MultiLabelModel predicts multi-label targets, a 0/1 vector per row with a
+// 1 for every label the row has, by binary relevance: one
+// LogisticRegression per label, each with its own decision threshold.
+type MultiLabelModel struct {
+	Labels     []string
+	Models     []*LogisticRegression // by label
+	Thresholds []float64             // by label; a probability at or above it predicts the label
+}
+
+// NewMultiLabelModel returns a model of the given labels whose per-label
+// models are made by newModel, with every threshold at threshold.
+func NewMultiLabelModel(labels []string, threshold float64, newModel func() *LogisticRegression) *MultiLabelModel {
+	m := &MultiLabelModel{Labels: labels}
+	for range labels {
+		m.Models = append(m.Models, newModel())
+		m.Thresholds = append(m.Thresholds, threshold)
+	}
+	return m
+}
+
+// Train fits the model of every label k to column k of Y.
+func (m *MultiLabelModel) Train(X, Y *mat.Dense) {
+	for k, model := range m.Models {
+		model.Train(X, mat.VecDenseCopyOf(Y.ColView(k)))
+	}
+}
+
+// PredictProba returns, for every row of X and label, the probability that
+// the row has the label.
+func (m *MultiLabelModel) PredictProba(X *mat.Dense) *mat.Dense {
+	r, _ := X.Dims()
+	probabilities := mat.NewDense(r, len(m.Models), nil)
+	for k, model := range m.Models {
+		probabilities.SetCol(k, model.PredictProba(X).RawVector().Data)
+	}
+	return probabilities
+}
+
+// Predict returns the label vector of every row of X.
+func (m *MultiLabelModel) Predict(X *mat.Dense) *mat.Dense {
+	predictions := m.PredictProba(X)
+	r, c := predictions.Dims()
+	for i := 0; i < r; i++ {
+		for k := 0; k < c; k++ {
+			if predictions.At(i, k) >= m.Thresholds[k] {
+				predictions.Set(i, k, 1)
+			} else {
+				predictions.Set(i, k, 0)
+			}
+		}
+	}
+	return predictions
+}
+
+// TuneThresholds sets the threshold of every label to the one with the best
+// F1 score on the rows of X, whose labels are Y, and returns those scores.
+func (m *MultiLabelModel) TuneThresholds(X, Y *mat.Dense) ([]float64, error) {
+	probabilities := m.PredictProba(X)
+	scores := make([]float64, len(m.Models))
+	for k := range m.Models {
+		threshold, f1, err := metrics.BestThreshold(mat.Col(nil, k, Y), mat.Col(nil, k, probabilities))
+		if err != nil {
+			return nil, fmt.Errorf("label %s: %v", m.Labels[k], err)
+		}
+		m.Thresholds[k], scores[k] = threshold, f1
+	}
+	return scores, nil
+}
+
+// Standardize fits Means and Stds to the columns of X.
+func (lr *LogisticRegression) Standardize(X *mat.Dense) {
+	r, _ := X.Dims()
+	rows := make([][]float64, r)
+	for i := range rows {
+		rows[i] = X.RawRowView(i)
+	}
+	var scaler preprocess.StandardScaler
+	if err := scaler.Fit(rows); err != nil {
+		return
+	}
+	lr.Means, lr.Stds = scaler.Means, scaler.Stds
+}
+
+// scale returns X standardized with Means and Stds, or X itself without them.
+func (lr *LogisticRegression) scale(X *mat.Dense) *mat.Dense {
+	if lr.Means == nil {
+		return X
+	}
+	r, c := X.Dims()
+	scaled := mat.NewDense(r, c, nil)
+	for i := 0; i < r; i++ {
+		scaled.SetRow(i, lr.scaleRow(X.RawRowView(i)))
+	}
+	return scaled
+}
+
+func (lr *LogisticRegression) scaleRow(features []float64) []float64 {
+	if lr.Means == nil {
+		return features
+	}
+	return (&preprocess.StandardScaler{Means: lr.Means, Stds: lr.Stds}).TransformRow(features)
+}
+
+// Kind names logistic regression models in the files Save writes, so that
+// a server loading several kinds of model can tell them apart.
+const Kind = "logistic"
+
+// savedModel is a LogisticRegression as written by Save.
+type savedModel struct {
+	Kind     string    `json:"kind"`
+	Features []string  `json:"features"`
+	Weights  []float64 `json:"weights"`
+	Means    []float64 `json:"means,omitempty"`
+	Stds     []float64 `json:"stds,omitempty"`
+	Degree   int       `json:"degree,omitempty"`
+	Inputs   []string  `json:"inputs,omitempty"`
+
+	Cross       *preprocess.FeatureCross `json:"cross,omitempty"`
+	CrossInputs []string                 `json:"cross_inputs,omitempty"`
+}
+
+// Save writes the weights, feature names and standardization to path as JSON.
+func (lr *LogisticRegression) Save(path string) error {
+	data, err := json.MarshalIndent(savedModel{
+		Kind:     Kind,
+		Features: lr.Features,
+		Weights:  mat.Col(nil, 0, lr.Weights),
+		Means:    lr.Means,
+		Stds:     lr.Stds,
+		Degree:   lr.Degree,
+		Inputs:   lr.Inputs,
+
+		Cross:       lr.Cross,
+		CrossInputs: lr.CrossInputs,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Load replaces the model with the one saved at path.
+func (lr *LogisticRegression) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := lr.decode(data); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// Decode returns the model Save wrote as data.
+func Decode(data []byte) (*LogisticRegression, error) {
+	lr := &LogisticRegression{}
+	if err := lr.decode(data); err != nil {
+		return nil, err
+	}
+	return lr, nil
+}
+
+// decode replaces the model with the one Save wrote as data.
+func (lr *LogisticRegression) decode(data []byte) error {
+	var saved savedModel
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("decoding: %v", err)
+	}
+	n := len(saved.Weights)
+	if n == 0 || len(saved.Features) != n {
+		return fmt.Errorf("%d weights for %d features", n, len(saved.Features))
+	}
+	if saved.Means != nil && (len(saved.Means) != n || len(saved.Stds) != n) {
+		return fmt.Errorf("standardization does not match the %d features", n)
+	}
+	lr.Weights = mat.NewVecDense(n, saved.Weights)
+	lr.Features, lr.Means, lr.Stds = saved.Features, saved.Means, saved.Stds
+	lr.Degree, lr.Inputs = saved.Degree, saved.Inputs
+	lr.Cross, lr.CrossInputs = saved.Cross, saved.CrossInputs
+	return nil
+}
+
+// checkRobustness prints how far the model's accuracy on data falls when its
+// features are perturbed by each of epsilons, in standard deviations of the
+// feature over the training rows. The gradient attack follows the gradient
+// of the squared error that training minimizes; random perturbations are
+// drawn from seed.
+func checkRobustness(model *LogisticRegression, train, data *dataset.Dataset, attack string, epsilons []float64, trials int, seed int64) error {
+	labels := make([]int, data.Len())
+	for i, label := range data.Y {
+		labels[i] = int(label)
+	}
+	scale := make([]float64, len(train.FeatureNames))
+	for j := range scale {
+		var mean, sq float64
+		for _, row := range train.X {
+			mean += row[j]
+			sq += row[j] * row[j]
+		}
+		mean /= float64(train.Len())
+		scale[j] = math.Sqrt(math.Max(sq/float64(train.Len())-mean*mean, 0))
+	}
+
+	report, err := explain.Robustness(model, data.X, labels, epsilons, explain.RobustnessOptions{
+		Attack: attack,
+		Scale:  scale,
+		Ranges: explain.Ranges(train.X),
+		Trials: trials,
+		Seed:   seed,
+		Gradient: func(features []float64, label int) []float64 {
+			scaled := model.scaleRow(features)
+			residual := mat.Dot(model.Weights, mat.NewVecDense(len(scaled), scaled)) - float64(label)
+			gradient := make([]float64, len(features))
+			for j := range gradient {
+				gradient[j] = residual * model.Weights.AtVec(j)
+				if model.Stds != nil && model.Stds[j] != 0 {
+					gradient[j] /= model.Stds[j]
+				}
+			}
+			return gradient
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Robustness (%s attack, %d rows): clean accuracy %.2f%%\n", report.Attack, report.Samples, report.Clean*100)
+	for _, point := range report.Points {
+		fmt.Printf("  epsilon %.2f: %.2f%% accuracy (-%.2f points, %d rows flipped)\n",
+			point.Epsilon, point.Accuracy*100, point.Degradation*100, point.Flipped)
+	}
+	return nil
+}
+
+func Accuracy(yTrue, yPred *mat.VecDense) float64 {
+	correct := 0
+	for i := 0; i < yTrue.Len(); i++ {
+		if yPred.AtVec(i) == yTrue.AtVec(i) {
+			correct++
+		}
+	}
+	return float64(correct) / float64(yTrue.Len())
+}
+
+// WeightedAccuracy is Accuracy with each sample counted by its weight.
+func WeightedAccuracy(yTrue, yPred, weights *mat.VecDense) float64 {
+	var correct, total float64
+	for i := 0; i < yTrue.Len(); i++ {
+		if yPred.AtVec(i) == yTrue.AtVec(i) {
+			correct += weights.AtVec(i)
+		}
+		total += weights.AtVec(i)
+	}
+	return correct / total
+}
+
+// balancedWeights weights every sample by n / (classes * count(class)) so
+// that each class contributes equally to training and evaluation.
+func balancedWeights(y *mat.VecDense) *mat.VecDense {
+	counts := make(map[float64]int)
+	for i := 0; i < y.Len(); i++ {
+		counts[y.AtVec(i)]++
+	}
+	weights := mat.NewVecDense(y.Len(), nil)
+	for i := 0; i < y.Len(); i++ {
+		weights.SetVec(i, float64(y.Len())/float64(len(counts)*counts[y.AtVec(i)]))
+	}
+	return weights
+}
+
+// rocCurve prints the AUC of the model's probabilities on X, and the rates
+// at the decision threshold, with the rows labelled at least positiveClass
+// as positives, and returns the ROC curve.
+func rocCurve(model *LogisticRegression, X *mat.Dense, y *mat.VecDense, positiveClass float64) ([]metrics.ROCPoint, error) {
+	positive := make([]bool, y.Len())
+	for i := range positive {
+		positive[i] = y.AtVec(i) >= positiveClass
+	}
+	curve, err := metrics.ROC(positive, model.PredictProba(X).RawVector().Data)
+	if err != nil {
+		return nil, err
+	}
+	at := metrics.At(curve, decisionThreshold)
+	fmt.Printf("ROC AUC (class >= %g positive): %.4f over %d thresholds; at the %.2f threshold, true positive rate %.3f, false positive rate %.3f\n",
+		positiveClass, metrics.AUC(curve), len(curve)-1, decisionThreshold, at.TruePositiveRate, at.FalsePositiveRate)
+	return curve, nil
+}
+
+// serveROC serves a chart of curve at addr until the program is stopped.
+func serveROC(addr string, curve []metrics.ROCPoint, positiveClass float64) error {
+	show := true
+	chart := charts.NewLine()
+	chart.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{Title: "ROC curve", Subtitle: fmt.Sprintf("class >= %g positive, AUC %.4f", positiveClass, metrics.AUC(curve))}),
+		charts.WithXAxisOpts(opts.XAxis{Name: "false positive rate", Type: "value", Min: 0, Max: 1}),
+		charts.WithYAxisOpts(opts.YAxis{Name: "true positive rate", Type: "value", Min: 0, Max: 1}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: &show}),
+		charts.WithLegendOpts(opts.Legend{Show: &show}),
+	)
+	points := make([]opts.LineData, len(curve))
+	for i, p := range curve {
+		points[i] = opts.LineData{Value: []interface{}{p.FalsePositiveRate, p.TruePositiveRate}}
+	}
+	chart.AddSeries("model", points)
+	chart.AddSeries("chance", []opts.LineData{{Value: []interface{}{0, 0}}, {Value: []interface{}{1, 1}}},
+		charts.WithLineStyleOpts(opts.LineStyle{Color: "#b0b0b0", Type: "dashed"}))
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if err := chart.Render(w); err != nil {
+			logger.Error("%v", err)
+		}
+	})
+	host := addr
+	if strings.HasPrefix(host, ":") {
+		host = "localhost" + host
+	}
+	logger.Info("Open http://%s to see the ROC curve.", host)
+	return http.ListenAndServe(addr, nil)
+}
+
+// priceClasses names the classes of classifyHouseValue.
+var priceClasses = []string{"low", "medium", "high"}
+
+// chartOneVsRest trains a one-vs-rest head per price class, each a
+// LogisticRegression made by newModel telling its class from the others on
+// standardized features, and writes a bar chart of their coefficients side
+// by side to path, with the difference between the medium and high heads:
+// the features that most separate medium from high house values have the
+// longest bars there. It logs those features too.
+func chartOneVsRest(path string, X *mat.Dense, y *mat.VecDense, features []string, newModel func() *LogisticRegression) error {
+	r, _ := X.Dims()
+	Y := mat.NewDense(r, len(priceClasses), nil)
+	for i := 0; i < r; i++ {
+		class := int(y.AtVec(i))
+		if class < 0 || class >= len(priceClasses) {
+			return fmt.Errorf("row %d has price class %d", i+1, class)
+		}
+		Y.Set(i, class, 1)
+	}
+	heads := NewMultiLabelModel(priceClasses, 0.5, func() *LogisticRegression {
+		m := newModel()
+		m.Standardize(X)
+		return m
+	})
+	heads.Train(X, Y)
+
+	show := true
+	chart := charts.NewBar()
+	chart.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{Title: "One-vs-rest coefficients", Subtitle: "weight of each standardized feature in the head of every price class"}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: &show, Trigger: "axis"}),
+		charts.WithLegendOpts(opts.Legend{Show: &show}),
+		charts.WithXAxisOpts(opts.XAxis{AxisLabel: &opts.AxisLabel{Rotate: 30, Interval: "0"}}),
+		charts.WithInitializationOpts(opts.Initialization{Width: "1200px", Height: "600px"}),
+	)
+	chart.SetXAxis(features)
+	for k, name := range priceClasses {
+		bars := make([]opts.BarData, len(features))
+		for j := range features {
+			bars[j] = opts.BarData{Value: heads.Models[k].Weights.AtVec(j)}
+		}
+		chart.AddSeries(name, bars)
+	}
+	medium, high := heads.Models[1].Weights, heads.Models[2].Weights
+	differences := make([]opts.BarData, len(features))
+	order := make([]int, len(features))
+	for j := range features {
+		differences[j] = opts.BarData{Value: medium.AtVec(j) - high.AtVec(j)}
+		order[j] = j
+	}
+	chart.AddSeries("medium − high", differences)
+
+	sort.Slice(order, func(a, b int) bool {
+		return math.Abs(medium.AtVec(order[a])-high.AtVec(order[a])) > math.Abs(medium.AtVec(order[b])-high.AtVec(order[b]))
+	})
+	for _, j := range order[:min(5, len(order))] {
+		logger.Info("Medium vs high: %s weighs %+.3f in the medium head and %+.3f in the high head", features[j], medium.AtVec(j), high.AtVec(j))
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := chart.Render(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// foldModel adapts a LogisticRegression to crossval.Model. Each fold fits its
+// own preprocessing, standardization and class weights on its training rows.
+type foldModel struct {
+	model       *LogisticRegression
+	prep        preprocess.Transformer
+	standardize bool
+	balanced    bool
+}
+
+func (f *foldModel) Fit(X [][]float64, y []float64) error {
+	if err := f.prep.Fit(X); err != nil {
+		return err
+	}
+	X = f.prep.Transform(X)
+	rows := mat.NewDense(len(X), f.model.Weights.Len(), nil)
+	for i, features := range X {
+		rows.SetRow(i, features)
+	}
+	labels := mat.NewVecDense(len(y), append([]float64(nil), y...))
+	if f.standardize {
+		f.model.Standardize(rows)
+	}
+	if f.balanced {
+		f.model.SampleWeights = balancedWeights(labels)
+	}
+	f.model.Train(rows, labels)
+	return nil
+}
+
+func (f *foldModel) Predict(X [][]float64) []float64 {
+	return f.model.PredictBatch(f.prep.Transform(X))
+}
+
+// Main runs the command with the arguments after its name: a subcommand
+// and its flags, or the flags of a training run.
+func Main(args []string) {
+	if len(args) > 0 && args[0] == "predict" {
+		runPredict(args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "multilabel" {
+		runMultiLabel(args[1:])
+		return
+	}
+
+	lineSearch := flag.Bool("line-search", false, "choose each epoch's step size by backtracking line search instead of the fixed learning rate")
+	solver := flag.String("solver", SolverGD, "optimizer: gd (gradient descent) or lbfgs")
+	classWeight := flag.String("class-weight", "", "set to \"balanced\" to weight samples by inverse class frequency")
+	testFraction := flag.Float64("test-fraction", 0, "hold out this fraction of the rows for testing (0 trains and reports on every row)")
+	groupColumns := flag.String("group-columns", "", "comma-separated columns identifying a block group; rows of a group stay on one side of the split")
+	splitSeed := flag.Int64("split-seed", 1, "random seed of the train/test split")
+	rocClass := flag.Float64("roc-class", 1, "label from which rows count as positive in the ROC curve of the predicted probabilities")
+	rocAddr := flag.String("roc-addr", "", "after training, serve a chart of the ROC curve at this address, such as :8080")
+	ovrChart := flag.String("ovr-chart", "", "train a one-vs-rest head per price class and write a chart comparing their coefficients to this HTML file")
+	robustness := flag.String("robustness", "", "perturb the evaluation rows with random or gradient attacks and report the accuracy lost")
+	robustnessEpsilons := flag.String("robustness-epsilons", "0.05,0.1,0.25,0.5", "comma-separated perturbation bounds per feature, in standard deviations")
+	robustnessTrials := flag.Int("robustness-trials", 10, "random perturbations drawn per row; it counts as correct only if all are")
+	standardize := flag.Bool("standardize", false, "standardize every feature by its mean and standard deviation over the training rows")
+	saveModel := flag.String("save-model", "", "write the trained model, with its standardization, to this JSON file")
+	dataPath := flag.String("data", "housing.csv", "CSV or .xlsx file of housing blocks")
+	mapping := dataset.Mapping{Label: "median_house_value"}
+	mapping.RegisterFlags(flag.CommandLine)
+	categorical := flag.String("categorical-columns", "ocean_proximity", "comma-separated columns holding names, one-hot encoded into features")
+	impute := flag.String("impute", "", "fill missing features with their mean, median or constant (0) over the training rows alone; it loads them as with -missing nan")
+	polyDegree := flag.Int("poly-degree", 1, "add the products of up to this many numeric features as features")
+	crossSpec := flag.String("feature-crosses", "", "comma-separated crosses of features joined by '&', e.g. ocean_proximity&median_income, each added as hashed features of its combinations")
+	crossBuckets := flag.Int("cross-buckets", 5, "quantile buckets a numeric feature is cut into for -feature-crosses")
+	crossSize := flag.Int("cross-size", 32, "hashed features of every cross of -feature-crosses")
+	// Unless -impute or -missing say otherwise, blocks with no
+	// total_bedrooms are left out.
+	options := dataset.Options{MaxBadRows: 1000}
+	options.RegisterFlags(flag.CommandLine)
+	var noise dataset.Noise
+	noise.RegisterFlags(flag.CommandLine)
+	var stopping convergence.Criteria
+	stopping.RegisterFlags(flag.CommandLine)
+	penalty := regularization.Penalty{Kind: regularization.L2, L1Ratio: 0.5}
+	penalty.RegisterFlags(flag.CommandLine)
+	cv := crossval.Options{Folds: 5, Stratified: true, Seed: 1}
+	cv.RegisterFlags(flag.CommandLine)
+	// The seeds default to 1, as the other seeds do.
+	repro := manifest.Options{Seed: 1}
+	repro.RegisterFlags(flag.CommandLine)
+	var logOptions logging.Options
+	logOptions.RegisterFlags(flag.CommandLine)
+	cli.Parse(flag.CommandLine, args)
+	if err := logger.Configure(logOptions); err != nil {
+		logger.Fatal("invalid logging flags: %v", err)
+	}
+	defer logger.Close()
+	run, err := repro.Start(flag.CommandLine, "split-seed", "cv-seed", "noise-seed")
+	if err != nil {
+		logger.Fatal("invalid -seed: %v", err)
+	}
+
+	if *impute != "" {
+		options.Missing = dataset.MissingNaN
+	}
+	data, err := loadHousing(*dataPath, mapping, options, dataset.SplitList(*categorical))
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+	if err := run.SetDataset(*dataPath, data.Len()); err != nil {
+		logger.Fatal("%v", err)
+	}
+
+	train, test := data, (*dataset.Dataset)(nil)
+	if *testFraction > 0 {
+		rng := rand.New(rand.NewSource(*splitSeed))
+		if *groupColumns != "" {
+			groups, err := featureGroups(data, dataset.SplitList(*groupColumns))
+			if err != nil {
+				logger.Fatal("%v", err)
+			}
+			trainRows, testRows := dataset.GroupSplit(groups, *testFraction, rng)
+			train, test = data.Subset(trainRows), data.Subset(testRows)
+		} else {
+			data.Shuffle(rng)
+			train, test = data.Split(1 - *testFraction)
+		}
+		logger.Info("Split: %d training rows, %d test rows", train.Len(), test.Len())
+	}
+	if *impute != "" {
+		logger.Info("Imputing missing values with the %s of the training rows", *impute)
+	}
+	cross, err := featureCross(data, *crossSpec, *crossBuckets, *crossSize)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+	prep := preprocessing(data, *impute, *polyDegree, cross)
+	if err := prep.Fit(train.X); err != nil {
+		logger.Fatal("%v", err)
+	}
+	features := prep.Names(data.FeatureNames)
+	train = transformed(train, prep, features)
+	if test != nil {
+		test = transformed(test, prep, features)
+	}
+	nFeatures := len(features)
+	if noise.Enabled() {
+		var corrupted int
+		train, corrupted = noise.Apply(train)
+		logger.Info("Corrupted training rows: feature noise %.2f std, %d labels replaced", noise.Features, corrupted)
+	}
+	X, y := matrices(train)
+
+	model := NewLogisticRegression(nFeatures, 0.02, 50)
+	model.Features = features
+	if *polyDegree > 1 {
+		model.Degree = *polyDegree
+		for _, name := range data.FeatureNames {
+			if _, ok := data.Categories[name]; !ok {
+				model.Inputs = append(model.Inputs, name)
+			}
+		}
+		logger.Info("Polynomial features: %d inputs up to degree %d, %d features", len(model.Inputs), model.Degree, nFeatures)
+	}
+	for _, t := range prep {
+		if fitted, ok := t.(*preprocess.FeatureCross); ok {
+			model.Cross, model.CrossInputs = fitted, data.FeatureNames
+			logger.Info("Feature crosses: %d, each hashed into %d features", len(fitted.Crosses), fitted.Size)
+		}
+	}
+	if *standardize {
+		model.Standardize(X)
+	}
+	model.LineSearch = *lineSearch
+	model.Solver = *solver
+	if err := stopping.Validate(); err != nil {
+		logger.Fatal("%v", err)
+	}
+	model.Convergence = stopping
+	if err := penalty.Validate(); err != nil {
+		logger.Fatal("%v", err)
+	}
+	model.Penalty = penalty
+	if penalty.Enabled() {
+		logger.Info("Penalty: %s", penalty)
+	}
+	if *classWeight == "balanced" {
+		model.SampleWeights = balancedWeights(y)
+	}
+	model.Train(X, y)
+
+	yPred := model.Predict(X)
+	accuracy := Accuracy(y, yPred)
+
+	fmt.Printf("Model Accuracy: %.2f%%\n", accuracy*100)
+	run.Metric("train_accuracy", accuracy)
+	if model.SampleWeights != nil {
+		fmt.Printf("Weighted Accuracy: %.2f%%\n", WeightedAccuracy(y, yPred, model.SampleWeights)*100)
+	}
+	evaluatedX, evaluatedY, evaluatedPred := X, y, yPred
+	if test != nil {
+		XTest, yTest := matrices(test)
+		yTestPred := model.Predict(XTest)
+		fmt.Printf("Test Accuracy: %.2f%%\n", Accuracy(yTest, yTestPred)*100)
+		run.Metric("test_accuracy", Accuracy(yTest, yTestPred))
+		evaluatedX, evaluatedY, evaluatedPred = XTest, yTest, yTestPred
+	}
+	// Predicting the most frequent training class for every row, on the
+	// rows the report covers, gives the accuracies above context.
+	var majority baseline.Classifier
+	if err := majority.Fit(nil, y.RawVector().Data); err != nil {
+		logger.Fatal("%v", err)
+	}
+	constant := mat.NewVecDense(evaluatedY.Len(), majority.Predict(make([][]float64, evaluatedY.Len())))
+	fmt.Printf("Baseline Accuracy (always class %.0f): %.2f%%\n", majority.Class, Accuracy(evaluatedY, constant)*100)
+	run.Metric("baseline_accuracy", Accuracy(evaluatedY, constant))
+	mcnemar, onlyModel, onlyBaseline, err := metrics.McNemar(evaluatedY.RawVector().Data, evaluatedPred.RawVector().Data, constant.RawVector().Data)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+	fmt.Printf("Against the baseline: %d rows right only by the model, %d only by the baseline; %s\n", onlyModel, onlyBaseline, mcnemar)
+	// The report covers the test rows if there are any, the training rows
+	// otherwise.
+	fmt.Println("Classification report (price classes 0 low, 1 medium, 2 high):")
+	metrics.New(evaluatedY.RawVector().Data, evaluatedPred.RawVector().Data).Report().Print(os.Stdout)
+	curve, err := rocCurve(model, evaluatedX, evaluatedY, *rocClass)
+	if err != nil {
+		logger.Error("No ROC curve: %v", err)
+	}
+	if *ovrChart != "" {
+		err := chartOneVsRest(*ovrChart, X, y, features, func() *LogisticRegression {
+			m := NewLogisticRegression(nFeatures, model.LR, model.Epochs)
+			m.LineSearch, m.Solver, m.Convergence, m.Penalty = model.LineSearch, model.Solver, model.Convergence, model.Penalty
+			return m
+		})
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		logger.Info("One-vs-rest coefficients charted in %s", *ovrChart)
+	}
+	if *saveModel != "" {
+		if err := model.Save(*saveModel); err != nil {
+			logger.Fatal("%v", err)
+		}
+		logger.Info("Model saved to %s", *saveModel)
+	}
+
+	// Cross-validation scores the same settings on every fold of the whole
+	// dataset, which varies far less than one split.
+	if cv.Folds > 0 {
+		folds, err := cv.Assign(data.Y)
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		report, err := crossval.Evaluate(func() crossval.Model {
+			m := NewLogisticRegression(nFeatures, model.LR, model.Epochs)
+			m.LineSearch, m.Solver, m.Convergence, m.Features = model.LineSearch, model.Solver, model.Convergence, model.Features
+			m.Penalty = model.Penalty
+			return &foldModel{model: m, prep: preprocessing(data, *impute, *polyDegree, cross), standardize: *standardize, balanced: *classWeight == "balanced"}
+		}, data.X, data.Y, folds, cv.Metrics...)
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		majority, err := crossval.Evaluate(func() crossval.Model { return &baseline.Classifier{} }, data.X, data.Y, folds)
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		fmt.Printf("%d-fold cross-validation:\n", cv.Folds)
+		report.Print(os.Stdout)
+		fmt.Printf("  majority-class baseline: accuracy %.2f%% ± %.2f%%\n", majority.MeanAccuracy*100, majority.StdAccuracy*100)
+		run.Metric("cv_accuracy", report.MeanAccuracy)
+		tests, err := crossval.Compare(report, majority, func(s crossval.FoldScore) float64 { return s.Accuracy })
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		for _, test := range tests {
+			fmt.Printf("  against the baseline: %s\n", test)
+		}
+	}
+
+	if *robustness != "" {
+		var epsilons []float64
+		for _, field := range dataset.SplitList(*robustnessEpsilons) {
+			epsilon, err := strconv.ParseFloat(field, 64)
+			if err != nil || epsilon <= 0 {
+				logger.Fatal("invalid perturbation size %q", field)
+			}
+			epsilons = append(epsilons, epsilon)
+		}
+		evaluated := train
+		if test != nil {
+			evaluated = test
+		}
+		if err := checkRobustness(model, train, evaluated, *robustness, epsilons, *robustnessTrials, repro.Seed); err != nil {
+			logger.Fatal("%v", err)
+		}
+	}
+	if err := run.Write(); err != nil {
+		logger.Fatal("%v", err)
+	}
+
+	if *rocAddr != "" && curve != nil {
+		if err := serveROC(*rocAddr, curve, *rocClass); err != nil {
+			logger.Fatal("%v", err)
+		}
+	}
+}
+
+// runPredict implements the "predict" command: it loads a model written by
+// -save-model and prints the predicted class and probability of every row
+// of a CSV. The label column may be left out; one-hot columns of category
+// values the file does not contain are 0.
+func runPredict(args []string) {
+	fs := flag.NewFlagSet("predict", flag.ExitOnError)
+	modelPath := fs.String("model", "model.json", "model saved with -save-model")
+	dataPath := fs.String("data", "housing.csv", "CSV or .xlsx file of housing blocks to score")
+	mapping := dataset.Mapping{Label: "median_house_value"}
+	mapping.RegisterFlags(fs)
+	categorical := fs.String("categorical-columns", "ocean_proximity", "comma-separated columns holding names, one-hot encoded into features")
+	options := dataset.Options{MaxBadRows: 1000}
+	options.RegisterFlags(fs)
+	var logOptions logging.Options
+	logOptions.RegisterFlags(fs)
+	cli.Parse(fs, args)
+	if err := logger.Configure(logOptions); err != nil {
+		logger.Fatal("invalid logging flags: %v", err)
+	}
+	defer logger.Close()
+
+	var model LogisticRegression
+	if err := model.Load(*modelPath); err != nil {
+		logger.Fatal("%v", err)
+	}
+	categories := dataset.SplitList(*categorical)
+	// A feature cross reads categories by code, so they are one-hot encoded
+	// only after it.
+	crossed := model.Cross != nil
+	data, err := dataset.CSVLoader{Path: *dataPath, Mapping: mapping, Options: options, Categorical: categories, Codes: crossed, Unlabeled: true}.Load()
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+	if summary := data.Summary(); summary != "" {
+		logger.Warn("%s", summary)
+	}
+
+	// The polynomial terms are computed from the file's columns the model
+	// took them from.
+	if model.Degree > 1 {
+		var inputs []int
+		for _, name := range model.Inputs {
+			k := -1
+			for i, feature := range data.FeatureNames {
+				if feature == name {
+					k = i
+				}
+			}
+			if k < 0 {
+				logger.Fatal("%s has no feature %q the model was trained on", *dataPath, name)
+			}
+			inputs = append(inputs, k)
+		}
+		poly := &preprocess.PolynomialFeatures{Degree: model.Degree, Columns: inputs}
+		data = transformed(data, poly, poly.Names(data.FeatureNames))
+	}
+	if crossed {
+		to := make(map[int]int)
+		for j, name := range model.CrossInputs {
+			to[j] = -1
+			for k, feature := range data.FeatureNames {
+				if feature == name {
+					to[j] = k
+				}
+			}
+		}
+		cross := model.Cross.Remap(to)
+		for _, columns := range cross.Crosses {
+			for _, k := range columns {
+				if k < 0 {
+					logger.Fatal("%s lacks a feature the model's crosses were trained on", *dataPath)
+				}
+			}
+		}
+		// The file's own codes name its categories.
+		for k := range cross.Categories {
+			cross.Categories[k] = data.Categories[data.FeatureNames[k]]
+		}
+		data = transformed(data, cross, cross.Names(data.FeatureNames))
+		encoder := &preprocess.OneHotEncoder{}
+		for j, name := range data.FeatureNames {
+			if codes, ok := data.Categories[name]; ok {
+				encoder.Columns = append(encoder.Columns, j)
+				encoder.Categories = append(encoder.Categories, codes)
+			}
+		}
+		if err := encoder.Fit(data.X); err != nil {
+			logger.Fatal("%v", err)
+		}
+		data = transformed(data, encoder, encoder.Names(data.FeatureNames))
+	}
+
+	// Find the model's features among the file's columns by name.
+	positions := make([]int, len(model.Features))
+	for j, name := range model.Features {
+		positions[j] = -1
+		for k, feature := range data.FeatureNames {
+			if feature == name {
+				positions[j] = k
+			}
+		}
+		column, _, oneHot := strings.Cut(name, "=")
+		if positions[j] < 0 && !(oneHot && contains(categories, column)) {
+			logger.Fatal("%s has no feature %q the model was trained on", *dataPath, name)
+		}
+	}
+
+	rows := make([][]float64, data.Len())
+	for i, row := range data.X {
+		rows[i] = make([]float64, len(positions))
+		for j, k := range positions {
+			if k >= 0 {
+				rows[i][j] = row[k]
+			}
+		}
+	}
+	predictions := model.PredictBatch(rows)
+
+	fmt.Println("row,prediction,probability")
+	for i, features := range rows {
+		id := strconv.Itoa(i + 1)
+		if data.IDs != nil {
+			id = data.IDs[i]
+		}
+		fmt.Printf("%s,%g,%.4f\n", id, predictions[i], model.Probability(features))
+	}
+	logger.Info("Scored %d rows with %s", data.Len(), *modelPath)
+}
+
+// labelColumns removes the named features from data and returns them as
+// label vectors, one per row, checking every value is 0 or 1.
+func labelColumns(data *dataset.Dataset, names []string) ([][]float64, error) {
+	positions := make([]int, len(names))
+	for k, name := range names {
+		positions[k] = -1
+		for j, feature := range data.FeatureNames {
+			if feature == name {
+				positions[k] = j
+			}
+		}
+		if positions[k] < 0 {
+			return nil, fmt.Errorf("no label column %q (columns: %s)", name, strings.Join(data.FeatureNames, ", "))
+		}
+	}
+	labels := make([][]float64, data.Len())
+	for i, row := range data.X {
+		for k, j := range positions {
+			if row[j] != 0 && row[j] != 1 {
+				return nil, fmt.Errorf("row %d: label %s is %g, want 0 or 1", i+1, names[k], row[j])
+			}
+			labels[i] = append(labels[i], row[j])
+		}
+	}
+	var features []int
+	for j, name := range data.FeatureNames {
+		if !contains(names, name) {
+			features = append(features, j)
+		}
+	}
+	names, rows := make([]string, len(features)), make([][]float64, data.Len())
+	for k, j := range features {
+		names[k] = data.FeatureNames[j]
+	}
+	for i, row := range data.X {
+		rows[i] = make([]float64, len(features))
+		for k, j := range features {
+			rows[i][k] = row[j]
+		}
+	}
+	data.FeatureNames, data.X = names, rows
+	return labels, nil
+}
+
+// runMultiLabel implements the "multilabel" command: it trains a model of
+// several 0/1 label columns at once, such as the tags of a row, and reports
+// the precision, recall and F1 score of every label on the test rows.
+func runMultiLabel(args []string) {
+	fs := flag.NewFlagSet("multilabel", flag.ExitOnError)
+	dataPath := fs.String("data", "tags.csv", "CSV or .xlsx file with a 0/1 column per label")
+	labels := fs.String("label-columns", "", "comma-separated 0/1 columns, one per label; every other column is a feature")
+	categorical := fs.String("categorical-columns", "", "comma-separated columns holding names, one-hot encoded into features")
+	testFraction := fs.Float64("test-fraction", 0.2, "hold out this fraction of the rows for testing")
+	splitSeed := fs.Int64("split-seed", 1, "random seed of the train/test split")
+	standardize := fs.Bool("standardize", true, "standardize every feature by its mean and standard deviation over the training rows")
+	solver := fs.String("solver", SolverLBFGS, "optimizer: gd (gradient descent) or lbfgs")
+	epochs := fs.Int("epochs", 100, "epochs, or iterations of lbfgs, per label")
+	threshold := fs.Float64("threshold", 0.5, "probability from which a label is predicted")
+	tune := fs.Bool("tune-thresholds", false, "pick every label's threshold for the best F1 score on the training rows instead of -threshold")
+	mapping := dataset.Mapping{}
+	mapping.RegisterFlags(fs)
+	options := dataset.Options{}
+	options.RegisterFlags(fs)
+	penalty := regularization.Penalty{Kind: regularization.L2, L1Ratio: 0.5}
+	penalty.RegisterFlags(fs)
+	var logOptions logging.Options
+	logOptions.RegisterFlags(fs)
+	cli.Parse(fs, args)
+	if err := logger.Configure(logOptions); err != nil {
+		logger.Fatal("invalid logging flags: %v", err)
+	}
+	defer logger.Close()
+	if err := penalty.Validate(); err != nil {
+		logger.Fatal("%v", err)
+	}
+	names := dataset.SplitList(*labels)
+	if len(names) == 0 {
+		logger.Fatal("no -label-columns given")
+	}
+
+	data, err := dataset.CSVLoader{Path: *dataPath, Mapping: mapping, Options: options, Categorical: dataset.SplitList(*categorical), Codes: true, Unlabeled: true}.Load()
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+	if summary := data.Summary(); summary != "" {
+		logger.Warn("%s", summary)
+	}
+	tags, err := labelColumns(data, names)
+	if err != nil {
+		logger.Fatal("%s: %v", *dataPath, err)
+	}
+	// The label vectors ride along as the rows' labels through the split.
+	for i := range data.Y {
+		data.Y[i] = float64(i)
+	}
+	data.Shuffle(rand.New(rand.NewSource(*splitSeed)))
+	train, test := data.Split(1 - *testFraction)
+	logger.Info("Split: %d training rows, %d test rows, %d labels", train.Len(), test.Len(), len(names))
+
+	prep := preprocessing(data, "", 1, nil)
+	if err := prep.Fit(train.X); err != nil {
+		logger.Fatal("%v", err)
+	}
+	features := prep.Names(data.FeatureNames)
+	train, test = transformed(train, prep, features), transformed(test, prep, features)
+	vectors := func(d *dataset.Dataset) (*mat.Dense, *mat.Dense) {
+		X, rows := matrices(d)
+		Y := mat.NewDense(d.Len(), len(names), nil)
+		for i := 0; i < d.Len(); i++ {
+			Y.SetRow(i, tags[int(rows.AtVec(i))])
+		}
+		return X, Y
+	}
+	XTrain, YTrain := vectors(train)
+	XTest, YTest := vectors(test)
+
+	model := NewMultiLabelModel(names, *threshold, func() *LogisticRegression {
+		m := NewLogisticRegression(len(features), 0.02, *epochs)
+		m.Solver, m.Penalty, m.Features = *solver, penalty, features
+		if *standardize {
+			m.Standardize(XTrain)
+		}
+		return m
+	})
+	model.Train(XTrain, YTrain)
+	if *tune {
+		scores, err := model.TuneThresholds(XTrain, YTrain)
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+		for k, name := range names {
+			logger.Info("Label %s: threshold %.3f, training F1 %.3f", name, model.Thresholds[k], scores[k])
+		}
+	}
+
+	predictions := model.Predict(XTest)
+	labelRows, predictedRows := make([][]float64, test.Len()), make([][]float64, test.Len())
+	for i := range labelRows {
+		labelRows[i], predictedRows[i] = YTest.RawRowView(i), predictions.RawRowView(i)
+	}
+	report, err := metrics.MultiLabel(names, labelRows, predictedRows)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+	fmt.Println("Multi-label report on the test rows:")
+	report.Print(os.Stdout)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
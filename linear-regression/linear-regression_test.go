@@ -0,0 +1,87 @@
+package logreg
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+
+	"gopherconAU/regularization"
+)
+
+// loopGradient computes the same gradient as gradient one element at a
+// time, as Train once did.
+func (lr *LogisticRegression) loopGradient(X *mat.Dense, y *mat.VecDense, weights *mat.VecDense) *mat.VecDense {
+	r, c := X.Dims()
+	predictions := mat.NewVecDense(r, nil)
+
+	for i := 0; i < r; i++ {
+		row := mat.Row(nil, i, X)
+		predictions.SetVec(i, mat.Dot(weights, mat.NewVecDense(c, row)))
+	}
+
+	gradients := mat.NewVecDense(c, nil)
+	for j := 0; j < c; j++ {
+		var gradient float64
+		for i := 0; i < r; i++ {
+			xij := X.At(i, j)
+			yVal := y.AtVec(i)
+			prediction := predictions.AtVec(i)
+			gradient += lr.sampleWeight(i) * (prediction - yVal) * xij
+		}
+		gradients.SetVec(j, gradient/lr.totalWeight(r))
+	}
+	lr.Penalty.AddGradient(gradients.RawVector().Data, weights.RawVector().Data)
+	return gradients
+}
+
+// gradientProblem returns a model with random weights and sample weights and
+// rows rows of features features with 0/1 labels.
+func gradientProblem(rows, features int) (*LogisticRegression, *mat.Dense, *mat.VecDense) {
+	rng := rand.New(rand.NewSource(1))
+	X := mat.NewDense(rows, features, nil)
+	y := mat.NewVecDense(rows, nil)
+	sampleWeights := mat.NewVecDense(rows, nil)
+	for i := 0; i < rows; i++ {
+		for j := 0; j < features; j++ {
+			X.Set(i, j, rng.NormFloat64())
+		}
+		y.SetVec(i, float64(rng.Intn(2)))
+		sampleWeights.SetVec(i, 0.5+rng.Float64())
+	}
+	model := NewLogisticRegression(features, 0.01, 1)
+	for j := 0; j < features; j++ {
+		model.Weights.SetVec(j, rng.NormFloat64())
+	}
+	model.SampleWeights = sampleWeights
+	model.Penalty = regularization.Penalty{Kind: regularization.ElasticNet, Lambda: 0.1, L1Ratio: 0.5}
+	return model, X, y
+}
+
+func TestGradientMatchesLoop(t *testing.T) {
+	model, X, y := gradientProblem(200, 6)
+	vectorized := model.gradient(X, y, model.Weights)
+	looped := model.loopGradient(X, y, model.Weights)
+	for j := 0; j < vectorized.Len(); j++ {
+		if math.Abs(vectorized.AtVec(j)-looped.AtVec(j)) > 1e-12 {
+			t.Errorf("gradient %d: vectorized %g, element by element %g", j, vectorized.AtVec(j), looped.AtVec(j))
+		}
+	}
+}
+
+// BenchmarkGradient times one gradient of the objective, as every epoch of
+// Train computes it, vectorized and element by element.
+func BenchmarkGradient(b *testing.B) {
+	model, X, y := gradientProblem(5000, 12)
+	b.Run("vectorized", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			model.gradient(X, y, model.Weights)
+		}
+	})
+	b.Run("loop", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			model.loopGradient(X, y, model.Weights)
+		}
+	})
+}
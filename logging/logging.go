@@ -0,0 +1,156 @@
+// Package logging is the structured logger shared by the programs in this
+// repository. Messages are formatted printf-style as before, and carry
+// fields such as worker_id, epoch, stage or duration_ms attached with With;
+// records are written as text or JSON, filtered by level, and optionally
+// copied to a file.
+package logging
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options selects the format, level and destination of a Logger.
+type Options struct {
+	Format string // text or json
+	Level  string // debug, info, warn or error
+	File   string // also append records to this file; empty writes only to stdout
+}
+
+// RegisterFlags adds -log-format, -log-level and -log-file to fs, with o's
+// current values as defaults.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	if o.Format == "" {
+		o.Format = "text"
+	}
+	if o.Level == "" {
+		o.Level = "info"
+	}
+	fs.StringVar(&o.Format, "log-format", o.Format, "log record format: text or json")
+	fs.StringVar(&o.Level, "log-level", o.Level, "least severe level logged: debug, info, warn or error")
+	fs.StringVar(&o.File, "log-file", o.File, "also append log records to this file")
+}
+
+// Logger writes leveled records. Loggers derived with With share their
+// parent's output, so configuring the root logger reconfigures them all.
+type Logger struct {
+	out   *output
+	attrs []any
+}
+
+// output is the handler every Logger derived from one root writes through.
+type output struct {
+	mu      sync.RWMutex
+	handler slog.Handler
+	file    *os.File
+}
+
+// New returns a logger writing text records of level info and above to
+// stdout until it is configured otherwise.
+func New() *Logger {
+	return &Logger{out: &output{handler: slog.NewTextHandler(os.Stdout, nil)}}
+}
+
+// Configure switches l, and every logger derived from it, to options. A log
+// file opened by an earlier Configure is closed.
+func (l *Logger) Configure(options Options) error {
+	var level slog.Level
+	switch strings.ToLower(options.Level) {
+	case "debug":
+		level = slog.LevelDebug
+	case "", "info":
+		level = slog.LevelInfo
+	case "warn", "warning":
+		level = slog.LevelWarn
+	case "error":
+		level = slog.LevelError
+	default:
+		return fmt.Errorf("unknown log level %q", options.Level)
+	}
+
+	var w io.Writer = os.Stdout
+	var file *os.File
+	if options.File != "" {
+		var err error
+		if file, err = os.OpenFile(options.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644); err != nil {
+			return err
+		}
+		w = io.MultiWriter(os.Stdout, file)
+	}
+
+	handlerOptions := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(options.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, handlerOptions)
+	case "json":
+		handler = slog.NewJSONHandler(w, handlerOptions)
+	default:
+		if file != nil {
+			file.Close()
+		}
+		return fmt.Errorf("unknown log format %q", options.Format)
+	}
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	if l.out.file != nil {
+		l.out.file.Close()
+	}
+	l.out.handler, l.out.file = handler, file
+	return nil
+}
+
+// Close closes the log file, if any; records then go to stdout only.
+func (l *Logger) Close() error {
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	if l.out.file == nil {
+		return nil
+	}
+	err := l.out.file.Close()
+	l.out.file = nil
+	l.out.handler = slog.NewTextHandler(os.Stdout, nil)
+	return err
+}
+
+// With returns a logger that adds the given key-value pairs to every record.
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{out: l.out, attrs: append(append([]any(nil), l.attrs...), args...)}
+}
+
+func (l *Logger) Debug(format string, v ...any) { l.log(slog.LevelDebug, format, v) }
+func (l *Logger) Info(format string, v ...any)  { l.log(slog.LevelInfo, format, v) }
+func (l *Logger) Warn(format string, v ...any)  { l.log(slog.LevelWarn, format, v) }
+func (l *Logger) Error(format string, v ...any) { l.log(slog.LevelError, format, v) }
+
+// Fatal logs at error level and exits with status 1.
+func (l *Logger) Fatal(format string, v ...any) {
+	l.log(slog.LevelError, format, v)
+	l.Close()
+	os.Exit(1)
+}
+
+func (l *Logger) log(level slog.Level, format string, v []any) {
+	l.out.mu.RLock()
+	defer l.out.mu.RUnlock()
+	ctx := context.Background()
+	if !l.out.handler.Enabled(ctx, level) {
+		return
+	}
+	record := slog.NewRecord(time.Now(), level, fmt.Sprintf(format, v...), 0)
+	record.Add(l.attrs...)
+	l.out.handler.Handle(ctx, record)
+}
+
+// Milliseconds expresses d for a duration_ms field.
+func Milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
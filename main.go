@@ -0,0 +1,31 @@
+// Command gopherconAU runs the programs of the talk as subcommands of one
+// binary. Their data paths default to the datasets at the root of the
+// repository, so they run as they are from there:
+//
+//	go build . && ./gopherconAU train-distributed -workers 8
+//	./gopherconAU pipeline -config talk.yaml
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	distributed "gopherconAU/basic-distributed-ml-pipeline"
+	"gopherconAU/cli"
+	cluster "gopherconAU/k-means-clustering"
+	visualize "gopherconAU/k-means-visualization"
+	logreg "gopherconAU/linear-regression"
+	pipeline "gopherconAU/pipeline-design-pattern"
+)
+
+var commands = []cli.Command{
+	{Name: "train-distributed", Summary: "train a wine quality model on distributed workers; also report, tune, watch, serve, ...", Main: distributed.Main},
+	{Name: "train-logreg", Summary: "train a logistic regression of housing prices; also predict and multilabel", Main: logreg.Main},
+	{Name: "cluster", Summary: "cluster a dataset by k-means, DBSCAN or hierarchical clustering", Main: cluster.Main},
+	{Name: "pipeline", Summary: "predict wine quality with KNN in a concurrent pipeline", Main: pipeline.Main},
+	{Name: "visualize", Summary: "serve charts of the clusters and a live k-means run", Main: visualize.Main},
+}
+
+func main() {
+	os.Exit(cli.Run(filepath.Base(os.Args[0]), commands, os.Args[1:]))
+}
@@ -0,0 +1,209 @@
+// Package manifest makes the runs of the programs in this repository
+// reproducible. -seed seeds every random choice a run makes, and -manifest
+// writes a JSON record of the run: the seed, the value of every flag, the
+// checksum of the dataset, the git commit the binary was built from and the
+// final metrics. The flags are recorded in a section named after the
+// command, so the manifest doubles as a config file that runs the command
+// again as it was:
+//
+//	gopherconAU pipeline -config run.json -manifest rerun.json
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopherconAU/dataset"
+)
+
+// Options selects the seed of a run and where to write its manifest; an
+// empty path writes none.
+type Options struct {
+	Seed int64
+	Path string
+}
+
+// RegisterFlags adds -seed and -manifest to fs, with o's current values as
+// defaults.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.Int64Var(&o.Seed, "seed", o.Seed, "seed of every random choice of the run, and of the other seed flags not given; 0 picks one from the clock, which the manifest records")
+	o.RegisterManifestFlag(fs)
+}
+
+// RegisterManifestFlag adds only -manifest to fs, for programs whose
+// options already have a -seed of their own.
+func (o *Options) RegisterManifestFlag(fs *flag.FlagSet) {
+	fs.StringVar(&o.Path, "manifest", o.Path, "write a manifest of the run, with its seed, flags, dataset checksum, git commit and metrics, to this JSON file, which -config can replay")
+}
+
+// Start settles the seed of a run whose flags fs has parsed, replacing 0
+// by one from the clock, and begins its manifest. If -seed was given, on
+// the command line or in a config file, the flags named by seeds, such as
+// cv-seed, take the settled seed unless they were given too, so that one
+// flag seeds the whole run, -seed 0 included.
+func (o *Options) Start(fs *flag.FlagSet, seeds ...string) (*Run, error) {
+	if o.Seed == 0 {
+		o.Seed = time.Now().UnixNano()
+	}
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if given["seed"] {
+		for _, name := range seeds {
+			if !given[name] {
+				if err := fs.Set(name, strconv.FormatInt(o.Seed, 10)); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return &Run{
+		path:      o.Path,
+		flags:     fs,
+		Command:   fs.Name(),
+		Args:      os.Args[1:],
+		Seed:      o.Seed,
+		StartedAt: time.Now(),
+		Metrics:   make(map[string]float64),
+	}, nil
+}
+
+// Run is the manifest of one run, written by Write.
+type Run struct {
+	path  string
+	flags *flag.FlagSet
+
+	Command   string
+	Args      []string
+	Seed      int64
+	Dataset   Dataset
+	StartedAt time.Time
+	// Metrics are the final metrics of the run by name, such as test_mse.
+	Metrics map[string]float64
+}
+
+// Dataset identifies the data a run read.
+type Dataset struct {
+	Path string `json:"path"`
+	// SHA256 is the hash of the file's contents, or for a dataset of
+	// several files, of their hashes.
+	SHA256 string `json:"sha256"`
+	Rows   int    `json:"rows"`
+}
+
+// SetDataset records the dataset at path, of rows rows, as the dataset of
+// the run. The path may name several files, as dataset.Files expands it.
+func (r *Run) SetDataset(path string, rows int) error {
+	files, err := dataset.Files(path)
+	if err != nil {
+		return err
+	}
+	hashes := make([]string, len(files))
+	for i, file := range files {
+		if hashes[i], err = hashFile(file); err != nil {
+			return err
+		}
+	}
+	sum := hashes[0]
+	if len(files) > 1 {
+		hash := sha256.New()
+		for _, h := range hashes {
+			fmt.Fprintln(hash, h)
+		}
+		sum = hex.EncodeToString(hash.Sum(nil))
+	}
+	r.Dataset = Dataset{Path: path, SHA256: sum, Rows: rows}
+	return nil
+}
+
+// hashFile returns the hex SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Metric records the final value of a metric.
+func (r *Run) Metric(name string, value float64) {
+	r.Metrics[name] = value
+}
+
+// Write writes the manifest, if the options asked for one, with the flags
+// as they are now. -config and -manifest are left out of the flags, so that
+// replaying a manifest neither reads another config file nor overwrites it,
+// and so are flags left empty, which some repeatable flags cannot be set to.
+func (r *Run) Write() error {
+	if r.path == "" {
+		return nil
+	}
+	flags := make(map[string]string)
+	r.flags.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if f.Name != "config" && f.Name != "manifest" && (value != "" || f.DefValue != "") {
+			flags[f.Name] = value
+		}
+	})
+	commit, modified := gitCommit()
+	data, err := json.MarshalIndent(map[string]any{
+		"command":      r.Command,
+		"args":         r.Args,
+		"seed":         r.Seed,
+		"dataset":      r.Dataset,
+		"git_commit":   commit,
+		"git_modified": modified,
+		"go_version":   runtime.Version(),
+		"started_at":   r.StartedAt,
+		"finished_at":  time.Now(),
+		"metrics":      r.Metrics,
+		r.Command:      flags,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append(data, '\n'), 0o644)
+}
+
+// gitCommit returns the commit the binary was built from, and whether the
+// tree had changes, from the build info that go build stamps. Binaries
+// built without it, such as by go run, ask git about the working directory
+// instead; outside a repository the commit is empty.
+func gitCommit() (string, bool) {
+	var commit string
+	var modified bool
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				commit = setting.Value
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+	}
+	if commit != "" {
+		return commit, modified
+	}
+	out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", false
+	}
+	status, err := exec.Command("git", "status", "--porcelain").Output()
+	return strings.TrimSpace(string(out)), err == nil && len(strings.TrimSpace(string(status))) > 0
+}
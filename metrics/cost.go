@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Costs is a misclassification cost matrix: what predicting one class
+// costs for a sample of another. A pair it does not list costs 0 when the
+// prediction is right and 1 when it is wrong, so an empty matrix counts
+// errors.
+type Costs struct {
+	costs map[[2]float64]float64 // by {label, prediction}
+}
+
+// NewCosts returns an empty cost matrix, to be filled in with Set.
+func NewCosts() *Costs {
+	return &Costs{costs: make(map[[2]float64]float64)}
+}
+
+// Set sets the cost of predicting prediction for a sample of class label.
+func (c *Costs) Set(label, prediction, cost float64) {
+	c.costs[[2]float64{label, prediction}] = cost
+}
+
+// Cost returns the cost of predicting prediction for a sample of class
+// label.
+func (c *Costs) Cost(label, prediction float64) float64 {
+	if cost, ok := c.costs[[2]float64{label, prediction}]; ok {
+		return cost
+	}
+	if label == prediction {
+		return 0
+	}
+	return 1
+}
+
+// ReadCosts reads a cost matrix from CSV laid out like a printed confusion
+// matrix: a header of predicted classes after one corner cell, then a row
+// per true class starting with the class. An empty cell keeps the default
+// cost of its pair.
+//
+//	actual \ predicted,5,6,7
+//	5,0,1,10
+//	6,1,0,5
+//	7,2,1,0
+func ReadCosts(r io.Reader) (*Costs, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 2 || len(records[0]) < 2 {
+		return nil, fmt.Errorf("a cost matrix needs a header of predicted classes and a row per true class")
+	}
+	parse := func(line int, field, what string) (float64, error) {
+		value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return 0, fmt.Errorf("line %d: %s %q is not a number", line, what, field)
+		}
+		return value, nil
+	}
+
+	predictions := make([]float64, len(records[0])-1)
+	for j, field := range records[0][1:] {
+		if predictions[j], err = parse(1, field, "predicted class"); err != nil {
+			return nil, err
+		}
+	}
+	c := NewCosts()
+	for i, record := range records[1:] {
+		line := i + 2
+		label, err := parse(line, record[0], "true class")
+		if err != nil {
+			return nil, err
+		}
+		for j, field := range record[1:] {
+			if strings.TrimSpace(field) == "" {
+				continue
+			}
+			cost, err := parse(line, field, "cost")
+			if err != nil {
+				return nil, err
+			}
+			c.Set(label, predictions[j], cost)
+		}
+	}
+	return c, nil
+}
+
+// Cost returns the mean cost of the counted predictions under costs.
+func (c *Confusion) Cost(costs *Costs) float64 {
+	total := 0.0
+	for pair, count := range c.counts {
+		total += costs.Cost(pair[0], pair[1]) * float64(count)
+	}
+	return ratioFloat(total, c.total)
+}
+
+// Decide returns the class of classes whose prediction has the least
+// expected cost when the sample is of each class with the given
+// probability, preferring the lower class on ties. It is the prediction
+// that minimizes the cost in the long run if the probabilities are
+// calibrated; with the default costs it is the most likely class.
+func (c *Costs) Decide(probabilities map[float64]float64, classes []float64) float64 {
+	best, bestCost := math.NaN(), math.Inf(1)
+	for _, prediction := range classes {
+		expected := 0.0
+		for label, p := range probabilities {
+			expected += p * c.Cost(label, prediction)
+		}
+		if expected < bestCost || expected == bestCost && prediction < best {
+			best, bestCost = prediction, expected
+		}
+	}
+	return best
+}
+
+// CostPoint is the mean cost of predicting with a threshold on a score.
+type CostPoint struct {
+	Threshold float64
+	Cost      float64
+}
+
+// CostCurve sweeps a threshold over every distinct score, from above the
+// highest down to the lowest, as ROC does, and returns the mean cost under
+// costs at each. At a threshold, sample i is predicted ifPositive[i] when
+// its score is at least the threshold and ifNegative[i] otherwise; its true
+// class is labels[i].
+func CostCurve(labels, scores, ifPositive, ifNegative []float64, costs *Costs) ([]CostPoint, error) {
+	n := len(labels)
+	if len(scores) != n || len(ifPositive) != n || len(ifNegative) != n {
+		return nil, fmt.Errorf("%d labels for %d scores and %d and %d predictions", n, len(scores), len(ifPositive), len(ifNegative))
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("no samples")
+	}
+
+	order := make([]int, n)
+	total := 0.0
+	for i := range order {
+		order[i] = i
+		total += costs.Cost(labels[i], ifNegative[i])
+	}
+	sort.Slice(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+
+	curve := []CostPoint{{Threshold: math.Inf(1), Cost: total / float64(n)}}
+	for k, i := range order {
+		total += costs.Cost(labels[i], ifPositive[i]) - costs.Cost(labels[i], ifNegative[i])
+		// Samples with equal scores cross the threshold together.
+		if k+1 < n && scores[order[k+1]] == scores[i] {
+			continue
+		}
+		curve = append(curve, CostPoint{Threshold: scores[i], Cost: total / float64(n)})
+	}
+	return curve, nil
+}
+
+// Cheapest returns the point of curve with the least cost, the one with the
+// highest threshold on ties.
+func Cheapest(curve []CostPoint) CostPoint {
+	best := curve[0]
+	for _, p := range curve[1:] {
+		if p.Cost < best.Cost {
+			best = p
+		}
+	}
+	return best
+}
+
+func ratioFloat(n float64, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return n / float64(d)
+}
@@ -0,0 +1,211 @@
+// Package metrics scores a classifier's predictions against the true
+// labels: a confusion matrix, the precision, recall and F1 score of every
+// class, and their macro, micro and support-weighted averages. Labels are
+// float64, as in crossval, and any number of classes is supported. For
+// classifiers that score samples, ROC and AUC measure how well the scores
+// rank positives above negatives at every threshold. When some errors cost
+// more than others, Costs prices them, and CostCurve finds the threshold on
+// a score that costs least. MultiLabel scores targets where every sample
+// has any number of labels. McNemar, PairedT and Wilcoxon test whether one
+// model really beats another or only got luckier on these samples. Register
+// names a metric, built in or user-defined, for the commands to pick by flag.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// Confusion counts predictions by their label and predicted class. The zero
+// value is not usable; make one with New.
+type Confusion struct {
+	counts map[[2]float64]int // by {label, prediction}
+	total  int
+}
+
+// New returns the confusion matrix of predictions against labels, which
+// must be the same length. Both may be empty, to be filled in with Add.
+func New(labels, predictions []float64) *Confusion {
+	c := &Confusion{counts: make(map[[2]float64]int)}
+	for i, label := range labels {
+		c.Add(label, predictions[i])
+	}
+	return c
+}
+
+// Add counts one prediction of a sample whose true class is label.
+func (c *Confusion) Add(label, prediction float64) {
+	c.counts[[2]float64{label, prediction}]++
+	c.total++
+}
+
+// Count returns the number of samples of class label predicted as
+// prediction.
+func (c *Confusion) Count(label, prediction float64) int {
+	return c.counts[[2]float64{label, prediction}]
+}
+
+// Total returns the number of samples counted.
+func (c *Confusion) Total() int { return c.total }
+
+// Classes returns every class seen as a label or a prediction, in
+// increasing order.
+func (c *Confusion) Classes() []float64 {
+	seen := make(map[float64]bool)
+	var classes []float64
+	for pair := range c.counts {
+		for _, class := range pair {
+			if !seen[class] {
+				seen[class] = true
+				classes = append(classes, class)
+			}
+		}
+	}
+	sort.Float64s(classes)
+	return classes
+}
+
+// ClassScore is how well one class is predicted. A score whose denominator
+// is zero, such as the precision of a class never predicted, is 0.
+type ClassScore struct {
+	Class     float64
+	Precision float64 // share of the samples predicted as Class that are of it
+	Recall    float64 // share of the samples of Class predicted as it
+	F1        float64 // harmonic mean of precision and recall
+	Support   int     // samples of Class
+}
+
+// Average is an average of the class scores.
+type Average struct {
+	Precision, Recall, F1 float64
+}
+
+// RankMAE returns the mean absolute error of the predictions on the ranks of
+// the classes, 1 for a prediction one class off whatever the classes are.
+// It scores ordered classes, such as quality scores, where a near miss is
+// better than a far one. Classes are ranked among all of those counted.
+func (c *Confusion) RankMAE() float64 {
+	rank := make(map[float64]int)
+	for i, class := range c.Classes() {
+		rank[class] = i
+	}
+	total := 0
+	for pair, count := range c.counts {
+		distance := rank[pair[0]] - rank[pair[1]]
+		if distance < 0 {
+			distance = -distance
+		}
+		total += distance * count
+	}
+	return ratio(total, c.total)
+}
+
+// Report summarizes a confusion matrix.
+type Report struct {
+	Confusion *Confusion
+	Classes   []ClassScore // in increasing order of class
+	Accuracy  float64
+	Macro     Average // every class counts the same
+	Micro     Average // every sample counts the same
+	Weighted  Average // every class counts by its support
+}
+
+// Report computes the scores of every class and their averages.
+func (c *Confusion) Report() *Report {
+	r := &Report{Confusion: c}
+	var truePositives, predictedPositives, actualPositives int
+	classes := c.Classes()
+	for _, class := range classes {
+		score := ClassScore{Class: class}
+		predicted := 0
+		for _, other := range classes {
+			score.Support += c.Count(class, other)
+			predicted += c.Count(other, class)
+		}
+		tp := c.Count(class, class)
+		score.Precision = ratio(tp, predicted)
+		score.Recall = ratio(tp, score.Support)
+		score.F1 = f1(score.Precision, score.Recall)
+		r.Classes = append(r.Classes, score)
+
+		truePositives += tp
+		predictedPositives += predicted
+		actualPositives += score.Support
+		r.Macro.add(score, 1)
+		r.Weighted.add(score, float64(score.Support))
+	}
+	if n := len(r.Classes); n > 0 {
+		r.Macro.scale(1 / float64(n))
+	}
+	if c.total > 0 {
+		r.Weighted.scale(1 / float64(c.total))
+	}
+	r.Accuracy = ratio(truePositives, c.total)
+	r.Micro.Precision = ratio(truePositives, predictedPositives)
+	r.Micro.Recall = ratio(truePositives, actualPositives)
+	r.Micro.F1 = f1(r.Micro.Precision, r.Micro.Recall)
+	return r
+}
+
+func (a *Average) add(score ClassScore, weight float64) {
+	a.Precision += score.Precision * weight
+	a.Recall += score.Recall * weight
+	a.F1 += score.F1 * weight
+}
+
+func (a *Average) scale(factor float64) {
+	a.Precision *= factor
+	a.Recall *= factor
+	a.F1 *= factor
+}
+
+func ratio(n, d int) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
+
+func f1(precision, recall float64) float64 {
+	if precision+recall == 0 {
+		return 0
+	}
+	return 2 * precision * recall / (precision + recall)
+}
+
+// Print writes the confusion matrix, with a row per true class and a column
+// per predicted class, followed by the scores of every class and their
+// averages.
+func (r *Report) Print(w io.Writer) {
+	classes := r.Confusion.Classes()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "actual \\ predicted\t")
+	for _, class := range classes {
+		fmt.Fprintf(tw, "%g\t", class)
+	}
+	fmt.Fprintln(tw)
+	for _, label := range classes {
+		fmt.Fprintf(tw, "%g\t", label)
+		for _, prediction := range classes {
+			fmt.Fprintf(tw, "%d\t", r.Confusion.Count(label, prediction))
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	fmt.Fprint(tw, "class\tprecision\trecall\tF1\tsupport\t\n")
+	for _, score := range r.Classes {
+		fmt.Fprintf(tw, "%g\t%.3f\t%.3f\t%.3f\t%d\t\n", score.Class, score.Precision, score.Recall, score.F1, score.Support)
+	}
+	fmt.Fprintf(tw, "accuracy\t\t\t%.3f\t%d\t\n", r.Accuracy, r.Confusion.Total())
+	for _, average := range []struct {
+		name string
+		Average
+	}{{"macro avg", r.Macro}, {"micro avg", r.Micro}, {"weighted avg", r.Weighted}} {
+		fmt.Fprintf(tw, "%s\t%.3f\t%.3f\t%.3f\t%d\t\n", average.name, average.Precision, average.Recall, average.F1, r.Confusion.Total())
+	}
+	tw.Flush()
+}
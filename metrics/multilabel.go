@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// LabelScore is how well one label of a multi-label target is predicted.
+type LabelScore struct {
+	Label     string
+	Precision float64 // share of the samples predicted to have Label that have it
+	Recall    float64 // share of the samples with Label predicted to have it
+	F1        float64
+	Support   int // samples with Label
+}
+
+// MultiLabelReport scores predictions of multi-label targets, where every
+// sample has any number of labels, given as a 0/1 vector.
+type MultiLabelReport struct {
+	Labels []LabelScore // in the order of the label vectors
+	Macro  Average      // every label counts the same
+	Micro  Average      // every sample-label pair counts the same
+	// HammingLoss is the share of sample-label pairs predicted wrong.
+	HammingLoss float64
+	// SubsetAccuracy is the share of samples with every label right.
+	SubsetAccuracy float64
+	Samples        int
+}
+
+// MultiLabel scores predictions of multi-label targets: labels[i][k] is 1
+// when sample i has label k, names[k], and predictions[i][k] is 1 when it
+// is predicted to.
+func MultiLabel(names []string, labels, predictions [][]float64) (*MultiLabelReport, error) {
+	if len(labels) != len(predictions) {
+		return nil, fmt.Errorf("%d label vectors for %d predictions", len(labels), len(predictions))
+	}
+	n := len(names)
+	counts := make([]struct{ tp, predicted, actual int }, n)
+	r := &MultiLabelReport{Samples: len(labels)}
+	wrong, exact := 0, 0
+	for i, row := range labels {
+		if len(row) != n || len(predictions[i]) != n {
+			return nil, fmt.Errorf("sample %d has %d labels and %d predictions, want %d", i+1, len(row), len(predictions[i]), n)
+		}
+		errors := 0
+		for k, label := range row {
+			has, predicted := label == 1, predictions[i][k] == 1
+			if has {
+				counts[k].actual++
+			}
+			if predicted {
+				counts[k].predicted++
+			}
+			if has && predicted {
+				counts[k].tp++
+			}
+			if has != predicted {
+				errors++
+			}
+		}
+		wrong += errors
+		if errors == 0 {
+			exact++
+		}
+	}
+
+	var tp, predicted, actual int
+	for k, c := range counts {
+		score := LabelScore{Label: names[k], Support: c.actual}
+		score.Precision = ratio(c.tp, c.predicted)
+		score.Recall = ratio(c.tp, c.actual)
+		score.F1 = f1(score.Precision, score.Recall)
+		r.Labels = append(r.Labels, score)
+		r.Macro.Precision += score.Precision
+		r.Macro.Recall += score.Recall
+		r.Macro.F1 += score.F1
+		tp, predicted, actual = tp+c.tp, predicted+c.predicted, actual+c.actual
+	}
+	if n > 0 {
+		r.Macro.scale(1 / float64(n))
+	}
+	r.Micro.Precision = ratio(tp, predicted)
+	r.Micro.Recall = ratio(tp, actual)
+	r.Micro.F1 = f1(r.Micro.Precision, r.Micro.Recall)
+	r.HammingLoss = ratio(wrong, len(labels)*n)
+	r.SubsetAccuracy = ratio(exact, len(labels))
+	return r, nil
+}
+
+// Print writes the scores of every label, their averages, the Hamming loss
+// and the subset accuracy.
+func (r *MultiLabelReport) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "label\tprecision\trecall\tF1\tsupport\t\n")
+	for _, score := range r.Labels {
+		fmt.Fprintf(tw, "%s\t%.3f\t%.3f\t%.3f\t%d\t\n", score.Label, score.Precision, score.Recall, score.F1, score.Support)
+	}
+	fmt.Fprintf(tw, "macro avg\t%.3f\t%.3f\t%.3f\t\t\n", r.Macro.Precision, r.Macro.Recall, r.Macro.F1)
+	fmt.Fprintf(tw, "micro avg\t%.3f\t%.3f\t%.3f\t\t\n", r.Micro.Precision, r.Micro.Recall, r.Micro.F1)
+	tw.Flush()
+	fmt.Fprintf(w, "Hamming loss %.4f, subset accuracy %.3f over %d samples\n", r.HammingLoss, r.SubsetAccuracy, r.Samples)
+}
+
+// BestThreshold returns the threshold on scores that gives the highest F1
+// when samples scoring at least it are predicted positive, and that F1.
+// labels[i] is 1 for a positive sample. Every distinct score is tried; on
+// ties the highest threshold wins. Without positives it returns a
+// threshold above every score.
+func BestThreshold(labels, scores []float64) (threshold, bestF1 float64, err error) {
+	if len(labels) != len(scores) {
+		return 0, 0, fmt.Errorf("%d labels for %d scores", len(labels), len(scores))
+	}
+	if len(labels) == 0 {
+		return 0, 0, fmt.Errorf("no samples")
+	}
+	order := make([]int, len(scores))
+	positives := 0
+	for i := range order {
+		order[i] = i
+		if labels[i] == 1 {
+			positives++
+		}
+	}
+	sort.Slice(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+
+	threshold = scores[order[0]] + 1
+	tp, predicted := 0, 0
+	for k, i := range order {
+		predicted++
+		if labels[i] == 1 {
+			tp++
+		}
+		// Samples with equal scores cross the threshold together.
+		if k+1 < len(order) && scores[order[k+1]] == scores[i] {
+			continue
+		}
+		if score := f1(ratio(tp, predicted), ratio(tp, positives)); score > bestF1 {
+			threshold, bestF1 = scores[i], score
+		}
+	}
+	return threshold, bestF1, nil
+}
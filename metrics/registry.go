@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Func scores predictions against the labels they predict.
+type Func func(labels, predictions []float64) float64
+
+// Metric is a Func registered by name, for cross-validation, tuning, early
+// stopping and reports to look up from a flag:
+//
+//	metrics.Register("mape", func(labels, predictions []float64) float64 {
+//		total := 0.0
+//		for i, label := range labels {
+//			total += math.Abs((label - predictions[i]) / label)
+//		}
+//		return total / float64(len(labels))
+//	})
+//
+// mse, rmse, mae, accuracy and r2 are registered from the start.
+type Metric struct {
+	Name string
+	Func Func
+	// HigherIsBetter is set for scores such as accuracy and clear for
+	// errors such as the MSE.
+	HigherIsBetter bool
+}
+
+// Loss returns the metric of predictions, negated if higher is better, so
+// that lower is always better, as minimizers such as tuner.Search expect.
+func (m Metric) Loss(labels, predictions []float64) float64 {
+	value := m.Func(labels, predictions)
+	if m.HigherIsBetter {
+		return -value
+	}
+	return value
+}
+
+// Better reports whether a is a better value of the metric than b.
+func (m Metric) Better(a, b float64) bool {
+	if m.HigherIsBetter {
+		return a > b
+	}
+	return a < b
+}
+
+var registry = struct {
+	sync.RWMutex
+	metrics map[string]Metric
+}{metrics: make(map[string]Metric)}
+
+// Register makes fn, an error for which lower is better, available by name.
+// Like database/sql.Register, it panics if name is empty or taken or fn is
+// nil, so it is meant for init functions and the start of main.
+func Register(name string, fn Func) { register(Metric{Name: name, Func: fn}) }
+
+// RegisterScore is Register for a score for which higher is better.
+func RegisterScore(name string, fn Func) {
+	register(Metric{Name: name, Func: fn, HigherIsBetter: true})
+}
+
+func register(m Metric) {
+	if m.Name == "" || m.Func == nil {
+		panic("metrics: Register needs a name and a function")
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if _, taken := registry.metrics[m.Name]; taken {
+		panic(fmt.Sprintf("metrics: Register called twice for %q", m.Name))
+	}
+	registry.metrics[m.Name] = m
+}
+
+// Lookup returns the metric registered as name.
+func Lookup(name string) (Metric, error) {
+	registry.RLock()
+	m, ok := registry.metrics[name]
+	registry.RUnlock()
+	if !ok {
+		return Metric{}, fmt.Errorf("unknown metric %q, want one of %s", name, strings.Join(Names(), ", "))
+	}
+	return m, nil
+}
+
+// LookupAll returns the metrics registered as names, in order.
+func LookupAll(names []string) ([]Metric, error) {
+	found := make([]Metric, len(names))
+	for i, name := range names {
+		m, err := Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		found[i] = m
+	}
+	return found, nil
+}
+
+// Names returns the registered metrics in alphabetical order.
+func Names() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	names := make([]string, 0, len(registry.metrics))
+	for name := range registry.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	Register("mse", meanSquaredError)
+	Register("rmse", func(labels, predictions []float64) float64 {
+		return math.Sqrt(meanSquaredError(labels, predictions))
+	})
+	Register("mae", func(labels, predictions []float64) float64 {
+		total := 0.0
+		for i, label := range labels {
+			total += math.Abs(label - predictions[i])
+		}
+		return total / float64(len(labels))
+	})
+	RegisterScore("accuracy", func(labels, predictions []float64) float64 {
+		correct := 0
+		for i, label := range labels {
+			if predictions[i] == label {
+				correct++
+			}
+		}
+		return ratio(correct, len(labels))
+	})
+	// The share of the variance of the labels the predictions explain.
+	RegisterScore("r2", func(labels, predictions []float64) float64 {
+		mean := 0.0
+		for _, label := range labels {
+			mean += label / float64(len(labels))
+		}
+		residual, total := 0.0, 0.0
+		for i, label := range labels {
+			residual += (label - predictions[i]) * (label - predictions[i])
+			total += (label - mean) * (label - mean)
+		}
+		if total == 0 {
+			return 0
+		}
+		return 1 - residual/total
+	})
+}
+
+func meanSquaredError(labels, predictions []float64) float64 {
+	total := 0.0
+	for i, label := range labels {
+		d := label - predictions[i]
+		total += d * d
+	}
+	return total / float64(len(labels))
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ROCPoint is one threshold of a ROC curve: the share of positives and of
+// negatives whose score is at least Threshold.
+type ROCPoint struct {
+	Threshold         float64
+	FalsePositiveRate float64
+	TruePositiveRate  float64
+}
+
+// ROC sweeps a threshold over every distinct score, from above the highest,
+// where nothing is predicted positive, down to the lowest, where
+// everything is, and returns the curve of the rates at each. positive tells
+// which samples are of the positive class; there must be some of both.
+func ROC(positive []bool, scores []float64) ([]ROCPoint, error) {
+	if len(positive) != len(scores) {
+		return nil, fmt.Errorf("%d labels and %d scores", len(positive), len(scores))
+	}
+	var positives, negatives int
+	for _, p := range positive {
+		if p {
+			positives++
+		} else {
+			negatives++
+		}
+	}
+	if positives == 0 || negatives == 0 {
+		return nil, fmt.Errorf("a ROC curve needs both classes, got %d positives and %d negatives", positives, negatives)
+	}
+
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+
+	curve := []ROCPoint{{Threshold: math.Inf(1)}}
+	var truePositives, falsePositives int
+	for i, j := range order {
+		if positive[j] {
+			truePositives++
+		} else {
+			falsePositives++
+		}
+		// Samples with equal scores cross the threshold together.
+		if i+1 < len(order) && scores[order[i+1]] == scores[j] {
+			continue
+		}
+		curve = append(curve, ROCPoint{
+			Threshold:         scores[j],
+			FalsePositiveRate: float64(falsePositives) / float64(negatives),
+			TruePositiveRate:  float64(truePositives) / float64(positives),
+		})
+	}
+	return curve, nil
+}
+
+// AUC returns the area under a ROC curve by the trapezoidal rule: the
+// chance that a random positive scores above a random negative, counting
+// ties as half.
+func AUC(curve []ROCPoint) float64 {
+	area := 0.0
+	for i := 1; i < len(curve); i++ {
+		width := curve[i].FalsePositiveRate - curve[i-1].FalsePositiveRate
+		area += width * (curve[i].TruePositiveRate + curve[i-1].TruePositiveRate) / 2
+	}
+	return area
+}
+
+// At returns the point of curve at threshold: the rates of predicting
+// positive every sample that scores at least threshold.
+func At(curve []ROCPoint, threshold float64) ROCPoint {
+	point := curve[0]
+	for _, p := range curve[1:] {
+		if p.Threshold < threshold {
+			break
+		}
+		point = p
+	}
+	point.Threshold = threshold
+	return point
+}
@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// Test is the outcome of a two-sided significance test: how likely a
+// difference at least as large as the one seen would be if the two models
+// were equally good.
+type Test struct {
+	Name      string
+	Statistic float64
+	PValue    float64
+	Exact     bool // whether PValue is exact rather than from an approximation
+}
+
+func (t Test) String() string {
+	return fmt.Sprintf("%s statistic %.3f, p = %.4g", t.Name, t.Statistic, t.PValue)
+}
+
+// Significant reports whether the difference is significant at level alpha.
+func (t Test) Significant(alpha float64) bool { return t.PValue < alpha }
+
+// McNemar tests whether two classifiers scored on the same samples differ in
+// accuracy, from the samples only one of them got right: onlyA by the
+// first, onlyB by the second. Below 25 such samples it uses the exact
+// binomial test, above it the chi-squared statistic with continuity
+// correction.
+func McNemar(labels, a, b []float64) (test Test, onlyA, onlyB int, err error) {
+	if len(labels) != len(a) || len(labels) != len(b) {
+		return Test{}, 0, 0, fmt.Errorf("%d labels for %d and %d predictions", len(labels), len(a), len(b))
+	}
+	for i, label := range labels {
+		switch rightA, rightB := a[i] == label, b[i] == label; {
+		case rightA && !rightB:
+			onlyA++
+		case rightB && !rightA:
+			onlyB++
+		}
+	}
+	test = Test{Name: "McNemar"}
+	n := onlyA + onlyB
+	switch {
+	case n == 0:
+		test.PValue, test.Exact = 1, true
+	case n < 25:
+		// Under the null hypothesis every disagreement goes either way with
+		// probability one half.
+		binomial := distuv.Binomial{N: float64(n), P: 0.5}
+		test.Statistic = float64(min(onlyA, onlyB))
+		test.PValue, test.Exact = math.Min(1, 2*binomial.CDF(test.Statistic)), true
+	default:
+		d := math.Abs(float64(onlyA-onlyB)) - 1
+		test.Statistic = d * d / float64(n)
+		test.PValue = distuv.ChiSquared{K: 1}.Survival(test.Statistic)
+	}
+	return test, onlyA, onlyB, nil
+}
+
+// PairedT tests whether the mean of the differences between paired scores
+// a and b, such as the MSEs of two models on the same cross-validation
+// folds, is zero, by Student's t-test.
+func PairedT(a, b []float64) (Test, error) {
+	differences, err := differences(a, b)
+	if err != nil {
+		return Test{}, err
+	}
+	n := float64(len(differences))
+	if n < 2 {
+		return Test{}, fmt.Errorf("a paired t-test needs at least 2 pairs, got %d", len(differences))
+	}
+	mean, squares := 0.0, 0.0
+	for _, d := range differences {
+		mean += d / n
+	}
+	for _, d := range differences {
+		squares += (d - mean) * (d - mean)
+	}
+	stderr := math.Sqrt(squares / (n - 1) / n)
+	test := Test{Name: "paired t"}
+	switch {
+	case stderr > 0:
+		test.Statistic = mean / stderr
+		test.PValue = 2 * distuv.StudentsT{Mu: 0, Sigma: 1, Nu: n - 1}.Survival(math.Abs(test.Statistic))
+	case mean == 0:
+		test.PValue = 1
+	default:
+		// Every pair differs by the same amount.
+		test.Statistic, test.PValue = math.Copysign(math.Inf(1), mean), 0
+	}
+	return test, nil
+}
+
+// Wilcoxon tests whether paired scores a and b differ by the Wilcoxon
+// signed-rank test, which unlike PairedT does not assume the differences
+// are normal. Pairs that are equal are left out and tied differences share
+// their mean rank. The statistic is the smaller of the rank sums of the
+// positive and the negative differences. Up to 20 pairs its p-value is
+// exact, by enumerating every assignment of signs; above, it comes from the
+// normal approximation.
+func Wilcoxon(a, b []float64) (Test, error) {
+	all, err := differences(a, b)
+	if err != nil {
+		return Test{}, err
+	}
+	var nonzero []float64
+	for _, d := range all {
+		if d != 0 {
+			nonzero = append(nonzero, d)
+		}
+	}
+	test := Test{Name: "Wilcoxon signed-rank", PValue: 1, Exact: true}
+	n := len(nonzero)
+	if n == 0 {
+		return test, nil
+	}
+	sort.Slice(nonzero, func(i, j int) bool { return math.Abs(nonzero[i]) < math.Abs(nonzero[j]) })
+	ranks := make([]float64, n)
+	for i := 0; i < n; {
+		j := i
+		for j+1 < n && math.Abs(nonzero[j+1]) == math.Abs(nonzero[i]) {
+			j++
+		}
+		for k := i; k <= j; k++ {
+			ranks[k] = float64(i+j)/2 + 1
+		}
+		i = j + 1
+	}
+	positive, total := 0.0, 0.0
+	for k, d := range nonzero {
+		if d > 0 {
+			positive += ranks[k]
+		}
+		total += ranks[k]
+	}
+	test.Statistic = math.Min(positive, total-positive)
+
+	if n <= 20 {
+		extreme := 0
+		for signs := 0; signs < 1<<n; signs++ {
+			sum := 0.0
+			for k := range ranks {
+				if signs&(1<<k) != 0 {
+					sum += ranks[k]
+				}
+			}
+			if math.Min(sum, total-sum) <= test.Statistic+1e-9 {
+				extreme++
+			}
+		}
+		test.PValue = float64(extreme) / float64(int(1)<<n)
+		return test, nil
+	}
+	mean := total / 2
+	variance := 0.0
+	for _, rank := range ranks {
+		variance += rank * rank / 4
+	}
+	z := (test.Statistic - mean) / math.Sqrt(variance)
+	test.PValue = math.Min(1, 2*distuv.UnitNormal.CDF(z))
+	test.Exact = false
+	return test, nil
+}
+
+func differences(a, b []float64) ([]float64, error) {
+	if len(a) != len(b) {
+		return nil, fmt.Errorf("%d scores paired with %d", len(a), len(b))
+	}
+	d := make([]float64, len(a))
+	for i := range a {
+		d[i] = a[i] - b[i]
+	}
+	return d, nil
+}
@@ -0,0 +1,242 @@
+// Package ordinal fits the proportional odds model, a regression for labels
+// that are ordered classes such as wine quality scores: a 6 is between a 5
+// and a 7, but not a 5 plus one. The model scores a row x with one weight
+// vector and cuts the score at increasing thresholds, one between each pair
+// of neighbouring classes:
+//
+//	P(y <= class k | x) = sigmoid(cutpoint_k - w·x)
+//
+// Unlike plain regression it does not assume the classes are evenly
+// spaced, and unlike a multiclass model it knows their order, so it needs
+// a single weight per feature for every class.
+package ordinal
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"gonum.org/v1/gonum/optimize"
+
+	"gopherconAU/regularization"
+)
+
+// Model is a proportional odds model. Set Iterations and Penalty before Fit;
+// Fit sets the rest. It is a crossval.Model.
+type Model struct {
+	Classes   []float64 `json:"classes"`   // in increasing order
+	Cutpoints []float64 `json:"cutpoints"` // increasing, one fewer than Classes
+	Weights   []float64 `json:"weights"`
+	// Iterations bounds the L-BFGS iterations of Fit; 0 allows 200.
+	Iterations int `json:"iterations,omitempty"`
+	// Penalty is added to the negative log-likelihood Fit minimizes. It
+	// applies to the weights, not the cutpoints.
+	Penalty regularization.Penalty `json:"penalty"`
+	// Loss is the mean negative log-likelihood of the training rows,
+	// penalty included, after Fit.
+	Loss float64 `json:"loss"`
+}
+
+// Fit fits the model to rows X whose labels y are classes; every distinct
+// label is a class.
+func (m *Model) Fit(X [][]float64, y []float64) error {
+	if len(X) == 0 || len(X) != len(y) {
+		return fmt.Errorf("%d rows for %d labels", len(X), len(y))
+	}
+	m.Classes = classes(y)
+	if len(m.Classes) < 2 {
+		return fmt.Errorf("need at least 2 classes, got %d", len(m.Classes))
+	}
+	index := make(map[float64]int, len(m.Classes))
+	for k, class := range m.Classes {
+		index[class] = k
+	}
+	labels := make([]int, len(y))
+	for i, label := range y {
+		labels[i] = index[label]
+	}
+	p, cuts := len(X[0]), len(m.Classes)-1
+
+	// The parameters are the weights, then the first cutpoint and the logs
+	// of the gaps to the others, which keeps the cutpoints in order.
+	start := make([]float64, p+cuts)
+	counts := make([]float64, len(m.Classes))
+	for _, k := range labels {
+		counts[k]++
+	}
+	// Start from the cutpoints that fit the class frequencies alone.
+	cumulative, previous := 0.0, 0.0
+	for k := 0; k < cuts; k++ {
+		cumulative += counts[k] / float64(len(y))
+		logit := math.Log(cumulative / (1 - cumulative))
+		if k == 0 {
+			start[p] = logit
+		} else {
+			start[p+k] = math.Log(math.Max(logit-previous, 1e-3))
+			logit = previous + math.Exp(start[p+k])
+		}
+		previous = logit
+	}
+
+	problem := optimize.Problem{
+		Func: func(params []float64) float64 {
+			return m.objective(X, labels, params, nil)
+		},
+		Grad: func(grad, params []float64) {
+			m.objective(X, labels, params, grad)
+		},
+	}
+	iterations := m.Iterations
+	if iterations == 0 {
+		iterations = 200
+	}
+	settings := &optimize.Settings{MajorIterations: iterations, GradientThreshold: 1e-6}
+	result, err := optimize.Minimize(problem, start, settings, &optimize.LBFGS{})
+	if result == nil {
+		return err
+	}
+	m.Weights = append([]float64(nil), result.X[:p]...)
+	m.Cutpoints = cutpoints(result.X[p:])
+	m.Loss = result.F
+	return nil
+}
+
+// cutpoints returns the cutpoints of the gap parameters: the first
+// cutpoint, then the logs of the gaps to each next one.
+func cutpoints(params []float64) []float64 {
+	cuts := make([]float64, len(params))
+	for k, param := range params {
+		if k == 0 {
+			cuts[k] = param
+		} else {
+			cuts[k] = cuts[k-1] + math.Exp(param)
+		}
+	}
+	return cuts
+}
+
+// objective returns the mean negative log-likelihood of the rows plus the
+// penalty at params and, if grad is not nil, stores its gradient there.
+func (m *Model) objective(X [][]float64, labels []int, params, grad []float64) float64 {
+	p := len(X[0])
+	weights, cuts := params[:p], cutpoints(params[p:])
+	for j := range grad {
+		grad[j] = 0
+	}
+	// Gradient with respect to the cutpoints themselves, mapped to the gap
+	// parameters at the end.
+	cutGrad := make([]float64, len(cuts))
+
+	loss := 0.0
+	for i, row := range X {
+		score := 0.0
+		for j, value := range row {
+			score += weights[j] * value
+		}
+		k := labels[i]
+		upper, upperDensity := 1.0, 0.0
+		if k < len(cuts) {
+			upper = sigmoid(cuts[k] - score)
+			upperDensity = upper * (1 - upper)
+		}
+		lower, lowerDensity := 0.0, 0.0
+		if k > 0 {
+			lower = sigmoid(cuts[k-1] - score)
+			lowerDensity = lower * (1 - lower)
+		}
+		probability := math.Max(upper-lower, 1e-15)
+		loss -= math.Log(probability)
+		if grad == nil {
+			continue
+		}
+		// d(-log p)/d score, then by the cutpoints on either side.
+		dScore := (upperDensity - lowerDensity) / probability
+		for j, value := range row {
+			grad[j] += dScore * value
+		}
+		if k < len(cuts) {
+			cutGrad[k] -= upperDensity / probability
+		}
+		if k > 0 {
+			cutGrad[k-1] += lowerDensity / probability
+		}
+	}
+	n := float64(len(X))
+	loss = loss/n + m.Penalty.Loss(weights)
+	if grad == nil {
+		return loss
+	}
+	for j := 0; j < p; j++ {
+		grad[j] /= n
+	}
+	m.Penalty.AddGradient(grad[:p], weights)
+	// Cutpoint k moves with the first parameter and with every gap
+	// parameter up to k.
+	for k := range cuts {
+		for g := 0; g <= k; g++ {
+			scale := 1.0
+			if g > 0 {
+				scale = math.Exp(params[p+g])
+			}
+			grad[p+g] += cutGrad[k] / n * scale
+		}
+	}
+	return loss
+}
+
+// Probabilities returns the probability of every class for a row, in the
+// order of Classes.
+func (m *Model) Probabilities(x []float64) []float64 {
+	score := 0.0
+	for j, value := range x {
+		score += m.Weights[j] * value
+	}
+	probabilities := make([]float64, len(m.Classes))
+	below := 0.0
+	for k := range m.Classes {
+		cumulative := 1.0
+		if k < len(m.Cutpoints) {
+			cumulative = sigmoid(m.Cutpoints[k] - score)
+		}
+		probabilities[k] = cumulative - below
+		below = cumulative
+	}
+	return probabilities
+}
+
+// Classify returns the most probable class of a row.
+func (m *Model) Classify(x []float64) float64 {
+	probabilities := m.Probabilities(x)
+	best := 0
+	for k, p := range probabilities {
+		if p > probabilities[best] {
+			best = k
+		}
+	}
+	return m.Classes[best]
+}
+
+// Predict classifies every row of X.
+func (m *Model) Predict(X [][]float64) []float64 {
+	predictions := make([]float64, len(X))
+	for i, x := range X {
+		predictions[i] = m.Classify(x)
+	}
+	return predictions
+}
+
+func sigmoid(x float64) float64 { return 1 / (1 + math.Exp(-x)) }
+
+// classes returns the distinct labels in increasing order.
+func classes(y []float64) []float64 {
+	seen := make(map[float64]bool)
+	var distinct []float64
+	for _, label := range y {
+		if !seen[label] {
+			seen[label] = true
+			distinct = append(distinct, label)
+		}
+	}
+	sort.Float64s(distinct)
+	return distinct
+}
@@ -1,305 +1,2710 @@
-package main
+// Package pipeline is the pipeline command: it predicts wine quality with
+// KNN in a pipeline of concurrent stages.
+package pipeline
 
 import (
-	"encoding/csv"
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"io"
 	"math"
 	"math/rand"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/debug"
+	"runtime/trace"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
 	"time"
+	"unicode"
+
+	"gopherconAU/baseline"
+	"gopherconAU/cli"
+	"gopherconAU/crossval"
+	"gopherconAU/dataset"
+	"gopherconAU/explain"
+	"gopherconAU/kdtree"
+	"gopherconAU/logging"
+	"gopherconAU/manifest"
+	"gopherconAU/metrics"
+	"gopherconAU/ordinal"
+	"gopherconAU/preprocess"
+	"gopherconAU/profiling"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
 )
 
 type Wine struct {
 	features []float64
 	quality  int
 	id       int
+	weight   float64 // sample importance for neighbor votes and accuracy
+	holdout  bool    // in the test split rather than the KNN reference set
+	repeat   bool    // drawn again by the weighted sampling source; counted once outside the reference set
+
+	probabilities map[int]float64 // KNN quality probabilities, once scored
+	branch        string          // pipeline branch the wine came through, set where branches merge
 }
 
+// PipelineStage runs process on every chunk of wines it receives and sends
+// the result on, so consecutive stages work on different chunks at once. An
+// error from process or finish stops the whole pipeline.
 type PipelineStage struct {
 	name    string
 	input   chan []Wine
 	output  chan []Wine
-	process func([]Wine) []Wine
+	process func(context.Context, []Wine) ([]Wine, error)
+	done    chan struct{} // closed once the stage has stopped
+	// finish, if set, runs once after the last chunk, or on cancellation,
+	// for stages that need every chunk; a non-empty result is sent on.
+	finish func(context.Context) ([]Wine, error)
+
+	// workers is the number of goroutines running process on chunks at
+	// once; process must then be safe for concurrent use. With more than
+	// one, results are sent in input order only if ordered is set.
+	workers int
+	ordered bool
+
+	// buffer is the number of chunks the stage's input holds while its
+	// workers are busy, and policy what its producers do once it is full:
+	// one of the Backpressure policies, block if empty.
+	buffer int
+	policy string
+
+	// wines and busy count the wines processed and the time spent in
+	// process and finish, summed over the workers; dropped and droppedWines
+	// count the chunks and wines discarded from the full input buffer. They
+	// are final once done is closed.
+	mu           sync.Mutex
+	wines        int
+	busy         time.Duration
+	dropped      int
+	droppedWines int
+
+	// downstream counts the chunks sent on to the next stages, and the
+	// stalls waiting for their buffers. It is final once Pipeline.Run returns.
+	downstream flow
+
+	// taken counts the chunks taken from the input that the workers have
+	// not finished with yet.
+	taken atomic.Int64
+}
+
+// Backpressure policies decide what a producer does when the input buffer
+// of the stage it sends to is full.
+const (
+	BackpressureBlock      = "block"       // wait until the stage takes a chunk
+	BackpressureDropOldest = "drop-oldest" // discard the oldest buffered chunk
+	BackpressureDropNewest = "drop-newest" // discard the chunk being sent
+)
+
+// flow counts the chunks a producer sent downstream, and how often and for
+// how long it stalled because a receiving stage's buffer was full.
+type flow struct {
+	mu      sync.Mutex
+	sent    int
+	stalls  int
+	stalled time.Duration
+}
+
+func (f *flow) record(stalled bool, waited time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent++
+	if stalled {
+		f.stalls++
+		f.stalled += waited
+	}
+}
+
+// logStalls logs how often the producer named by source stalled, if ever.
+func (f *flow) logStalls(log *logging.Logger, source string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stalls == 0 {
+		return
+	}
+	log.With("stalls", f.stalls, "duration_ms", logging.Milliseconds(f.stalled)).Info("🚦 %s stalled on %d of %d chunks sent downstream, waiting %v in total for full buffers",
+		source, f.stalls, f.sent, f.stalled.Round(time.Millisecond))
 }
 
-func init() {
-	log.SetPrefix("PIPELINE: ")
-	log.SetFlags(log.Ltime | log.Lmicroseconds)
+// stageChunk is a chunk of wines numbered in the order the stage received it.
+type stageChunk struct {
+	seq   int
+	wines []Wine
 }
 
-func NewPipelineStage(name string, process func([]Wine) []Wine) *PipelineStage {
+// chunkSize is the number of wines that travel between stages together. It
+// is small enough for the test wines to span several chunks, so parallel
+// prediction workers all have work.
+var chunkSize = 20
+
+// adaptiveChunks lets a chunkController size the source chunks, between
+// minChunkSize and maxChunkSize, starting at chunkSize.
+var (
+	adaptiveChunks = false
+	minChunkSize   = 5
+	maxChunkSize   = 100
+)
+
+// diagnosticsDir receives a report for every stage panic; empty only logs them.
+var diagnosticsDir = "diagnostics"
+
+var logger = logging.New().With("program", "pipeline")
+
+func NewPipelineStage(name string, process func(context.Context, []Wine) ([]Wine, error)) *PipelineStage {
 	return &PipelineStage{
 		name:    name,
-		input:   make(chan []Wine),
 		output:  make(chan []Wine),
 		process: process,
+		done:    make(chan struct{}),
 	}
 }
 
-func (s *PipelineStage) Run() {
+// Run processes the stage's input chunk by chunk until it is closed or ctx
+// is cancelled, then runs finish and closes the output. The chunks fan out
+// to the stage's workers and their results fan back in to the output. ctx
+// is passed on to the stage functions, which should return early once it is
+// cancelled; the result of a cancelled chunk is dropped. The first error of
+// a stage function is sent on errs, if there is room, and the stage drops
+// the chunk; it is up to the receiver to cancel ctx. Every goroutine of the
+// stage carries the stage's name and its part in profiler labels, and
+// traces show every chunk processed as a region.
+func (s *PipelineStage) Run(ctx context.Context, errs chan<- error) {
+	log := logger.With("stage", s.name)
+	jobs := make(chan stageChunk)
+	results := make(chan stageChunk)
+
+	go func() {
+		profiling.Label(ctx, "stage", s.name, "phase", "fan-out")
+		defer close(jobs)
+		for seq := 0; ; seq++ {
+			select {
+			case <-ctx.Done():
+				return
+			case data, ok := <-s.input:
+				if !ok {
+					return
+				}
+				s.taken.Add(1)
+				select {
+				case jobs <- stageChunk{seq, data}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < max(s.workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx := profiling.Label(ctx, "stage", s.name, "phase", "process")
+			for job := range jobs {
+				data := job.wines
+				log.With("samples", len(data)).Debug("⚙️  Stage [%s] processing %d samples...", s.name, len(data))
+				start := time.Now()
+				region := trace.StartRegion(ctx, s.name)
+				result, err := s.safeProcess(data, func() ([]Wine, error) { return s.process(ctx, data) })
+				region.End()
+				s.taken.Add(-1)
+				s.record(len(data), time.Since(start))
+				if err != nil {
+					s.fail(ctx, errs, err)
+					result = nil
+				} else if ctx.Err() != nil {
+					result = nil
+				} else {
+					log.With("duration_ms", logging.Milliseconds(time.Since(start))).Debug("✅ Stage [%s] completed processing", s.name)
+				}
+				// Dropped chunks are still reported, so ordered fan-in
+				// does not wait for them.
+				results <- stageChunk{job.seq, result}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
 	go func() {
+		profiling.Label(ctx, "stage", s.name, "phase", "fan-in")
+		defer close(s.done)
 		defer close(s.output)
-		log.Printf("📡 Stage [%s] started and waiting for input...", s.name)
-		for data := range s.input {
-			log.Printf("⚙️  Stage [%s] processing %d samples...", s.name, len(data))
-			result := s.process(data)
-			log.Printf("✅ Stage [%s] completed processing", s.name)
-			s.output <- result
-		}
-		log.Printf("🏁 Stage [%s] finished all processing", s.name)
+		log.Info("📡 Stage [%s] started with %d worker(s) and waiting for input...", s.name, max(s.workers, 1))
+		start := time.Now()
+		defer func() { s.logThroughput(log, time.Since(start)) }()
+
+		waiting := make(map[int][]Wine)
+		next := 0
+		for result := range results {
+			if !s.ordered {
+				s.send(ctx, result.wines)
+				continue
+			}
+			waiting[result.seq] = result.wines
+			for wines, ok := waiting[next]; ok; wines, ok = waiting[next] {
+				delete(waiting, next)
+				next++
+				s.send(ctx, wines)
+			}
+		}
+		if ctx.Err() != nil {
+			log.Warn("🛑 Stage [%s] cancelled", s.name)
+			s.runFinish(ctx, errs)
+			return
+		}
+		s.send(ctx, s.runFinish(ctx, errs))
+		log.Info("🏁 Stage [%s] finished all processing", s.name)
 	}()
 }
 
-func loadWineData(filename string) ([]Wine, error) {
-	log.Printf("📂 Starting data loading from %s", filename)
-	start := time.Now()
+// backlog returns the number of chunks waiting in the stage's input buffer
+// or being processed by its workers.
+func (s *PipelineStage) backlog() int {
+	return len(s.input) + int(s.taken.Load())
+}
+
+// record adds a processed chunk to the stage's counters.
+func (s *PipelineStage) record(wines int, busy time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wines += wines
+	s.busy += busy
+}
 
-	file, err := os.Open(filename)
+// runFinish runs the stage's finish function, if it has one.
+func (s *PipelineStage) runFinish(ctx context.Context, errs chan<- error) []Wine {
+	if s.finish == nil {
+		return nil
+	}
+	start := time.Now()
+	defer func() { s.record(0, time.Since(start)) }()
+	result, err := s.safeProcess(nil, func() ([]Wine, error) { return s.finish(ctx) })
 	if err != nil {
-		return nil, err
+		s.fail(ctx, errs, err)
+		return nil
 	}
-	defer file.Close()
+	return result
+}
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		return nil, err
+// fail reports err on errs. Errors once ctx is cancelled are most likely
+// the cancellation itself, and are ignored.
+func (s *PipelineStage) fail(ctx context.Context, errs chan<- error, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	logger.With("stage", s.name).Error("❌ Stage [%s] failed: %v", s.name, err)
+	select {
+	case errs <- fmt.Errorf("stage %s: %w", s.name, err):
+	default:
 	}
+}
 
-	var wines []Wine
-	for _, record := range records[1:] {
-		wine := Wine{
-			features: make([]float64, len(record)-2),
-		}
+// offer puts chunk in the stage's input, applying the stage's backpressure
+// policy if the buffer is full. It reports whether the producer stalled, and
+// for how long.
+func (s *PipelineStage) offer(ctx context.Context, chunk []Wine) (bool, time.Duration) {
+	select {
+	case s.input <- chunk:
+		return false, 0
+	default:
+	}
 
-		for i := 0; i < len(record)-2; i++ {
-			value, err := strconv.ParseFloat(record[i], 64)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing feature: %v", err)
+	switch s.policy {
+	case BackpressureDropNewest:
+		s.drop(chunk)
+	case BackpressureDropOldest:
+		for {
+			select {
+			case s.input <- chunk:
+				return false, 0
+			case <-ctx.Done():
+				return false, 0
+			default:
+			}
+			// Another producer may have filled the freed slot first,
+			// hence the loop.
+			select {
+			case oldest := <-s.input:
+				s.drop(oldest)
+			default:
 			}
-			wine.features[i] = value
 		}
-
-		quality, err := strconv.Atoi(record[len(record)-2])
-		if err != nil {
-			return nil, fmt.Errorf("error parsing quality: %v", err)
+	default:
+		start := time.Now()
+		select {
+		case s.input <- chunk:
+		case <-ctx.Done():
 		}
-		wine.quality = quality
+		return true, time.Since(start)
+	}
+	return false, 0
+}
 
-		id, err := strconv.Atoi(record[len(record)-1])
-		if err != nil {
-			return nil, fmt.Errorf("error parsing ID: %v", err)
-		}
-		wine.id = id
+// drop counts a chunk discarded from, or never let into, the full input.
+func (s *PipelineStage) drop(chunk []Wine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped++
+	s.droppedWines += len(chunk)
+}
 
-		wines = append(wines, wine)
+// send passes a non-empty chunk on to the next stage.
+func (s *PipelineStage) send(ctx context.Context, chunk []Wine) {
+	if len(chunk) == 0 {
+		return
 	}
+	select {
+	case s.output <- chunk:
+	case <-ctx.Done():
+	}
+}
 
-	log.Printf("✅ Data loading completed in %v. Loaded %d samples", time.Since(start), len(wines))
-	return wines, nil
+// logThroughput logs how many wines the stage handled per second of work,
+// with its workers in parallel, and how long it was idle, waiting for input
+// or for the next stage.
+func (s *PipelineStage) logThroughput(log *logging.Logger, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	workers := max(s.workers, 1)
+	working := s.busy / time.Duration(workers)
+	rate := 0.0
+	if working > 0 {
+		rate = float64(s.wines) / working.Seconds()
+	}
+	log.With("samples", s.wines, "workers", workers, "duration_ms", logging.Milliseconds(s.busy)).Info("📊 Stage [%s] throughput: %d samples in %v busy over %d worker(s) (%.0f samples/s), %v idle",
+		s.name, s.wines, s.busy.Round(time.Millisecond), workers, rate, max(elapsed-working, 0).Round(time.Millisecond))
+	if s.dropped > 0 {
+		log.With("dropped", s.dropped).Warn("🗑️  Stage [%s] dropped %d chunks (%d samples) from its full input buffer under %s", s.name, s.dropped, s.droppedWines, s.policy)
+	}
 }
 
-func standardize(data []Wine) []Wine {
-	log.Printf("🔄 Starting standardization process")
-	start := time.Now()
+// chunks splits data into slices of at most size wines.
+func chunks(data []Wine, size int) [][]Wine {
+	var result [][]Wine
+	for start := 0; start < len(data); start += size {
+		result = append(result, data[start:min(start+size, len(data))])
+	}
+	return result
+}
 
-	time.Sleep(2 * time.Second)
+// chunkController picks the size of every chunk the source sends from the
+// backlog of the stages it watches, the slow ones the pipeline should keep
+// busy, aiming for between one chunk per worker and as many more as their
+// input buffers hold. A watched stage with fewer chunks than workers leaves
+// workers idle, and the chunks halve so that the same wines reach more of
+// them; one with more than its buffer holds makes its producers stall or
+// drop, and the chunks grow by step so that fewer of them queue up. Idle
+// workers win over full buffers.
+type chunkController struct {
+	watch                  []*PipelineStage
+	size, minSize, maxSize int
+	step                   int
 
-	numFeatures := len(data[0].features)
-	means := make([]float64, numFeatures)
-	stds := make([]float64, numFeatures)
+	mu            sync.Mutex
+	sizes         []int // of every chunk sent
+	grown, shrunk int
+}
 
-	log.Printf("📊 Calculating means for %d features", numFeatures)
+func newChunkController(size, minSize, maxSize int, watch ...*PipelineStage) *chunkController {
+	return &chunkController{
+		watch:   watch,
+		size:    min(max(size, minSize), maxSize),
+		minSize: minSize,
+		maxSize: maxSize,
+		step:    minSize,
+	}
+}
 
-	for _, wine := range data {
-		for i, feature := range wine.features {
-			means[i] += feature
-		}
+// next returns the size of the next chunk, adjusted to the backlogs of the
+// watched stages now.
+func (c *chunkController) next() int {
+	starving, full := false, false
+	backlogs := make([]string, len(c.watch))
+	for i, stage := range c.watch {
+		backlog, workers := stage.backlog(), max(stage.workers, 1)
+		starving = starving || backlog < workers
+		full = full || backlog > workers+max(stage.buffer, 0)
+		backlogs[i] = fmt.Sprintf("%s: %d", stage.name, backlog)
 	}
-	for i := range means {
-		means[i] /= float64(len(data))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case starving && c.size > c.minSize:
+		c.size = max(c.size/2, c.minSize)
+		c.shrunk++
+	case full && !starving && c.size < c.maxSize:
+		c.size = min(c.size+c.step, c.maxSize)
+		c.grown++
+	default:
+		return c.size
 	}
+	logger.With("chunk_size", c.size).Debug("📏 Source chunks now %d samples (backlog %s)", c.size, strings.Join(backlogs, ", "))
+	return c.size
+}
 
-	log.Printf("📊 Calculating standard deviations")
-	for _, wine := range data {
-		for i, feature := range wine.features {
-			diff := feature - means[i]
-			stds[i] += diff * diff
+// feed sends the wines of source to out in chunks of the sizes next picks,
+// until they run out or ctx is cancelled.
+func (c *chunkController) feed(ctx context.Context, source [][]Wine, out chan<- []Wine) {
+	var wines []Wine
+	for _, chunk := range source {
+		wines = append(wines, chunk...)
+	}
+	for start := 0; start < len(wines); {
+		chunk := wines[start:min(start+c.next(), len(wines))]
+		select {
+		case out <- chunk:
+		case <-ctx.Done():
+			return
 		}
+		c.mu.Lock()
+		c.sizes = append(c.sizes, len(chunk))
+		c.mu.Unlock()
+		start += len(chunk)
+	}
+}
+
+// logSizes logs the range of the chunk sizes sent and how often they changed.
+func (c *chunkController) logSizes(log *logging.Logger) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.sizes) == 0 {
+		return
 	}
-	for i := range stds {
-		stds[i] = math.Sqrt(stds[i] / float64(len(data)))
+	smallest, largest, total := c.sizes[0], c.sizes[0], 0
+	for _, size := range c.sizes {
+		smallest, largest, total = min(smallest, size), max(largest, size), total+size
 	}
+	log.With("chunks", len(c.sizes), "grown", c.grown, "shrunk", c.shrunk).Info("📏 Source sent %d samples in %d chunks of %d to %d (%.1f on average), growing them %d times and halving them %d times",
+		total, len(c.sizes), smallest, largest, float64(total)/float64(len(c.sizes)), c.grown, c.shrunk)
+}
 
-	log.Printf("📊 Applying standardization transformation")
-	standardized := make([]Wine, len(data))
-	for i, wine := range data {
-		standardized[i].features = make([]float64, numFeatures)
-		for j, feature := range wine.features {
-			if stds[j] != 0 {
-				standardized[i].features[j] = (feature - means[j]) / stds[j]
-			}
-		}
-		standardized[i].quality = wine.quality
-		standardized[i].id = wine.id
+// prorate returns the share of d that n of total wines account for, so a
+// simulated cost for the whole dataset is spread over its chunks.
+func prorate(d time.Duration, n, total int) time.Duration {
+	if total == 0 {
+		return 0
 	}
+	return d * time.Duration(n) / time.Duration(total)
+}
 
-	log.Printf("✅ Standardization completed in %v", time.Since(start))
-	return standardized
+// sleep pauses for d, or until ctx is cancelled, and reports whether the
+// whole pause elapsed.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
-func splitDataset(data []Wine) []Wine {
-	log.Printf("🔄 Starting dataset splitting")
-	start := time.Now()
+// Pipeline wires stages into a directed acyclic graph. Stages are added in
+// order; Branch forks the stream into parallel sub-pipelines that all get
+// every chunk, and Merge joins them into one stage, which sees each wine
+// tagged with the name of the branch it came through. Stages must not
+// modify the wines they receive, since branches share them.
+type Pipeline struct {
+	stages []*PipelineStage
+	next   map[*PipelineStage][]link
+	roots  []*PipelineStage // fed by the source
 
-	time.Sleep(1 * time.Second)
+	tails    []*PipelineStage // where the next stage attaches
+	fork     []*PipelineStage // where the open branches start
+	branches []branchEnd      // open branches, waiting for Merge
+	err      error
 
-	rand.Seed(time.Now().UnixNano())
-	shuffled := make([]Wine, len(data))
-	copy(shuffled, data)
+	// chunking, if set, resizes the source chunks as the pipeline runs.
+	chunking *chunkController
+}
 
-	log.Printf("🔀 Shuffling dataset")
-	rand.Shuffle(len(shuffled), func(i, j int) {
-		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
-	})
+type link struct {
+	to     *PipelineStage
+	branch string // set on links into a merge stage
+}
+
+type branchEnd struct {
+	name  string
+	tails []*PipelineStage
+}
+
+func NewPipeline() *Pipeline {
+	return &Pipeline{next: make(map[*PipelineStage][]link)}
+}
 
-	splitIndex := int(float64(len(data)) * 0.8)
-	trainData := shuffled[:splitIndex]
-	testData := shuffled[splitIndex:]
+// Stage adds a stage after the current one.
+func (p *Pipeline) Stage(stage *PipelineStage) *Pipeline {
+	if len(p.branches) > 0 {
+		p.fail(fmt.Errorf("stage %q follows unmerged branches", stage.name))
+		return p
+	}
+	p.stages = append(p.stages, stage)
+	p.connect(p.tails, stage, "")
+	p.tails = []*PipelineStage{stage}
+	return p
+}
 
-	log.Printf("✅ Dataset split completed in %v - Training: %d samples, Test: %d samples",
-		time.Since(start), len(trainData), len(testData))
+// Branch adds a branch fed by the current stage, or by the source if there
+// is none yet. Branches added one after another run side by side until the
+// next Merge.
+func (p *Pipeline) Branch(name string, branch *Pipeline) *Pipeline {
+	switch {
+	case branch.err != nil:
+		p.fail(fmt.Errorf("branch %q: %v", name, branch.err))
+		return p
+	case len(branch.branches) > 0:
+		p.fail(fmt.Errorf("branch %q has unmerged branches", name))
+		return p
+	case len(branch.stages) == 0:
+		p.fail(fmt.Errorf("branch %q has no stages", name))
+		return p
+	}
+	if len(p.branches) == 0 {
+		p.fork = p.tails
+	}
+	p.stages = append(p.stages, branch.stages...)
+	for from, links := range branch.next {
+		p.next[from] = append(p.next[from], links...)
+	}
+	for _, root := range branch.roots {
+		p.connect(p.fork, root, "")
+	}
+	p.branches = append(p.branches, branchEnd{name, branch.tails})
+	p.tails = nil
+	return p
+}
 
-	return shuffled
+// Merge adds a stage that receives the output of every open branch.
+func (p *Pipeline) Merge(stage *PipelineStage) *Pipeline {
+	if len(p.branches) == 0 {
+		p.fail(fmt.Errorf("merge stage %q has no branches to merge", stage.name))
+		return p
+	}
+	p.stages = append(p.stages, stage)
+	for _, end := range p.branches {
+		p.connect(end.tails, stage, end.name)
+	}
+	p.branches, p.fork = nil, nil
+	p.tails = []*PipelineStage{stage}
+	return p
 }
 
-func predictQuality(data []Wine) []Wine {
-	log.Printf("🔄 Starting KNN prediction process")
-	start := time.Now()
+func (p *Pipeline) connect(from []*PipelineStage, to *PipelineStage, branch string) {
+	if len(from) == 0 {
+		p.roots = append(p.roots, to)
+	}
+	for _, stage := range from {
+		p.next[stage] = append(p.next[stage], link{to, branch})
+	}
+}
 
-	k := 5
-	trainSize := int(float64(len(data)) * 0.8)
-	trainData := data[:trainSize]
-	testData := data[trainSize:]
+func (p *Pipeline) fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
 
-	log.Printf("📈 Training KNN model with k=%d", k)
-	time.Sleep(1 * time.Second)
+// Stages returns every stage, in the order they were added.
+func (p *Pipeline) Stages() []*PipelineStage {
+	return p.stages
+}
 
-	correct := 0
-	total := len(testData)
+// Run starts the stages, feeds them the source chunks and returns once
+// every stage has stopped. A stage's input is buffered as the stage asks,
+// and closed once all the stages feeding it have closed their output. The
+// first error of any stage cancels every stage, and Run returns it; Run
+// also fails, before starting any stage, if the pipeline was built wrongly.
+// How often each producer stalled on a full buffer is logged at the end.
+// With a chunk controller, the source wines are sent in chunks of the size
+// it picks rather than in the chunks given.
+func (p *Pipeline) Run(ctx context.Context, source [][]Wine) error {
+	if p.err != nil {
+		return p.err
+	}
+	if len(p.branches) > 0 {
+		return fmt.Errorf("%d branches are never merged", len(p.branches))
+	}
+	for _, stage := range p.stages {
+		switch stage.policy {
+		case "", BackpressureBlock:
+		case BackpressureDropOldest, BackpressureDropNewest:
+			if stage.buffer < 1 {
+				return fmt.Errorf("stage %q: %s needs a buffer of at least 1 chunk", stage.name, stage.policy)
+			}
+		default:
+			return fmt.Errorf("stage %q: unknown backpressure policy %q", stage.name, stage.policy)
+		}
+	}
+	for _, stage := range p.stages {
+		stage.input = make(chan []Wine, max(stage.buffer, 0))
+	}
 
-	batchSize := 10
-	numBatches := (total + batchSize - 1) / batchSize
+	ctx, task := trace.NewTask(ctx, "pipeline")
+	defer task.End()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, 1)
+	var failed error
+	aborted := make(chan struct{})
+	go func() {
+		defer close(aborted)
+		select {
+		case failed = <-errs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
-	for batchNum := 0; batchNum < numBatches; batchNum++ {
-		start := batchNum * batchSize
-		end := math.Min(float64(start+batchSize), float64(total))
+	producers := make(map[*PipelineStage]*sync.WaitGroup)
+	for _, stage := range p.stages {
+		producers[stage] = &sync.WaitGroup{}
+	}
+	for _, root := range p.roots {
+		producers[root].Add(1)
+	}
+	for _, links := range p.next {
+		for _, link := range links {
+			producers[link.to].Add(1)
+		}
+	}
+	for stage, wg := range producers {
+		go func() {
+			wg.Wait()
+			close(stage.input)
+		}()
+	}
 
-		log.Printf("🔄 Processing prediction batch %d/%d (samples %d-%d)",
-			batchNum+1, numBatches, start, int(end)-1)
+	for _, stage := range p.stages {
+		stage.Run(ctx, errs)
+		go p.forward(ctx, stage.output, &stage.downstream, p.next[stage], producers)
+	}
+	var sourceLinks []link
+	for _, root := range p.roots {
+		sourceLinks = append(sourceLinks, link{to: root})
+	}
+	sourceOutput := make(chan []Wine)
+	var sourceFlow flow
+	go p.forward(ctx, sourceOutput, &sourceFlow, sourceLinks, producers)
+	go func() {
+		defer close(sourceOutput)
+		if p.chunking != nil {
+			p.chunking.feed(ctx, source, sourceOutput)
+			return
+		}
+		for _, chunk := range source {
+			select {
+			case sourceOutput <- chunk:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 
-		time.Sleep(500 * time.Millisecond)
+	for _, stage := range p.stages {
+		<-stage.done
+	}
+	sourceFlow.logStalls(logger, "Source")
+	if p.chunking != nil {
+		p.chunking.logSizes(logger)
+	}
+	for _, stage := range p.stages {
+		stage.downstream.logStalls(logger.With("stage", stage.name), "Stage ["+stage.name+"]")
+	}
+	cancel()
+	<-aborted
+	if failed == nil {
+		select {
+		case failed = <-errs:
+		default:
+		}
+	}
+	return failed
+}
 
-		for _, test := range testData[start:int(end)] {
-			prediction := predictSingle(test, trainData, k)
-			if prediction == test.quality {
-				correct++
+// forward sends every chunk of output to all of links, tagging the wines
+// of links into a merge stage with their branch and counting the sends in
+// stats, then tells the receiving stages that this producer is done.
+func (p *Pipeline) forward(ctx context.Context, output <-chan []Wine, stats *flow, links []link, producers map[*PipelineStage]*sync.WaitGroup) {
+	for chunk := range output {
+		for _, link := range links {
+			sent := chunk
+			if link.branch != "" {
+				sent = make([]Wine, len(chunk))
+				for i, wine := range chunk {
+					sent[i] = wine
+					sent[i].branch = link.branch
+				}
 			}
+			stats.record(link.to.offer(ctx, sent))
 		}
 	}
+	for _, link := range links {
+		producers[link.to].Done()
+	}
+}
 
-	accuracy := float64(correct) / float64(total)
-	log.Printf("✅ Prediction completed in %v - Final Accuracy: %.2f%%",
-		time.Since(start), accuracy*100)
+// safeProcess runs a stage function on data and, if it panics, writes a
+// diagnostics report and drops the input instead of crashing the pipeline.
+func (s *PipelineStage) safeProcess(data []Wine, run func() ([]Wine, error)) (result []Wine, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.With("stage", s.name).Error("💥 Stage [%s] panicked: %v", s.name, r)
+			writeStageReport(s.name, r, data)
+			result, err = nil, nil
+		}
+	}()
+	return run()
+}
 
-	return data
+type stageReport struct {
+	Time       time.Time `json:"time"`
+	Stage      string    `json:"stage"`
+	Panic      string    `json:"panic"`
+	Stack      string    `json:"stack"`
+	Samples    int       `json:"samples"`
+	FirstID    int       `json:"first_id"`
+	LastID     int       `json:"last_id"`
+	FeatureMin []float64 `json:"feature_min"`
+	FeatureMax []float64 `json:"feature_max"`
+	QualityMin int       `json:"quality_min"`
+	QualityMax int       `json:"quality_max"`
 }
 
-func predictSingle(test Wine, trainData []Wine, k int) int {
-	type neighbor struct {
-		distance float64
-		quality  int
+func writeStageReport(stage string, value interface{}, data []Wine) {
+	report := stageReport{
+		Time:    time.Now(),
+		Stage:   stage,
+		Panic:   fmt.Sprint(value),
+		Stack:   string(debug.Stack()),
+		Samples: len(data),
+	}
+	if len(data) > 0 {
+		report.FirstID, report.LastID = data[0].id, data[len(data)-1].id
+		report.QualityMin, report.QualityMax = data[0].quality, data[0].quality
+	}
+	for _, wine := range data {
+		for j, f := range wine.features {
+			if j >= len(report.FeatureMin) {
+				report.FeatureMin = append(report.FeatureMin, math.Inf(1))
+				report.FeatureMax = append(report.FeatureMax, math.Inf(-1))
+			}
+			// JSON cannot hold NaN or infinities, so they are left out.
+			if math.IsNaN(f) || math.IsInf(f, 0) {
+				continue
+			}
+			report.FeatureMin[j] = math.Min(report.FeatureMin[j], f)
+			report.FeatureMax[j] = math.Max(report.FeatureMax[j], f)
+		}
+		report.QualityMin = min(report.QualityMin, wine.quality)
+		report.QualityMax = max(report.QualityMax, wine.quality)
+	}
+	// Columns without a finite value report zeros.
+	for j := range report.FeatureMin {
+		if math.IsInf(report.FeatureMin[j], 0) {
+			report.FeatureMin[j], report.FeatureMax[j] = 0, 0
+		}
+	}
+
+	if diagnosticsDir == "" {
+		return
+	}
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(diagnosticsDir, 0o755)
 	}
+	path := filepath.Join(diagnosticsDir, fmt.Sprintf("stage-panic-%s-%s.json", report.Time.Format("20060102T150405"), strings.ReplaceAll(stage, " ", "-")))
+	if err == nil {
+		err = os.WriteFile(path, encoded, 0o644)
+	}
+	if err != nil {
+		logger.Error("❌ Failed to write diagnostics for stage [%s]: %v", stage, err)
+		return
+	}
+	logger.Info("🩺 Diagnostics for stage [%s] written to %s", stage, path)
+}
 
-	neighbors := make([]neighbor, len(trainData))
+func loadWineData(filename string, mapping dataset.Mapping, options dataset.Options) ([]Wine, error) {
+	logger.Info("📂 Starting data loading from %s", filename)
+	start := time.Now()
 
-	for i, train := range trainData {
-		dist := 0.0
-		for j := range train.features {
-			diff := test.features[j] - train.features[j]
-			dist += diff * diff
+	data, err := dataset.CSVLoader{Path: filename, Mapping: mapping, Options: options}.Load()
+	if err != nil {
+		return nil, err
+	}
+	if summary := data.Summary(); summary != "" {
+		logger.Warn("⚠️  %s", summary)
+	}
+	if options.Filter != "" {
+		logger.Info("🔎 Filter %q kept %d rows and dropped %d", options.Filter, data.Len(), data.Filtered())
+	}
+	if data.Len() == 0 {
+		switch {
+		case options.Filter != "":
+			return nil, fmt.Errorf("no rows match the filter %q", options.Filter)
+		case options.Missing == dataset.MissingDrop:
+			return nil, fmt.Errorf("no rows are left after dropping those with missing values")
 		}
-		neighbors[i] = neighbor{math.Sqrt(dist), train.quality}
+		return nil, fmt.Errorf("no rows")
 	}
+	featureNames = data.FeatureNames
 
-	for i := 0; i < len(neighbors)-1; i++ {
-		for j := i + 1; j < len(neighbors); j++ {
-			if neighbors[i].distance > neighbors[j].distance {
-				neighbors[i], neighbors[j] = neighbors[j], neighbors[i]
+	wines := make([]Wine, data.Len())
+	for i, features := range data.X {
+		wines[i] = Wine{id: i + 1, features: features, weight: data.Weight(i)}
+		if data.Y[i] != math.Trunc(data.Y[i]) {
+			return nil, fmt.Errorf("wine %d: quality %g is not a whole number", i+1, data.Y[i])
+		}
+		wines[i].quality = int(data.Y[i])
+		if data.IDs != nil {
+			if wines[i].id, err = strconv.Atoi(strings.TrimSpace(data.IDs[i])); err != nil {
+				return nil, fmt.Errorf("wine %d: id: %v", i+1, err)
 			}
 		}
 	}
 
-	qualityCounts := make(map[int]int)
-	for i := 0; i < k; i++ {
-		qualityCounts[neighbors[i].quality]++
+	logger.With("duration_ms", logging.Milliseconds(time.Since(start))).Info("✅ Data loading completed in %v. Loaded %d samples", time.Since(start), len(wines))
+	return wines, nil
+}
+
+// standardizer scales every feature to zero mean and unit variance. The
+// statistics are fitted on the training wines before the wines stream
+// through the pipeline, so the test wines play no part in them; the stage
+// only applies them, chunk by chunk.
+type standardizer struct {
+	scaler preprocess.StandardScaler
+	total  int
+}
+
+func fitStandardizer(train []Wine, total int) (*standardizer, error) {
+	if len(train) == 0 {
+		return nil, fmt.Errorf("no training wines")
+	}
+	logger.Info("📊 Fitting means and standard deviations of %d features on %d training wines", len(train[0].features), len(train))
+	s := &standardizer{total: total}
+	if err := s.scaler.Fit(wineFeatures(train)); err != nil {
+		return nil, err
+	}
+	featureMeans, featureStds = s.scaler.Means, s.scaler.Stds
+	return s, nil
+}
+
+func (s *standardizer) process(ctx context.Context, chunk []Wine) ([]Wine, error) {
+	if !sleep(ctx, prorate(2*time.Second, len(chunk), s.total)) {
+		return nil, ctx.Err()
+	}
+	return transformWines(chunk, &s.scaler, len(s.scaler.Means))
+}
+
+// minMaxScaler scales every feature to the range [0, 1] of the training
+// wines, fitted like standardizer before they stream.
+type minMaxScaler struct {
+	scaler preprocess.MinMaxScaler
+	total  int
+}
+
+func fitMinMaxScaler(train []Wine, total int) (*minMaxScaler, error) {
+	s := &minMaxScaler{total: total}
+	if err := s.scaler.Fit(wineFeatures(train)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *minMaxScaler) process(ctx context.Context, chunk []Wine) ([]Wine, error) {
+	if !sleep(ctx, prorate(2*time.Second, len(chunk), s.total)) {
+		return nil, ctx.Err()
+	}
+	return transformWines(chunk, &s.scaler, len(s.scaler.Mins))
+}
+
+// wineFeatures returns the features of every wine.
+func wineFeatures(wines []Wine) [][]float64 {
+	rows := make([][]float64, len(wines))
+	for i, wine := range wines {
+		rows[i] = wine.features
 	}
+	return rows
+}
 
-	maxCount := 0
-	prediction := 0
-	for quality, count := range qualityCounts {
-		if count > maxCount {
-			maxCount = count
-			prediction = quality
+// transformWines returns copies of chunk with their features transformed by
+// t, which was fitted on wines with n features.
+func transformWines(chunk []Wine, t preprocess.Transformer, n int) ([]Wine, error) {
+	for _, wine := range chunk {
+		if len(wine.features) != n {
+			return nil, fmt.Errorf("wine %d has %d features, the scaler was fitted on %d", wine.id, len(wine.features), n)
 		}
 	}
+	rows := t.Transform(wineFeatures(chunk))
+	scaled := make([]Wine, len(chunk))
+	for i, wine := range chunk {
+		scaled[i] = wine
+		scaled[i].features = rows[i]
+	}
+	return scaled, nil
+}
 
-	return prediction
+// splitter puts the first trainSize wines of the stream in the training set
+// and the rest in the test set. The wines are shuffled before they are
+// streamed, so this is a random split that needs no more than one chunk.
+type splitter struct {
+	trainSize, total int
+	seen             int
 }
 
-func main() {
-	log.Printf("🚀 Starting Wine Quality Pipeline Pattern Demo")
-	log.Printf("============================================")
+func (s *splitter) process(ctx context.Context, chunk []Wine) ([]Wine, error) {
+	if s.seen+len(chunk) > s.total {
+		return nil, fmt.Errorf("received more than the %d wines the split was sized for", s.total)
+	}
+	if !sleep(ctx, prorate(1*time.Second, len(chunk), s.total)) {
+		return nil, ctx.Err()
+	}
 
-	data, err := loadWineData("/workspaces/gopherConAU/winequality-dataset.csv")
-	if err != nil {
-		log.Fatalf("❌ Error loading data: %v", err)
+	split := make([]Wine, len(chunk))
+	for i, wine := range chunk {
+		split[i] = wine
+		split[i].holdout = s.seen >= s.trainSize
+		s.seen++
 	}
+	if s.seen == s.total {
+		logger.Info("✅ Dataset split completed - Training: %d samples, Test: %d samples", s.trainSize, s.total-s.trainSize)
+	}
+	return split, nil
+}
+
+// knnTrainer builds the KNN reference set from the training wines, which
+// come first in the stream, and holds the test wines back until it is
+// complete; from then on they are passed on as they arrive.
+type knnTrainer struct {
+	branch       string
+	log          *logging.Logger
+	k, trainSize int
+
+	all       []Wine // every wine seen, for cross-validation and explanations
+	trainData []Wine // the KNN reference set, after noise and reduction
+	testData  []Wine
+	fullSize  int          // reference set size before reduction
+	index     *kdtree.Tree // over trainData, unless neighborSearch is brute
+	ready     bool
+	pending   []Wine // test wines held back until the reference set is ready
+	start     time.Time
+}
+
+func newKNNTrainer(branch string, k, trainSize int) *knnTrainer {
+	return &knnTrainer{branch: branch, log: logger.With("branch", branch), k: k, trainSize: trainSize}
+}
 
-	stages := []*PipelineStage{
-		NewPipelineStage("Standardization", standardize),
-		NewPipelineStage("Dataset Split", splitDataset),
-		NewPipelineStage("Quality Prediction", predictQuality),
+func (t *knnTrainer) process(ctx context.Context, chunk []Wine) ([]Wine, error) {
+	if t.start.IsZero() {
+		t.log.Info("🔄 Starting KNN prediction process")
+		voting := "majority"
+		if distanceWeighted {
+			voting = "distance-weighted"
+		}
+		t.log.Info("📈 Training KNN model with k=%d, %s distance and %s votes", t.k, metricName(), voting)
+		t.start = time.Now()
 	}
+	training := 0
+	for _, wine := range chunk {
+		if !wine.repeat {
+			t.all = append(t.all, wine)
+		}
+		if wine.holdout {
+			t.testData = append(t.testData, wine)
+			t.pending = append(t.pending, wine)
+		} else {
+			t.trainData = append(t.trainData, wine)
+			training++
+		}
+	}
+	if !sleep(ctx, prorate(1*time.Second, training, t.trainSize)) {
+		return nil, ctx.Err()
+	}
+	if !t.ready && len(t.trainData) == t.trainSize {
+		if err := t.prepare(); err != nil {
+			return nil, err
+		}
+	}
+	if !t.ready {
+		return nil, nil
+	}
+	released := t.pending
+	t.pending = nil
+	return released, nil
+}
 
-	log.Printf("🔗 Setting up pipeline with %d stages", len(stages))
+// prepare applies the training noise and reduction to the complete
+// reference set.
+func (t *knnTrainer) prepare() error {
+	if len(t.trainData) == 0 {
+		return fmt.Errorf("no training wines")
+	}
+	if trainingNoise.Enabled() {
+		t.trainData = addNoise(t.trainData)
+	}
+	t.fullSize = len(t.trainData)
+	if reduction != "" {
+		t.trainData = reduceReferenceSet(t.trainData, t.k, reduction)
+	}
+	if len(t.trainData) == 0 {
+		return fmt.Errorf("the %s reduction left no reference wines", reduction)
+	}
+	if neighborSearch == SearchKDTree {
+		start := time.Now()
+		t.index = newReferenceIndex(t.trainData)
+		t.log.With("duration_ms", logging.Milliseconds(time.Since(start))).Info("🌳 Built KD-tree over %d reference samples in %v", len(t.trainData), time.Since(start))
+	}
+	t.ready = true
+	t.log.Info("📈 KNN reference set complete with %d samples", len(t.trainData))
+	return nil
+}
 
-	for _, stage := range stages {
-		stage.Run()
+// finish releases any test wines still held back.
+func (t *knnTrainer) finish(ctx context.Context) ([]Wine, error) {
+	if ctx.Err() != nil {
+		return nil, nil
+	}
+	if !t.ready {
+		if err := t.prepare(); err != nil {
+			return nil, err
+		}
 	}
+	released := t.pending
+	t.pending = nil
+	return released, nil
+}
 
-	log.Printf("🔄 Connecting pipeline stages")
-	for i := 0; i < len(stages)-1; i++ {
-		currentStage := stages[i]
-		nextStage := stages[i+1]
-		go func() {
-			for result := range currentStage.output {
-				nextStage.input <- result
-			}
-			close(nextStage.input)
-		}()
+// knnScorer predicts the quality probabilities of test wines against the
+// trainer's reference set, which is complete before any test wine reaches
+// it. It holds no other state, so any number of workers can share it.
+type knnScorer struct {
+	trainer *knnTrainer
+}
+
+const predictionBatchSize = 10
+
+func (s knnScorer) process(ctx context.Context, chunk []Wine) ([]Wine, error) {
+	scored := make([]Wine, len(chunk))
+	copy(scored, chunk)
+	model := KNN{Reference: s.trainer.trainData, K: s.trainer.k, Index: s.trainer.index}
+	for start := 0; start < len(scored); start += predictionBatchSize {
+		batch := scored[start:min(start+predictionBatchSize, len(scored))]
+		if !sleep(ctx, prorate(500*time.Millisecond, len(batch), predictionBatchSize)) {
+			return nil, ctx.Err()
+		}
+		features := make([][]float64, len(batch))
+		for i, test := range batch {
+			features[i] = test.features
+		}
+		for i, probabilities := range model.probaBatch(features) {
+			batch[i].probabilities = probabilities
+		}
 	}
+	return scored, nil
+}
 
-	totalStart := time.Now()
-	log.Printf("⚡ Initiating data flow through pipeline")
+// qualityMetrics accumulates the accuracy, confusion matrix, log-loss and
+// calibration of scored test wines.
+type qualityMetrics struct {
+	scored, correct                       int
+	weightedCorrect, totalWeight, logLoss float64
+	calibration                           [10]calibrationBin
+	confusion                             *metrics.Confusion
+	tests                                 []Wine // the scored wines, kept for the cost-sensitive evaluation
+	// outcomes holds {quality, prediction} by wine id, for comparing branches.
+	outcomes map[int][2]float64
+}
+
+func (m *qualityMetrics) add(test Wine) {
+	prediction, confidence := mostLikely(test.probabilities)
+	m.confusion.Add(float64(test.quality), float64(prediction))
+	m.outcomes[test.id] = [2]float64{float64(test.quality), float64(prediction)}
+	if costMatrix != nil {
+		m.tests = append(m.tests, test)
+	}
 
-	stages[0].input <- data
-	close(stages[0].input)
+	m.logLoss -= math.Log(math.Max(test.probabilities[test.quality], 1e-15))
+	bin := &m.calibration[min(int(confidence*10), 9)]
+	bin.count++
+	bin.confidence += confidence
 
-	<-stages[len(stages)-1].output
+	if prediction == test.quality {
+		m.correct++
+		m.weightedCorrect += test.weight
+		bin.correct++
+	}
+	m.totalWeight += test.weight
+	m.scored++
+}
+
+func (m *qualityMetrics) accuracy() float64 {
+	return float64(m.correct) / float64(m.scored)
+}
+
+// qualityEvaluator is where the pipeline's branches merge: it accumulates
+// the metrics of every branch's scored test wines and reports them once all
+// have arrived. The explanations run on the first branch, whose features
+// are standardized.
+type qualityEvaluator struct {
+	trainers []*knnTrainer // one per branch, in the order reported
+	testSize int
+	metrics  map[string]*qualityMetrics
+}
+
+func newQualityEvaluator(testSize int, trainers ...*knnTrainer) *qualityEvaluator {
+	e := &qualityEvaluator{trainers: trainers, testSize: testSize, metrics: make(map[string]*qualityMetrics)}
+	for _, t := range trainers {
+		e.metrics[t.branch] = &qualityMetrics{confusion: metrics.New(nil, nil), outcomes: make(map[int][2]float64)}
+	}
+	return e
+}
+
+func (e *qualityEvaluator) process(ctx context.Context, chunk []Wine) ([]Wine, error) {
+	for _, test := range chunk {
+		metrics, ok := e.metrics[test.branch]
+		if !ok {
+			return nil, fmt.Errorf("wine %d came through unknown branch %q", test.id, test.branch)
+		}
+		if test.probabilities == nil {
+			return nil, fmt.Errorf("wine %d was not scored", test.id)
+		}
+		metrics.add(test)
+	}
+	return nil, nil
+}
+
+// finish reports the metrics. If ctx is cancelled, they cover the wines
+// scored so far.
+func (e *qualityEvaluator) finish(ctx context.Context) ([]Wine, error) {
+	for _, t := range e.trainers {
+		e.report(ctx, t)
+	}
 
-	log.Printf("✨ Pipeline execution completed in %v", time.Since(totalStart))
-	log.Printf("============================================")
+	if ctx.Err() != nil {
+		return nil, nil
+	}
+	if len(e.trainers) > 1 {
+		// Branches whose test wines were all dropped have no accuracy.
+		var best *knnTrainer
+		var scores []string
+		for _, t := range e.trainers {
+			if e.metrics[t.branch].scored == 0 {
+				continue
+			}
+			if best == nil || e.metrics[t.branch].accuracy() > e.metrics[best.branch].accuracy() {
+				best = t
+			}
+			scores = append(scores, fmt.Sprintf("%s %.2f%%", t.branch, e.metrics[t.branch].accuracy()*100))
+		}
+		if best != nil {
+			logger.Info("🏆 Best scaling: %s (%s)", best.branch, strings.Join(scores, ", "))
+			e.compareBranches(best)
+		}
+	}
+
+	t := e.trainers[0]
+	logBaselines(t.trainData, t.testData)
+	if crossValidation.Folds > 0 {
+		crossValidate(t.all, t.k)
+	}
+	if len(dependenceFeatures) > 0 {
+		explainQuality(t.trainData, t.testData, t.k)
+	}
+	if counterfactualID >= 0 {
+		explainWine(t.all, t.trainData, t.k)
+	}
+	if robustnessAttack != "" {
+		checkRobustness(t.trainData, t.testData, t.k)
+	}
+	if compareOrdinal {
+		compareOrdinalRegression(t.trainData, t.testData)
+	}
+	return nil, nil
+}
+
+// compareBranches logs whether the best branch is significantly more
+// accurate than each other one, by McNemar's test on the test wines both
+// scored.
+func (e *qualityEvaluator) compareBranches(best *knnTrainer) {
+	bestOutcomes := e.metrics[best.branch].outcomes
+	for _, t := range e.trainers {
+		if t == best || e.metrics[t.branch].scored == 0 {
+			continue
+		}
+		var ids []int
+		for id := range e.metrics[t.branch].outcomes {
+			if _, ok := bestOutcomes[id]; ok {
+				ids = append(ids, id)
+			}
+		}
+		sort.Ints(ids)
+		labels, ours, theirs := make([]float64, len(ids)), make([]float64, len(ids)), make([]float64, len(ids))
+		for i, id := range ids {
+			labels[i], ours[i] = bestOutcomes[id][0], bestOutcomes[id][1]
+			theirs[i] = e.metrics[t.branch].outcomes[id][1]
+		}
+		test, onlyBest, onlyOther, err := metrics.McNemar(labels, ours, theirs)
+		if err != nil {
+			logger.Error("❌ Cannot compare %s with %s: %v", best.branch, t.branch, err)
+			continue
+		}
+		verdict := "not significant"
+		if test.Significant(0.05) {
+			verdict = "significant"
+		}
+		logger.Info("🔬 %s vs %s on %d test wines: %d right only by %s, %d only by %s; %s (%s at 5%%)",
+			best.branch, t.branch, len(ids), onlyBest, best.branch, onlyOther, t.branch, test, verdict)
+	}
+}
+
+// report logs the metrics of one branch.
+func (e *qualityEvaluator) report(ctx context.Context, t *knnTrainer) {
+	m := e.metrics[t.branch]
+	if ctx.Err() != nil {
+		t.log.Warn("🛑 Prediction interrupted after %d of %d test samples", m.scored, e.testSize)
+	} else if m.scored < e.testSize {
+		t.log.Warn("🗑️  Only %d of %d test samples were scored; the others were dropped under backpressure", m.scored, e.testSize)
+	}
+	total := m.scored
+	if total == 0 {
+		return
+	}
+	accuracy := m.accuracy()
+	t.log.With("duration_ms", logging.Milliseconds(time.Since(t.start))).Info("✅ Prediction completed in %v - Final Accuracy: %.2f%%",
+		time.Since(t.start), accuracy*100)
+	t.log.Info("⚖️  Weighted Accuracy: %.2f%%", m.weightedCorrect/m.totalWeight*100)
+	if reduction != "" {
+		t.log.Info("✂️  Size/accuracy trade-off: %.2f%% accuracy with %d of %d reference samples (%.1f%%)",
+			accuracy*100, len(t.trainData), t.fullSize, float64(len(t.trainData))/float64(t.fullSize)*100)
+	}
+	t.log.Info("📉 Log-loss: %.4f", m.logLoss/float64(total))
+	t.log.Info("🪜 Mean absolute error on quality ranks: %.3f", m.confusion.RankMAE())
+
+	var scores strings.Builder
+	m.confusion.Report().Print(&scores)
+	t.log.Info("🧮 Confusion matrix and scores by quality:")
+	for _, line := range strings.Split(scores.String(), "\n") {
+		if line != "" {
+			t.log.Info("   %s", line)
+		}
+	}
+	if costMatrix != nil {
+		reportCosts(t.log, m)
+	}
+
+	expectedCalibrationError := 0.0
+	t.log.Info("📏 Calibration (confidence bin: mean confidence vs accuracy):")
+	for i, bin := range m.calibration {
+		if bin.count == 0 {
+			continue
+		}
+		meanConfidence := bin.confidence / float64(bin.count)
+		binAccuracy := float64(bin.correct) / float64(bin.count)
+		expectedCalibrationError += math.Abs(meanConfidence-binAccuracy) * float64(bin.count) / float64(total)
+		t.log.Info("   %.1f-%.1f: %.3f vs %.3f (%d samples)", float64(i)/10, float64(i+1)/10, meanConfidence, binAccuracy, bin.count)
+	}
+	t.log.Info("📏 Expected calibration error: %.4f", expectedCalibrationError)
+}
+
+// costMatrix prices every misclassification for the cost-sensitive
+// evaluation, which is skipped when it is nil. Qualities from highQuality
+// up count as high for its cost-optimal threshold.
+var (
+	costMatrix  *metrics.Costs
+	highQuality = 7
+)
+
+// reportCosts logs the expected cost per test wine of the predicted
+// qualities under costMatrix, and how much less it could be. Predicting the
+// quality with the least expected cost rather than the most likely one
+// minimizes it when the KNN probabilities are calibrated; the threshold on
+// the probability of a high quality that costs least on the test wines
+// shows how sure the model has to be before a high quality pays off.
+func reportCosts(log *logging.Logger, m *qualityMetrics) {
+	var classes, high, low []float64
+	seen := make(map[int]bool)
+	for _, test := range m.tests {
+		for quality := range test.probabilities {
+			seen[quality] = true
+		}
+		seen[test.quality] = true
+	}
+	for quality := range seen {
+		classes = append(classes, float64(quality))
+		if quality >= highQuality {
+			high = append(high, float64(quality))
+		} else {
+			low = append(low, float64(quality))
+		}
+	}
+	sort.Float64s(classes)
+
+	decided := metrics.New(nil, nil)
+	n := len(m.tests)
+	labels, scores := make([]float64, n), make([]float64, n)
+	ifHigh, ifLow := make([]float64, n), make([]float64, n)
+	for i, test := range m.tests {
+		probabilities := make(map[float64]float64, len(test.probabilities))
+		for quality, p := range test.probabilities {
+			probabilities[float64(quality)] = p
+			if quality >= highQuality {
+				scores[i] += p
+			}
+		}
+		labels[i] = float64(test.quality)
+		decided.Add(labels[i], costMatrix.Decide(probabilities, classes))
+		// Each side of the threshold predicts its cheapest quality.
+		ifHigh[i], ifLow[i] = costMatrix.Decide(probabilities, high), costMatrix.Decide(probabilities, low)
+	}
+	log.Info("💸 Expected cost per wine: %.4f predicting the most likely quality, %.4f predicting the cheapest in expectation",
+		m.confusion.Cost(costMatrix), decided.Cost(costMatrix))
+
+	if len(high) == 0 || len(low) == 0 {
+		log.Info("💸 No cost-optimal threshold: every quality seen is on one side of %d", highQuality)
+		return
+	}
+	curve, err := metrics.CostCurve(labels, scores, ifHigh, ifLow, costMatrix)
+	if err != nil {
+		log.Error("❌ No cost curve: %v", err)
+		return
+	}
+	best := metrics.Cheapest(curve)
+	if math.IsInf(best.Threshold, 1) {
+		log.Info("💸 Cost-optimal threshold: never predicting quality %d or more, at %.4f per wine", highQuality, best.Cost)
+		return
+	}
+	log.Info("💸 Cost-optimal threshold: predict quality %d or more once its probability reaches %.3f, at %.4f per wine",
+		highQuality, best.Threshold, best.Cost)
+}
+
+// featureNames names the features of the loaded wines, in order, and
+// featureMeans and featureStds undo their standardization.
+var (
+	featureNames []string
+	featureMeans []float64
+	featureStds  []float64
+)
+
+// dependenceFeatures lists the features whose partial dependence and ICE
+// curves are charted to dependenceOut, over at most dependenceSamples test
+// wines; empty skips the charts.
+var (
+	dependenceFeatures []string
+	dependenceOut      = "partial-dependence.html"
+	dependenceSamples  = 50
+)
+
+// explainQuality charts how the KNN model's expected quality responds to each
+// of dependenceFeatures. Features are in standardized units.
+func explainQuality(trainData, testData []Wine, k int) {
+	logger.Info("🔍 Computing partial dependence of quality on %s", strings.Join(dependenceFeatures, ", "))
+	start := time.Now()
+
+	model := explain.EstimatorFunc(func(features []float64) float64 {
+		expected := 0.0
+		for quality, p := range predictProba(Wine{features: features}, trainData, k) {
+			expected += float64(quality) * p
+		}
+		return expected
+	})
+	rows := make([][]float64, 0, dependenceSamples)
+	for _, wine := range testData {
+		if len(rows) == dependenceSamples {
+			break
+		}
+		rows = append(rows, wine.features)
+	}
+
+	var dependences []explain.Dependence
+	for _, name := range dependenceFeatures {
+		feature := -1
+		for j, n := range featureNames {
+			if n == name {
+				feature = j
+			}
+		}
+		if feature < 0 {
+			logger.Error("❌ No feature %q (features: %s)", name, strings.Join(featureNames, ", "))
+			continue
+		}
+		grid, err := explain.Grid(rows, feature, 20)
+		if err != nil {
+			logger.Error("❌ Cannot explain %s: %v", name, err)
+			continue
+		}
+		dependence := explain.PartialDependence(model, rows, feature, name+" (standardized)", grid)
+		dependences = append(dependences, dependence)
+		logger.Info("📈 %s: expected quality %.2f at %.2f to %.2f at %.2f", name,
+			dependence.Average[0], grid[0], dependence.Average[len(grid)-1], grid[len(grid)-1])
+	}
+	if len(dependences) == 0 {
+		return
+	}
+
+	if err := explain.RenderDependence(dependenceOut, "expected quality", dependences, dependenceSamples); err != nil {
+		logger.Error("❌ Failed to write partial dependence chart: %v", err)
+		return
+	}
+	logger.With("duration_ms", logging.Milliseconds(time.Since(start))).Info("✅ Partial dependence chart written to %s in %v", dependenceOut, time.Since(start))
+}
+
+func predictSingle(test Wine, trainData []Wine, k int) int {
+	prediction, _ := mostLikely(predictProba(test, trainData, k))
+	return prediction
+}
+
+// mostLikely returns the class with the highest probability and that
+// probability, preferring the lower quality on ties.
+func mostLikely(probabilities map[int]float64) (int, float64) {
+	prediction, confidence := 0, 0.0
+	for quality, p := range probabilities {
+		if p > confidence || (p == confidence && quality < prediction) {
+			prediction, confidence = quality, p
+		}
+	}
+	return prediction, confidence
+}
+
+// trainingNoise corrupts the KNN reference set before prediction, leaving
+// the test wines clean.
+var trainingNoise dataset.Noise
+
+// addNoise returns a copy of the wines corrupted as trainingNoise describes.
+func addNoise(wines []Wine) []Wine {
+	clean := &dataset.Dataset{}
+	for _, wine := range wines {
+		clean.X = append(clean.X, wine.features)
+		clean.Y = append(clean.Y, float64(wine.quality))
+	}
+	noisy, corrupted := trainingNoise.Apply(clean)
+
+	corruptedWines := make([]Wine, len(wines))
+	for i, wine := range wines {
+		wine.features, wine.quality = noisy.X[i], int(noisy.Y[i])
+		corruptedWines[i] = wine
+	}
+	logger.Info("🌪️  Corrupted training wines: feature noise %.2f std, %d of %d qualities replaced",
+		trainingNoise.Features, corrupted, len(wines))
+	return corruptedWines
+}
+
+// compareOrdinal fits an ordinal regression after the pipeline and compares
+// it with plain regression on the test wines.
+var compareOrdinal = false
+
+// compareOrdinalRegression fits a proportional odds model of quality, which
+// knows that qualities are ordered, and a least squares regression rounded
+// to the nearest quality, which treats them as evenly spaced numbers, on the
+// training wines, and logs the accuracy and the mean absolute error on
+// quality ranks of each on the test wines, to set beside the KNN's.
+func compareOrdinalRegression(trainData, testData []Wine) {
+	logger.Info("🪜 Fitting ordinal regression on %d training wines", len(trainData))
+	start := time.Now()
+	X, y := wineFeatures(trainData), make([]float64, len(trainData))
+	for i, wine := range trainData {
+		y[i] = float64(wine.quality)
+	}
+	model := &ordinal.Model{}
+	if err := model.Fit(X, y); err != nil {
+		logger.Error("❌ Ordinal regression failed: %v", err)
+		return
+	}
+	logger.With("duration_ms", logging.Milliseconds(time.Since(start))).Info(
+		"✅ Ordinal regression fitted in %v, log-loss %.4f, cutpoints %.2f", time.Since(start), model.Loss, model.Cutpoints)
+
+	// Least squares with an intercept, by the normal equations.
+	design := mat.NewDense(len(X), len(X[0])+1, nil)
+	for i, row := range X {
+		design.Set(i, 0, 1)
+		for j, value := range row {
+			design.Set(i, j+1, value)
+		}
+	}
+	var coefficients mat.VecDense
+	if err := coefficients.SolveVec(design, mat.NewVecDense(len(y), y)); err != nil {
+		logger.Error("❌ Least squares regression failed: %v", err)
+		return
+	}
+	low, high := floats.Min(y), floats.Max(y)
+
+	labels := make([]float64, len(testData))
+	ordinalPredictions, linearPredictions := make([]float64, len(testData)), make([]float64, len(testData))
+	for i, wine := range testData {
+		labels[i] = float64(wine.quality)
+		ordinalPredictions[i] = model.Classify(wine.features)
+		score := coefficients.AtVec(0) + floats.Dot(coefficients.RawVector().Data[1:], wine.features)
+		linearPredictions[i] = math.Max(low, math.Min(high, math.Round(score)))
+	}
+	for _, result := range []struct {
+		name      string
+		confusion *metrics.Confusion
+	}{{"ordinal regression", metrics.New(labels, ordinalPredictions)}, {"rounded linear regression", metrics.New(labels, linearPredictions)}} {
+		logger.Info("🪜 %s: accuracy %.2f%%, mean absolute error on quality ranks %.3f",
+			result.name, result.confusion.Report().Accuracy*100, result.confusion.RankMAE())
+	}
+	if test, onlyOrdinal, onlyLinear, err := metrics.McNemar(labels, ordinalPredictions, linearPredictions); err == nil {
+		logger.Info("🔬 %d test wines right only by ordinal regression, %d only by linear: %s", onlyOrdinal, onlyLinear, test)
+	}
+}
+
+// logBaselines logs how the trivial models fitted on the training wines
+// score on the test wines, the floor every branch's metrics should be read
+// against: the most frequent training quality for every wine, and the mean
+// training quality.
+func logBaselines(trainData, testData []Wine) {
+	X, y := wineFeatures(trainData), make([]float64, len(trainData))
+	for i, wine := range trainData {
+		y[i] = float64(wine.quality)
+	}
+	majority, mean := &baseline.Classifier{}, &baseline.Regressor{}
+	if err := majority.Fit(X, y); err != nil {
+		logger.Error("❌ Baselines failed: %v", err)
+		return
+	}
+	if err := mean.Fit(X, y); err != nil {
+		logger.Error("❌ Baselines failed: %v", err)
+		return
+	}
+	confusion := metrics.New(nil, nil)
+	squared := 0.0
+	for _, wine := range testData {
+		label := float64(wine.quality)
+		confusion.Add(label, majority.Class)
+		squared += (label - mean.Value) * (label - mean.Value)
+	}
+	logger.Info("🧱 Baselines on %d test wines: majority quality %.0f has accuracy %.2f%% and mean absolute error on quality ranks %.3f; mean quality %.2f has MSE %.4f",
+		len(testData), majority.Class, confusion.Report().Accuracy*100, confusion.RankMAE(), mean.Value, squared/float64(len(testData)))
+}
+
+// crossValidation configures the k-fold estimate of accuracy reported
+// alongside the single train/test split; zero folds skip it.
+var crossValidation = crossval.Options{Folds: 5, Stratified: true, Seed: 1}
+
+// foldKNN is KNN behind a standardization fitted on each fold's training
+// wines, so that no fold is scaled by statistics of its test wines.
+type foldKNN struct {
+	KNN
+	scaler preprocess.StandardScaler
+}
+
+func (m *foldKNN) Fit(X [][]float64, y []float64) error {
+	X, err := preprocess.FitTransform(&m.scaler, X)
+	if err != nil {
+		return err
+	}
+	return m.KNN.Fit(X, y)
+}
+
+func (m *foldKNN) Predict(X [][]float64) []float64 {
+	return m.KNN.Predict(m.scaler.Transform(X))
+}
+
+// crossValidate logs the accuracy of KNN with k neighbors on every fold of
+// the wines, and its mean and spread.
+func crossValidate(wines []Wine, k int) {
+	logger.Info("🔁 Cross-validating over %d folds", crossValidation.Folds)
+	start := time.Now()
+
+	X := make([][]float64, len(wines))
+	y := make([]float64, len(wines))
+	for i, wine := range wines {
+		X[i], y[i] = wine.features, float64(wine.quality)
+	}
+	folds, err := crossValidation.Assign(y)
+	if err != nil {
+		logger.Error("❌ Cannot assign folds: %v", err)
+		return
+	}
+	report, err := crossval.Evaluate(func() crossval.Model { return &foldKNN{KNN: KNN{K: k}} }, X, y, folds, crossValidation.Metrics...)
+	if err != nil {
+		logger.Error("❌ Cross-validation failed: %v", err)
+		return
+	}
+	majority, err := crossval.Evaluate(func() crossval.Model { return &baseline.Classifier{} }, X, y, folds)
+	if err != nil {
+		logger.Error("❌ Cross-validation failed: %v", err)
+		return
+	}
+	for _, fold := range report.Folds {
+		logger.With("fold", fold.Fold+1).Info("   fold %d: %.2f%% accuracy on %d wines", fold.Fold+1, fold.Accuracy*100, fold.Test)
+	}
+	logger.With("duration_ms", logging.Milliseconds(time.Since(start))).Info(
+		"✅ Cross-validated accuracy %.2f%% ± %.2f%%, against %.2f%% for the majority quality", report.MeanAccuracy*100, report.StdAccuracy*100, majority.MeanAccuracy*100)
+	for _, m := range report.Metrics {
+		logger.With("metric", m.Name).Info("   %s %.4f ± %.4f", m.Name, m.Mean, m.Std)
+	}
+	tests, err := crossval.Compare(report, majority, func(s crossval.FoldScore) float64 { return s.Accuracy })
+	if err != nil {
+		logger.Error("❌ Cannot compare with the majority quality: %v", err)
+		return
+	}
+	for _, test := range tests {
+		logger.Info("🔬 KNN vs majority quality over %d folds: %s", len(report.Folds), test)
+	}
+}
+
+// distanceWeighted makes closer neighbors count more in predictProba.
+var distanceWeighted = false
+
+// Distance metrics between wines. Minkowski distances take their order from
+// minkowskiP; the Manhattan and Euclidean distances are those of order 1
+// and 2. The cosine distance, one minus the cosine similarity, ignores how
+// far a wine is from the mean wine and compares only the direction.
+const (
+	MetricEuclidean = "euclidean"
+	MetricManhattan = "manhattan"
+	MetricMinkowski = "minkowski"
+	MetricCosine    = "cosine"
+)
+
+// distanceMetric selects how far apart KNN considers two wines.
+var (
+	distanceMetric = MetricEuclidean
+	minkowskiP     = 3.0
+)
+
+// minkowskiOrder returns the order of the Minkowski distance distanceMetric
+// stands for; the cosine distance is measured as half the squared Euclidean
+// distance between unit vectors.
+func minkowskiOrder() float64 {
+	switch distanceMetric {
+	case MetricManhattan:
+		return 1
+	case MetricMinkowski:
+		return minkowskiP
+	default:
+		return 2
+	}
+}
+
+// metricName describes distanceMetric for logs.
+func metricName() string {
+	if distanceMetric == MetricMinkowski {
+		return fmt.Sprintf("%s (p=%g)", distanceMetric, minkowskiP)
+	}
+	return distanceMetric
+}
+
+// metricPoint returns the point that stands for features in the metric
+// space: the features scaled to unit length for the cosine distance, where
+// a wine at the mean stays at the origin, and the features themselves
+// otherwise.
+func metricPoint(features []float64) []float64 {
+	if distanceMetric != MetricCosine {
+		return features
+	}
+	norm := floats.Norm(features, 2)
+	if norm == 0 {
+		return features
+	}
+	unit := append([]float64(nil), features...)
+	floats.Scale(1/norm, unit)
+	return unit
+}
+
+// metricDistance converts the distance between two metric points into the
+// distance of distanceMetric.
+func metricDistance(d float64) float64 {
+	if distanceMetric == MetricCosine {
+		return d * d / 2
+	}
+	return d
+}
+
+// wineDistance returns the distance between two wines' features.
+func wineDistance(a, b []float64) float64 {
+	return metricDistance(kdtree.Minkowski(metricPoint(a), metricPoint(b), minkowskiOrder()))
+}
+
+// Neighbor searches: the prediction stage finds the nearest reference wines
+// either in a KD-tree built once over the reference set, or by measuring
+// the distance to every one of them.
+const (
+	SearchKDTree = "kdtree"
+	SearchBrute  = "brute"
+)
+
+// neighborSearch selects the neighbor search of the prediction stage and
+// cross-validation.
+var neighborSearch = SearchKDTree
+
+// newReferenceIndex builds a KD-tree over the features of reference in
+// distanceMetric.
+func newReferenceIndex(reference []Wine) *kdtree.Tree {
+	points := make([][]float64, len(reference))
+	for i, wine := range reference {
+		points[i] = metricPoint(wine.features)
+	}
+	return kdtree.NewMinkowski(points, minkowskiOrder())
+}
+
+// predictProba estimates class probabilities for test from its k nearest
+// neighbors: each votes with its sample weight (divided by its distance when
+// distanceWeighted is set) and the votes are normalized to sum to one.
+func predictProba(test Wine, trainData []Wine, k int) map[int]float64 {
+	return KNN{Reference: trainData, K: k}.probaBatch([][]float64{test.features})[0]
+}
+
+// KNN predicts the quality of a wine by a vote of its K nearest reference
+// wines, as predictProba describes. They are looked up in Index, if set,
+// which must be built over the features of Reference, in order.
+type KNN struct {
+	Reference []Wine
+	K         int
+	Index     *kdtree.Tree
+}
+
+// Fit makes the rows of X, with the qualities in y, the reference set, each
+// with weight one. Noise and reduction are applied as in the prediction stage.
+func (m *KNN) Fit(X [][]float64, y []float64) error {
+	m.Reference = make([]Wine, len(X))
+	for i, features := range X {
+		m.Reference[i] = Wine{id: i + 1, features: features, quality: int(y[i]), weight: 1}
+	}
+	if trainingNoise.Enabled() {
+		m.Reference = addNoise(m.Reference)
+	}
+	if reduction != "" {
+		m.Reference = reduceReferenceSet(m.Reference, m.K, reduction)
+	}
+	m.Index = nil
+	if neighborSearch == SearchKDTree {
+		m.Index = newReferenceIndex(m.Reference)
+	}
+	return nil
+}
+
+// Predict is PredictBatch, which makes *KNN a crossval.Model.
+func (m *KNN) Predict(X [][]float64) []float64 {
+	return m.PredictBatch(X)
+}
+
+// PredictBatch predicts the quality of every row of features in X.
+func (m KNN) PredictBatch(X [][]float64) []float64 {
+	predictions := make([]float64, len(X))
+	for i, probabilities := range m.probaBatch(X) {
+		quality, _ := mostLikely(probabilities)
+		predictions[i] = float64(quality)
+	}
+	return predictions
+}
+
+// probaBatch returns the class probabilities of every row of X.
+func (m KNN) probaBatch(X [][]float64) []map[int]float64 {
+	votes := make([]map[int]float64, len(X))
+	for i := range votes {
+		votes[i] = make(map[int]float64)
+	}
+	if len(X) == 0 || len(m.Reference) == 0 {
+		return votes
+	}
+
+	for i, nearest := range m.nearestK(X) {
+		total := 0.0
+		for _, n := range nearest {
+			vote := m.Reference[n.Index].weight
+			if distanceWeighted {
+				vote /= n.Distance + 1e-9
+			}
+			votes[i][m.Reference[n.Index].quality] += vote
+			total += vote
+		}
+		if total == 0 {
+			continue
+		}
+		for quality := range votes[i] {
+			votes[i][quality] /= total
+		}
+	}
+	return votes
+}
+
+// nearestK returns the K nearest reference wines of every row of X in
+// distanceMetric, nearest first, from the index if there is one. Otherwise
+// the Euclidean and cosine distances from all rows to all reference wines
+// come from a single matrix multiply, with squared Euclidean distances of
+// |x|² + |r|² - 2x·r, and the other Minkowski distances from a scan.
+func (m KNN) nearestK(X [][]float64) [][]kdtree.Neighbor {
+	nearest := make([][]kdtree.Neighbor, len(X))
+	if m.Index != nil {
+		for i, x := range X {
+			nearest[i] = m.Index.NearestK(metricPoint(x), m.K)
+			for n := range nearest[i] {
+				nearest[i][n].Distance = metricDistance(nearest[i][n].Distance)
+			}
+		}
+		return nearest
+	}
+	if minkowskiOrder() != 2 {
+		points := make([][]float64, len(m.Reference))
+		for j, wine := range m.Reference {
+			points[j] = wine.features
+		}
+		for i, x := range X {
+			nearest[i] = kdtree.Scan(points, x, m.K, minkowskiOrder())
+		}
+		return nearest
+	}
+
+	features := len(m.Reference[0].features)
+	rows := mat.NewDense(len(X), features, nil)
+	rowNorms := make([]float64, len(X))
+	for i, x := range X {
+		x = metricPoint(x)
+		rows.SetRow(i, x)
+		rowNorms[i] = floats.Dot(x, x)
+	}
+	reference := mat.NewDense(len(m.Reference), features, nil)
+	referenceNorms := make([]float64, len(m.Reference))
+	for j, wine := range m.Reference {
+		point := metricPoint(wine.features)
+		reference.SetRow(j, point)
+		referenceNorms[j] = floats.Dot(point, point)
+	}
+	var products mat.Dense
+	products.Mul(rows, reference.T())
+
+	distances := make([]float64, len(m.Reference))
+	order := make([]int, len(m.Reference))
+	for i := range X {
+		for j := range m.Reference {
+			// Rounding can take the distance of a duplicate slightly below zero.
+			distances[j] = metricDistance(math.Sqrt(math.Max(rowNorms[i]+referenceNorms[j]-2*products.At(i, j), 0)))
+			order[j] = j
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			return distances[order[a]] < distances[order[b]]
+		})
+		for _, j := range order[:min(m.K, len(order))] {
+			nearest[i] = append(nearest[i], kdtree.Neighbor{Index: j, Distance: distances[j]})
+		}
+	}
+	return nearest
+}
+
+// reduction selects the instance-selection algorithm applied to the KNN
+// reference set: "enn", "cnn", "enn+cnn" or empty for none.
+var reduction = ""
+
+// reduceReferenceSet shrinks the reference set with the configured algorithm.
+func reduceReferenceSet(trainData []Wine, k int, method string) []Wine {
+	logger.Info("✂️  Reducing reference set of %d samples with %s", len(trainData), method)
+	start := time.Now()
+
+	reduced := trainData
+	switch method {
+	case "enn":
+		reduced = editedNearestNeighbors(trainData, k)
+	case "cnn":
+		reduced = condensedNearestNeighbors(trainData)
+	case "enn+cnn":
+		reduced = condensedNearestNeighbors(editedNearestNeighbors(trainData, k))
+	default:
+		logger.Error("❌ Unknown reduction %q, keeping the full reference set", method)
+	}
+
+	logger.With("duration_ms", logging.Milliseconds(time.Since(start))).Info("✅ Reference set reduced from %d to %d samples in %v", len(trainData), len(reduced), time.Since(start))
+	return reduced
+}
+
+// editedNearestNeighbors (Wilson's ENN) drops every sample that its own k
+// nearest neighbors would misclassify, removing noise and class overlap.
+func editedNearestNeighbors(trainData []Wine, k int) []Wine {
+	if len(trainData) == 0 {
+		return nil
+	}
+	var kept []Wine
+	others := make([]Wine, 0, len(trainData)-1)
+	for i, wine := range trainData {
+		others = append(others[:0], trainData[:i]...)
+		others = append(others, trainData[i+1:]...)
+		if predictSingle(wine, others, k) == wine.quality {
+			kept = append(kept, wine)
+		}
+	}
+	return kept
+}
+
+// condensedNearestNeighbors (Hart's CNN) keeps a subset that still classifies
+// every training sample correctly with 1-NN, dropping redundant interior
+// points.
+func condensedNearestNeighbors(trainData []Wine) []Wine {
+	if len(trainData) == 0 {
+		return nil
+	}
+
+	store := []Wine{trainData[0]}
+	inStore := make([]bool, len(trainData))
+	inStore[0] = true
+
+	for changed := true; changed; {
+		changed = false
+		for i, wine := range trainData {
+			if inStore[i] || nearestQuality(wine, store) == wine.quality {
+				continue
+			}
+			store = append(store, wine)
+			inStore[i] = true
+			changed = true
+		}
+	}
+	return store
+}
+
+func nearestQuality(test Wine, reference []Wine) int {
+	best, quality := math.Inf(1), 0
+	for _, wine := range reference {
+		if dist := wineDistance(test.features, wine.features); dist < best {
+			best, quality = dist, wine.quality
+		}
+	}
+	return quality
+}
+
+// calibrationBin accumulates predictions whose top-class confidence falls in
+// one tenth of [0, 1].
+type calibrationBin struct {
+	count      int
+	confidence float64
+	correct    int
+}
+
+// balanceClassWeights weights every wine by n / (classes * count(quality)) so
+// rare quality grades count as much as common ones.
+func balanceClassWeights(wines []Wine) {
+	counts := make(map[int]int)
+	for _, wine := range wines {
+		counts[wine.quality]++
+	}
+	for i := range wines {
+		wines[i].weight = float64(len(wines)) / float64(len(counts)*counts[wines[i].quality])
+	}
+}
+
+// sampleWeights configures the weighted sampling source: "inverse" draws
+// every quality equally often, a list such as "3=8,4=4,8=4" weights the
+// qualities named (the others weigh 1), and empty streams the wines as they
+// are.
+var sampleWeights = ""
+
+// parseSampleWeights returns the sampling weight of every quality among
+// wines according to spec.
+func parseSampleWeights(spec string, wines []Wine) (map[int]float64, error) {
+	counts := make(map[int]int)
+	for _, wine := range wines {
+		counts[wine.quality]++
+	}
+	weights := make(map[int]float64, len(counts))
+	for quality, count := range counts {
+		weights[quality] = 1
+		if spec == "inverse" {
+			weights[quality] = float64(len(wines)) / float64(len(counts)*count)
+		}
+	}
+	if spec == "inverse" {
+		return weights, nil
+	}
+	for _, item := range dataset.SplitList(spec) {
+		name, value, ok := strings.Cut(item, "=")
+		quality, err := strconv.Atoi(strings.TrimSpace(name))
+		if !ok || err != nil {
+			return nil, fmt.Errorf("sample weight %q is not quality=weight", item)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || weight < 0 || math.IsInf(weight, 0) {
+			return nil, fmt.Errorf("sample weight %q must be a non-negative number", item)
+		}
+		weights[quality] = weight
+	}
+	total := 0.0
+	for quality, count := range counts {
+		total += weights[quality] * float64(count)
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("sample weights %q leave no training wine to draw", spec)
+	}
+	return weights, nil
+}
+
+// weightedSource returns the chunks the pipeline streams when sampling is
+// on: the first trainSize wines replaced by as many drawn from them by rng,
+// with replacement, in proportion to the weight of their quality,
+// followed by the test wines as they are. Minority qualities then fill
+// enough of the KNN reference set to win votes. A wine drawn more than once
+// is marked as a repeat after its first draw, so cross-validation still
+// sees every distinct wine only once.
+func weightedSource(data []Wine, trainSize int, rng *rand.Rand) ([][]Wine, error) {
+	train := data[:trainSize]
+	weights, err := parseSampleWeights(sampleWeights, train)
+	if err != nil {
+		return nil, err
+	}
+	cumulative := make([]float64, len(train))
+	total := 0.0
+	for i, wine := range train {
+		total += weights[wine.quality]
+		cumulative[i] = total
+	}
+
+	sampled := make([]Wine, 0, len(data))
+	drawn := make(map[int]bool)
+	before, after := make(map[int]int), make(map[int]int)
+	for i := range train {
+		j := sort.SearchFloat64s(cumulative, rng.Float64()*total)
+		// Zero-weight wines share their cumulative weight with the wine
+		// before them; skip past them to the wine that owns the draw.
+		for cumulative[j] == 0 || j > 0 && cumulative[j] == cumulative[j-1] {
+			j++
+		}
+		wine := train[j]
+		wine.repeat = drawn[j]
+		drawn[j] = true
+		sampled = append(sampled, wine)
+		before[train[i].quality]++
+		after[wine.quality]++
+	}
+
+	qualities := make([]int, 0, len(before))
+	for quality := range before {
+		qualities = append(qualities, quality)
+	}
+	sort.Ints(qualities)
+	counts := make([]string, len(qualities))
+	for i, quality := range qualities {
+		counts[i] = fmt.Sprintf("%d: %d→%d", quality, before[quality], after[quality])
+	}
+	logger.Info("🎯 Weighted sampling (%s) of %d training wines, by quality: %s", sampleWeights, trainSize, strings.Join(counts, ", "))
+	return chunks(append(sampled, data[trainSize:]...), max(chunkSize, 1)), nil
+}
+
+// counterfactualID selects the wine explainWine looks for a counterfactual
+// of, or -1 for none. The counterfactual must reach counterfactualQuality, or
+// any other quality when that is 0, without changing counterfactualFixed.
+var (
+	counterfactualID      = -1
+	counterfactualQuality = 0
+	counterfactualFixed   []string
+)
+
+// explainWine searches for the smallest change to the selected wine, within
+// the ranges seen in training, that changes its predicted quality, and logs
+// it in the original units.
+func explainWine(data, trainData []Wine, k int) {
+	var wine *Wine
+	for i := range data {
+		if data[i].id == counterfactualID {
+			wine = &data[i]
+		}
+	}
+	if wine == nil {
+		logger.Error("❌ No wine with id %d", counterfactualID)
+		return
+	}
+	start := time.Now()
+
+	// The wine does not vote on its own quality.
+	reference := make([]Wine, 0, len(trainData))
+	for _, train := range trainData {
+		if train.id != wine.id {
+			reference = append(reference, train)
+		}
+	}
+	model := explain.ClassifierFunc(func(features []float64) int {
+		return predictSingle(Wine{features: features}, reference, k)
+	})
+	predicted := model.Classify(wine.features)
+	wanted := func(quality int) bool { return quality != predicted }
+	goal := "any other quality"
+	if counterfactualQuality > 0 {
+		wanted = func(quality int) bool { return quality >= counterfactualQuality }
+		goal = fmt.Sprintf("quality %d or better", counterfactualQuality)
+	}
+	logger.Info("🔍 Wine %d is predicted quality %d (actual %d); searching for %s", wine.id, predicted, wine.quality, goal)
+
+	rows := make([][]float64, len(reference))
+	for i, train := range reference {
+		rows[i] = train.features
+	}
+	options := explain.CounterfactualOptions{
+		Ranges:    explain.Ranges(rows),
+		Samples:   100,
+		Step:      0.25,
+		MaxRadius: 10,
+		Rand:      rand.New(rand.NewSource(int64(wine.id))),
+	}
+	for _, name := range counterfactualFixed {
+		found := false
+		for j, n := range featureNames {
+			if n == name {
+				options.Immutable = append(options.Immutable, j)
+				found = true
+			}
+		}
+		if !found {
+			logger.Error("❌ No feature %q (features: %s)", name, strings.Join(featureNames, ", "))
+			return
+		}
+	}
+
+	counterfactual, err := explain.FindCounterfactual(model, wine.features, wanted, options)
+	if err != nil {
+		logger.Error("❌ No counterfactual for wine %d: %v", wine.id, err)
+		return
+	}
+	logger.Info("💡 Predicted quality %d if (distance %.2f standard deviations, found in %v):",
+		counterfactual.Class, counterfactual.Distance, time.Since(start))
+	for _, j := range counterfactual.Changed {
+		from := wine.features[j]*featureStds[j] + featureMeans[j]
+		to := counterfactual.Features[j]*featureStds[j] + featureMeans[j]
+		logger.Info("   %s: %.4g → %.4g", featureNames[j], from, to)
+	}
+}
+
+// robustnessAttack selects the perturbation checkRobustness applies to the
+// test wines, random or gradient; empty skips the check. robustnessEpsilons
+// bound the change of every feature, in standard deviations.
+var (
+	robustnessAttack   = ""
+	robustnessEpsilons = "0.05,0.1,0.25,0.5"
+	robustnessTrials   = 10
+)
+
+// reproducibility holds -seed, which seeds the shuffle, the weighted
+// sampling and the robustness check, and -manifest.
+var reproducibility manifest.Options
+
+// checkRobustness reports how far the KNN model's test accuracy falls when
+// the test wines are perturbed. The gradient attack follows the estimated
+// gradient of the probability of a wrong quality.
+func checkRobustness(trainData, testData []Wine, k int) {
+	logger.Info("🛡️  Checking robustness against %s perturbations", robustnessAttack)
+	start := time.Now()
+
+	var epsilons []float64
+	for _, field := range dataset.SplitList(robustnessEpsilons) {
+		epsilon, err := strconv.ParseFloat(field, 64)
+		if err != nil || epsilon <= 0 {
+			logger.Error("❌ Invalid perturbation size %q", field)
+			return
+		}
+		epsilons = append(epsilons, epsilon)
+	}
+	rows := make([][]float64, len(testData))
+	labels := make([]int, len(testData))
+	for i, wine := range testData {
+		rows[i], labels[i] = wine.features, wine.quality
+	}
+
+	model := explain.ClassifierFunc(func(features []float64) int {
+		return predictSingle(Wine{features: features}, trainData, k)
+	})
+	report, err := explain.Robustness(model, rows, labels, epsilons, explain.RobustnessOptions{
+		Attack: robustnessAttack,
+		Trials: robustnessTrials,
+		Seed:   reproducibility.Seed,
+		Loss: func(features []float64, quality int) float64 {
+			return 1 - predictProba(Wine{features: features}, trainData, k)[quality]
+		},
+	})
+	if err != nil {
+		logger.Error("❌ Robustness check failed: %v", err)
+		return
+	}
+
+	logger.Info("🛡️  Clean accuracy %.2f%% over %d test wines", report.Clean*100, report.Samples)
+	for _, point := range report.Points {
+		logger.Info("   ε=%.2f: %.2f%% accuracy (-%.2f points, %d wines flipped)",
+			point.Epsilon, point.Accuracy*100, point.Degradation*100, point.Flipped)
+	}
+	logger.With("duration_ms", logging.Milliseconds(time.Since(start))).Info("✅ Robustness check completed in %v", time.Since(start))
+}
+
+// explorer is an interactive prompt for trying the trained KNN model on one
+// wine at a time: a wine of the dataset, picked by id, or one typed in, with
+// any feature changed. After every command it shows the prediction, the
+// nearest neighbors and how much each feature contributes.
+type explorer struct {
+	wines     []Wine // every wine, to pick from by id
+	reference []Wine
+	k         int
+	in        *bufio.Scanner
+	out       io.Writer
+
+	current  Wine
+	original *Wine // the dataset wine current started from, or nil
+}
+
+const explorerHelp = `Commands:
+  row <id>                 explore the dataset wine with this id
+  wine <v1,v2,...>         explore a new wine with these feature values
+  set <feature> = <value>  change a feature of the current wine
+  reset                    undo the changes to a dataset wine
+  k <n>                    use n neighbors
+  show                     show the current wine again
+  features                 list the feature names
+  help                     show this help
+  quit                     leave the explorer`
+
+func runExplorer(in io.Reader, out io.Writer, trainer *knnTrainer) {
+	e := &explorer{wines: trainer.all, reference: trainer.trainData, k: trainer.k, in: bufio.NewScanner(in), out: out}
+	fmt.Fprintf(out, "🔭 Exploring the KNN model (k=%d, %d reference samples). Type help for the commands.\n", e.k, len(e.reference))
+	if len(trainer.testData) > 0 {
+		e.selectWine(trainer.testData[0].id)
+	}
+	for {
+		fmt.Fprint(out, "> ")
+		if !e.in.Scan() {
+			fmt.Fprintln(out)
+			return
+		}
+		fields := strings.Fields(e.in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		command, rest := fields[0], strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(e.in.Text()), fields[0]))
+		var err error
+		switch command {
+		case "row":
+			var id int
+			if id, err = strconv.Atoi(rest); err == nil {
+				err = e.selectWine(id)
+			}
+		case "wine":
+			err = e.newWine(rest)
+		case "set":
+			err = e.set(rest)
+		case "reset":
+			if e.original == nil {
+				err = fmt.Errorf("the current wine is not from the dataset")
+			} else {
+				err = e.selectWine(e.original.id)
+			}
+		case "k":
+			var k int
+			if k, err = strconv.Atoi(rest); err == nil && k < 1 {
+				err = fmt.Errorf("k must be at least 1")
+			} else if err == nil {
+				e.k = k
+				e.show()
+			}
+		case "show":
+			e.show()
+		case "features":
+			fmt.Fprintln(out, strings.Join(featureNames, ", "))
+		case "help":
+			fmt.Fprintln(out, explorerHelp)
+		case "quit", "exit":
+			return
+		default:
+			err = fmt.Errorf("unknown command %q; type help for the commands", command)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "❌ %v\n", err)
+		}
+	}
+}
+
+func (e *explorer) selectWine(id int) error {
+	for i := range e.wines {
+		if e.wines[i].id == id {
+			e.original = &e.wines[i]
+			e.current = e.wines[i]
+			e.current.features = append([]float64(nil), e.wines[i].features...)
+			e.show()
+			return nil
+		}
+	}
+	return fmt.Errorf("no wine with id %d", id)
+}
+
+// newWine starts a wine from feature values in the units of the dataset.
+func (e *explorer) newWine(values string) error {
+	fields := strings.FieldsFunc(values, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	if len(fields) != len(featureNames) {
+		return fmt.Errorf("got %d values, want one for each of the %d features (%s)", len(fields), len(featureNames), strings.Join(featureNames, ", "))
+	}
+	features := make([]float64, len(fields))
+	for j, field := range fields {
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %v", featureNames[j], err)
+		}
+		features[j] = standardizeFeature(j, value)
+	}
+	e.original = nil
+	e.current = Wine{features: features, weight: 1}
+	e.show()
+	return nil
+}
+
+// set changes one feature, given as "name = value" in the units of the
+// dataset. A unique prefix of the name is enough.
+func (e *explorer) set(assignment string) error {
+	if e.current.features == nil {
+		return fmt.Errorf("no wine selected; use row or wine first")
+	}
+	name, value, ok := strings.Cut(assignment, "=")
+	if !ok {
+		return fmt.Errorf("want set <feature> = <value>")
+	}
+	j, err := findFeature(strings.TrimSpace(name))
+	if err != nil {
+		return err
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return fmt.Errorf("%s: %v", featureNames[j], err)
+	}
+	e.current.features[j] = standardizeFeature(j, v)
+	e.show()
+	return nil
+}
+
+// findFeature returns the index of the feature with the given name, or the
+// only one it is a prefix of, ignoring case.
+func findFeature(name string) (int, error) {
+	match := -1
+	for j, n := range featureNames {
+		switch {
+		case strings.EqualFold(n, name):
+			return j, nil
+		case len(name) > 0 && strings.HasPrefix(strings.ToLower(n), strings.ToLower(name)):
+			if match >= 0 {
+				return 0, fmt.Errorf("%q matches both %s and %s", name, featureNames[match], n)
+			}
+			match = j
+		}
+	}
+	if match < 0 {
+		return 0, fmt.Errorf("no feature %q (features: %s)", name, strings.Join(featureNames, ", "))
+	}
+	return match, nil
+}
+
+func standardizeFeature(j int, value float64) float64 {
+	if featureStds[j] == 0 {
+		return 0
+	}
+	return (value - featureMeans[j]) / featureStds[j]
+}
+
+// referenceFor leaves a dataset wine out of the reference set, so it does
+// not vote on its own quality.
+func (e *explorer) referenceFor() []Wine {
+	if e.original == nil {
+		return e.reference
+	}
+	reference := make([]Wine, 0, len(e.reference))
+	for _, train := range e.reference {
+		if train.id != e.original.id {
+			reference = append(reference, train)
+		}
+	}
+	return reference
+}
+
+// show prints the prediction for the current wine, its nearest neighbors
+// and the contribution of every feature: how much the probability of the
+// predicted quality drops when the feature is set to its mean.
+func (e *explorer) show() {
+	if e.current.features == nil {
+		fmt.Fprintln(e.out, "No wine selected; use row or wine first.")
+		return
+	}
+	reference := e.referenceFor()
+	model := KNN{Reference: reference, K: e.k}
+	probabilities := model.probaBatch([][]float64{e.current.features})[0]
+	prediction, confidence := mostLikely(probabilities)
+
+	switch {
+	case e.original == nil:
+		fmt.Fprintln(e.out, "Custom wine")
+	case e.original.holdout:
+		fmt.Fprintf(e.out, "Wine %d (test set, quality %d)\n", e.original.id, e.original.quality)
+	default:
+		fmt.Fprintf(e.out, "Wine %d (training set, quality %d; left out of the reference set)\n", e.original.id, e.original.quality)
+	}
+	qualities := make([]int, 0, len(probabilities))
+	for quality := range probabilities {
+		qualities = append(qualities, quality)
+	}
+	sort.Ints(qualities)
+	var shares []string
+	for _, quality := range qualities {
+		shares = append(shares, fmt.Sprintf("%d: %.2f", quality, probabilities[quality]))
+	}
+	fmt.Fprintf(e.out, "Predicted quality %d (confidence %.2f; %s)\n", prediction, confidence, strings.Join(shares, ", "))
+
+	tw := tabwriter.NewWriter(e.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "\nNEIGHBOR\tQUALITY\tDISTANCE\n")
+	for _, neighbor := range nearestNeighbors(e.current.features, reference, e.k) {
+		fmt.Fprintf(tw, "%d\t%d\t%.3f\n", neighbor.wine.id, neighbor.wine.quality, neighbor.distance)
+	}
+	fmt.Fprintf(tw, "\nFEATURE\tVALUE\tCONTRIBUTION TO P(%d)\n", prediction)
+	contributions := make([]float64, len(e.current.features))
+	order := make([]int, len(e.current.features))
+	for j := range e.current.features {
+		without := append([]float64(nil), e.current.features...)
+		without[j] = 0
+		contributions[j] = confidence - model.probaBatch([][]float64{without})[0][prediction]
+		order[j] = j
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return math.Abs(contributions[order[a]]) > math.Abs(contributions[order[b]])
+	})
+	for _, j := range order {
+		value := e.current.features[j]*featureStds[j] + featureMeans[j]
+		fmt.Fprintf(tw, "%s\t%.4g\t%+.2f\n", featureNames[j], value, contributions[j])
+	}
+	tw.Flush()
+}
+
+type neighbor struct {
+	wine     Wine
+	distance float64
+}
+
+// nearestNeighbors returns the k reference wines closest to features,
+// nearest first.
+func nearestNeighbors(features []float64, reference []Wine, k int) []neighbor {
+	neighbors := make([]neighbor, len(reference))
+	for i, wine := range reference {
+		neighbors[i] = neighbor{wine, wineDistance(features, wine.features)}
+	}
+	sort.SliceStable(neighbors, func(a, b int) bool {
+		return neighbors[a].distance < neighbors[b].distance
+	})
+	return neighbors[:min(k, len(neighbors))]
+}
+
+// Main runs the command with the arguments after its name.
+func Main(args []string) {
+	classWeight := flag.String("class-weight", "", "set to \"balanced\" to weight wines by inverse quality frequency")
+	flag.StringVar(&reduction, "reduce", reduction, "shrink the KNN reference set with enn, cnn or enn+cnn")
+	flag.BoolVar(&distanceWeighted, "distance-weighted", distanceWeighted, "weight neighbor votes by inverse distance")
+	flag.StringVar(&distanceMetric, "metric", distanceMetric, "distance between wines: euclidean, manhattan, minkowski or cosine")
+	flag.Float64Var(&minkowskiP, "minkowski-p", minkowskiP, "order of the minkowski metric, at least 1 (inf for the Chebyshev distance)")
+	flag.StringVar(&neighborSearch, "neighbor-search", neighborSearch, "how predictions find the nearest reference wines: kdtree (an index built once) or brute (a scan of every wine)")
+	flag.BoolVar(&compareOrdinal, "ordinal", compareOrdinal, "after the pipeline, fit an ordinal (proportional odds) regression of quality and compare it with rounded linear regression on the test wines")
+	flag.StringVar(&diagnosticsDir, "diagnostics-dir", diagnosticsDir, "directory receiving a report for every stage panic")
+	flag.IntVar(&chunkSize, "chunk-size", chunkSize, "wines passed between pipeline stages at a time")
+	flag.BoolVar(&adaptiveChunks, "adaptive-chunks", adaptiveChunks, "resize the source chunks as the pipeline runs, halving them while a KNN prediction stage has fewer chunks than workers and growing them while its input buffer is full")
+	flag.IntVar(&minChunkSize, "min-chunk-size", minChunkSize, "smallest chunk, and the step chunks grow by, under -adaptive-chunks")
+	flag.IntVar(&maxChunkSize, "max-chunk-size", maxChunkSize, "largest chunk under -adaptive-chunks")
+	costs := flag.String("cost-matrix", "", "CSV of misclassification costs, true qualities by row and predicted ones by column, for a cost-sensitive evaluation")
+	flag.IntVar(&highQuality, "high-quality", highQuality, "lowest quality counted as high by the cost-optimal threshold of -cost-matrix")
+	flag.StringVar(&sampleWeights, "sample-weights", sampleWeights, "draw the training wines streamed to the KNN trainers with replacement, weighted by quality: \"inverse\" for inverse frequency or a list such as \"3=8,4=4,8=4\"")
+	predictionWorkers := flag.Int("prediction-workers", 4, "goroutines scoring chunks of test wines in parallel")
+	orderedPrediction := flag.Bool("ordered", false, "pass scored chunks on in input order rather than as they finish")
+	buffer := flag.Int("buffer", 0, "chunks every stage's input holds while the stage is busy")
+	backpressure := flag.String("backpressure", BackpressureBlock, "what a stage's producers do when its input buffer is full: block, drop-oldest or drop-newest")
+	explore := flag.Bool("explore", false, "after the pipeline, open a prompt for exploring the model's predictions wine by wine")
+	dependence := flag.String("pdp", "", "comma-separated features to chart partial dependence and ICE curves for, e.g. \"alcohol,volatile acidity\"")
+	flag.StringVar(&dependenceOut, "pdp-out", dependenceOut, "path of the generated partial dependence chart")
+	flag.IntVar(&dependenceSamples, "pdp-samples", dependenceSamples, "test wines to compute ICE curves for")
+	flag.IntVar(&counterfactualID, "counterfactual", counterfactualID, "id of a wine to find the smallest change of predicted quality for (-1 for none)")
+	flag.IntVar(&counterfactualQuality, "counterfactual-quality", counterfactualQuality, "quality the counterfactual must reach at least (0 for any other quality)")
+	flag.StringVar(&robustnessAttack, "robustness", robustnessAttack, "perturb the test wines with random or gradient attacks and report the accuracy lost")
+	flag.StringVar(&robustnessEpsilons, "robustness-epsilons", robustnessEpsilons, "comma-separated perturbation bounds per feature, in standard deviations")
+	flag.IntVar(&robustnessTrials, "robustness-trials", robustnessTrials, "random perturbations drawn per wine; it counts as correct only if all are")
+	fixed := flag.String("counterfactual-fixed", "", "comma-separated features the counterfactual may not change")
+	dataPath := flag.String("data", "winequality-dataset.csv", "CSV or .xlsx file of wines")
+	mapping := dataset.Mapping{Label: "quality", ID: "Id"}
+	mapping.RegisterFlags(flag.CommandLine)
+	var parseOptions dataset.Options
+	parseOptions.RegisterFlags(flag.CommandLine)
+	trainingNoise.RegisterFlags(flag.CommandLine)
+	crossValidation.RegisterFlags(flag.CommandLine)
+	var profiles profiling.Options
+	profiles.RegisterFlags(flag.CommandLine)
+	reproducibility.RegisterFlags(flag.CommandLine)
+	var logOptions logging.Options
+	logOptions.RegisterFlags(flag.CommandLine)
+	cli.Parse(flag.CommandLine, args)
+	if err := logger.Configure(logOptions); err != nil {
+		logger.Fatal("❌ Invalid logging flags: %v", err)
+	}
+	defer logger.Close()
+	run, err := reproducibility.Start(flag.CommandLine, "cv-seed", "noise-seed")
+	if err != nil {
+		logger.Fatal("❌ Invalid -seed: %v", err)
+	}
+	stopProfiles, err := profiles.Start()
+	if err != nil {
+		logger.Fatal("❌ Cannot start profiling: %v", err)
+	}
+	defer func() {
+		if err := stopProfiles(); err != nil {
+			logger.Error("❌ Cannot write profiles: %v", err)
+		}
+	}()
+	if adaptiveChunks && (minChunkSize < 1 || maxChunkSize < minChunkSize) {
+		logger.Fatal("❌ -min-chunk-size must be at least 1 and at most -max-chunk-size, got %d and %d", minChunkSize, maxChunkSize)
+	}
+	if neighborSearch != SearchKDTree && neighborSearch != SearchBrute {
+		logger.Fatal("❌ Unknown neighbor search %q, want %s or %s", neighborSearch, SearchKDTree, SearchBrute)
+	}
+	switch reduction {
+	case "", "enn", "cnn", "enn+cnn":
+	default:
+		logger.Fatal("❌ Unknown reduction %q, want enn, cnn or enn+cnn", reduction)
+	}
+	switch distanceMetric {
+	case MetricEuclidean, MetricManhattan, MetricCosine:
+	case MetricMinkowski:
+		if !(minkowskiP >= 1) {
+			logger.Fatal("❌ -minkowski-p must be at least 1, got %g", minkowskiP)
+		}
+	default:
+		logger.Fatal("❌ Unknown metric %q, want %s, %s, %s or %s", distanceMetric, MetricEuclidean, MetricManhattan, MetricMinkowski, MetricCosine)
+	}
+	dependenceFeatures = dataset.SplitList(*dependence)
+	counterfactualFixed = dataset.SplitList(*fixed)
+	if *costs != "" {
+		file, err := os.Open(*costs)
+		if err != nil {
+			logger.Fatal("❌ %v", err)
+		}
+		costMatrix, err = metrics.ReadCosts(file)
+		file.Close()
+		if err != nil {
+			logger.Fatal("❌ %s: %v", *costs, err)
+		}
+	}
+
+	logger.Info("🚀 Starting Wine Quality Pipeline Pattern Demo")
+	logger.Info("============================================")
+
+	data, err := loadWineData(*dataPath, mapping, parseOptions)
+	if err != nil {
+		logger.Fatal("❌ Error loading data: %v", err)
+	}
+	if *classWeight == "balanced" {
+		balanceClassWeights(data)
+		logger.Info("⚖️  Using balanced class weights")
+	}
+
+	// An interrupt cancels the stages; the pipeline stops once they have
+	// returned, with the metrics of the wines scored so far.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rng := rand.New(rand.NewSource(reproducibility.Seed))
+	logger.Info("🔀 Shuffling dataset with seed %d", reproducibility.Seed)
+	rng.Shuffle(len(data), func(i, j int) {
+		data[i], data[j] = data[j], data[i]
+	})
+	trainSize := int(float64(len(data)) * 0.8)
+
+	// The wines are split once, then scaled and scored in two branches
+	// side by side, which the evaluation compares.
+	var predictions []*PipelineStage
+	knnBranch := func(name string, scaling *PipelineStage) (*Pipeline, *knnTrainer) {
+		trainer := newKNNTrainer(name, 5, trainSize)
+		training := NewPipelineStage("KNN Training ("+name+")", trainer.process)
+		training.finish = trainer.finish
+		prediction := NewPipelineStage("Quality Prediction ("+name+")", knnScorer{trainer}.process)
+		prediction.workers, prediction.ordered = *predictionWorkers, *orderedPrediction
+		predictions = append(predictions, prediction)
+		return NewPipeline().Stage(scaling).Stage(training).Stage(prediction), trainer
+	}
+	split := &splitter{trainSize: trainSize, total: len(data)}
+	// The scalers are fitted on the training wines alone.
+	zScaler, err := fitStandardizer(data[:trainSize], len(data))
+	if err != nil {
+		logger.Fatal("❌ %v", err)
+	}
+	minMaxScaler, err := fitMinMaxScaler(data[:trainSize], len(data))
+	if err != nil {
+		logger.Fatal("❌ %v", err)
+	}
+	zScore, trainer := knnBranch("z-score", NewPipelineStage("Standardization", zScaler.process))
+	minMax, minMaxTrainer := knnBranch("min-max", NewPipelineStage("Min-Max Scaling", minMaxScaler.process))
+	evaluator := newQualityEvaluator(len(data)-trainSize, trainer, minMaxTrainer)
+	evaluation := NewPipelineStage("Evaluation", evaluator.process)
+	evaluation.finish = evaluator.finish
+
+	pipeline := NewPipeline().
+		Stage(NewPipelineStage("Dataset Split", split.process)).
+		Branch("z-score", zScore).
+		Branch("min-max", minMax).
+		Merge(evaluation)
+	stages := pipeline.Stages()
+	for _, stage := range stages {
+		stage.buffer, stage.policy = *buffer, *backpressure
+	}
+	// The KNN prediction stages are the slowest; adaptive chunks keep them
+	// busy.
+	if adaptiveChunks {
+		pipeline.chunking = newChunkController(chunkSize, minChunkSize, maxChunkSize, predictions...)
+	}
+
+	logger.Info("🔗 Setting up pipeline with %d stages", len(stages))
+
+	source := chunks(data, max(chunkSize, 1))
+	if sampleWeights != "" {
+		if source, err = weightedSource(data, trainSize, rng); err != nil {
+			logger.Fatal("❌ %v", err)
+		}
+	}
+
+	totalStart := time.Now()
+	if adaptiveChunks {
+		logger.Info("⚡ Initiating data flow through pipeline in chunks of %d to %d samples, starting at %d", minChunkSize, maxChunkSize, pipeline.chunking.size)
+	} else {
+		logger.Info("⚡ Initiating data flow through pipeline in chunks of %d samples", chunkSize)
+	}
+	if err := pipeline.Run(ctx, source); err != nil {
+		logger.Fatal("❌ Pipeline failed: %v", err)
+	}
+	if ctx.Err() != nil {
+		logger.With("duration_ms", logging.Milliseconds(time.Since(totalStart))).Warn("🛑 Pipeline interrupted after %v", time.Since(totalStart))
+		return
+	}
+
+	elapsed := time.Since(totalStart)
+	var busy time.Duration
+	for _, stage := range stages {
+		busy += stage.busy
+	}
+	logger.With("duration_ms", logging.Milliseconds(elapsed)).Info("✨ Pipeline execution completed in %v", elapsed)
+	logger.Info("⏱️  Stages were busy for %v in total; overlapping them saved %v (%.2fx speedup)",
+		busy.Round(time.Millisecond), (busy - elapsed).Round(time.Millisecond), busy.Seconds()/elapsed.Seconds())
+	logger.Info("============================================")
+
+	if err := run.SetDataset(*dataPath, len(data)); err != nil {
+		logger.Error("❌ Cannot checksum the dataset: %v", err)
+	}
+	for _, t := range evaluator.trainers {
+		if m := evaluator.metrics[t.branch]; m.scored > 0 {
+			run.Metric(t.branch+"_accuracy", m.accuracy())
+			run.Metric(t.branch+"_log_loss", m.logLoss/float64(m.scored))
+		}
+	}
+	run.Metric("pipeline_seconds", elapsed.Seconds())
+	if err := run.Write(); err != nil {
+		logger.Error("❌ Cannot write the manifest: %v", err)
+	} else if reproducibility.Path != "" {
+		logger.Info("🧾 Manifest written to %s", reproducibility.Path)
+	}
+
+	if *explore {
+		// Interrupts end the program again rather than the pipeline.
+		stop()
+		runExplorer(os.Stdin, os.Stdout, trainer)
+	}
 }
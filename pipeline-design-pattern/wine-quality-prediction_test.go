@@ -0,0 +1,68 @@
+package pipeline
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// randomWines returns n wines of the given number of features, drawn from a
+// standard normal distribution, with qualities from 3 to 8.
+func randomWines(rng *rand.Rand, n, features int) []Wine {
+	wines := make([]Wine, n)
+	for i := range wines {
+		wines[i] = Wine{id: i + 1, features: make([]float64, features), quality: 3 + rng.Intn(6), weight: 1}
+		for j := range wines[i].features {
+			wines[i].features[j] = rng.NormFloat64()
+		}
+	}
+	return wines
+}
+
+func TestKDTreeMatchesBruteForce(t *testing.T) {
+	defer func(metric string) { distanceMetric = metric }(distanceMetric)
+	rng := rand.New(rand.NewSource(1))
+	reference := randomWines(rng, 500, 11)
+	test := wineFeatures(randomWines(rng, 100, 11))
+
+	for _, metric := range []string{MetricEuclidean, MetricManhattan, MetricMinkowski, MetricCosine} {
+		distanceMetric = metric
+		brute := KNN{Reference: reference, K: 5}
+		indexed := KNN{Reference: reference, K: 5, Index: newReferenceIndex(reference)}
+		bruteNearest, indexedNearest := brute.nearestK(test), indexed.nearestK(test)
+		for i := range test {
+			for n := range bruteNearest[i] {
+				b, k := bruteNearest[i][n], indexedNearest[i][n]
+				if b.Index != k.Index || math.Abs(b.Distance-k.Distance) > 1e-9 {
+					t.Errorf("%s: wine %d, neighbor %d: brute force finds %d at %g, KD-tree %d at %g", metric, i, n, b.Index, b.Distance, k.Index, k.Distance)
+				}
+			}
+		}
+		bruteQuality, indexedQuality := brute.PredictBatch(test), indexed.PredictBatch(test)
+		for i := range test {
+			if bruteQuality[i] != indexedQuality[i] {
+				t.Errorf("%s: wine %d: brute force predicts %g, KD-tree %g", metric, i, bruteQuality[i], indexedQuality[i])
+			}
+		}
+	}
+}
+
+// BenchmarkNeighborSearch times predicting the quality of test wines by a
+// brute-force scan and with a KD-tree, including the time to build it, in
+// a reference set the size of the wine dataset's training split.
+func BenchmarkNeighborSearch(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	reference := randomWines(rng, 1000, 11)
+	test := wineFeatures(randomWines(rng, 250, 11))
+
+	b.Run("brute", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			KNN{Reference: reference, K: 5}.PredictBatch(test)
+		}
+	})
+	b.Run("kdtree", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			KNN{Reference: reference, K: 5, Index: newReferenceIndex(reference)}.PredictBatch(test)
+		}
+	})
+}
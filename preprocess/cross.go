@@ -0,0 +1,159 @@
+package preprocess
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+)
+
+// FeatureCross appends crossed features, which let a linear model learn a
+// weight for a combination of values, such as blocks near the bay with a
+// high median income, rather than for each value alone. Every cross of
+// Crosses combines the columns it lists: a column named in Categories holds
+// category codes and takes part by category name, any other column by which
+// of Buckets quantile buckets over the training rows its value falls in
+// (missing values have a bucket of their own). Each combination is hashed
+// into one of Size 0/1 features appended for the cross, which bounds the
+// features however many combinations there are, at the cost of unrelated
+// combinations sometimes sharing one.
+//
+// The combinations are hashed by category name and bucket, not by code or
+// column position, so a fitted FeatureCross applies to a file whose columns
+// or codes are in another order once moved there with Remap.
+type FeatureCross struct {
+	Crosses [][]int `json:"crosses"`
+	// Categories names the codes of the categorical columns, by column.
+	Categories map[int][]string `json:"categories,omitempty"`
+	Buckets    int              `json:"buckets"`
+	Size       int              `json:"size"`
+	// Cuts holds the fitted bucket boundaries of every numeric column
+	// crossed, by column.
+	Cuts map[int][]float64 `json:"cuts"`
+}
+
+func (f *FeatureCross) Fit(train [][]float64) error {
+	n, err := width(train)
+	if err != nil {
+		return err
+	}
+	if f.Size < 1 {
+		return fmt.Errorf("feature cross size %d must be at least 1", f.Size)
+	}
+	if f.Buckets < 1 {
+		return fmt.Errorf("feature cross buckets %d must be at least 1", f.Buckets)
+	}
+	f.Cuts = make(map[int][]float64)
+	for _, cross := range f.Crosses {
+		if len(cross) < 2 {
+			return fmt.Errorf("a feature cross needs at least 2 columns, got %d", len(cross))
+		}
+		for _, j := range cross {
+			if j < 0 || j >= n {
+				return fmt.Errorf("crossed column %d out of range for %d features", j, n)
+			}
+			if _, ok := f.Categories[j]; ok {
+				continue
+			}
+			if _, ok := f.Cuts[j]; !ok {
+				f.Cuts[j] = quantileCuts(train, j, f.Buckets)
+			}
+		}
+	}
+	return nil
+}
+
+// quantileCuts returns the boundaries between buckets quantile buckets of
+// column j over rows, leaving out boundaries that repeat.
+func quantileCuts(rows [][]float64, j, buckets int) []float64 {
+	var present []float64
+	for _, row := range rows {
+		if !math.IsNaN(row[j]) {
+			present = append(present, row[j])
+		}
+	}
+	sort.Float64s(present)
+	var cuts []float64
+	for b := 1; b < buckets && len(present) > 0; b++ {
+		cut := present[b*len(present)/buckets]
+		if len(cuts) == 0 || cut > cuts[len(cuts)-1] {
+			cuts = append(cuts, cut)
+		}
+	}
+	return cuts
+}
+
+// value returns how column j of row takes part in a cross.
+func (f *FeatureCross) value(row []float64, j int) string {
+	if names, ok := f.Categories[j]; ok {
+		if code := int(row[j]); code >= 0 && code < len(names) && !math.IsNaN(row[j]) {
+			return names[code]
+		}
+		return "?"
+	}
+	if math.IsNaN(row[j]) {
+		return "?"
+	}
+	return fmt.Sprintf("b%d", sort.Search(len(f.Cuts[j]), func(b int) bool { return f.Cuts[j][b] > row[j] }))
+}
+
+// slot returns the feature of cross c that a row's combination sets.
+func (f *FeatureCross) slot(c int, row []float64) int {
+	h := fnv.New32a()
+	fmt.Fprint(h, c)
+	for _, j := range f.Crosses[c] {
+		fmt.Fprintf(h, "|%s", f.value(row, j))
+	}
+	return int(h.Sum32() % uint32(f.Size))
+}
+
+func (f *FeatureCross) Transform(data [][]float64) [][]float64 {
+	out := make([][]float64, len(data))
+	for i, row := range data {
+		out[i] = append(make([]float64, 0, len(row)+len(f.Crosses)*f.Size), row...)
+		for c := range f.Crosses {
+			hashed := make([]float64, f.Size)
+			hashed[f.slot(c, row)] = 1
+			out[i] = append(out[i], hashed...)
+		}
+	}
+	return out
+}
+
+// Names names the features of a cross of columns a and b "a&b#0" to
+// "a&b#<Size-1>".
+func (f *FeatureCross) Names(input []string) []string {
+	names := append([]string(nil), input...)
+	for _, cross := range f.Crosses {
+		columns := make([]string, len(cross))
+		for k, j := range cross {
+			columns[k] = input[j]
+		}
+		for s := 0; s < f.Size; s++ {
+			names = append(names, fmt.Sprintf("%s#%d", strings.Join(columns, "&"), s))
+		}
+	}
+	return names
+}
+
+// Remap returns a copy of f reading column to[j] wherever f reads column j,
+// for applying it to rows whose columns are in another order.
+func (f *FeatureCross) Remap(to map[int]int) *FeatureCross {
+	out := *f
+	out.Crosses = make([][]int, len(f.Crosses))
+	for c, cross := range f.Crosses {
+		for _, j := range cross {
+			out.Crosses[c] = append(out.Crosses[c], to[j])
+		}
+	}
+	out.Categories = make(map[int][]string, len(f.Categories))
+	for j, names := range f.Categories {
+		out.Categories[to[j]] = names
+	}
+	out.Cuts = make(map[int][]float64, len(f.Cuts))
+	for j, cuts := range f.Cuts {
+		out.Cuts[to[j]] = cuts
+	}
+	return &out
+}
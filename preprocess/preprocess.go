@@ -0,0 +1,439 @@
+// Package preprocess holds the feature transformers shared by the models in
+// this repository. Every transformer is fitted on the training rows alone
+// and then applied unchanged to any rows, so that nothing about the test
+// rows, not even their mean, leaks into training:
+//
+//	chain := preprocess.Chain{&preprocess.Imputer{}, &preprocess.StandardScaler{}}
+//	if err := chain.Fit(train); err != nil { ... }
+//	train, test = chain.Transform(train), chain.Transform(test)
+//
+// Rows are []float64 with one value per feature; a missing value is NaN.
+package preprocess
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Transformer learns a mapping of rows from training rows and applies it.
+type Transformer interface {
+	// Fit learns the transformation from the training rows.
+	Fit(train [][]float64) error
+	// Transform returns the rows transformed, leaving them unchanged.
+	Transform(data [][]float64) [][]float64
+	// Names returns the names of the features the transformation produces
+	// from features with the given names.
+	Names(input []string) []string
+}
+
+// Chain applies transformers in turn, each fitted on the output of the ones
+// before it.
+type Chain []Transformer
+
+func (c Chain) Fit(train [][]float64) error {
+	for _, t := range c {
+		if err := t.Fit(train); err != nil {
+			return err
+		}
+		train = t.Transform(train)
+	}
+	return nil
+}
+
+func (c Chain) Transform(data [][]float64) [][]float64 {
+	for _, t := range c {
+		data = t.Transform(data)
+	}
+	return data
+}
+
+func (c Chain) Names(input []string) []string {
+	for _, t := range c {
+		input = t.Names(input)
+	}
+	return input
+}
+
+// FitTransform fits t on train and returns train transformed.
+func FitTransform(t Transformer, train [][]float64) ([][]float64, error) {
+	if err := t.Fit(train); err != nil {
+		return nil, err
+	}
+	return t.Transform(train), nil
+}
+
+// width returns the number of features of rows, checking they all have it.
+func width(rows [][]float64) (int, error) {
+	if len(rows) == 0 {
+		return 0, fmt.Errorf("no rows to fit on")
+	}
+	n := len(rows[0])
+	for i, row := range rows {
+		if len(row) != n {
+			return 0, fmt.Errorf("row %d has %d features, row 1 has %d", i+1, len(row), n)
+		}
+	}
+	return n, nil
+}
+
+// mapRows returns a copy of data with f applied to every value.
+func mapRows(data [][]float64, f func(j int, value float64) float64) [][]float64 {
+	out := make([][]float64, len(data))
+	for i, row := range data {
+		out[i] = make([]float64, len(row))
+		for j, value := range row {
+			out[i][j] = f(j, value)
+		}
+	}
+	return out
+}
+
+// StandardScaler scales every feature to zero mean and unit variance over
+// the training rows. A feature constant in training is only centred.
+type StandardScaler struct {
+	Means []float64 `json:"means"`
+	Stds  []float64 `json:"stds"`
+}
+
+func (s *StandardScaler) Fit(train [][]float64) error {
+	n, err := width(train)
+	if err != nil {
+		return err
+	}
+	s.Means, s.Stds = make([]float64, n), make([]float64, n)
+	for _, row := range train {
+		for j, value := range row {
+			s.Means[j] += value
+		}
+	}
+	for j := range s.Means {
+		s.Means[j] /= float64(len(train))
+	}
+	for _, row := range train {
+		for j, value := range row {
+			s.Stds[j] += (value - s.Means[j]) * (value - s.Means[j])
+		}
+	}
+	for j := range s.Stds {
+		s.Stds[j] = math.Sqrt(s.Stds[j] / float64(len(train)))
+	}
+	return nil
+}
+
+func (s *StandardScaler) Transform(data [][]float64) [][]float64 {
+	return mapRows(data, s.scale)
+}
+
+// TransformRow returns one row standardized.
+func (s *StandardScaler) TransformRow(row []float64) []float64 {
+	out := make([]float64, len(row))
+	for j, value := range row {
+		out[j] = s.scale(j, value)
+	}
+	return out
+}
+
+func (s *StandardScaler) scale(j int, value float64) float64 {
+	value -= s.Means[j]
+	if s.Stds[j] != 0 {
+		value /= s.Stds[j]
+	}
+	return value
+}
+
+func (s *StandardScaler) Names(input []string) []string { return input }
+
+// MinMaxScaler scales every feature to [0, 1] over the training rows; rows
+// outside the training range fall outside it. A feature constant in
+// training becomes 0.
+type MinMaxScaler struct {
+	Mins []float64 `json:"mins"`
+	Maxs []float64 `json:"maxs"`
+}
+
+func (s *MinMaxScaler) Fit(train [][]float64) error {
+	if _, err := width(train); err != nil {
+		return err
+	}
+	s.Mins = append([]float64(nil), train[0]...)
+	s.Maxs = append([]float64(nil), train[0]...)
+	for _, row := range train {
+		for j, value := range row {
+			s.Mins[j] = math.Min(s.Mins[j], value)
+			s.Maxs[j] = math.Max(s.Maxs[j], value)
+		}
+	}
+	return nil
+}
+
+func (s *MinMaxScaler) Transform(data [][]float64) [][]float64 {
+	return mapRows(data, func(j int, value float64) float64 {
+		if s.Maxs[j] > s.Mins[j] {
+			return (value - s.Mins[j]) / (s.Maxs[j] - s.Mins[j])
+		}
+		return 0
+	})
+}
+
+func (s *MinMaxScaler) Names(input []string) []string { return input }
+
+// Imputation strategies.
+const (
+	Mean     = "mean"
+	Median   = "median"
+	Constant = "constant"
+)
+
+// Imputer replaces missing (NaN) values with the mean or median of the
+// feature over the training rows, or with Fill. The zero Imputer uses the
+// mean. A feature missing from every training row is filled with Fill.
+type Imputer struct {
+	Strategy string  `json:"strategy,omitempty"` // Mean, Median or Constant
+	Fill     float64 `json:"fill,omitempty"`
+	// Values holds the fitted replacement of every feature.
+	Values []float64 `json:"values"`
+}
+
+func (m *Imputer) Fit(train [][]float64) error {
+	n, err := width(train)
+	if err != nil {
+		return err
+	}
+	switch m.Strategy {
+	case "", Mean, Median, Constant:
+	default:
+		return fmt.Errorf("unknown imputation strategy %q, want mean, median or constant", m.Strategy)
+	}
+	m.Values = make([]float64, n)
+	for j := range m.Values {
+		m.Values[j] = m.Fill
+		if m.Strategy == Constant {
+			continue
+		}
+		var present []float64
+		for _, row := range train {
+			if !math.IsNaN(row[j]) {
+				present = append(present, row[j])
+			}
+		}
+		if len(present) == 0 {
+			continue
+		}
+		if m.Strategy == Median {
+			sort.Float64s(present)
+			mid := len(present) / 2
+			m.Values[j] = present[mid]
+			if len(present)%2 == 0 {
+				m.Values[j] = (present[mid-1] + present[mid]) / 2
+			}
+			continue
+		}
+		sum := 0.0
+		for _, value := range present {
+			sum += value
+		}
+		m.Values[j] = sum / float64(len(present))
+	}
+	return nil
+}
+
+func (m *Imputer) Transform(data [][]float64) [][]float64 {
+	return mapRows(data, func(j int, value float64) float64 {
+		if math.IsNaN(value) {
+			return m.Values[j]
+		}
+		return value
+	})
+}
+
+func (m *Imputer) Names(input []string) []string { return input }
+
+// Missing returns the number of missing values in every feature of rows.
+func Missing(rows [][]float64) []int {
+	var counts []int
+	for _, row := range rows {
+		for len(counts) < len(row) {
+			counts = append(counts, 0)
+		}
+		for j, value := range row {
+			if math.IsNaN(value) {
+				counts[j]++
+			}
+		}
+	}
+	return counts
+}
+
+// OneHotEncoder replaces each of Columns, which hold category codes, with
+// one 0/1 feature per code seen in training, in increasing order and in the
+// column's place. A code not seen in training sets none of them. Codes are
+// the indices of the category names, as dataset.CSVLoader.Codes loads
+// them; Categories names them for Names.
+type OneHotEncoder struct {
+	Columns []int `json:"columns"`
+	// Categories names the codes of each of Columns. Without it, the
+	// features are named by the codes.
+	Categories [][]string `json:"categories,omitempty"`
+	// Levels holds the fitted codes of each of Columns.
+	Levels [][]float64 `json:"levels"`
+}
+
+func (e *OneHotEncoder) Fit(train [][]float64) error {
+	n, err := width(train)
+	if err != nil {
+		return err
+	}
+	e.Levels = make([][]float64, len(e.Columns))
+	for k, j := range e.Columns {
+		if j < 0 || j >= n {
+			return fmt.Errorf("one-hot column %d out of range for %d features", j, n)
+		}
+		seen := make(map[float64]bool)
+		for _, row := range train {
+			if !seen[row[j]] && !math.IsNaN(row[j]) {
+				seen[row[j]] = true
+				e.Levels[k] = append(e.Levels[k], row[j])
+			}
+		}
+		sort.Float64s(e.Levels[k])
+	}
+	return nil
+}
+
+// column returns the position of feature j among Columns, or -1.
+func (e *OneHotEncoder) column(j int) int {
+	for k, c := range e.Columns {
+		if c == j {
+			return k
+		}
+	}
+	return -1
+}
+
+func (e *OneHotEncoder) Transform(data [][]float64) [][]float64 {
+	out := make([][]float64, len(data))
+	for i, row := range data {
+		for j, value := range row {
+			k := e.column(j)
+			if k < 0 {
+				out[i] = append(out[i], value)
+				continue
+			}
+			for _, level := range e.Levels[k] {
+				hot := 0.0
+				if value == level {
+					hot = 1
+				}
+				out[i] = append(out[i], hot)
+			}
+		}
+	}
+	return out
+}
+
+func (e *OneHotEncoder) Names(input []string) []string {
+	var names []string
+	for j, name := range input {
+		k := e.column(j)
+		if k < 0 {
+			names = append(names, name)
+			continue
+		}
+		for _, level := range e.Levels[k] {
+			category := fmt.Sprint(level)
+			if k < len(e.Categories) && int(level) >= 0 && int(level) < len(e.Categories[k]) {
+				category = e.Categories[k][int(level)]
+			}
+			names = append(names, name+"="+category)
+		}
+	}
+	return names
+}
+
+// PolynomialFeatures appends every product of up to Degree of Columns,
+// their squares and higher powers included, after the features: "a*b" and
+// "a^2" for Degree 2. Nil Columns takes every feature. Degree 1 or less
+// leaves the rows as they are. It learns nothing from training beyond the
+// number of features.
+type PolynomialFeatures struct {
+	Degree  int   `json:"degree"`
+	Columns []int `json:"columns,omitempty"`
+	terms   [][]int
+}
+
+func (p *PolynomialFeatures) Fit(train [][]float64) error {
+	n, err := width(train)
+	if err != nil {
+		return err
+	}
+	p.terms = p.expand(n)
+	return nil
+}
+
+// expand lists the products to append as the columns multiplied, each in
+// nondecreasing order.
+func (p *PolynomialFeatures) expand(n int) [][]int {
+	columns := p.Columns
+	if columns == nil {
+		for j := 0; j < n; j++ {
+			columns = append(columns, j)
+		}
+	}
+	var terms [][]int
+	var grow func(term []int, from int)
+	grow = func(term []int, from int) {
+		if len(term) >= 2 {
+			terms = append(terms, append([]int(nil), term...))
+		}
+		if len(term) == p.Degree {
+			return
+		}
+		for k := from; k < len(columns); k++ {
+			grow(append(term, columns[k]), k)
+		}
+	}
+	grow(nil, 0)
+	return terms
+}
+
+func (p *PolynomialFeatures) Transform(data [][]float64) [][]float64 {
+	out := make([][]float64, len(data))
+	for i, row := range data {
+		terms := p.terms
+		if terms == nil {
+			terms = p.expand(len(row))
+		}
+		out[i] = append(make([]float64, 0, len(row)+len(terms)), row...)
+		for _, term := range terms {
+			product := 1.0
+			for _, j := range term {
+				product *= row[j]
+			}
+			out[i] = append(out[i], product)
+		}
+	}
+	return out
+}
+
+func (p *PolynomialFeatures) Names(input []string) []string {
+	names := append([]string(nil), input...)
+	for _, term := range p.expand(len(input)) {
+		var factors []string
+		for k := 0; k < len(term); {
+			power := 1
+			for k+power < len(term) && term[k+power] == term[k] {
+				power++
+			}
+			factor := input[term[k]]
+			if power > 1 {
+				factor += fmt.Sprintf("^%d", power)
+			}
+			factors = append(factors, factor)
+			k += power
+		}
+		names = append(names, strings.Join(factors, "*"))
+	}
+	return names
+}
@@ -0,0 +1,105 @@
+// Package profiling writes CPU and heap profiles and execution traces of the
+// programs in this repository, and labels their goroutines so that profiles
+// attribute work to what the goroutine was doing, such as worker 3 training
+// a batch of epoch 7 or the normalize stage of a pipeline, rather than to
+// anonymous goroutines. To see a flame graph rooted at the labels:
+//
+//	go tool pprof -http :8081 -tagroot worker,epoch,phase cpu.prof
+//
+// In go tool trace, the same work shows up as tasks and regions.
+package profiling
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// Options selects the profiles to write; empty paths write none.
+type Options struct {
+	CPUProfile string
+	MemProfile string
+	Trace      string
+}
+
+// RegisterFlags adds -cpuprofile, -memprofile and -trace to fs, with o's
+// current values as defaults.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.CPUProfile, "cpuprofile", o.CPUProfile, "write a CPU profile, with goroutine labels, to this file")
+	fs.StringVar(&o.MemProfile, "memprofile", o.MemProfile, "write a heap profile to this file on exit")
+	fs.StringVar(&o.Trace, "trace", o.Trace, "write an execution trace, with tasks and regions, to this file")
+}
+
+// Start starts the CPU profile and the trace o asks for. The returned
+// function stops them and writes the heap profile; it must be called
+// before the program exits for the files to be complete.
+func (o Options) Start() (stop func() error, err error) {
+	var files []*os.File
+	var cpu, tracing bool
+	end := func() error {
+		if cpu {
+			pprof.StopCPUProfile()
+		}
+		if tracing {
+			trace.Stop()
+		}
+		var errs []error
+		for _, f := range files {
+			errs = append(errs, f.Close())
+		}
+		return errors.Join(errs...)
+	}
+
+	if o.CPUProfile != "" {
+		f, err := os.Create(o.CPUProfile)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+		if err := pprof.StartCPUProfile(f); err != nil {
+			end()
+			return nil, err
+		}
+		cpu = true
+	}
+	if o.Trace != "" {
+		f, err := os.Create(o.Trace)
+		if err != nil {
+			end()
+			return nil, err
+		}
+		files = append(files, f)
+		if err := trace.Start(f); err != nil {
+			end()
+			return nil, err
+		}
+		tracing = true
+	}
+	return func() error {
+		err := end()
+		if o.MemProfile == "" {
+			return err
+		}
+		runtime.GC() // so the profile shows the memory live at the end
+		f, createErr := os.Create(o.MemProfile)
+		if createErr != nil {
+			return errors.Join(err, createErr)
+		}
+		return errors.Join(err, pprof.WriteHeapProfile(f), f.Close())
+	}, nil
+}
+
+// Label returns ctx with labels, pairs of keys and values, added to its
+// profiler labels, and gives the calling goroutine all of them. CPU profiles
+// attribute the goroutine's samples to them from then on, and goroutines it
+// starts inherit them, so it is meant to be called first thing in a
+// goroutine doing one job and again as the job moves on.
+func Label(ctx context.Context, labels ...string) context.Context {
+	ctx = pprof.WithLabels(ctx, pprof.Labels(labels...))
+	pprof.SetGoroutineLabels(ctx)
+	return ctx
+}
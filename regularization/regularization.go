@@ -0,0 +1,137 @@
+// Package regularization holds the weight penalties shared by the
+// gradient-trained models in this repository. A penalty adds
+//
+//	lambda * (l1Ratio*||w||_1 + (1-l1Ratio)/2*||w||^2)
+//
+// to the training loss, the same elastic net objective the regularization
+// path of the distributed trainer fits: an L1 penalty (l1Ratio 1) drives
+// weights to exactly zero, an L2 penalty (l1Ratio 0) shrinks them all, and
+// the elastic net mixes the two. Biases are never penalized.
+package regularization
+
+import (
+	"flag"
+	"fmt"
+	"math"
+)
+
+// Penalty kinds.
+const (
+	L1         = "l1"
+	L2         = "l2"
+	ElasticNet = "elasticnet"
+)
+
+// Penalty is a weight penalty. A zero Lambda turns it off, so the zero
+// Penalty trains without regularization.
+type Penalty struct {
+	Kind    string  `json:"kind,omitempty"` // L1, L2 or ElasticNet
+	Lambda  float64 `json:"lambda,omitempty"`
+	L1Ratio float64 `json:"l1_ratio,omitempty"` // share of an ElasticNet penalty that is L1
+}
+
+// RegisterFlags adds -penalty, -lambda and -l1-ratio to fs, with p's current
+// values as defaults.
+func (p *Penalty) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&p.Kind, "penalty", p.Kind, "weight penalty applied with -lambda: l1, l2 or elasticnet")
+	fs.Float64Var(&p.Lambda, "lambda", p.Lambda, "strength of the weight penalty (0 trains without one)")
+	fs.Float64Var(&p.L1Ratio, "l1-ratio", p.L1Ratio, "share of the elastic net penalty that is L1 (1 is the lasso)")
+}
+
+// Enabled reports whether the penalty changes training.
+func (p Penalty) Enabled() bool { return p.Lambda > 0 }
+
+// Validate rejects unknown kinds, a negative lambda and an L1 ratio outside
+// [0, 1].
+func (p Penalty) Validate() error {
+	switch {
+	case p.Lambda < 0:
+		return fmt.Errorf("lambda %g must not be negative", p.Lambda)
+	case p.Kind == ElasticNet && (p.L1Ratio < 0 || p.L1Ratio > 1):
+		return fmt.Errorf("L1 ratio %g must be between 0 and 1", p.L1Ratio)
+	case p.Kind != L1 && p.Kind != L2 && p.Kind != ElasticNet && (p.Kind != "" || p.Enabled()):
+		return fmt.Errorf("unknown penalty %q, want l1, l2 or elasticnet", p.Kind)
+	}
+	return nil
+}
+
+// String describes the penalty for logs.
+func (p Penalty) String() string {
+	switch {
+	case !p.Enabled():
+		return "none"
+	case p.Kind == ElasticNet:
+		return fmt.Sprintf("elastic net, lambda %g, L1 ratio %g", p.Lambda, p.L1Ratio)
+	}
+	return fmt.Sprintf("%s, lambda %g", p.Kind, p.Lambda)
+}
+
+// l1 returns the share of the penalty that is L1.
+func (p Penalty) l1() float64 {
+	switch p.Kind {
+	case L1:
+		return 1
+	case ElasticNet:
+		return p.L1Ratio
+	}
+	return 0
+}
+
+// Loss returns the penalty on weights.
+func (p Penalty) Loss(weights []float64) float64 {
+	if !p.Enabled() {
+		return 0
+	}
+	var abs, squares float64
+	for _, w := range weights {
+		abs += math.Abs(w)
+		squares += w * w
+	}
+	a := p.l1()
+	return p.Lambda * (a*abs + (1-a)/2*squares)
+}
+
+// AddGradient adds the gradient of the penalty at weights to gradient. The
+// L1 part is not differentiable at zero; its subgradient there is taken
+// as zero.
+func (p Penalty) AddGradient(gradient, weights []float64) {
+	if !p.Enabled() {
+		return
+	}
+	a := p.l1()
+	for j, w := range weights {
+		var sign float64
+		switch {
+		case w > 0:
+			sign = 1
+		case w < 0:
+			sign = -1
+		}
+		gradient[j] += p.Lambda * (a*sign + (1-a)*w)
+	}
+}
+
+// Shrink applies the penalty's proximal operator for a gradient step of the
+// given size to weights, in place: L2 scales them towards zero, and L1
+// moves them towards zero by a fixed amount, setting any it would carry
+// past zero to exactly zero. Taken after every step of the loss gradient,
+// it is proximal gradient descent on the penalized loss.
+func (p Penalty) Shrink(weights []float64, step float64) {
+	if !p.Enabled() {
+		return
+	}
+	a := p.l1()
+	threshold := step * p.Lambda * a
+	scale := 1 / (1 + step*p.Lambda*(1-a))
+	for j, w := range weights {
+		switch {
+		case w > threshold:
+			w -= threshold
+		case w < -threshold:
+			w += threshold
+		default:
+			w = 0
+		}
+		weights[j] = w * scale
+	}
+}
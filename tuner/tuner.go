@@ -0,0 +1,210 @@
+// Package tuner searches the hyperparameters of the distributed trainer:
+// every combination of a grid, or a random sample of it, is scored by an
+// objective, several trials at a time, and the results are ranked.
+package tuner
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Params is one configuration to try.
+type Params struct {
+	LearningRate float64 `json:"learning_rate"`
+	BatchSize    int     `json:"batch_size"`
+	Epochs       int     `json:"epochs"`
+	Workers      int     `json:"workers"`
+}
+
+func (p Params) String() string {
+	return fmt.Sprintf("learning rate %.4g, batch size %d, %d epochs, %d workers", p.LearningRate, p.BatchSize, p.Epochs, p.Workers)
+}
+
+// Space lists the values searched for every parameter.
+type Space struct {
+	LearningRates []float64
+	BatchSizes    []int
+	Epochs        []int
+	Workers       []int
+}
+
+// RegisterFlags adds -learning-rates, -batch-sizes, -epochs and -workers to
+// fs, each a comma-separated list, with s's current values as defaults.
+func (s *Space) RegisterFlags(fs *flag.FlagSet) {
+	fs.Func("learning-rates", fmt.Sprintf("comma-separated learning rates to try (default %s)", formatList(s.LearningRates)), func(value string) (err error) {
+		s.LearningRates, err = parseList(value, func(field string) (float64, error) {
+			rate, err := strconv.ParseFloat(field, 64)
+			if err == nil && rate <= 0 {
+				err = fmt.Errorf("must be positive")
+			}
+			return rate, err
+		})
+		return err
+	})
+	for _, list := range []struct {
+		name, usage string
+		values      *[]int
+	}{
+		{"batch-sizes", "batch sizes", &s.BatchSizes},
+		{"epochs", "epoch counts", &s.Epochs},
+		{"workers", "worker counts", &s.Workers},
+	} {
+		fs.Func(list.name, fmt.Sprintf("comma-separated %s to try (default %s)", list.usage, formatList(*list.values)), func(value string) (err error) {
+			*list.values, err = parseList(value, func(field string) (int, error) {
+				n, err := strconv.Atoi(field)
+				if err == nil && n < 1 {
+					err = fmt.Errorf("must be at least 1")
+				}
+				return n, err
+			})
+			return err
+		})
+	}
+}
+
+func parseList[T any](value string, parse func(string) (T, error)) ([]T, error) {
+	var values []T
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		v, err := parse(field)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %v", field, err)
+		}
+		values = append(values, v)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no values in %q", value)
+	}
+	return values, nil
+}
+
+func formatList[T any](values []T) string {
+	fields := make([]string, len(values))
+	for i, v := range values {
+		fields[i] = fmt.Sprint(v)
+	}
+	return strings.Join(fields, ",")
+}
+
+// Grid returns every combination of the values, learning rates varying
+// slowest.
+func (s Space) Grid() []Params {
+	var grid []Params
+	for _, rate := range s.LearningRates {
+		for _, batchSize := range s.BatchSizes {
+			for _, epochs := range s.Epochs {
+				for _, workers := range s.Workers {
+					grid = append(grid, Params{LearningRate: rate, BatchSize: batchSize, Epochs: epochs, Workers: workers})
+				}
+			}
+		}
+	}
+	return grid
+}
+
+// Random returns n configurations drawn with rng. Learning rates are drawn
+// log-uniformly between the smallest and largest listed rate, the other
+// parameters uniformly from their lists.
+func (s Space) Random(n int, rng *rand.Rand) []Params {
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, rate := range s.LearningRates {
+		low, high = math.Min(low, rate), math.Max(high, rate)
+	}
+	trials := make([]Params, n)
+	for i := range trials {
+		trials[i] = Params{
+			LearningRate: math.Exp(math.Log(low) + rng.Float64()*(math.Log(high)-math.Log(low))),
+			BatchSize:    s.BatchSizes[rng.Intn(len(s.BatchSizes))],
+			Epochs:       s.Epochs[rng.Intn(len(s.Epochs))],
+			Workers:      s.Workers[rng.Intn(len(s.Workers))],
+		}
+	}
+	return trials
+}
+
+// Objective trains with the given parameters and returns a loss to
+// minimize, such as the validation MSE.
+type Objective func(Params) (float64, error)
+
+// Result is the outcome of one trial.
+type Result struct {
+	Params
+	Score    float64       `json:"score"`
+	Duration time.Duration `json:"duration_ns"`
+	Err      error         `json:"-"`
+}
+
+// Search scores every trial with objective, running at most parallel trials
+// at once, and returns the results in the order of trials. A trial whose
+// objective fails, or returns a loss that is not finite, records an error.
+// done, if not nil, is called as each trial finishes.
+func Search(trials []Params, parallel int, objective Objective, done func(Result)) []Result {
+	results := make([]Result, len(trials))
+	indices := make(chan int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < max(parallel, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				start := time.Now()
+				score, err := objective(trials[i])
+				if err == nil && (math.IsNaN(score) || math.IsInf(score, 0)) {
+					err = fmt.Errorf("diverged")
+				}
+				result := Result{Params: trials[i], Score: score, Duration: time.Since(start), Err: err}
+				results[i] = result
+				if done != nil {
+					mu.Lock()
+					done(result)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range trials {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	return results
+}
+
+// Ranked returns the successful results, lowest score first, followed by
+// the failed ones.
+func Ranked(results []Result) []Result {
+	ranked := append([]Result(nil), results...)
+	sort.SliceStable(ranked, func(a, b int) bool {
+		if (ranked[a].Err == nil) != (ranked[b].Err == nil) {
+			return ranked[a].Err == nil
+		}
+		return ranked[a].Err == nil && ranked[a].Score < ranked[b].Score
+	})
+	return ranked
+}
+
+// PrintTable writes the results, best first, as an aligned table.
+func PrintTable(w io.Writer, results []Result) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RANK\tLEARNING RATE\tBATCH SIZE\tEPOCHS\tWORKERS\tSCORE\tTIME")
+	for i, r := range Ranked(results) {
+		score := strconv.FormatFloat(r.Score, 'f', 6, 64)
+		if r.Err != nil {
+			score = "failed: " + r.Err.Error()
+		}
+		fmt.Fprintf(tw, "%d\t%.4g\t%d\t%d\t%d\t%s\t%v\n", i+1, r.LearningRate, r.BatchSize, r.Epochs, r.Workers, score, r.Duration.Round(time.Millisecond))
+	}
+	tw.Flush()
+}